@@ -0,0 +1,74 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LogFilter matches requests which aren't logged if successful: by Method if set and by Path (the URL path or
+// below it) if set.
+type LogFilter struct {
+	Method string
+	Path   string
+}
+
+// matches reports whether the filter applies to the request.
+func (f LogFilter) matches(req *http.Request) bool {
+	if f.Method != "" && !strings.EqualFold(f.Method, req.Method) {
+		return false
+	}
+	return f.Path == "" || hasPathPrefix(req.URL.Path, f.Path)
+}
+
+// sampledReads counts the successful reads considered for logging, every SampleReads-th of them is logged.
+var sampledReads atomic.Int64
+
+// sampleRead reports whether a successful read is logged, 1 in SampleReads of them are.
+func (l *Logging) sampleRead() bool {
+	return l.SampleReads <= 1 || sampledReads.Add(1)%int64(l.SampleReads) == 0
+}
+
+// logsRequest reports whether the answered request is logged. Errors are always logged, successful requests
+// unless a filter matches them, and only a sample of the successful reads.
+func (l *Logging) logsRequest(req *http.Request, status int) bool {
+	if status >= http.StatusBadRequest {
+		return true
+	}
+	for _, filter := range l.Skip {
+		if filter.matches(req) {
+			return false
+		}
+	}
+	return writeMethods[req.Method] || l.sampleRead()
+}
+
+// accessWriter records the response of a request for the access log.
+type accessWriter struct {
+	statusWriter
+	user    string
+	started time.Time
+}
+
+// log writes the entry of the answered request to the access log, if it's logged at all.
+func (w *accessWriter) log(cfg *Config, req *http.Request) {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if !cfg.Log.logsRequest(req, status) {
+		return
+	}
+	log.WithFields(log.Fields{
+		"method":   req.Method,
+		"path":     req.URL.Path,
+		"user":     w.user,
+		"address":  clientAddress(req),
+		"status":   status,
+		"bytes":    w.written.Load(),
+		"duration": time.Since(w.started).String(),
+	}).Info("Request served")
+}
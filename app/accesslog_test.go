@@ -0,0 +1,63 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+func TestLogsRequest(t *testing.T) {
+	sampledReads.Store(0)
+	l := &Logging{SampleReads: 3, Skip: []LogFilter{{Method: "OPTIONS"}, {Path: "/healthz"}}}
+	tests := []struct {
+		method string
+		path   string
+		status int
+		want   bool
+	}{
+		{"OPTIONS", "/docs", http.StatusOK, false},
+		{"GET", "/healthz", http.StatusOK, false},
+		{"GET", "/healthz/deep", http.StatusOK, false},
+		{"GET", "/healthz", http.StatusInternalServerError, true},
+		{"PUT", "/docs/a.txt", http.StatusCreated, true},
+		{"DELETE", "/docs/a.txt", http.StatusNoContent, true},
+		{"GET", "/docs/a.txt", http.StatusNotFound, true},
+		{"GET", "/docs/a.txt", http.StatusOK, false},
+		{"PROPFIND", "/docs", http.StatusMultiStatus, false},
+		{"GET", "/docs/b.txt", http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		if got := l.logsRequest(httptest.NewRequest(tt.method, tt.path, nil), tt.status); got != tt.want {
+			t.Errorf("logsRequest(%s %s %d) = %v, want %v", tt.method, tt.path, tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	out := log.StandardLogger().Out
+	log.SetOutput(&buf)
+	defer log.SetOutput(out)
+
+	cfg := &Config{
+		Log:   Logging{Access: true},
+		Users: map[string]*UserInfo{"alice": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")}},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}}
+	r := httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("content"))
+	r.SetBasicAuth("alice", "password")
+	handle(context.Background(), httptest.NewRecorder(), r, a)
+
+	entry := buf.String()
+	for _, want := range []string{`msg="Request served"`, "method=PUT", "path=/a.txt", "user=alice", "status=201"} {
+		if !strings.Contains(entry, want) {
+			t.Errorf("log = %q, want %s", entry, want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultAccountingInterval is used when no flush interval is configured.
+const defaultAccountingInterval = time.Minute
+
+// accountingDateLayout is the layout of the date of an accounting record.
+const accountingDateLayout = "2006-01-02"
+
+// AccountingRecord is a line of the accounting file holding the usage of a user on a day.
+// Several records may exist for the same day and user, they have to be summed up.
+type AccountingRecord struct {
+	Date string `json:"date"`
+	User string `json:"user"`
+	Usage
+}
+
+// takePending returns the usage recorded since the last call and resets it.
+func (u *usageTracker) takePending() map[string]*Usage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	pending := u.pending
+	u.pending = map[string]*Usage{}
+	return pending
+}
+
+// flushAccounting appends the usage recorded since the last flush to the accounting file.
+func flushAccounting(file string, now time.Time) error {
+	pending := usage.takePending()
+	if len(pending) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	encoder := json.NewEncoder(f)
+	for user, entry := range pending {
+		if err := encoder.Encode(AccountingRecord{Date: now.UTC().Format(accountingDateLayout), User: user, Usage: *entry}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startAccounting periodically flushes the accounting to the configured file.
+func (cfg *Config) startAccounting() {
+	interval := cfg.Accounting.Interval
+	if interval <= 0 {
+		interval = defaultAccountingInterval
+	}
+	go func() {
+		for now := range time.Tick(interval) {
+			if err := flushAccounting(cfg.Accounting.File, now); err != nil {
+				log.WithError(err).WithField("path", cfg.Accounting.File).Error("Error writing accounting file")
+			}
+		}
+	}()
+}
+
+// FlushAccounting writes the usage recorded since the last flush to the accounting file right away, so none is
+// lost when the server shuts down.
+func (cfg *Config) FlushAccounting() {
+	if cfg.Accounting == nil {
+		return
+	}
+	if err := flushAccounting(cfg.Accounting.File, time.Now()); err != nil {
+		log.WithError(err).WithField("path", cfg.Accounting.File).Error("Error writing accounting file")
+	}
+}
+
+// ReadAccounting reads all records of the accounting file dated between from and to (inclusive).
+func ReadAccounting(file string, from, to time.Time) ([]AccountingRecord, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []AccountingRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record AccountingRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A partially written last line must not spoil the whole report
+			log.WithError(err).WithField("path", file).Warn("Skipping invalid accounting record")
+			continue
+		}
+		date, err := time.Parse(accountingDateLayout, record.Date)
+		if err != nil || date.Before(from) || date.After(to) {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,214 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// validateACL checks the patterns of an access control list.
+func validateACL(acl map[string]string) error {
+	for pattern := range acl {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pathSegments splits a slash separated path into its names, the root has none.
+func pathSegments(name string) []string {
+	name = strings.Trim(name, "/")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// matchACL reports whether the pattern of an ACL rule matches the slash separated path rel, ignoring the case.
+// Wildcards of path.Match match within a name, ** matches any number of names, including none.
+func matchACL(pattern, rel string) bool {
+	return matchSegments(pathSegments(strings.ToLower(pattern)), pathSegments(strings.ToLower(rel)))
+}
+
+func matchSegments(pattern, names []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(names); i >= 0; i-- {
+				if matchSegments(pattern[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], names[0]); !ok {
+			return false
+		}
+		pattern, names = pattern[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+// aclBase returns the names of an ACL pattern in front of its first wildcard.
+func aclBase(pattern string) string {
+	var base []string
+	for _, name := range pathSegments(pattern) {
+		if strings.ContainsAny(name, `*?[\`) {
+			break
+		}
+		base = append(base, name)
+	}
+	return "/" + strings.Join(base, "/")
+}
+
+// permissionsAt returns the permissions of a user at the slash separated path rel of their tree: the ones of
+// the most specific, that is longest, ACL pattern matching it, else the configured ones.
+func (user *UserInfo) permissionsAt(rel string) *CrudType {
+	best := ""
+	for pattern := range user.ACL {
+		if matchACL(pattern, rel) && (len(pattern) > len(best) || len(pattern) == len(best) && pattern < best) {
+			best = pattern
+		}
+	}
+	if best == "" {
+		return user.Crud
+	}
+	return newCrudType(strings.ToLower(user.ACL[best]))
+}
+
+// permissionsBelow returns the permissions of a user at rel, restricted to the ones of the ACL rules applying
+// below it. Deleting or moving a directory affects everything in it.
+func (user *UserInfo) permissionsBelow(rel string) *CrudType {
+	crud := user.permissionsAt(rel)
+	for pattern, permissions := range user.ACL {
+		if base := aclBase(pattern); base != rel && hasPathPrefix(strings.ToLower(base), strings.ToLower(rel)) {
+			crud = intersectCrud(crud, newCrudType(strings.ToLower(permissions)))
+		}
+	}
+	return crud
+}
+
+// intersectCrud returns the permissions granted by both a and b. Files created with them can't be modified
+// if either only allows to append.
+func intersectCrud(a, b *CrudType) *CrudType {
+	var permissions strings.Builder
+	for _, granted := range []struct {
+		ch   byte
+		a, b bool
+	}{{'c', a.Create, b.Create}, {'r', a.Read, b.Read}, {'u', a.Update, b.Update}, {'d', a.Delete, b.Delete}, {'l', a.List, b.List}} {
+		if granted.a && granted.b {
+			permissions.WriteByte(granted.ch)
+		}
+	}
+	if a.Create && b.Create && (a.Append || b.Append) {
+		permissions.WriteByte('a')
+	}
+	return newCrudType(permissions.String())
+}
+
+// aclPermissions returns the permissions of the request at the physical path, restricted by the ACL of the
+// user. Every lookup of a path goes through them, so paths the ACL denies can't be reached in any way, like
+// the internal endpoints or the listing of their parent. With below the rules applying below the path restrict
+// them as well.
+func (d Dir) aclPermissions(ctx context.Context, name string, below bool) *CrudType {
+	crud := d.crud(ctx)
+	user := d.Config.user(d.resolveUser(ctx))
+	if user == nil || len(user.ACL) == 0 {
+		return crud
+	}
+	rel, err := filepath.Rel(Resolve(ctx, "/", d), name)
+	if name == "" || err != nil || !filepath.IsLocal(rel) && rel != "." {
+		return &CrudType{}
+	}
+	rel = path.Clean("/" + filepath.ToSlash(rel))
+	if below {
+		return intersectCrud(crud, user.permissionsBelow(rel))
+	}
+	return intersectCrud(crud, user.permissionsAt(rel))
+}
+
+// crudAt returns the permissions of the request at the physical path.
+func (d Dir) crudAt(ctx context.Context, name string) *CrudType {
+	return d.aclPermissions(ctx, name, false)
+}
+
+// crudBelow returns the permissions of the request at the physical path and everything below it.
+func (d Dir) crudBelow(ctx context.Context, name string) *CrudType {
+	return d.aclPermissions(ctx, name, true)
+}
+
+// hasACL reports whether the permissions of the user vary by path.
+func (d Dir) hasACL(ctx context.Context) bool {
+	user := d.Config.user(d.resolveUser(ctx))
+	return user != nil && len(user.ACL) != 0
+}
+
+// aclDir lists only the entries of a directory the ACL of the user allows to read or list.
+type aclDir struct {
+	webdav.File
+	ctx  context.Context
+	dir  Dir
+	name string
+}
+
+// Readdir returns the entries of the directory the user may see.
+func (d *aclDir) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := d.File.Readdir(count)
+	visible := infos[:0]
+	for _, info := range infos {
+		if crud := d.dir.crudAt(d.ctx, filepath.Join(d.name, info.Name())); crud.Read || crud.List {
+			visible = append(visible, info)
+		}
+	}
+	return visible, err
+}
+
+// applyACL replaces the permissions of the request by the ones the ACL of the user grants at its path, so
+// they're checked by method as usual. Copies read with the permissions of the source and write with the ones
+// of the destination, moves need the permissions at both. Permissions of a token or certificate rule aren't
+// widened. It returns true if the request was answered with 403 Forbidden.
+func applyACL(cfg *Config, w http.ResponseWriter, req *http.Request, authInfo *AuthInfo) bool {
+	user := cfg.user(authInfo.Username)
+	if user == nil || len(user.ACL) == 0 || authInfo.CrudType != user.Crud {
+		return false
+	}
+	prefix := cfg.prefixOf(authInfo.Username)
+	rel := path.Clean("/" + strings.TrimPrefix(req.URL.Path, prefix))
+	switch req.Method {
+	case http.MethodDelete:
+		authInfo.CrudType = user.permissionsBelow(rel)
+		return false
+	case Copy, Move:
+	default:
+		authInfo.CrudType = user.permissionsAt(rel)
+		return false
+	}
+	u, err := url.Parse(req.Header.Get("Destination"))
+	if err != nil {
+		writeDAVError(w, http.StatusBadRequest, conditionNeedPrivileges)
+		return true
+	}
+	destination := user.permissionsBelow(path.Clean("/" + strings.TrimPrefix(u.Path, prefix)))
+	if !destination.Create {
+		log.WithFields(log.Fields{"user": authInfo.Username, "method": req.Method, "path": u.Path}).Warn("Refused copy or move to a path the ACL doesn't allow to create in")
+		writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges, u.Path)
+		return true
+	}
+	if req.Method == Copy {
+		source := user.permissionsBelow(rel)
+		authInfo.CrudType = intersectCrud(destination, &CrudType{Create: true, Read: source.Read, Update: true, Delete: true})
+	} else {
+		authInfo.CrudType = intersectCrud(user.permissionsBelow(rel), destination)
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestMatchACL(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		{"/projects/**", "/projects", true},
+		{"/projects/**", "/projects/a/b.txt", true},
+		{"/projects/**", "/projects-old/a.txt", false},
+		{"/projects", "/projects/a.txt", false},
+		{"/**/*.pdf", "/a/b/report.pdf", true},
+		{"/**/*.pdf", "/report.pdf", true},
+		{"/*/drafts/**", "/a/drafts/x", true},
+		{"/*/drafts/**", "/a/b/drafts/x", false},
+		{"/Archive/**", "/archive/2024", true},
+		{"/**", "/", true},
+	}
+	for _, tt := range tests {
+		if got := matchACL(tt.pattern, tt.rel); got != tt.want {
+			t.Errorf("matchACL(%s, %s) = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestACL(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		destination string
+		want        int
+	}{
+		{"upload to project", http.MethodPut, "/projects/new.txt", "", http.StatusCreated},
+		{"upload to archive", http.MethodPut, "/archive/new.txt", "", http.StatusForbidden},
+		{"list archive", "PROPFIND", "/archive", "", http.StatusMultiStatus},
+		{"delete in archive", http.MethodDelete, "/archive/old.txt", "", http.StatusForbidden},
+		{"more specific rule", http.MethodDelete, "/archive/scratch/old.txt", "", http.StatusNoContent},
+		{"list secret", "PROPFIND", "/secret", "", http.StatusForbidden},
+		{"delete parent of archive", http.MethodDelete, "/", "", http.StatusForbidden},
+		{"upload outside of rules", http.MethodPut, "/new.txt", "", http.StatusForbidden},
+		{"copy into archive", Copy, "/projects/old.txt", "/archive/copy.txt", http.StatusForbidden},
+		{"copy out of archive", Copy, "/archive/old.txt", "/projects/copy.txt", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range []string{"projects", "archive", "archive/scratch", "secret"} {
+				os.MkdirAll(filepath.Join(dir, name), 0700)
+				os.WriteFile(filepath.Join(dir, name, "old.txt"), []byte("old"), 0600)
+			}
+			cfg := &Config{
+				Dir: dir,
+				Log: Logging{Create: true, Delete: true},
+				Users: map[string]*UserInfo{"alice": {
+					Password: GenHash([]byte("password")),
+					Crud:     newCrudType("r"),
+					ACL:      map[string]string{"/projects/**": "crud", "/archive/**": "r", "/archive/scratch/**": "crud", "/secret/**": ""},
+				}},
+			}
+			a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+			body := ""
+			if tt.method == http.MethodPut {
+				body = "new"
+			}
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(body))
+			r.SetBasicAuth("alice", "password")
+			r.Header.Set("Depth", "0")
+			if tt.destination != "" {
+				r.Header.Set("Destination", "http://example.com"+tt.destination)
+			}
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, r, a)
+
+			if w.Code != tt.want {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestACLBeyondRequestPath(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"projects", "secret"} {
+		os.MkdirAll(filepath.Join(dir, name), 0700)
+		os.WriteFile(filepath.Join(dir, name, "old.txt"), []byte("old"), 0600)
+	}
+	cfg := &Config{
+		Dir:     dir,
+		Log:     Logging{Create: true},
+		Presign: &Presign{Secret: "s3cr3t"},
+		Shares:  &Shares{File: filepath.Join(t.TempDir(), "shares.db")},
+		Users: map[string]*UserInfo{"alice": {
+			Password: GenHash([]byte("password")),
+			Crud:     newCrudType("crud"),
+			ACL:      map[string]string{"/secret/**": ""},
+		}},
+	}
+	var err error
+	if cfg.shares, err = openShareStore(cfg.Shares); err != nil {
+		t.Fatal(err)
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.SetBasicAuth("alice", "password")
+		r.Header.Set("Depth", "1")
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		return w
+	}
+
+	// Listings of the parent leave out the denied directory
+	if listing := do("PROPFIND", "/", "").Body.String(); !strings.Contains(listing, "projects") || strings.Contains(listing, "secret") {
+		t.Errorf("listing = %s, want projects without secret", listing)
+	}
+	// The internal endpoints can't reach it either
+	if w := do(http.MethodGet, "/_presign?path=/secret/old.txt", ""); w.Code != http.StatusNotFound {
+		t.Errorf("pre-signing denied file = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := do(http.MethodGet, PresignURL(cfg, "alice", "/secret/old.txt", time.Now().Add(time.Hour)), ""); w.Code != http.StatusNotFound {
+		t.Errorf("pre-signed url of denied file = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := do(http.MethodPost, "/_shares", `{"path": "/secret"}`); w.Code != http.StatusForbidden {
+		t.Errorf("sharing denied directory = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	// Nor renames into it
+	r := httptest.NewRequest(Move, "/projects/old.txt", nil)
+	r.SetBasicAuth("alice", "password")
+	r.Header.Set("Destination", "http://example.com/secret/moved.txt")
+	w := httptest.NewRecorder()
+	handle(context.Background(), w, r, a)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("move into denied directory = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
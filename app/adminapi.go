@@ -0,0 +1,153 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// adminUsersEndpoint is the path (relative to the configured prefix) admins manage the users of the user store at.
+const adminUsersEndpoint = "/_admin/users"
+
+// adminUser is a user as sent and returned by the admin API. The password is only accepted, in plaintext.
+type adminUser struct {
+	Username      string  `json:"username"`
+	Password      string  `json:"password,omitempty"`
+	Subdir        *string `json:"subdir,omitempty"`
+	Permissions   string  `json:"permissions"`
+	Admin         bool    `json:"admin"`
+	MaxUploadSize int64   `json:"maxUploadSize"`
+}
+
+// newAdminUser returns the user without its password hash.
+func newAdminUser(username string, user *UserInfo) adminUser {
+	return adminUser{Username: username, Subdir: user.Subdir, Permissions: user.Permissions, Admin: user.Admin, MaxUploadSize: user.MaxUploadSize}
+}
+
+// handleAdminUsersRequest lists the users at the endpoint itself and reads (GET), creates or updates (PUT) and
+// deletes (DELETE) a single user below it. Users of the config file are listed, but can't be changed.
+func handleAdminUsersRequest(a *App, ctx context.Context, w http.ResponseWriter, req *http.Request, authInfo *AuthInfo) {
+	if user := a.Config.user(authInfo.Username); user == nil || !user.Admin {
+		writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges)
+		return
+	}
+	store := a.Config.userStore
+	username := strings.Trim(strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, a.Config.Prefix), adminUsersEndpoint), "/")
+
+	if username == "" {
+		if req.Method != http.MethodGet {
+			handleMethodNotAllowed(ctx, w, req, http.MethodGet)
+			return
+		}
+		usernames, err := store.list()
+		if err != nil {
+			log.WithError(err).Error("Error listing users of user store")
+			http.Error(w, "error listing users", http.StatusInternalServerError)
+			return
+		}
+		users := []adminUser{}
+		for name, user := range a.Config.Users {
+			users = append(users, newAdminUser(name, user))
+		}
+		for _, name := range usernames {
+			if a.Config.Users[name] != nil {
+				continue
+			}
+			if user, err := store.get(name); err == nil && user != nil {
+				users = append(users, newAdminUser(name, user))
+			}
+		}
+		writeJSON(w, users)
+		return
+	}
+
+	if strings.Contains(username, "/") {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if req.Method != http.MethodGet && a.Config.Users[username] != nil {
+		http.Error(w, "user is defined in the config file", http.StatusConflict)
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		user := a.Config.storedUser(username)
+		if user == nil {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, newAdminUser(username, user))
+	case http.MethodPut:
+		var change adminUser
+		if err := json.NewDecoder(req.Body).Decode(&change); err != nil {
+			http.Error(w, "invalid user", http.StatusBadRequest)
+			return
+		}
+		existing, err := store.get(username)
+		if err != nil {
+			log.WithError(err).WithField("user", username).Error("Error reading user from user store")
+			http.Error(w, "error reading user", http.StatusInternalServerError)
+			return
+		}
+		user := &UserInfo{Permissions: strings.ToLower(change.Permissions), Admin: change.Admin, MaxUploadSize: change.MaxUploadSize}
+		if change.Subdir != nil {
+			subdir := path.Clean("/" + *change.Subdir)
+			user.Subdir = &subdir
+		}
+		// The password is kept unless a new one is given
+		switch {
+		case change.Password != "":
+			// Hashed like the passwords of the config file, with the pepper and the configured algorithm
+			hash, err := a.Config.genHash([]byte(change.Password))
+			if err != nil {
+				http.Error(w, "invalid password", http.StatusBadRequest)
+				return
+			}
+			user.Password = hash
+		case existing != nil:
+			user.Password = existing.Password
+		default:
+			http.Error(w, "missing password", http.StatusBadRequest)
+			return
+		}
+		if err := store.put(username, user); err != nil {
+			log.WithError(err).WithField("user", username).Error("Error writing user to user store")
+			http.Error(w, "error writing user", http.StatusInternalServerError)
+			return
+		}
+		if user.Subdir != nil {
+			if err := os.MkdirAll(filepath.Join(a.Config.Dir, *user.Subdir), os.ModePerm); err != nil {
+				log.WithError(err).WithField("user", username).Warn("Can't create user dir")
+			}
+		}
+		log.WithFields(log.Fields{"user": username, "admin": authInfo.Username, "created": existing == nil}).Info("Updated user in user store")
+		securityEvent(a.Config, log.InfoLevel, "Admin updated user", log.Fields{"user": username, "admin": authInfo.Username, "address": a.Config.sourceAddressString(req), "created": existing == nil, "permissions": user.Permissions, "isAdmin": user.Admin})
+		if existing == nil {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case http.MethodDelete:
+		deleted, err := store.delete(username)
+		if err != nil {
+			log.WithError(err).WithField("user", username).Error("Error deleting user from user store")
+			http.Error(w, "error deleting user", http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		log.WithFields(log.Fields{"user": username, "admin": authInfo.Username}).Info("Deleted user from user store")
+		securityEvent(a.Config, log.InfoLevel, "Admin deleted user", log.Fields{"user": username, "admin": authInfo.Username, "address": a.Config.sourceAddressString(req)})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		handleMethodNotAllowed(ctx, w, req, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
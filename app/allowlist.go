@@ -0,0 +1,108 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// parsePrefixes parses a list of CIDR ranges, single addresses are ranges of their own.
+func parsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %s", s, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q: %s", s, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// containsAddr reports whether one of the prefixes contains the address.
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceAddress returns the address the request was sent from. The X-Forwarded-For header is only believed if
+// the request comes from a trusted proxy, the last address not of a trusted proxy in it is the client.
+func (cfg *Config) sourceAddress(req *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	proxies, _ := parsePrefixes(cfg.TrustedProxies)
+	if !containsAddr(proxies, addr) {
+		return addr.Unmap(), true
+	}
+	forwarded := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		value := strings.TrimSpace(forwarded[i])
+		if value == "" {
+			continue
+		}
+		hop, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		addr = hop
+		if !containsAddr(proxies, hop) {
+			break
+		}
+	}
+	return addr.Unmap(), true
+}
+
+// sourceAddressString returns the address the request was sent from for logs and events, the remote address
+// if it can't be parsed.
+func (cfg *Config) sourceAddressString(req *http.Request) string {
+	if addr, ok := cfg.sourceAddress(req); ok {
+		return addr.String()
+	}
+	return req.RemoteAddr
+}
+
+// rejectDisallowedAddress answers requests of users limited to address ranges, which come from elsewhere, like
+// failed logins, so the response doesn't reveal that the password was right. It returns false if the user may
+// log in from the address.
+func rejectDisallowedAddress(cfg *Config, w http.ResponseWriter, req *http.Request, username string) bool {
+	user := cfg.user(username)
+	if user == nil || len(user.AllowedCIDRs) == 0 {
+		return false
+	}
+	allowed, err := parsePrefixes(user.AllowedCIDRs)
+	if err != nil {
+		log.WithField("user", username).WithError(err).Error("Error parsing allowed address ranges of user")
+	}
+	addr, ok := cfg.sourceAddress(req)
+	if ok && err == nil && containsAddr(allowed, addr) {
+		return false
+	}
+	log.WithFields(log.Fields{"user": username, "address": addr.String()}).Warn("Refused login from outside the allowed address ranges of user")
+	securityEvent(cfg, log.WarnLevel, "Refused login from outside the allowed address ranges", log.Fields{"user": username, "address": addr.String()})
+	SayUnauthorized(w, cfg.Realm)
+	return true
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestSourceAddress(t *testing.T) {
+	cfg := &Config{TrustedProxies: []string{"10.0.0.0/8", "::1"}}
+	tests := []struct {
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"192.0.2.1:1234", "", "192.0.2.1"},
+		{"192.0.2.1:1234", "198.51.100.1", "192.0.2.1"},
+		{"10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"10.0.0.1:1234", "203.0.113.5, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"[::1]:1234", "198.51.100.1", "198.51.100.1"},
+		{"10.0.0.1:1234", "", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("PROPFIND", "/", nil)
+		req.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got, ok := cfg.sourceAddress(req); !ok || got.String() != tt.want {
+			t.Errorf("sourceAddress(%s, %q) = %v, want %s", tt.remote, tt.forwarded, got, tt.want)
+		}
+	}
+}
+
+func TestAllowedCIDRs(t *testing.T) {
+	cfg := &Config{
+		Dir: t.TempDir(),
+		Users: map[string]*UserInfo{
+			"backup": {Password: GenHash([]byte("password")), Crud: newCrudType("crud"), AllowedCIDRs: []string{"192.0.2.0/24", "2001:db8::1"}},
+			"alice":  {Password: GenHash([]byte("password")), Crud: newCrudType("crud")},
+		},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	tests := []struct {
+		user      string
+		remote    string
+		forwarded string
+		want      int
+	}{
+		{"backup", "192.0.2.10:1234", "", http.StatusMultiStatus},
+		{"backup", "[2001:db8::1]:1234", "", http.StatusMultiStatus},
+		{"backup", "198.51.100.1:1234", "", http.StatusUnauthorized},
+		{"backup", "198.51.100.1:1234", "192.0.2.10", http.StatusUnauthorized},
+		{"alice", "198.51.100.1:1234", "", http.StatusMultiStatus},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("PROPFIND", "/", nil)
+		r.Header.Set("Depth", "0")
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		r.SetBasicAuth(tt.user, "password")
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		if w.Code != tt.want {
+			t.Errorf("PROPFIND of %s from %s (%q) = %d, want %d", tt.user, tt.remote, tt.forwarded, w.Code, tt.want)
+		}
+	}
+
+	if _, err := parsePrefixes([]string{"192.0.2.0/33"}); err == nil {
+		t.Errorf("parsePrefixes() of an invalid range succeeded")
+	}
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// inAppendOnly reports whether the physical path lies in an append-only directory. With ancestors it is also
+// reported if the path contains one, removing or renaming it would affect the append-only files as well.
+func (cfg *Config) inAppendOnly(name string, ancestors bool) bool {
+	rel, ok := cfg.relPath(name)
+	if !ok {
+		return false
+	}
+	for _, dir := range cfg.AppendOnly {
+		dir = path.Clean("/" + dir)
+		if hasFilePathPrefix(rel, dir) || ancestors && hasFilePathPrefix(dir, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// denyAppendOnly refuses the modification of the physical path by regular users if it affects an append-only
+// directory, admins aren't restricted. The refusal is answered with 403 Forbidden.
+func (d Dir) denyAppendOnly(ctx context.Context, name string, ancestors bool) error {
+	if len(d.Config.AppendOnly) == 0 || !d.Config.inAppendOnly(name, ancestors) {
+		return nil
+	}
+	username := d.resolveUser(ctx)
+	if user := d.Config.user(username); user != nil && user.Admin {
+		return nil
+	}
+	log.WithFields(log.Fields{"user": username, "path": name}).Warn("Denied modification in append-only directory")
+	recordFailure(ctx, http.StatusForbidden, conditionAppendOnly, "append-only")
+	return os.ErrPermission
+}
+
+// denyAppendingUser refuses users who may only append to write to the existing file at the physical path,
+// whichever directory it's in. The refusal is answered with 403 Forbidden.
+func (d Dir) denyAppendingUser(ctx context.Context, name string) error {
+	if !d.crud(ctx).Append {
+		return nil
+	}
+	if _, err := d.storage().Stat(name); err != nil {
+		return nil
+	}
+	log.WithFields(log.Fields{"user": d.resolveUser(ctx), "path": name}).Warn("Denied overwrite by user who may only append")
+	recordFailure(ctx, http.StatusForbidden, conditionAppendOnly, "append-only")
+	return os.ErrPermission
+}
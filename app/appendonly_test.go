@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestAppendOnly(t *testing.T) {
+	tests := []struct {
+		name        string
+		user        string
+		method      string
+		path        string
+		destination string
+		want        int
+	}{
+		{"create", "foo", http.MethodPut, "/backups/new.tar", "", http.StatusCreated},
+		{"overwrite", "foo", http.MethodPut, "/backups/old.tar", "", http.StatusForbidden},
+		{"delete", "foo", http.MethodDelete, "/backups/old.tar", "", http.StatusForbidden},
+		{"delete directory", "foo", http.MethodDelete, "/backups", "", http.StatusForbidden},
+		{"delete parent", "foo", http.MethodDelete, "/data", "", http.StatusForbidden},
+		{"rename", "foo", Move, "/backups/old.tar", "/backups/renamed.tar", http.StatusForbidden},
+		{"move out", "foo", Move, "/backups/old.tar", "/old.tar", http.StatusForbidden},
+		{"move in", "foo", Move, "/other.txt", "/backups/other.txt", http.StatusCreated},
+		{"overwrite elsewhere", "foo", http.MethodPut, "/other.txt", "", http.StatusCreated},
+		{"admin delete", "admin", http.MethodDelete, "/backups/old.tar", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.MkdirAll(filepath.Join(dir, "backups"), 0700)
+			os.MkdirAll(filepath.Join(dir, "data", "logs"), 0700)
+			os.WriteFile(filepath.Join(dir, "backups", "old.tar"), []byte("old"), 0600)
+			os.WriteFile(filepath.Join(dir, "other.txt"), []byte("other"), 0600)
+			cfg := &Config{
+				Dir:        dir,
+				Log:        Logging{Create: true},
+				AppendOnly: []string{"/backups", "data/logs"},
+				Users: map[string]*UserInfo{
+					"foo":   {Crud: newCrudType("crud")},
+					"admin": {Crud: newCrudType("crud"), Admin: true},
+				},
+			}
+			a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+			ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: tt.user, Authenticated: true})
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader("new"))
+			if tt.destination != "" {
+				r.Header.Set("Destination", "http://example.com"+tt.destination)
+			}
+			w := httptest.NewRecorder()
+			serveWebdav(a, ctx, w, r, tt.user)
+
+			if w.Code != tt.want {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body.String(), tt.want)
+			}
+			if tt.want == http.StatusForbidden && !strings.Contains(w.Body.String(), "append-only") {
+				t.Errorf("%s %s without append-only condition: %s", tt.method, tt.path, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAppendPermission(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		destination string
+		want        int
+	}{
+		{"create", http.MethodPut, "/new.tar", "", http.StatusCreated},
+		{"create directory", "MKCOL", "/daily", "", http.StatusCreated},
+		{"overwrite", http.MethodPut, "/old.tar", "", http.StatusForbidden},
+		{"delete", http.MethodDelete, "/old.tar", "", http.StatusForbidden},
+		{"rename", Move, "/old.tar", "/renamed.tar", http.StatusForbidden},
+		{"copy", Copy, "/old.tar", "/copy.tar", http.StatusCreated},
+		{"copy onto existing", Copy, "/old.tar", "/other.tar", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, "old.tar"), []byte("old"), 0600)
+			os.WriteFile(filepath.Join(dir, "other.tar"), []byte("other"), 0600)
+			cfg := &Config{
+				Dir:   dir,
+				Log:   Logging{Create: true},
+				Users: map[string]*UserInfo{"backup": {Password: GenHash([]byte("password")), Crud: newCrudType("ruda")}},
+			}
+			a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+			body := ""
+			if tt.method == http.MethodPut {
+				body = "new"
+			}
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(body))
+			r.SetBasicAuth("backup", "password")
+			if tt.destination != "" {
+				r.Header.Set("Destination", "http://example.com"+tt.destination)
+			}
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, r, a)
+
+			if w.Code != tt.want {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body.String(), tt.want)
+			}
+			if content, _ := os.ReadFile(filepath.Join(dir, "old.tar")); string(content) != "old" {
+				t.Errorf("%s %s modified the existing file: %q", tt.method, tt.path, content)
+			}
+		})
+	}
+}
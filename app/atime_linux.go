@@ -0,0 +1,17 @@
+package app
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTime returns the time a file was last read, depending on the mount options it's only updated
+// occasionally (relatime) or never (noatime), in which case it's the modification time at most.
+func accessTime(info os.FileInfo) time.Time {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(st.Atim.Unix())
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package app
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime falls back to the modification time where the access time isn't available.
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -0,0 +1,284 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Audit configures the file audit entries are appended to as JSON lines. The entries are chained by their
+// hashes, which are HMACs with Key if set, so modified, removed and forged entries are detected.
+type Audit struct {
+	File string
+	Key  string
+}
+
+// AuditEntry records an action which has to be accountable, like overriding a protection.
+// Seq numbers the entries, Prev is the hash of the previous one and Hash the hash of the entry.
+type AuditEntry struct {
+	Seq    uint64    `json:"seq,omitempty"`
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Action string    `json:"action"`
+	Path   string    `json:"path"`
+	Detail string    `json:"detail,omitempty"`
+	Prev   string    `json:"prev,omitempty"`
+	Hash   string    `json:"hash,omitempty"`
+}
+
+// auditHead is the last entry of the chain, kept next to the audit file so removing entries from its end
+// is detected as well. With a key, it's signed by MAC.
+type auditHead struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+	MAC  string `json:"mac,omitempty"`
+}
+
+// AuditVerification is the result of the verification of the chain of audit entries.
+type AuditVerification struct {
+	Entries   int      `json:"entries"`
+	Unchained int      `json:"unchained"`
+	Problems  []string `json:"problems,omitempty"`
+}
+
+// auditMu serializes the writes to the audit file.
+var auditMu sync.Mutex
+
+// newHash returns the hash of the chain, an HMAC with the key.
+func (a *Audit) newHash() hash.Hash {
+	if a.Key != "" {
+		return hmac.New(sha256.New, []byte(a.Key))
+	}
+	return sha256.New()
+}
+
+// hash returns the hash of the entry, which covers all its fields besides the hash itself.
+func (a *Audit) hash(entry AuditEntry) (string, error) {
+	entry.Hash = ""
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	h := a.newHash()
+	h.Write(line)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// headFile returns the file of the head of the chain.
+func (a *Audit) headFile() string {
+	return a.File + ".head"
+}
+
+// headMAC returns the signature of the head, empty without key.
+func (a *Audit) headMAC(head auditHead) string {
+	if a.Key == "" {
+		return ""
+	}
+	h := a.newHash()
+	h.Write([]byte("head\n" + strconv.FormatUint(head.Seq, 10) + "\n" + head.Hash))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// readHead returns the head of the chain. Without head file, like for audit files written before entries
+// were chained, the last chained entry of the audit file is taken.
+func (a *Audit) readHead() (auditHead, error) {
+	var head auditHead
+	content, err := os.ReadFile(a.headFile())
+	if err == nil {
+		return head, json.Unmarshal(content, &head)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return head, err
+	}
+	entries, err := readAuditEntries(a.File)
+	if err != nil {
+		return head, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Hash != "" {
+			return auditHead{Seq: entries[i].Seq, Hash: entries[i].Hash}, nil
+		}
+	}
+	return head, nil
+}
+
+// writeHead replaces the head of the chain by the entry.
+func (a *Audit) writeHead(entry AuditEntry) error {
+	head := auditHead{Seq: entry.Seq, Hash: entry.Hash}
+	head.MAC = a.headMAC(head)
+	content, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	temp := a.headFile() + ".tmp"
+	if err := os.WriteFile(temp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temp, a.headFile())
+}
+
+// seal chains the entries to the head and returns the new head.
+func (a *Audit) seal(head auditHead, entries []AuditEntry) (auditHead, error) {
+	for i := range entries {
+		entries[i].Seq, entries[i].Prev = head.Seq+1, head.Hash
+		hash, err := a.hash(entries[i])
+		if err != nil {
+			return head, err
+		}
+		entries[i].Hash = hash
+		head = auditHead{Seq: entries[i].Seq, Hash: hash}
+	}
+	return head, nil
+}
+
+// writeAudit logs the entry and appends it to the audit file if configured, chained to the previous entry.
+// The file is opened for each entry, so it can be rotated while the server is running.
+func writeAudit(cfg *Config, entry AuditEntry) {
+	entry.Time = time.Now().UTC()
+	log.WithFields(log.Fields{"user": entry.User, "action": entry.Action, "path": entry.Path, "detail": entry.Detail}).Info("Audit")
+	siemAudit(cfg, entry)
+	if cfg.Audit == nil || cfg.Audit.File == "" {
+		return
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	head, err := cfg.Audit.readHead()
+	if err != nil {
+		log.WithError(err).WithField("path", cfg.Audit.headFile()).Error("Error reading head of audit chain")
+		return
+	}
+	entries := []AuditEntry{entry}
+	if _, err := cfg.Audit.seal(head, entries); err != nil {
+		log.WithError(err).Error("Error encoding audit entry")
+		return
+	}
+	line, err := json.Marshal(entries[0])
+	if err != nil {
+		log.WithError(err).Error("Error encoding audit entry")
+		return
+	}
+	f, err := os.OpenFile(cfg.Audit.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.WithError(err).WithField("path", cfg.Audit.File).Error("Error opening audit file")
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.WithError(err).WithField("path", cfg.Audit.File).Error("Error writing audit entry")
+		return
+	}
+	if err := cfg.Audit.writeHead(entries[0]); err != nil {
+		log.WithError(err).WithField("path", cfg.Audit.headFile()).Error("Error writing head of audit chain")
+	}
+}
+
+// rewriteAudit replaces the entries of the audit file, which are chained anew from the first chained entry on.
+// The head is replaced as well, so this is only done for legitimate changes like the erasure of a user.
+func rewriteAudit(cfg *Config, entries []AuditEntry) error {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	first := len(entries)
+	for i, entry := range entries {
+		if entry.Hash != "" {
+			first = i
+			break
+		}
+	}
+	head := auditHead{}
+	if first < len(entries) {
+		head = auditHead{Seq: entries[first].Seq - 1, Hash: entries[first].Prev}
+	}
+	head, err := cfg.Audit.seal(head, entries[first:])
+	if err != nil {
+		return err
+	}
+	content, err := jsonLines(entries)
+	if err != nil {
+		return err
+	}
+	if err := replaceFile(cfg.Audit.File, content); err != nil {
+		return err
+	}
+	if first < len(entries) {
+		return cfg.Audit.writeHead(entries[len(entries)-1])
+	}
+	return nil
+}
+
+// VerifyAudit verifies the chain of the entries of the audit files, given in the order they were written
+// (like rotated files before the current one). The end of the chain is compared with its head if the last
+// file is the configured audit file.
+func VerifyAudit(cfg *Config, files ...string) (*AuditVerification, error) {
+	if cfg.Audit == nil {
+		return nil, errors.New("audit isn't configured")
+	}
+	if len(files) == 0 {
+		files = []string{cfg.Audit.File}
+	}
+	result := &AuditVerification{}
+	var last *AuditEntry
+	for _, file := range files {
+		entries, err := readAuditEntries(file)
+		if err != nil {
+			return nil, err
+		}
+		for i := range entries {
+			entry := &entries[i]
+			result.Entries++
+			if entry.Hash == "" {
+				if last != nil {
+					result.Problems = append(result.Problems, fmt.Sprintf("%s: entry %d isn't chained", file, i+1))
+				} else {
+					result.Unchained++
+				}
+				continue
+			}
+			if hash, err := cfg.Audit.hash(*entry); err != nil || hash != entry.Hash {
+				result.Problems = append(result.Problems, fmt.Sprintf("%s: entry %d (seq %d) was modified", file, i+1, entry.Seq))
+			}
+			if last != nil && (entry.Prev != last.Hash || entry.Seq != last.Seq+1) {
+				if entry.Seq > last.Seq+1 {
+					result.Problems = append(result.Problems, fmt.Sprintf("%s: entries %d to %d are missing", file, last.Seq+1, entry.Seq-1))
+				} else {
+					result.Problems = append(result.Problems, fmt.Sprintf("%s: entry %d (seq %d) doesn't follow seq %d", file, i+1, entry.Seq, last.Seq))
+				}
+			}
+			last = entry
+		}
+	}
+	if files[len(files)-1] != cfg.Audit.File {
+		return result, nil
+	}
+	content, err := os.ReadFile(cfg.Audit.headFile())
+	if errors.Is(err, os.ErrNotExist) {
+		if last != nil {
+			result.Problems = append(result.Problems, "head of the chain is missing")
+		}
+		return result, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var head auditHead
+	if err := json.Unmarshal(content, &head); err != nil {
+		return nil, err
+	}
+	switch {
+	case cfg.Audit.Key != "" && !hmac.Equal([]byte(head.MAC), []byte(cfg.Audit.headMAC(head))):
+		result.Problems = append(result.Problems, "head of the chain was modified")
+	case last == nil || head.Seq > last.Seq:
+		result.Problems = append(result.Problems, fmt.Sprintf("entries up to %d were removed from the end", head.Seq))
+	case head.Seq != last.Seq || head.Hash != last.Hash:
+		result.Problems = append(result.Problems, "last entry doesn't match the head of the chain")
+	}
+	return result, nil
+}
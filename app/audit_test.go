@@ -0,0 +1,88 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyAudit(t *testing.T) {
+	// writeLog writes a legacy entry and four chained ones, and returns the lines of the audit file
+	writeLog := func(t *testing.T) (*Config, []string) {
+		cfg := &Config{Audit: &Audit{File: filepath.Join(t.TempDir(), "audit.log"), Key: "secret"}}
+		os.WriteFile(cfg.Audit.File, []byte(`{"time":"2024-01-01T00:00:00Z","user":"old","action":"legacy","path":"/"}`+"\n"), 0600)
+		for _, user := range []string{"alice", "bob", "carol", "dave"} {
+			writeAudit(cfg, AuditEntry{User: user, Action: "retention-override", Path: "/" + user})
+		}
+		content, _ := os.ReadFile(cfg.Audit.File)
+		lines := strings.SplitAfter(string(content), "\n")
+		return cfg, lines[:len(lines)-1]
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func(cfg *Config, lines []string) []string
+		problem string
+	}{
+		{"intact", func(cfg *Config, lines []string) []string { return lines }, ""},
+		{"modified entry", func(cfg *Config, lines []string) []string {
+			lines[2] = strings.Replace(lines[2], "bob", "eve", 1)
+			return lines
+		}, "entry 3 (seq 2) was modified"},
+		{"removed entry", func(cfg *Config, lines []string) []string {
+			return append(lines[:2], lines[3:]...)
+		}, "entries 2 to 2 are missing"},
+		{"truncated", func(cfg *Config, lines []string) []string {
+			return lines[:3]
+		}, "entries up to 4 were removed from the end"},
+		{"head rewritten without key", func(cfg *Config, lines []string) []string {
+			os.WriteFile(cfg.Audit.headFile(), []byte(`{"seq":2,"hash":"x"}`), 0600)
+			return lines[:3]
+		}, "head of the chain was modified"},
+		{"entries of other key", func(cfg *Config, lines []string) []string {
+			cfg.Audit.Key = "other"
+			return lines
+		}, "entry 2 (seq 1) was modified"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, lines := writeLog(t)
+			os.WriteFile(cfg.Audit.File, []byte(strings.Join(tt.tamper(cfg, lines), "")), 0600)
+			result, err := VerifyAudit(cfg)
+			if err != nil {
+				t.Fatalf("VerifyAudit() error = %v", err)
+			}
+			if result.Unchained != 1 {
+				t.Errorf("unchained = %d, want the legacy entry", result.Unchained)
+			}
+			if tt.problem == "" && len(result.Problems) != 0 || tt.problem != "" && !strings.Contains(strings.Join(result.Problems, "\n"), tt.problem) {
+				t.Errorf("problems = %q, want %q", result.Problems, tt.problem)
+			}
+		})
+	}
+
+	t.Run("rotated files", func(t *testing.T) {
+		cfg, lines := writeLog(t)
+		rotated := cfg.Audit.File + ".1"
+		os.WriteFile(rotated, []byte(strings.Join(lines[:3], "")), 0600)
+		os.WriteFile(cfg.Audit.File, []byte(strings.Join(lines[3:], "")), 0600)
+		writeAudit(cfg, AuditEntry{User: "erin", Action: "retention-override", Path: "/erin"})
+		result, err := VerifyAudit(cfg, rotated, cfg.Audit.File)
+		if err != nil || result.Entries != 6 || len(result.Problems) != 0 {
+			t.Errorf("VerifyAudit() = %+v, %v, want 6 entries without problems", result, err)
+		}
+	})
+	t.Run("erased user", func(t *testing.T) {
+		cfg, _ := writeLog(t)
+		entries, _ := readAuditEntries(cfg.Audit.File)
+		entries[2].User = "erased-0123"
+		if err := rewriteAudit(cfg, entries); err != nil {
+			t.Fatalf("rewriteAudit() error = %v", err)
+		}
+		result, err := VerifyAudit(cfg)
+		if err != nil || len(result.Problems) != 0 {
+			t.Errorf("VerifyAudit() = %+v, %v, want no problems", result, err)
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultAuthFailureWindow is used when no window is configured.
+const defaultAuthFailureWindow = 15 * time.Minute
+
+// authFailure counts the consecutive failed logins of an address and username.
+type authFailure struct {
+	count int
+	last  time.Time
+}
+
+// authFailureTracker remembers failed logins until they're older than the window or the login succeeds.
+type authFailureTracker struct {
+	mu       sync.Mutex
+	failures map[string]*authFailure
+	swept    time.Time
+}
+
+// authFailures tracks the failed logins of all clients.
+var authFailures = &authFailureTracker{failures: map[string]*authFailure{}}
+
+// authFailureKey combines address and username, so a guessing client doesn't delay the logins of others.
+func authFailureKey(address, username string) string {
+	return address + "\x00" + username
+}
+
+// addressFailureKey is the key of the failed logins of an address with any username, which sprays of
+// passwords across usernames add up to.
+func addressFailureKey(address string) string {
+	return address
+}
+
+// failureAddress returns the address failed logins are counted for. Only the X-Forwarded-For header of
+// trusted proxies is believed, so clients can't escape their lockout or lock out others by sending one.
+func (cfg *Config) failureAddress(req *http.Request) string {
+	return cfg.sourceAddressString(req)
+}
+
+// fail records a failed login and returns the number of consecutive failures.
+func (t *authFailureTracker) fail(key string, now time.Time, window time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Forget stale failures now and then, so the map doesn't grow with every address ever seen
+	if now.Sub(t.swept) > window {
+		for k, f := range t.failures {
+			if now.Sub(f.last) > window {
+				delete(t.failures, k)
+			}
+		}
+		t.swept = now
+	}
+	f, ok := t.failures[key]
+	if !ok || now.Sub(f.last) > window {
+		f = &authFailure{}
+		t.failures[key] = f
+	}
+	f.count++
+	f.last = now
+	return f.count
+}
+
+// count returns the number of consecutive failures and the time until they're forgotten.
+func (t *authFailureTracker) count(key string, now time.Time, window time.Duration) (int, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, ok := t.failures[key]
+	if !ok || now.Sub(f.last) > window {
+		return 0, 0
+	}
+	return f.count, window - now.Sub(f.last)
+}
+
+// reset forgets the failures after a successful login.
+func (t *authFailureTracker) reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, key)
+}
+
+// authDelay returns the delay after the given number of consecutive failures.
+// The last delay of the curve applies to all further failures.
+func (s *Security) authDelay(failures int) time.Duration {
+	if s == nil {
+		return 0
+	}
+	return delayAfter(s.AuthDelays, failures)
+}
+
+// addressDelay returns the delay after the given number of failures of an address, the ones up to the
+// threshold are free.
+func (s *Security) addressDelay(failures int) time.Duration {
+	if s == nil {
+		return 0
+	}
+	return delayAfter(s.AddressDelays, failures-s.AddressThreshold)
+}
+
+// delayAfter returns the delay of the curve after the given number of failures, the last one applies to all
+// further failures.
+func delayAfter(curve []time.Duration, failures int) time.Duration {
+	if len(curve) == 0 || failures < 1 {
+		return 0
+	}
+	if failures > len(curve) {
+		failures = len(curve)
+	}
+	return curve[failures-1]
+}
+
+// window returns the time after which failures are forgotten.
+func (s *Security) window() time.Duration {
+	if s == nil || s.AuthFailureWindow <= 0 {
+		return defaultAuthFailureWindow
+	}
+	return s.AuthFailureWindow
+}
+
+// tarpitFailedLogin records a failed login of the request and delays the response according to the configured curve.
+// Requests without credentials, like the initial challenge of most clients, aren't counted.
+func tarpitFailedLogin(cfg *Config, req *http.Request) {
+	username, _, ok := req.BasicAuth()
+	if !ok {
+		return
+	}
+	tarpitFailure(cfg, req, cfg.normalizeUsername(username))
+}
+
+// tarpitFailure records a failed login of the account from the address of the request and delays the response.
+// Accounts are usernames, or the links of shares protected by a password.
+func tarpitFailure(cfg *Config, req *http.Request, username string) {
+	if cfg.Security == nil {
+		return
+	}
+	address := cfg.failureAddress(req)
+	failures := cfg.authFailureCounter().fail(authFailureKey(address, username), time.Now(), cfg.Security.window())
+	delay := cfg.Security.authDelay(failures)
+	// Failures with any username add up for the address, so spraying passwords across users is slowed down too
+	if len(cfg.Security.AddressDelays) > 0 {
+		addressFailures := cfg.authFailureCounter().fail(addressFailureKey(address), time.Now(), cfg.Security.window())
+		delay = max(delay, cfg.Security.addressDelay(addressFailures))
+	}
+	if delay <= 0 {
+		return
+	}
+	log.WithFields(log.Fields{"user": username, "address": address, "failures": failures, "delay": delay}).Debug("Delaying response to failed login")
+	securityEvent(cfg, log.WarnLevel, "Delaying response to failed login", log.Fields{"user": username, "address": address, "failures": failures, "delay": delay.String()})
+	select {
+	case <-time.After(delay):
+	case <-req.Context().Done():
+	}
+}
+
+// rejectLockedOut answers logins of a username from an address with 429 Too Many Requests once they failed
+// the configured number of times, until the window passed without further failures. The password isn't
+// verified meanwhile, so guessing can't go on. It returns false if the login can proceed.
+func rejectLockedOut(cfg *Config, w http.ResponseWriter, req *http.Request) bool {
+	username, _, ok := req.BasicAuth()
+	if !ok {
+		return false
+	}
+	return rejectLockedOutAccount(cfg, w, req, cfg.normalizeUsername(username))
+}
+
+// rejectLockedOutAccount answers with 429 Too Many Requests once the logins of the account from the address
+// of the request failed the configured number of times. It returns false if the login can proceed.
+func rejectLockedOutAccount(cfg *Config, w http.ResponseWriter, req *http.Request, username string) bool {
+	if cfg.Security == nil || cfg.Security.LockoutThreshold <= 0 {
+		return false
+	}
+	address := cfg.failureAddress(req)
+	failures, remaining := cfg.authFailureCounter().count(authFailureKey(address, username), time.Now(), cfg.Security.window())
+	if failures < cfg.Security.LockoutThreshold {
+		return false
+	}
+	retryAfter := int(math.Ceil(remaining.Seconds()))
+	log.WithFields(log.Fields{"user": username, "address": address, "failures": failures, "retry": retryAfter}).Debug("Refused login of locked out client")
+	securityEvent(cfg, log.WarnLevel, "Refused login of locked out client", log.Fields{"user": username, "address": address, "failures": failures})
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	return true
+}
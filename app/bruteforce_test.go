@@ -0,0 +1,188 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestAuthDelay(t *testing.T) {
+	security := &Security{AuthDelays: []time.Duration{0, 500 * time.Millisecond, 2 * time.Second, 8 * time.Second}}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{2, 500 * time.Millisecond},
+		{4, 8 * time.Second},
+		{10, 8 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := security.authDelay(tt.failures); got != tt.want {
+			t.Errorf("authDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+	if got := (*Security)(nil).authDelay(3); got != 0 {
+		t.Errorf("authDelay() without security settings = %v, want 0", got)
+	}
+}
+
+func TestAuthFailureTracker(t *testing.T) {
+	tracker := &authFailureTracker{failures: map[string]*authFailure{}}
+	now := time.Now()
+	key := authFailureKey("192.0.2.1", "alice")
+
+	for i := 1; i <= 3; i++ {
+		if got := tracker.fail(key, now, time.Minute); got != i {
+			t.Errorf("fail() = %d, want %d", got, i)
+		}
+	}
+	// Other users from the same address aren't affected
+	if got := tracker.fail(authFailureKey("192.0.2.1", "bob"), now, time.Minute); got != 1 {
+		t.Errorf("fail() of another user = %d, want 1", got)
+	}
+	// Failures older than the window are forgotten
+	if got := tracker.fail(key, now.Add(2*time.Minute), time.Minute); got != 1 {
+		t.Errorf("fail() after window = %d, want 1", got)
+	}
+	tracker.fail(key, now.Add(2*time.Minute), time.Minute)
+	tracker.reset(key)
+	if got := tracker.fail(key, now.Add(2*time.Minute), time.Minute); got != 1 {
+		t.Errorf("fail() after reset = %d, want 1", got)
+	}
+}
+
+func TestTarpitFailedLogin(t *testing.T) {
+	cfg := &Config{Security: &Security{AuthDelays: []time.Duration{0, 50 * time.Millisecond}}}
+	req := httptest.NewRequest("PROPFIND", "/", nil)
+	req.RemoteAddr = "198.51.100.7:1234"
+	req.SetBasicAuth("tarpit", "wrong")
+	defer authFailures.reset(authFailureKey("198.51.100.7", "tarpit"))
+
+	for i, want := range []time.Duration{0, 50 * time.Millisecond} {
+		start := time.Now()
+		tarpitFailedLogin(cfg, req)
+		if elapsed := time.Since(start); elapsed < want || (want == 0 && elapsed > 25*time.Millisecond) {
+			t.Errorf("failure %d delayed %v, want %v", i+1, elapsed, want)
+		}
+	}
+}
+
+func TestAddressDelay(t *testing.T) {
+	security := &Security{AddressDelays: []time.Duration{time.Second, 2 * time.Second}, AddressThreshold: 3}
+	for failures, want := range map[int]time.Duration{1: 0, 3: 0, 4: time.Second, 5: 2 * time.Second, 20: 2 * time.Second} {
+		if got := security.addressDelay(failures); got != want {
+			t.Errorf("addressDelay(%d) = %v, want %v", failures, got, want)
+		}
+	}
+
+	// Failures with different usernames from the same address add up
+	cfg := &Config{Security: &Security{AddressDelays: []time.Duration{50 * time.Millisecond}, AddressThreshold: 2}}
+	defer authFailures.reset(addressFailureKey("198.51.100.10"))
+	for i, want := range []time.Duration{0, 0, 50 * time.Millisecond} {
+		req := httptest.NewRequest("PROPFIND", "/", nil)
+		req.RemoteAddr = "198.51.100.10:1234"
+		req.SetBasicAuth("spray"+strconv.Itoa(i), "wrong")
+		defer authFailures.reset(authFailureKey("198.51.100.10", "spray"+strconv.Itoa(i)))
+		start := time.Now()
+		tarpitFailedLogin(cfg, req)
+		if elapsed := time.Since(start); elapsed < want || (want == 0 && elapsed > 25*time.Millisecond) {
+			t.Errorf("failure %d delayed %v, want %v", i+1, elapsed, want)
+		}
+	}
+}
+
+func TestLockout(t *testing.T) {
+	cfg := &Config{
+		Dir:      t.TempDir(),
+		Users:    map[string]*UserInfo{"lockout": {Password: GenHash([]byte("password")), Crud: newCrudType("r")}},
+		Security: &Security{LockoutThreshold: 3, AuthFailureWindow: time.Minute},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	defer authFailures.reset(authFailureKey("198.51.100.8", "lockout"))
+	login := func(address, password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PROPFIND", "/", nil)
+		r.Header.Set("Depth", "0")
+		r.RemoteAddr = address + ":1234"
+		r.SetBasicAuth("lockout", password)
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := login("198.51.100.8", "wrong"); w.Code != http.StatusUnauthorized {
+			t.Errorf("failed login %d = %d, want %d", i+1, w.Code, http.StatusUnauthorized)
+		}
+	}
+	// Even the right password is refused until the window passed
+	w := login("198.51.100.8", "password")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("login after lockout = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if retry, _ := strconv.Atoi(w.Header().Get("Retry-After")); retry < 1 || retry > 60 {
+		t.Errorf("Retry-After = %q, want up to 60 seconds", w.Header().Get("Retry-After"))
+	}
+	// Other addresses aren't locked out
+	if w := login("198.51.100.9", "password"); w.Code != http.StatusMultiStatus {
+		t.Errorf("login from another address = %d, want %d", w.Code, http.StatusMultiStatus)
+	}
+}
+
+func TestLockoutSpoofedForwardedFor(t *testing.T) {
+	cfg := &Config{
+		Dir:      t.TempDir(),
+		Users:    map[string]*UserInfo{"spoofer": {Password: GenHash([]byte("password")), Crud: newCrudType("r")}},
+		Security: &Security{LockoutThreshold: 3, AuthFailureWindow: time.Minute},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	defer authFailures.reset(authFailureKey("198.51.100.11", "spoofer"))
+	login := func(forwarded, password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PROPFIND", "/", nil)
+		r.Header.Set("Depth", "0")
+		r.Header.Set("X-Forwarded-For", forwarded)
+		r.RemoteAddr = "198.51.100.11:1234"
+		r.SetBasicAuth("spoofer", password)
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		return w
+	}
+
+	// A new X-Forwarded-For header with every guess doesn't escape the lockout of an untrusted client
+	for i := 0; i < 3; i++ {
+		if w := login("203.0.113."+strconv.Itoa(i), "wrong"); w.Code != http.StatusUnauthorized {
+			t.Errorf("failed login %d = %d, want %d", i+1, w.Code, http.StatusUnauthorized)
+		}
+	}
+	if w := login("203.0.113.99", "password"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("login with another X-Forwarded-For = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	// And the spoofed addresses weren't locked out instead
+	if failures, _ := authFailures.count(authFailureKey("203.0.113.0", "spoofer"), time.Now(), time.Minute); failures != 0 {
+		t.Errorf("failures of spoofed address = %d, want 0", failures)
+	}
+}
+
+func TestAddressDelaySpoofedForwardedFor(t *testing.T) {
+	cfg := &Config{Security: &Security{AddressDelays: []time.Duration{50 * time.Millisecond}, AddressThreshold: 2}}
+	defer authFailures.reset(addressFailureKey("198.51.100.12"))
+	// Changing the X-Forwarded-For header with every failure doesn't reset the delay of the address
+	for i, want := range []time.Duration{0, 0, 50 * time.Millisecond} {
+		req := httptest.NewRequest("PROPFIND", "/", nil)
+		req.RemoteAddr = "198.51.100.12:1234"
+		req.Header.Set("X-Forwarded-For", "203.0.113."+strconv.Itoa(i))
+		req.SetBasicAuth("spray"+strconv.Itoa(i), "wrong")
+		defer authFailures.reset(authFailureKey("198.51.100.12", "spray"+strconv.Itoa(i)))
+		start := time.Now()
+		tarpitFailedLogin(cfg, req)
+		if elapsed := time.Since(start); elapsed < want || (want == 0 && elapsed > 25*time.Millisecond) {
+			t.Errorf("failure %d delayed %v, want %v", i+1, elapsed, want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// withinDir reports whether the path is the directory or below it, comparing the cleaned paths.
+func withinDir(dir, name string) bool {
+	rel, err := filepath.Rel(dir, name)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// realPath resolves the symlinks of the path. Of paths which don't exist (yet), the nearest existing ancestor
+// is resolved. Entries which exist but can't be resolved, like symlinks pointing nowhere, are an error, as
+// creating a file through them could create it anywhere.
+func realPath(name string) (string, error) {
+	name, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for {
+		real, err := filepath.EvalSymlinks(name)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if _, lerr := os.Lstat(name); !errors.Is(err, os.ErrNotExist) || lerr == nil {
+			return "", err
+		}
+		parent := filepath.Dir(name)
+		if parent == name {
+			return "", err
+		}
+		name, rest = parent, filepath.Join(filepath.Base(name), rest)
+	}
+}
+
+// localStorage reports whether the storage keeps the files at their physical paths, so their symlinks matter.
+func localStorage(s Storage) bool {
+	switch s.(type) {
+	case osStorage, *tieredStorage:
+		return true
+	}
+	return false
+}
+
+// confine returns the physical path if it's below the root the user is jailed in, also once its symlinks
+// are resolved unless symlinks may be followed anywhere. Otherwise it returns an empty path.
+func (d Dir) confine(root, name string) string {
+	if !withinDir(root, name) {
+		return ""
+	}
+	if d.Config.FollowSymlinks || !localStorage(d.storage()) {
+		return name
+	}
+	realRoot, err := realPath(root)
+	if err != nil {
+		return ""
+	}
+	real, err := realPath(name)
+	if err != nil || !withinDir(realRoot, real) {
+		return ""
+	}
+	return name
+}
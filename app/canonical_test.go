@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSymlinks(t *testing.T) {
+	base := t.TempDir()
+	outside := t.TempDir()
+	dir := filepath.Join(base, "data")
+	os.MkdirAll(filepath.Join(dir, "alice", "docs"), 0700)
+	os.MkdirAll(filepath.Join(dir, "bob"), 0700)
+	links := map[string]string{
+		"alice/inside":   filepath.Join(dir, "alice", "docs"),
+		"alice/outside":  outside,
+		"alice/bob":      filepath.Join(dir, "bob"),
+		"alice/dangling": filepath.Join(outside, "missing.txt"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(link))); err != nil {
+			t.Skipf("symlinks aren't supported: %v", err)
+		}
+	}
+	subdir := "/alice"
+	cfg := &Config{Dir: dir, Users: map[string]*UserInfo{"alice": {Subdir: &subdir, Crud: newCrudType("crud")}}}
+	ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "alice", Authenticated: true, CrudType: newCrudType("crud")})
+
+	tests := []struct {
+		name   string
+		follow bool
+		want   bool
+	}{
+		{"/docs/new.txt", false, true},
+		{"/inside/new.txt", false, true},
+		{"/outside", false, false},
+		{"/outside/new/file.txt", false, false},
+		{"/bob/file.txt", false, false},
+		{"/dangling", false, false},
+		{"/outside/new.txt", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.FollowSymlinks = tt.follow
+			got := Resolve(ctx, tt.name, Dir{Config: cfg})
+			if (got != "") != tt.want {
+				t.Errorf("Resolve() = %q, want resolved %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzResolve(f *testing.F) {
+	for _, seed := range []string{
+		"/a/b", "../../etc/passwd", "/..", "a/../../b", "%2e%2e/%2e%2e", `..\..\windows`, "//server/share/file",
+		"C:/Windows", "file.txt::$DATA", "/a/./b/../../..", "\x00", "/bob/../alice", "....//....//",
+	} {
+		f.Add(seed)
+	}
+	base := f.TempDir()
+	subdir := "/alice"
+	cfg := &Config{Dir: base, Users: map[string]*UserInfo{"alice": {Subdir: &subdir, Crud: newCrudType("crud")}}}
+	ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "alice", Authenticated: true, CrudType: newCrudType("crud")})
+	root := filepath.Join(base, "alice")
+
+	f.Fuzz(func(t *testing.T, name string) {
+		got := Resolve(ctx, name, Dir{Config: cfg})
+		if got == "" {
+			return
+		}
+		if !withinDir(root, got) {
+			t.Errorf("Resolve(%q) = %q, outside of %q", name, got, root)
+		}
+		if strings.ContainsRune(got, 0) {
+			t.Errorf("Resolve(%q) = %q, contains a null byte", name, got)
+		}
+	})
+}
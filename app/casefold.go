@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// matchCase returns the physical path with the casing of the existing entries below root, names are compared
+// case-insensitively where they don't exist as given. Names without a matching entry keep their casing. A name
+// matching several entries is ambiguous, which is reported as false.
+func matchCase(root, name string) (string, bool) {
+	rel, err := filepath.Rel(root, name)
+	if err != nil {
+		return "", false
+	}
+	if rel == "." {
+		return name, true
+	}
+	matched := root
+	elems := strings.Split(rel, string(filepath.Separator))
+	for i, elem := range elems {
+		if _, err := os.Lstat(filepath.Join(matched, elem)); err == nil {
+			matched = filepath.Join(matched, elem)
+			continue
+		}
+		entries, _ := os.ReadDir(matched)
+		var found []string
+		for _, entry := range entries {
+			if strings.EqualFold(entry.Name(), elem) {
+				found = append(found, entry.Name())
+			}
+		}
+		switch len(found) {
+		case 0:
+			return filepath.Join(append([]string{matched}, elems[i:]...)...), true
+		case 1:
+			matched = filepath.Join(matched, found[0])
+		default:
+			return "", false
+		}
+	}
+	return matched, true
+}
+
+// denyCaseConflict refuses creating the name if its physical path got the casing of an existing entry, which
+// differs from the name only by case and would be replaced. The refusal is answered with 409 Conflict.
+func (d Dir) denyCaseConflict(ctx context.Context, name, physical string) error {
+	if !d.Config.CaseInsensitive {
+		return nil
+	}
+	base := path.Base(path.Clean("/" + name))
+	if base == "/" || filepath.Base(physical) == base {
+		return nil
+	}
+	log.WithFields(log.Fields{"user": d.resolveUser(ctx), "path": physical, "name": base}).Warn("Denied creation of a name differing from an existing one only by case")
+	recordFailure(ctx, http.StatusConflict, conditionCaseConflict, "case-conflict")
+	return os.ErrPermission
+}
+
+// rejectCaseOnlyMove answers moves and copies of a path onto itself in another casing with 409 Conflict, the
+// webdav handler would delete the source as the existing destination before. It returns false if the request
+// can be served.
+func rejectCaseOnlyMove(cfg *Config, w http.ResponseWriter, req *http.Request) bool {
+	if !cfg.CaseInsensitive || req.Method != Move && req.Method != Copy {
+		return false
+	}
+	u, err := url.Parse(req.Header.Get("Destination"))
+	if err != nil {
+		return false
+	}
+	source, destination := path.Clean("/"+req.URL.Path), path.Clean("/"+u.Path)
+	if source == destination || !strings.EqualFold(source, destination) {
+		return false
+	}
+	log.WithFields(log.Fields{"method": req.Method, "path": source, "destination": destination}).Debug("Refused move differing only by case")
+	writeDAVError(w, http.StatusConflict, conditionCaseConflict, req.URL.Path)
+	return true
+}
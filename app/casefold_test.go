@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestMatchCase(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "Docs", "Reports"), 0700)
+	os.WriteFile(filepath.Join(root, "Docs", "Reports", "Q1.txt"), []byte("q1"), 0600)
+
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"docs/reports/q1.txt", "Docs/Reports/Q1.txt", true},
+		{"Docs/Reports/Q1.txt", "Docs/Reports/Q1.txt", true},
+		{"DOCS/new/q1.txt", "Docs/new/q1.txt", true},
+		{"docs/reports/q2.txt", "Docs/Reports/q2.txt", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := matchCase(root, filepath.Join(root, filepath.FromSlash(tt.name)))
+			if ok != tt.ok || got != filepath.Join(root, filepath.FromSlash(tt.want)) {
+				t.Errorf("matchCase() = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	// Names matching several entries are ambiguous on case-sensitive file systems
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), nil, 0600); err == nil {
+		if os.WriteFile(filepath.Join(root, "A.txt"), nil, 0600) == nil {
+			if entries, _ := os.ReadDir(root); len(entries) == 3 {
+				if got, ok := matchCase(root, filepath.Join(root, "a.TXT")); ok {
+					t.Errorf("matchCase() = %q, want ambiguous", got)
+				}
+			}
+		}
+	}
+}
+
+func TestCaseInsensitivePaths(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "Notes.txt"), []byte("content"), 0600)
+	cfg := &Config{
+		Dir:             dir,
+		CaseInsensitive: true,
+		Users:           map[string]*UserInfo{"alice": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")}},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	serve := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		r.SetBasicAuth("alice", "password")
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		return w
+	}
+
+	if w := serve("PROPFIND", "/notes.TXT", "", "Depth", "0"); w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "Notes.txt") {
+		t.Errorf("PROPFIND = %d %q, want the existing file", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodPut, "/NOTES.txt", "replaced"); w.Code != http.StatusConflict {
+		t.Errorf("PUT = %d, want %d", w.Code, http.StatusConflict)
+	}
+	ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "alice", Authenticated: true, CrudType: newCrudType("crud")})
+	if err := (Dir{Config: cfg}).Mkdir(ctx, "/notes.txt", 0700); err == nil {
+		t.Error("Mkdir() succeeded, want a conflict")
+	}
+	if w := serve("MOVE", "/Notes.txt", "", "Destination", "http://example.com/notes.txt"); w.Code != http.StatusConflict {
+		t.Errorf("MOVE = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := serve(http.MethodPut, "/Notes.txt", "updated"); w.Code != http.StatusNoContent && w.Code != http.StatusCreated {
+		t.Errorf("PUT with the existing casing = %d, want success", w.Code)
+	}
+	if content, err := os.ReadFile(filepath.Join(dir, "Notes.txt")); err != nil || string(content) != "updated" {
+		t.Errorf("content = %q, %v, want %q", content, err, "updated")
+	}
+}
@@ -0,0 +1,183 @@
+package app
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ClientCertRule maps verified client certificates to a user. All given conditions have to match.
+type ClientCertRule struct {
+	CN          string  // regular expression matched against the common name
+	Email       string  // regular expression matched against the email addresses of the SAN
+	DNS         string  // regular expression matched against the DNS names of the SAN
+	OU          string  // organizational unit the certificate has to contain
+	User        string  // username, may reference groups of the CN (or else the email or DNS) expression like $1
+	Subdir      *string // subdir of users not defined in the config file, may reference groups like User
+	Permissions string  // overrides the permissions of the user, required for users not in the config file
+
+	cn    *regexp.Regexp
+	email *regexp.Regexp
+	dns   *regexp.Regexp
+}
+
+// compile compiles the regular expressions of the rule.
+func (r *ClientCertRule) compile() error {
+	var err error
+	if r.CN != "" {
+		if r.cn, err = regexp.Compile(r.CN); err != nil {
+			return fmt.Errorf("invalid cn expression %q: %s", r.CN, err)
+		}
+	}
+	if r.Email != "" {
+		if r.email, err = regexp.Compile(r.Email); err != nil {
+			return fmt.Errorf("invalid email expression %q: %s", r.Email, err)
+		}
+	}
+	if r.DNS != "" {
+		if r.dns, err = regexp.Compile(r.DNS); err != nil {
+			return fmt.Errorf("invalid dns expression %q: %s", r.DNS, err)
+		}
+	}
+	if r.User == "" {
+		return errors.New("client certificate rule without user")
+	}
+	return nil
+}
+
+// match returns the expanded username and subdir if the certificate satisfies the rule.
+func (r *ClientCertRule) match(cert *x509.Certificate) (string, *string, bool) {
+	var re *regexp.Regexp
+	var submatches []int
+	var subject string
+	if r.cn != nil {
+		if submatches = r.cn.FindStringSubmatchIndex(cert.Subject.CommonName); submatches == nil {
+			return "", nil, false
+		}
+		re, subject = r.cn, cert.Subject.CommonName
+	}
+	// The groups of the CN expression take precedence for the expansion, then the ones of the email expression
+	for _, san := range []struct {
+		re     *regexp.Regexp
+		values []string
+	}{{r.email, cert.EmailAddresses}, {r.dns, cert.DNSNames}} {
+		if san.re == nil {
+			continue
+		}
+		found := false
+		for _, value := range san.values {
+			if indexes := san.re.FindStringSubmatchIndex(value); indexes != nil {
+				found = true
+				if re == nil {
+					re, subject, submatches = san.re, value, indexes
+				}
+				break
+			}
+		}
+		if !found {
+			return "", nil, false
+		}
+	}
+	if r.OU != "" {
+		found := false
+		for _, ou := range cert.Subject.OrganizationalUnit {
+			found = found || ou == r.OU
+		}
+		if !found {
+			return "", nil, false
+		}
+	}
+
+	expand := func(template string) string {
+		if re == nil {
+			return template
+		}
+		return string(re.ExpandString(nil, template, subject, submatches))
+	}
+	var subdir *string
+	if r.Subdir != nil {
+		expanded := expand(*r.Subdir)
+		subdir = &expanded
+	}
+	return expand(r.User), subdir, true
+}
+
+// newCrudType parses a permission string like "crud", unknown characters are ignored.
+func newCrudType(permissions string) *CrudType {
+	crud := &CrudType{Crud: permissions}
+	for _, ch := range permissions {
+		switch ch {
+		case 'c', 'C':
+			crud.Create = true
+		case 'r', 'R':
+			crud.Read = true
+		case 'u', 'U':
+			crud.Update = true
+		case 'd', 'D':
+			crud.Delete = true
+		case 'l', 'L':
+			crud.List = true
+		case 'a', 'A':
+			crud.Append = true
+		}
+	}
+	if crud.Append {
+		crud.Create, crud.Update, crud.Delete = true, false, false
+	}
+	return crud
+}
+
+// loadCertPool reads the CA certificates clients have to present a certificate of.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in " + file)
+	}
+	return pool, nil
+}
+
+// authenticateClientCertificate maps the verified client certificate of the request to a user.
+// It returns nil if there's no certificate or no rule matches, so other methods of authentication apply.
+func authenticateClientCertificate(cfg *Config, req *http.Request) *AuthInfo {
+	if cfg.TLS == nil || req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	cert := req.TLS.VerifiedChains[0][0]
+	for _, rule := range cfg.TLS.ClientCertRules {
+		username, subdir, ok := rule.match(cert)
+		if !ok {
+			continue
+		}
+		user := cfg.Users[username]
+		if user == nil {
+			// Unknown users are created on the fly, which requires the rule to define their permissions
+			if rule.Permissions == "" {
+				log.WithFields(log.Fields{"user": username, "cn": cert.Subject.CommonName}).Warn("Client certificate maps to unknown user without permissions")
+				return nil
+			}
+			user = &UserInfo{Subdir: subdir, Permissions: rule.Permissions, Crud: &CrudType{Crud: rule.Permissions}}
+			cfg.externalUsers.Store(username, user)
+			if err := FormatCrud(context.Background(), username, cfg); err != nil {
+				log.WithField("user", username).WithError(err).Error("Error parsing permissions of client certificate rule")
+				return nil
+			}
+		}
+		crud := user.Crud
+		if rule.Permissions != "" {
+			crud = newCrudType(rule.Permissions)
+		}
+		log.WithFields(log.Fields{"user": username, "cn": cert.Subject.CommonName, "crud": crud}).Debug("User was authenticated by client certificate")
+		return &AuthInfo{Username: username, Authenticated: true, CrudType: crud}
+	}
+	return nil
+}
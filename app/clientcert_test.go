@@ -0,0 +1,70 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticateClientCertificate(t *testing.T) {
+	devices := "/devices/$1"
+	cfg := &Config{
+		Users: map[string]*UserInfo{
+			"backup": {Crud: newCrudType("crud")},
+		},
+		TLS: &TLS{ClientCertRules: []*ClientCertRule{
+			{CN: `^backup\.example\.com$`, OU: "Ops", User: "backup", Permissions: "cr"},
+			{CN: `^sensor-(\d+)$`, User: "sensor-$1", Subdir: &devices, Permissions: "c"},
+			{Email: `^(\w+)@example\.com$`, User: "$1"},
+			{OU: "Fleet", User: "backup"},
+			{DNS: `^(\w+)\.sync\.example\.com$`, User: "sync-$1", Permissions: "crud"},
+		}},
+	}
+	for _, rule := range cfg.TLS.ClientCertRules {
+		if err := rule.compile(); err != nil {
+			t.Fatalf("compile() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		cert     *x509.Certificate
+		wantUser string
+		wantCrud string
+	}{
+		{"cn and ou with override", &x509.Certificate{Subject: pkix.Name{CommonName: "backup.example.com", OrganizationalUnit: []string{"Ops"}}}, "backup", "cr"},
+		{"cn without ou", &x509.Certificate{Subject: pkix.Name{CommonName: "backup.example.com"}}, "", ""},
+		{"unknown user from cn", &x509.Certificate{Subject: pkix.Name{CommonName: "sensor-42"}}, "sensor-42", "c"},
+		{"unknown user without permissions", &x509.Certificate{EmailAddresses: []string{"alice@example.com"}}, "", ""},
+		{"known user by ou", &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{"Fleet"}}}, "backup", "crud"},
+		{"unknown user from dns name", &x509.Certificate{DNSNames: []string{"www.example.com", "nas.sync.example.com"}}, "sync-nas", "crud"},
+		{"no match", &x509.Certificate{Subject: pkix.Name{CommonName: "other"}}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PROPFIND", "/", nil)
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.cert}}}
+			got := authenticateClientCertificate(cfg, req)
+			if tt.wantUser == "" {
+				if got != nil {
+					t.Errorf("authenticateClientCertificate() = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil || got.Username != tt.wantUser || got.CrudType.Crud != tt.wantCrud {
+				t.Errorf("authenticateClientCertificate() = %v, want user %s with crud %s", got, tt.wantUser, tt.wantCrud)
+			}
+		})
+	}
+
+	// The override must not change the configured permissions of the user
+	if !cfg.Users["backup"].Crud.Delete {
+		t.Errorf("configured permissions of backup were changed")
+	}
+	// Users created by a rule are known with their expanded subdir
+	if user := cfg.user("sensor-42"); user == nil || user.Subdir == nil || *user.Subdir != "/devices/42" {
+		t.Errorf("user() = %v, want user with subdir /devices/42", user)
+	}
+}
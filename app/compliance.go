@@ -0,0 +1,161 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// complianceContent is the content of the file the compliance test writes.
+	complianceContent = "david compliance test\n"
+	// lockTokenPlaceholder is replaced in the headers of a step by the token of the lock step.
+	lockTokenPlaceholder = "{lock-token}"
+)
+
+// ComplianceResult is the outcome of one step of the compliance test.
+type ComplianceResult struct {
+	Step   string `json:"step"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// complianceStep is a request of the compliance test and the check of its response.
+type complianceStep struct {
+	step   string
+	method string
+	path   string
+	header map[string]string
+	body   string
+	check  func(res *http.Response, body string) error
+}
+
+// wantStatus returns a check accepting the given status codes.
+func wantStatus(codes ...int) func(*http.Response, string) error {
+	return func(res *http.Response, _ string) error {
+		for _, code := range codes {
+			if res.StatusCode == code {
+				return nil
+			}
+		}
+		return fmt.Errorf("status %d, want %v", res.StatusCode, codes)
+	}
+}
+
+// RunCompliance exercises the WebDAV server at url with a scripted suite of requests in a scratch collection,
+// which is deleted at the end. Each step is checked against the behavior RFC 4918 requires, a result without
+// error passed.
+func RunCompliance(client *http.Client, url, username, password string) []ComplianceResult {
+	random := make([]byte, 4)
+	rand.Read(random)
+	dir := strings.TrimSuffix(url, "/") + "/david-test-" + hex.EncodeToString(random) + "/"
+	file := dir + "file.txt"
+	var token string
+
+	steps := []complianceStep{
+		{step: "options", method: http.MethodOptions, path: url, check: func(res *http.Response, _ string) error {
+			if !strings.Contains(res.Header.Get("DAV"), "1") {
+				return fmt.Errorf("DAV header %q doesn't announce class 1", res.Header.Get("DAV"))
+			}
+			return wantStatus(http.StatusOK, http.StatusNoContent)(res, "")
+		}},
+		{step: "create collection", method: "MKCOL", path: dir, check: wantStatus(http.StatusCreated)},
+		{step: "create existing collection", method: "MKCOL", path: dir, check: wantStatus(http.StatusMethodNotAllowed)},
+		{step: "upload", method: http.MethodPut, path: file, body: complianceContent, check: wantStatus(http.StatusCreated, http.StatusNoContent, http.StatusOK)},
+		{step: "download", method: http.MethodGet, path: file, check: func(res *http.Response, body string) error {
+			if err := wantStatus(http.StatusOK)(res, body); err != nil {
+				return err
+			}
+			if body != complianceContent {
+				return fmt.Errorf("content %q, want %q", body, complianceContent)
+			}
+			return nil
+		}},
+		{step: "list", method: "PROPFIND", path: dir, header: map[string]string{"Depth": "1"}, check: func(res *http.Response, body string) error {
+			if err := wantStatus(http.StatusMultiStatus)(res, body); err != nil {
+				return err
+			}
+			if !strings.Contains(body, "file.txt") {
+				return fmt.Errorf("listing doesn't contain file.txt")
+			}
+			return nil
+		}},
+		{step: "lock", method: "LOCK", path: file, header: map[string]string{"Depth": "0", "Timeout": "Second-60"},
+			body: `<?xml version="1.0" encoding="utf-8"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner>david test</D:owner></D:lockinfo>`,
+			check: func(res *http.Response, body string) error {
+				if err := wantStatus(http.StatusOK)(res, body); err != nil {
+					return err
+				}
+				if token = res.Header.Get("Lock-Token"); token == "" {
+					return fmt.Errorf("no Lock-Token in the response")
+				}
+				return nil
+			}},
+		{step: "upload to locked file", method: http.MethodPut, path: file, body: complianceContent, check: wantStatus(http.StatusLocked)},
+		{step: "upload with lock token", method: http.MethodPut, path: file, body: complianceContent, header: map[string]string{"If": "(" + lockTokenPlaceholder + ")"}, check: wantStatus(http.StatusCreated, http.StatusNoContent, http.StatusOK)},
+		{step: "unlock", method: "UNLOCK", path: file, header: map[string]string{"Lock-Token": lockTokenPlaceholder}, check: wantStatus(http.StatusNoContent, http.StatusOK)},
+		{step: "copy", method: "COPY", path: file, header: map[string]string{"Destination": dir + "copy.txt"}, check: wantStatus(http.StatusCreated)},
+		{step: "copy without overwrite", method: "COPY", path: file, header: map[string]string{"Destination": dir + "copy.txt", "Overwrite": "F"}, check: wantStatus(http.StatusPreconditionFailed)},
+		{step: "move", method: "MOVE", path: dir + "copy.txt", header: map[string]string{"Destination": dir + "moved.txt"}, check: wantStatus(http.StatusCreated)},
+		{step: "source of move is gone", method: "PROPFIND", path: dir + "copy.txt", header: map[string]string{"Depth": "0"}, check: wantStatus(http.StatusNotFound)},
+		{step: "delete", method: http.MethodDelete, path: dir, check: wantStatus(http.StatusNoContent, http.StatusOK)},
+		{step: "deleted collection is gone", method: "PROPFIND", path: dir, header: map[string]string{"Depth": "0"}, check: wantStatus(http.StatusNotFound)},
+	}
+
+	results := make([]ComplianceResult, 0, len(steps))
+	deleted := false
+	for _, step := range steps {
+		for key, value := range step.header {
+			step.header[key] = strings.ReplaceAll(value, lockTokenPlaceholder, token)
+		}
+		result := runComplianceStep(client, step, username, password)
+		deleted = deleted || step.method == http.MethodDelete && result.Error == ""
+		results = append(results, result)
+	}
+	if !deleted {
+		// Don't leave the scratch collection behind if a step failed
+		runComplianceStep(client, complianceStep{method: http.MethodDelete, path: dir, check: wantStatus()}, username, password)
+	}
+	return results
+}
+
+// runComplianceStep sends the request of a step and checks its response.
+func runComplianceStep(client *http.Client, step complianceStep, username, password string) ComplianceResult {
+	result := ComplianceResult{Step: step.step, Method: step.method, Path: step.path}
+	var body io.Reader
+	if step.body != "" {
+		body = strings.NewReader(step.body)
+	}
+	req, err := http.NewRequest(step.method, step.path, body)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	for key, value := range step.header {
+		req.Header.Set(key, value)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer res.Body.Close()
+	content, err := io.ReadAll(res.Body)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = res.StatusCode
+	if err := step.check(res, string(content)); err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestRunCompliance(t *testing.T) {
+	dir := t.TempDir()
+	handler := &webdav.Handler{FileSystem: webdav.Dir(dir), LockSystem: webdav.NewMemLS()}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	for _, result := range RunCompliance(server.Client(), server.URL, "", "") {
+		if result.Error != "" {
+			t.Errorf("step %s: %s", result.Step, result.Error)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("scratch collection left behind: %v", entries)
+	}
+
+	// Failures are reported and the scratch collection is still deleted
+	noLocks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "LOCK" {
+			http.Error(w, "not implemented", http.StatusNotImplemented)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer noLocks.Close()
+	failed := map[string]bool{}
+	for _, result := range RunCompliance(noLocks.Client(), noLocks.URL+"/", "", "") {
+		failed[result.Step] = result.Error != ""
+	}
+	if !failed["lock"] || failed["upload"] {
+		t.Errorf("failed steps = %v, want lock but not upload", failed)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("scratch collection left behind: %v", entries)
+	}
+}
+
+func TestRunComplianceAgainstDavid(t *testing.T) {
+	cfg := &Config{
+		Dir: t.TempDir(),
+		Users: map[string]*UserInfo{
+			"alice": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")},
+		},
+	}
+	server := httptest.NewServer(NewBasicAuthWebdavHandler(&App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}))
+	defer server.Close()
+	for _, result := range RunCompliance(server.Client(), server.URL, "alice", "password") {
+		if result.Error != "" {
+			t.Errorf("step %s: %s", result.Step, result.Error)
+		}
+	}
+	if entries, _ := os.ReadDir(cfg.Dir); len(entries) != 0 {
+		t.Errorf("scratch collection left behind: %v", entries)
+	}
+}
@@ -4,51 +4,300 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"html/template"
+	"maps"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
 
+	"github.com/crewjam/saml/samlsp"
 	"github.com/fsnotify/fsnotify"
+	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/net/webdav"
 )
 
 // Config represents the configuration of the server application.
 type Config struct {
-	Address string               `default:"127.0.0.1"`
-	Port    string               `default:"8000"`
-	Prefix  string               `default:""`
-	Dir     string               `default:"/tmp"`
-	TLS     *TLS                 `default:"nil"`
-	Log     Logging              `default:"{error:true, create:false, read:false, update:false, delete:false}"`
-	Realm   string               `default:"david"`
-	Users   map[string]*UserInfo `default:"nil"`
-	Cors    Cors                 `default:"{origin:*, credentials:false}"`
+	Address            string               `default:"127.0.0.1"`
+	Port               string               `default:"8000"`
+	Prefix             string               `default:""`
+	Dir                string               `default:"/tmp"`
+	TLS                *TLS                 `default:"nil"`
+	HTTP               *HTTP                `default:"nil"`
+	Log                Logging              `default:"{error:true, create:false, read:false, update:false, delete:false}"`
+	Realm              string               `default:"david"`
+	Users              map[string]*UserInfo `default:"nil"`
+	Groups             map[string]*Group    `default:"nil"`
+	Roles              map[string]string    `default:"nil"`
+	Cors               Cors                 `default:"{origin:*, credentials:false}"`
+	Presign            *Presign             `default:"nil"`
+	Hooks              Hooks
+	Script             *Script              `default:"nil"`
+	Plugins            map[string]*Plugin   `default:"nil"`
+	Metrics            *Metrics             `default:"nil"`
+	Debug              *Debug               `default:"nil"`
+	Stats              bool                 `default:"false"`
+	Accounting         *Accounting          `default:"nil"`
+	SAML               *SAML                `default:"nil"`
+	JWT                *JWT                 `default:"nil"`
+	ProxyAuth          *ProxyAuth           `default:"nil"`
+	ForwardAuth        *ForwardAuth         `default:"nil"`
+	Usernames          *Usernames           `default:"nil"`
+	Tenants            []*Tenant            `default:"nil"`
+	UserPrefix         bool                 `default:"false"`
+	SubdirPolicy       string               `default:""`
+	FollowSymlinks     bool                 `default:"false"`
+	CaseInsensitive    bool                 `default:"false"`
+	ListPermission     bool                 `default:"false"`
+	Security           *Security            `default:"nil"`
+	TrustedProxies     []string             `default:"nil"`
+	PlaintextPasswords string               `default:""`
+	ErrorPages         string               `default:""`
+	MaxUploadSize      int64                `default:"0"`
+	MaxPathLength      int                  `default:"0"`
+	MaxPathDepth       int                  `default:"0"`
+	MaxWrites          int                  `default:"0"`
+	Staging            *Staging             `default:"nil"`
+	Preallocate        bool                 `default:"false"`
+	WriteBufferSize    int                  `default:"0"`
+	Sparse             bool                 `default:"false"`
+	AppendOnly         []string             `default:"nil"`
+	OwnerOnly          []string             `default:"nil"`
+	TrackOwners        bool                 `default:"false"`
+	StripMetadata      []string             `default:"nil"`
+	Retention          []*RetentionRule     `default:"nil"`
+	Audit              *Audit               `default:"nil"`
+	UserStore          *UserStore           `default:"nil"`
+	UsersFile          *UsersFile           `default:"nil"`
+	PAM                *PAM                 `default:"nil"`
+	Unix               *Unix                `default:"nil"`
+	Kerberos           *Kerberos            `default:"nil"`
+	Redis              *Redis               `default:"nil"`
+	HA                 bool                 `default:"false"`
+	Maintenance        []*MaintenanceWindow `default:"nil"`
+	Janitor            *Janitor             `default:"nil"`
+	Trash              *Trash               `default:"nil"`
+	Versions           *Versions            `default:"nil"`
+	PurgeInterval      time.Duration        `default:"0"`
+	Expiry             []*ExpiryRule        `default:"nil"`
+	ExpiryInterval     time.Duration        `default:"0"`
+	Tiering            *Tiering             `default:"nil"`
+	Index              *Index               `default:"nil"`
+	Properties         *Properties          `default:"nil"`
+	Shares             *Shares              `default:"nil"`
+	Thumbnails         *Thumbnails          `default:"nil"`
+	Encryption         *Encryption          `default:"nil"`
+	SIEM               *SIEM                `default:"nil"`
+	SecurityLog        *SecurityLog         `default:"nil"`
+	FailedLoginLog     string               `default:""`
+	Progress           *Progress            `default:"nil"`
+
+	script        *policyScript
+	saml          *samlsp.Middleware
+	keytab        *keytab.Keytab
+	tenants       map[string]*Config
+	errorPages    map[int]*template.Template
+	storage       Storage
+	authPlugins   []*pluginClient
+	userStore     *userStore
+	redis         *redisState
+	tiered        *tieredStorage
+	indexer       *indexer
+	thumbnailer   *thumbnailer
+	siem          *siemSink
+	securityLog   *securityLogger
+	failedLogins  *failedLoginLog
+	properties    *sqlitePropertyStore
+	shares        *shareStore
+	eventPlugins  []*pluginClient
+	externalUsers sync.Map
+	fileUsers     map[string]bool
+	pepper        string
+	passwordFiles *fsnotify.Watcher
 }
 
 // Logging allows definition for logging each CRUD method.
 type Logging struct {
-	Production bool `default:"false"`
-	Debug      bool `default:"true"`
-	Error      bool
-	Create     bool
-	Read       bool
-	Update     bool
-	Delete     bool
+	Production      bool `default:"false"`
+	Debug           bool `default:"true"`
+	Error           bool
+	Create          bool
+	Read            bool
+	Update          bool
+	Delete          bool
+	Access          bool
+	SampleReads     int
+	Skip            []LogFilter
+	Redact          string
+	RedactKey       string
+	Level           string
+	Format          string
+	Colors          bool
+	Fields          []string
+	TimestampFormat string
 }
 
 // TLS allows specification of a certificate and private key file.
+// A client CA enables client certificates, which are mapped to users by the rules.
 type TLS struct {
-	CertFile string
-	KeyFile  string
+	CertFile           string
+	KeyFile            string
+	ClientCAFile       string
+	ClientCertRequired bool
+	ClientCertRules    []*ClientCertRule
+	certPEM            []byte
+	keyPEM             []byte
+}
+
+// HTTP configures a plain HTTP listener served besides the TLS one, e.g. for the LAN.
+// Credentials are only accepted over cleartext if allowed, and write operations may require TLS.
+type HTTP struct {
+	Address            string
+	Port               string
+	AllowAuth          bool
+	RequireTLSForWrite bool
 }
 
 // UserInfo allows storing of a password and user directory.
 type UserInfo struct {
-	Password    string
-	Subdir      *string
-	Permissions string
-	Crud        *CrudType
+	Password      string
+	Subdir        *string
+	Permissions   string
+	Crud          *CrudType
+	Admin         bool
+	MaxUploadSize int64
+	MaxWrites     int
+	Encrypt       bool
+	KeyFile       string
+	AllowedCIDRs  []string  `mapstructure:"allowed_cidrs"`
+	ExpiresAt     time.Time `mapstructure:"expires_at"`
+	Disabled      bool
+	PasswordSetAt time.Time `mapstructure:"password_set_at"`
+	PasswordFile  string    `mapstructure:"password_file"`
+	ACL           map[string]string
+	Groups        []string
+	Role          string
+	Methods       []string
+	passwordRef   string
+}
+
+// expired reports whether the account of the user expired at now, accounts without expiry never do.
+func (user *UserInfo) expired(now time.Time) bool {
+	return !user.ExpiresAt.IsZero() && !now.Before(user.ExpiresAt)
+}
+
+// passwordExpired reports whether the password of the user is older than the maximum age at now. Passwords
+// without the time they were set at don't expire.
+func (cfg *Config) passwordExpired(user *UserInfo, now time.Time) bool {
+	return cfg.Security != nil && cfg.Security.MaxPasswordAge > 0 && !user.PasswordSetAt.IsZero() &&
+		now.Sub(user.PasswordSetAt) > cfg.Security.MaxPasswordAge
+}
+
+// pruneExpiredUsers removes the users of the configuration whose accounts expired at now. The users are
+// replaced at once, requests keep reading the previous ones meanwhile.
+func (cfg *Config) pruneExpiredUsers(now time.Time) {
+	users := make(map[string]*UserInfo, len(cfg.Users))
+	for username, user := range cfg.Users {
+		if user.expired(now) {
+			log.WithField("user", username).WithField("expiry", user.ExpiresAt).Info("Removed expired user")
+			continue
+		}
+		users[username] = user
+	}
+	if len(users) != len(cfg.Users) {
+		cfg.Users = users
+	}
+}
+
+// Presign allows the generation of HMAC signed, time limited download links.
+type Presign struct {
+	Secret    string
+	MaxExpiry time.Duration
+}
+
+// Staging writes uploads to a temp file first, which replaces the destination once the upload is complete.
+// The temp files are kept next to their destination unless Dir is set, which has to be on the same file system.
+type Staging struct {
+	Suffix string
+	Dir    string
+}
+
+// Hooks contains external commands run before and after file operations.
+type Hooks struct {
+	Upload   Hook
+	Delete   Hook
+	Move     Hook
+	DiskFull string
+	Timeout  time.Duration
+}
+
+// Hook holds the commands run before (able to veto via exit code) and after an operation.
+type Hook struct {
+	Pre  string
+	Post string
+}
+
+// Script references a starlark policy script evaluated at login and before each operation.
+type Script struct {
+	File string
+}
+
+// Plugin is an external process extending david over RPC, see package plugin for the protocol.
+type Plugin struct {
+	Command string
+	Auth    bool
+	Storage bool
+	Events  bool
+}
+
+// Metrics configures the listener serving Prometheus metrics and the accounting of all users.
+type Metrics struct {
+	Address string
+}
+
+// Accounting configures the file the per-user usage is periodically appended to.
+type Accounting struct {
+	File     string
+	Interval time.Duration
+}
+
+// SAML configures the service provider used for browser logins with an identity provider.
+// The NameID (or the given attribute) is the username, unless it's translated by the users mapping.
+type SAML struct {
+	URL             string
+	IDPMetadataFile string
+	CertFile        string
+	KeyFile         string
+	Attribute       string
+	Users           []SAMLUser
+}
+
+// SAMLUser translates the identity of a SAML login to a configured user.
+type SAMLUser struct {
+	Identity string
+	User     string
+}
+
+// Security contains settings hardening the authentication.
+type Security struct {
+	AuthDelays          []time.Duration `mapstructure:"auth_delays"`            // delay before answering the n-th consecutive failed login
+	AuthFailureWindow   time.Duration   `mapstructure:"auth_failure_window"`    // failed logins older than this are forgotten
+	LockoutThreshold    int             `mapstructure:"lockout_threshold"`      // failed logins after which logins are refused for the window
+	AddressDelays       []time.Duration `mapstructure:"address_delays"`         // delay after failed logins of an address with any username
+	AddressThreshold    int             `mapstructure:"address_threshold"`      // failed logins of an address before its delays apply
+	HashAlgorithm       string          `mapstructure:"hash_algorithm"`         // algorithm of new password hashes, bcrypt if empty
+	UpgradeHashes       bool            `mapstructure:"upgrade_hashes"`         // rehash weaker passwords on login and persist them
+	HashCost            int             `mapstructure:"hash_cost"`              // cost of new bcrypt hashes and minimum of stored ones
+	PepperFile          string          `mapstructure:"pepper_file"`            // file of the secret appended to passwords, else $DAVID_PEPPER
+	MaxPasswordAge      time.Duration   `mapstructure:"max_password_age"`       // logins with passwords set longer ago are refused
+	PasswordAgeWarnOnly bool            `mapstructure:"password_age_warn_only"` // only log logins with expired passwords
 }
 
 // Cors contains settings related to Cross-Origin Resource Sharing (CORS)
@@ -83,11 +332,23 @@ func ParseConfig(path string) *Config {
 		log.Fatal(fmt.Errorf("fatal error parsing config file: %s", err)) // Propagate error with context
 	}
 	log.WithField("path", viper.ConfigFileUsed()).Debug("Finished Unmarshalling config file")
+	// Let a drive letter alone denote the root of the drive on Windows
+	cfg.Dir = rootDir(cfg.Dir)
+	// Redact personal data in the log (if configured) before any of it is logged
+	if mode := cfg.Log.Redact; mode != "" && mode != redactHash && mode != redactTruncate {
+		log.Fatal(fmt.Errorf("unknown log redaction: %s", mode))
+	}
+	installRedaction(cfg)
 
 	// Set production mode for logging in NDJSON format
 	cfg.Log.Production = viper.GetBool("Log.Production")
 	cfg.Log.Debug = viper.GetBool("Log.Debug")
 
+	// Pass the settings of the groups on to their members, which have to be of known groups and roles
+	if err := cfg.applyGroups(); err != nil {
+		log.Fatal(fmt.Errorf("error in groups or roles: %s", err))
+	}
+
 	// Process user permissions
 	for user := range viper.GetStringMap("Users") {
 		log.WithField("user", user).Debug("Processing user permissions") // Log user permissions processing
@@ -105,15 +366,292 @@ func ParseConfig(path string) *Config {
 		log.WithFields(logrus.Fields{"user": user,
 			"crud": cfg.Users[user].Crud}).Debug("Parsed crud string from config file") // Log parsed permissions
 	}
+	// Hash the passwords pasted in plaintext (if allowed), which would never match
+	if mode := cfg.PlaintextPasswords; mode != "" && mode != plaintextHash && mode != plaintextRewrite {
+		log.Fatal(fmt.Errorf("unknown handling of plaintext passwords: %s", mode))
+	}
+	// Load the pepper of the password hashes, which is kept until restart
+	var pepperFile string
+	if cfg.Security != nil {
+		pepperFile = cfg.Security.PepperFile
+	}
+	if cfg.pepper, err = LoadPepper(pepperFile); err != nil {
+		log.Fatal(fmt.Errorf("error loading pepper: %s", err))
+	}
+	// Replace the references to secrets by them
+	if err := cfg.resolveSecrets(); err != nil {
+		log.Fatal(fmt.Errorf("error resolving secret: %s", err))
+	}
+	cfg.hashPlaintextPasswords(viper.ConfigFileUsed(), nil)
+	// Merge the users of the htpasswd file (if present)
+	if err := cfg.loadUsersFile(); err != nil {
+		log.Fatal(fmt.Errorf("error reading users file: %s", err))
+	}
+	cfg.pruneExpiredUsers(time.Now())
 
 	// Validate TLS configuration (if present)
 	if cfg.TLS != nil {
-		if _, err := os.Stat(cfg.TLS.KeyFile); err != nil {
+		if _, err := os.Stat(cfg.TLS.KeyFile); err != nil && cfg.TLS.keyPEM == nil {
 			log.Fatal(fmt.Errorf("TLS keyFile doesn't exist: %s", err)) // Check for and log missing key file error
 		}
-		if _, err := os.Stat(cfg.TLS.CertFile); err != nil {
+		if _, err := os.Stat(cfg.TLS.CertFile); err != nil && cfg.TLS.certPEM == nil {
 			log.Fatal(fmt.Errorf("TLS certFile doesn't exist: %s", err)) // Check for and log missing cert file error
 		}
+		for _, rule := range cfg.TLS.ClientCertRules {
+			if err := rule.compile(); err != nil {
+				log.Fatal(fmt.Errorf("error in client certificate rule: %s", err))
+			}
+		}
+	}
+	// Validate the additional HTTP listener (if present)
+	if cfg.HTTP != nil && cfg.TLS == nil {
+		log.Fatal(errors.New("an additional http listener requires tls")) // Without TLS the server is listening on HTTP already
+	}
+	// Validate pre-signed url configuration (if present)
+	if cfg.Presign != nil && cfg.Presign.Secret == "" {
+		log.Fatal(errors.New("presign secret must not be empty")) // A missing secret would make every signature forgeable
+	}
+	// PAM needs a build with its support (if present)
+	if cfg.PAM != nil && !pamSupported {
+		log.Fatal(errPAMUnsupported)
+	}
+	// Validate the algorithm of new password hashes (if present)
+	if cfg.Security != nil {
+		switch cfg.Security.HashAlgorithm {
+		case "", HashBcrypt, HashArgon2id, HashScrypt:
+		default:
+			log.Fatal(fmt.Errorf("unknown hash algorithm: %s", cfg.Security.HashAlgorithm))
+		}
+		if cost := cfg.Security.HashCost; cost != 0 && (cost < bcrypt.MinCost || cost > bcrypt.MaxCost) {
+			log.Fatal(fmt.Errorf("hash cost %d is outside of %d to %d", cost, bcrypt.MinCost, bcrypt.MaxCost))
+		}
+	}
+	cfg.warnWeakHashes()
+	// Validate the secret of the bearer tokens (if present)
+	if cfg.JWT != nil && cfg.JWT.Secret == "" {
+		log.Fatal(errors.New("jwt secret must not be empty"))
+	}
+	// The proxy authentication header is only believed from trusted proxies (if present)
+	if cfg.ProxyAuth != nil && len(cfg.TrustedProxies) == 0 {
+		log.Fatal(errors.New("proxy authentication requires trusted proxies"))
+	}
+	// Validate the endpoint of the forward authentication (if present)
+	if cfg.ForwardAuth != nil {
+		if cfg.ForwardAuth.URL == "" {
+			log.Fatal(errors.New("forward auth url must not be empty"))
+		}
+		if cfg.ForwardAuth.Mode != "" && cfg.ForwardAuth.Mode != forwardCredentials && cfg.ForwardAuth.Mode != forwardHeader {
+			log.Fatal(fmt.Errorf("invalid forward auth mode %q, use credentials or header", cfg.ForwardAuth.Mode))
+		}
+	}
+	// Accounts of the shadow file need their permissions (if present)
+	if cfg.Unix != nil && cfg.Unix.Permissions == "" {
+		log.Fatal(errors.New("unix accounts need permissions"))
+	}
+	// Load the policy script (if present)
+	if cfg.Script != nil {
+		script, err := loadScript(cfg.Script.File)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error loading policy script: %s", err))
+		}
+		cfg.script = script
+	}
+	// Load the custom error pages (if present)
+	if cfg.ErrorPages != "" {
+		pages, err := loadErrorPages(cfg.ErrorPages)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error loading error pages: %s", err))
+		}
+		cfg.errorPages = pages
+	}
+	// Validate the maintenance windows (if present)
+	for _, window := range cfg.Maintenance {
+		if err := window.validate(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Validate the expiry rules (if present)
+	for _, rule := range cfg.Expiry {
+		if err := rule.validate(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Create the directory of staged uploads (if present)
+	if cfg.Staging != nil && cfg.Staging.Dir != "" {
+		if err := os.MkdirAll(cfg.Staging.Dir, 0700); err != nil {
+			log.Fatal(fmt.Errorf("error creating staging directory: %s", err))
+		}
+	}
+	// Create the directories of the trash and the versions (if present)
+	if cfg.Trash != nil {
+		if cfg.Trash.Dir == "" {
+			log.Fatal(fmt.Errorf("trash without dir"))
+		}
+		if err := os.MkdirAll(cfg.Trash.Dir, 0700); err != nil {
+			log.Fatal(fmt.Errorf("error creating trash directory: %s", err))
+		}
+	}
+	if cfg.Versions != nil {
+		if cfg.Versions.Dir == "" {
+			log.Fatal(fmt.Errorf("versions without dir"))
+		}
+		if err := os.MkdirAll(cfg.Versions.Dir, 0700); err != nil {
+			log.Fatal(fmt.Errorf("error creating versions directory: %s", err))
+		}
+	}
+	// Validate the address ranges of the proxies and the users (if present)
+	if _, err := parsePrefixes(cfg.TrustedProxies); err != nil {
+		log.Fatal(fmt.Errorf("error in trusted proxies: %s", err))
+	}
+	for username, user := range cfg.Users {
+		if _, err := parsePrefixes(user.AllowedCIDRs); err != nil {
+			log.Fatal(fmt.Errorf("error in allowed address ranges of user %s: %s", username, err))
+		}
+		if err := validateACL(user.ACL); err != nil {
+			log.Fatal(fmt.Errorf("error in acl of user %s: %s", username, err))
+		}
+		if err := validateMethods(user.Methods); err != nil {
+			log.Fatal(fmt.Errorf("error in methods of user %s: %s", username, err))
+		}
+	}
+	// Check the keys of the users whose files are encrypted
+	for username, user := range cfg.Users {
+		if user.KeyFile != "" {
+			if _, err := readKeyFile(user.KeyFile); err != nil {
+				log.Fatal(fmt.Errorf("error reading key file of user %s: %s", username, err))
+			}
+		} else if user.Encrypt && (cfg.Encryption == nil || cfg.Encryption.Keys == "") {
+			log.Fatal(fmt.Errorf("user %s is encrypted, but the directory of the encryption keys isn't set", username))
+		}
+	}
+	// Connect to the bucket of cold files (if present)
+	if cfg.Tiering != nil {
+		if cfg.Tiering.Dir == "" {
+			log.Fatal(fmt.Errorf("tiering without dir"))
+		}
+		if err := os.MkdirAll(cfg.Tiering.Dir, 0700); err != nil {
+			log.Fatal(fmt.Errorf("error creating tiering directory: %s", err))
+		}
+		store, err := openS3Store(cfg.Tiering)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error connecting to object storage: %s", err))
+		}
+		cfg.tiered = &tieredStorage{tiering: cfg.Tiering, objects: store}
+	}
+	// Open the store of the dead properties (if present)
+	if cfg.Properties != nil {
+		store, err := openPropertyStore(cfg.Properties)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error opening property store: %s", err))
+		}
+		cfg.properties = store
+	}
+	// Owners of files are kept with their dead properties
+	if len(cfg.OwnerOnly) != 0 && cfg.propertyStore() == nil {
+		log.Fatal(fmt.Errorf("owner-only directories need properties or ha"))
+	}
+	if cfg.TrackOwners && cfg.propertyStore() == nil {
+		log.Fatal(fmt.Errorf("tracking owners needs properties or ha"))
+	}
+	// Open the store of the share links (if present)
+	if cfg.Shares != nil {
+		store, err := openShareStore(cfg.Shares)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error opening share store: %s", err))
+		}
+		cfg.shares = store
+	}
+	// Open the search index (if present)
+	if cfg.Index != nil {
+		ix, err := openIndexer(cfg.Index)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error opening index: %s", err))
+		}
+		cfg.indexer = ix
+	}
+	// Create the cache of the thumbnails (if present)
+	if cfg.Thumbnails != nil {
+		if cfg.Thumbnails.Dir == "" {
+			log.Fatal(fmt.Errorf("thumbnails without dir"))
+		}
+		for _, size := range cfg.Thumbnails.Sizes {
+			if size <= 0 {
+				log.Fatal(fmt.Errorf("invalid thumbnail size %d", size))
+			}
+		}
+		if err := os.MkdirAll(cfg.Thumbnails.Dir, 0700); err != nil {
+			log.Fatal(fmt.Errorf("error creating thumbnails directory: %s", err))
+		}
+		cfg.thumbnailer = newThumbnailer(cfg.Thumbnails)
+	}
+	// Set up the export of events to the SIEM (if present)
+	if cfg.SIEM != nil {
+		sink, err := newSIEMSink(cfg.SIEM)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error in siem configuration: %s", err))
+		}
+		cfg.siem = sink
+	}
+	// Open the log of security events (if present)
+	if cfg.SecurityLog != nil {
+		logger, err := newSecurityLogger(cfg.SecurityLog)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error opening security log: %s", err))
+		}
+		cfg.securityLog = logger
+	}
+	// Open the log of failed logins for fail2ban (if present)
+	if cfg.FailedLoginLog != "" {
+		failedLogins, err := openFailedLoginLog(cfg.FailedLoginLog)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error opening failed login log: %s", err))
+		}
+		cfg.failedLogins = failedLogins
+	}
+	// Connect to the user store (if present)
+	if cfg.UserStore != nil {
+		store, err := openUserStore(cfg.UserStore)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error opening user store: %s", err))
+		}
+		cfg.userStore = store
+	}
+	// Connect to the server of the shared state (if present)
+	if cfg.Redis != nil {
+		state, err := openRedis(cfg.Redis)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error connecting to redis: %s", err))
+		}
+		cfg.redis = state
+	}
+	// Users without subdir are served the base directory unless the policy says otherwise
+	if !validSubdirPolicy(cfg.SubdirPolicy) {
+		log.Fatal(fmt.Errorf("invalid subdir policy %s", cfg.SubdirPolicy))
+	}
+	cfg.warnSubdirPolicy()
+	// High availability shares locks and properties through redis
+	if cfg.HA && cfg.redis == nil {
+		log.Fatal(errors.New("high availability mode requires redis"))
+	}
+	// Set up the SAML service provider (if present)
+	if cfg.SAML != nil {
+		sp, err := loadSAML(cfg)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error setting up SAML: %s", err))
+		}
+		cfg.saml = sp
+	}
+	// Load the keytab of the Kerberos service (if present)
+	if cfg.Kerberos != nil {
+		kt, err := loadKeytab(cfg.Kerberos)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error loading kerberos keytab: %s", err))
+		}
+		cfg.keytab = kt
+	}
+	// Derive the configurations of the tenants (if present)
+	if err := cfg.parseTenants(); err != nil {
+		log.Fatal(fmt.Errorf("error in tenant configuration: %s", err))
 	}
 	// Enable config hot reload and update
 	viper.WatchConfig()
@@ -125,9 +663,92 @@ func ParseConfig(path string) *Config {
 	return cfg
 }
 
+// Start launches the plugins and background services of the server.
+// They are started once and aren't affected by hot reloads.
+func (cfg *Config) Start() error {
+	if err := cfg.startPlugins(); err != nil {
+		return fmt.Errorf("error starting plugins: %s", err)
+	}
+	if cfg.UsersFile != nil {
+		if err := cfg.watchUsersFile(); err != nil {
+			return fmt.Errorf("error watching users file: %s", err)
+		}
+	}
+	if err := cfg.watchPasswordFiles(); err != nil {
+		return fmt.Errorf("error watching password files: %s", err)
+	}
+	if cfg.Accounting != nil {
+		cfg.startAccounting()
+	}
+	if cfg.Janitor != nil {
+		cfg.startJanitor()
+	}
+	if cfg.Progress != nil {
+		cfg.startProgress()
+	}
+	if cfg.Trash != nil || cfg.Versions != nil {
+		cfg.startPurge()
+	}
+	if len(cfg.Expiry) != 0 {
+		cfg.startExpiry()
+	}
+	if cfg.tiered != nil {
+		// Stubs are local files, so tiering can't be combined with a storage plugin
+		if cfg.storage != nil {
+			return errors.New("tiering requires the local file system as storage")
+		}
+		cfg.storage = cfg.tiered
+		cfg.startTiering(cfg.tiered)
+	}
+	if cfg.indexer != nil {
+		cfg.indexer.props = cfg.propertyStore()
+		cfg.indexer.start(cfg)
+	}
+	if cfg.thumbnailer != nil {
+		cfg.thumbnailer.start()
+	}
+	if cfg.siem != nil {
+		cfg.siem.start()
+	}
+	// Tenants share the storage and event plugins, auth plugins only apply to the main configuration
+	for _, tenant := range cfg.tenants {
+		tenant.storage, tenant.eventPlugins = cfg.storage, cfg.eventPlugins
+	}
+	return nil
+}
+
+// LockSystem returns the lock system of the served tree, which is shared by all instances in high availability mode.
+func (cfg *Config) LockSystem() webdav.LockSystem {
+	if cfg.HA {
+		return newRedisLockSystem(cfg.redis, cfg.Dir)
+	}
+	return webdav.NewMemLS()
+}
+
 // AuthenticationNeeded returns whether users are defined and authentication is required
 func (cfg *Config) AuthenticationNeeded() bool {
-	return cfg.Users != nil && len(cfg.Users) != 0
+	return cfg.Users != nil && len(cfg.Users) != 0 || len(cfg.authPlugins) != 0 || cfg.userStore != nil ||
+		cfg.TLS != nil && len(cfg.TLS.ClientCertRules) != 0 || cfg.JWT != nil || cfg.UsersFile != nil ||
+		cfg.PAM != nil || cfg.Unix != nil || cfg.ProxyAuth != nil || cfg.ForwardAuth != nil || cfg.Kerberos != nil
+}
+
+// prefixOf returns the URL prefix of the tree of a user, which ends with the username if per-user prefixes are enabled.
+func (cfg *Config) prefixOf(username string) string {
+	if cfg.UserPrefix && username != "" {
+		return cfg.Prefix + "/" + username
+	}
+	return cfg.Prefix
+}
+
+// user returns the configured or stored user with the given name, or a user authenticated by an external source.
+func (cfg *Config) user(name string) *UserInfo {
+	if user := cfg.storedUser(name); user != nil {
+		return user
+	}
+	if user, ok := cfg.externalUsers.Load(name); ok {
+		return user.(*UserInfo)
+	}
+	return nil
 }
 
 func (cfg *Config) handleConfigUpdate(e fsnotify.Event) {
@@ -161,11 +782,49 @@ func (cfg *Config) handleConfigUpdate(e fsnotify.Event) {
 		log.WithError(err).Error("Error parsing config file")
 		return
 	}
+	updatedCfg.pepper = cfg.pepper
+	if err := updatedCfg.resolveSecrets(); err != nil {
+		log.WithError(err).Error("Error resolving secret")
+		return
+	}
+	updatedCfg.hashPlaintextPasswords(e.Name, cfg.Users)
+	// The users of the htpasswd file are kept, its settings aren't affected by reloads
+	updatedCfg.UsersFile = cfg.UsersFile
+	if err := updatedCfg.loadUsersFile(); err != nil {
+		log.WithError(err).Error("Error reading users file")
+		return
+	}
+	updatedCfg.pruneExpiredUsers(time.Now())
+	if err := updatedCfg.applyGroups(); err != nil {
+		log.WithError(err).Error("Error in groups or roles")
+		return
+	}
+	// The usage recorded so far is written before the users it belongs to change
+	cfg.FlushAccounting()
 	updateConfig(cfg, updatedCfg)
+	cfg.fileUsers = updatedCfg.fileUsers
+	// Users may have got password files in directories which aren't watched yet
+	if err := cfg.watchPasswordFiles(); err != nil {
+		log.WithError(err).Error("Error watching password files")
+	}
 }
 
 // Call the updateConfig function to merge changes
 func updateConfig(cfg *Config, updatedCfg *Config) {
+	// Roles and groups are updated first, the permissions of their members are merged with them
+	if !maps.Equal(cfg.Roles, updatedCfg.Roles) {
+		cfg.Roles = updatedCfg.Roles
+		log.WithField("roles", cfg.Roles).Info("Updated roles")
+	}
+	if !reflect.DeepEqual(cfg.Groups, updatedCfg.Groups) {
+		cfg.Groups = updatedCfg.Groups
+		log.Info("Updated groups")
+	}
+	// Update whether listing collections needs the "List" permission
+	if cfg.ListPermission != updatedCfg.ListPermission {
+		cfg.ListPermission = updatedCfg.ListPermission
+		log.WithField("enabled", cfg.ListPermission).Info("Updated list permission")
+	}
 	for username := range cfg.Users {
 		if updatedCfg.Users[username] == nil {
 			log.WithField("user", username).Debug("Removed User from configuration")
@@ -183,10 +842,56 @@ func updateConfig(cfg *Config, updatedCfg *Config) {
 				log.WithField("user", username).Info("Updated password of user")
 				cfg.Users[username].Password = userInformationChange.Password
 			}
+			cfg.Users[username].passwordRef = userInformationChange.passwordRef
+			cfg.Users[username].PasswordFile = userInformationChange.PasswordFile
 			if cfg.Users[username].Subdir != userInformationChange.Subdir {
 				log.WithField("user", username).Info("Updated subdir of user")
 				cfg.Users[username].Subdir = userInformationChange.Subdir
 			}
+			if cfg.Users[username].MaxUploadSize != userInformationChange.MaxUploadSize {
+				log.WithField("user", username).WithField("limit", userInformationChange.MaxUploadSize).Info("Updated upload limit of user")
+				cfg.Users[username].MaxUploadSize = userInformationChange.MaxUploadSize
+			}
+			if cfg.Users[username].MaxWrites != userInformationChange.MaxWrites {
+				log.WithField("user", username).WithField("limit", userInformationChange.MaxWrites).Info("Updated concurrent write limit of user")
+				cfg.Users[username].MaxWrites = userInformationChange.MaxWrites
+			}
+			if !slices.Equal(cfg.Users[username].AllowedCIDRs, userInformationChange.AllowedCIDRs) {
+				log.WithField("user", username).WithField("ranges", userInformationChange.AllowedCIDRs).Info("Updated allowed address ranges of user")
+				cfg.Users[username].AllowedCIDRs = userInformationChange.AllowedCIDRs
+			}
+			if !maps.Equal(cfg.Users[username].ACL, userInformationChange.ACL) {
+				log.WithField("user", username).WithField("acl", userInformationChange.ACL).Info("Updated acl of user")
+				cfg.Users[username].ACL = userInformationChange.ACL
+			}
+			if !slices.Equal(cfg.Users[username].Groups, userInformationChange.Groups) {
+				log.WithField("user", username).WithField("groups", userInformationChange.Groups).Info("Updated groups of user")
+				cfg.Users[username].Groups = userInformationChange.Groups
+			}
+			if !slices.Equal(cfg.Users[username].Methods, userInformationChange.Methods) {
+				log.WithField("user", username).WithField("methods", userInformationChange.Methods).Info("Updated methods of user")
+				cfg.Users[username].Methods = userInformationChange.Methods
+			}
+			if cfg.Users[username].Role != userInformationChange.Role {
+				log.WithField("user", username).WithField("role", userInformationChange.Role).Info("Updated role of user")
+				cfg.Users[username].Role = userInformationChange.Role
+			}
+			if !cfg.Users[username].ExpiresAt.Equal(userInformationChange.ExpiresAt) {
+				log.WithField("user", username).WithField("expiry", userInformationChange.ExpiresAt).Info("Updated expiry of user")
+				cfg.Users[username].ExpiresAt = userInformationChange.ExpiresAt
+			}
+			if !cfg.Users[username].PasswordSetAt.Equal(userInformationChange.PasswordSetAt) {
+				log.WithField("user", username).WithField("set", userInformationChange.PasswordSetAt).Info("Updated time the password of user was set at")
+				cfg.Users[username].PasswordSetAt = userInformationChange.PasswordSetAt
+			}
+			if cfg.Users[username].Disabled != userInformationChange.Disabled {
+				log.WithField("user", username).WithField("disabled", userInformationChange.Disabled).Info("Updated disabled flag of user")
+				cfg.Users[username].Disabled = userInformationChange.Disabled
+			}
+			if cfg.Users[username].Admin != userInformationChange.Admin {
+				log.WithField("user", username).WithField("admin", userInformationChange.Admin).Info("Updated admin flag of user")
+				cfg.Users[username].Admin = userInformationChange.Admin
+			}
 			if cfg.Users[username].Crud != userInformationChange.Crud {
 				cfg.Users[username].Crud = &CrudType{Crud: userInformationChange.Permissions}
 				err := FormatCrud(context.Background(), username, cfg)
@@ -205,6 +910,21 @@ func updateConfig(cfg *Config, updatedCfg *Config) {
 	if cfg.Log.Debug != updatedCfg.Log.Debug {
 		cfg.Log.Debug = updatedCfg.Log.Debug
 		log.WithField("enabled", cfg.Log.Debug).Debug("Set debug mode")
+		if err := cfg.ApplyLog(); err != nil {
+			log.WithError(err).Error("Error updating the log level")
+		}
+	}
+	if cfg.Log.Level != updatedCfg.Log.Level || cfg.Log.Format != updatedCfg.Log.Format || cfg.Log.Colors != updatedCfg.Log.Colors ||
+		!slices.Equal(cfg.Log.Fields, updatedCfg.Log.Fields) || cfg.Log.TimestampFormat != updatedCfg.Log.TimestampFormat {
+		previous := cfg.Log
+		cfg.Log.Level, cfg.Log.Format, cfg.Log.Colors = updatedCfg.Log.Level, updatedCfg.Log.Format, updatedCfg.Log.Colors
+		cfg.Log.Fields, cfg.Log.TimestampFormat = updatedCfg.Log.Fields, updatedCfg.Log.TimestampFormat
+		if err := cfg.ApplyLog(); err != nil {
+			log.WithError(err).Error("Error updating the log format, keeping the previous one")
+			cfg.Log = previous
+		} else {
+			log.WithFields(log.Fields{"level": cfg.Log.Level, "format": cfg.Log.Format}).Info("Updated log level and format")
+		}
 	}
 	if cfg.Log.Create != updatedCfg.Log.Create {
 		cfg.Log.Create = updatedCfg.Log.Create
@@ -222,6 +942,264 @@ func updateConfig(cfg *Config, updatedCfg *Config) {
 		cfg.Log.Delete = updatedCfg.Log.Delete
 		log.WithField("enabled", cfg.Log.Delete).Debug("Set logging for delete operations")
 	}
+	if cfg.Log.Access != updatedCfg.Log.Access {
+		cfg.Log.Access = updatedCfg.Log.Access
+		log.WithField("enabled", cfg.Log.Access).Debug("Set logging of requests")
+	}
+	if cfg.Log.SampleReads != updatedCfg.Log.SampleReads || !slices.Equal(cfg.Log.Skip, updatedCfg.Log.Skip) {
+		cfg.Log.SampleReads, cfg.Log.Skip = updatedCfg.Log.SampleReads, updatedCfg.Log.Skip
+		log.WithFields(log.Fields{"sampleReads": cfg.Log.SampleReads, "skip": len(cfg.Log.Skip)}).Info("Updated sampling and filters of the log")
+	}
+	if cfg.Log.Redact != updatedCfg.Log.Redact {
+		cfg.Log.Redact = updatedCfg.Log.Redact
+		log.WithField("mode", cfg.Log.Redact).Info("Updated redaction of the log")
+	}
+
+	// Update hooks
+	if cfg.Hooks != updatedCfg.Hooks {
+		cfg.Hooks = updatedCfg.Hooks
+		log.Info("Updated hooks")
+	}
+
+	// Reload the policy script, a broken script keeps the previous one active
+	if updatedCfg.Script == nil {
+		if cfg.script != nil {
+			log.Info("Removed policy script")
+		}
+		cfg.Script, cfg.script = nil, nil
+	} else if script, err := loadScript(updatedCfg.Script.File); err != nil {
+		log.WithError(err).WithField("path", updatedCfg.Script.File).Error("Error reloading policy script")
+	} else {
+		cfg.Script, cfg.script = updatedCfg.Script, script
+		log.WithField("path", updatedCfg.Script.File).Debug("Reloaded policy script")
+	}
+
+	// Update security settings
+	if !reflect.DeepEqual(cfg.Security, updatedCfg.Security) {
+		cfg.Security = updatedCfg.Security
+		log.Info("Updated security settings")
+	}
+
+	// Update the trusted proxies, invalid ranges keep the previous ones active
+	if !slices.Equal(cfg.TrustedProxies, updatedCfg.TrustedProxies) {
+		if _, err := parsePrefixes(updatedCfg.TrustedProxies); err != nil {
+			log.WithError(err).Error("Error updating trusted proxies, keeping the previous ones")
+		} else {
+			cfg.TrustedProxies = updatedCfg.TrustedProxies
+			log.WithField("proxies", cfg.TrustedProxies).Info("Updated trusted proxies")
+		}
+	}
+
+	// Update the proxy authentication, which can't be enabled without trusted proxies
+	if !reflect.DeepEqual(cfg.ProxyAuth, updatedCfg.ProxyAuth) {
+		if updatedCfg.ProxyAuth != nil && len(cfg.TrustedProxies) == 0 {
+			log.Error("Error updating proxy authentication, it requires trusted proxies")
+		} else {
+			cfg.ProxyAuth = updatedCfg.ProxyAuth
+			log.WithField("enabled", cfg.ProxyAuth != nil).Info("Updated proxy authentication")
+		}
+	}
+
+	// Update the normalization of usernames
+	if !reflect.DeepEqual(cfg.Usernames, updatedCfg.Usernames) {
+		cfg.Usernames = updatedCfg.Usernames
+		log.WithField("enabled", cfg.Usernames != nil).Info("Updated normalization of usernames")
+	}
+
+	// Update the forward authentication
+	if !reflect.DeepEqual(cfg.ForwardAuth, updatedCfg.ForwardAuth) {
+		cfg.ForwardAuth = updatedCfg.ForwardAuth
+		log.WithField("enabled", cfg.ForwardAuth != nil).Info("Updated forward authentication")
+	}
+
+	// Update the authentication of Unix accounts
+	if !reflect.DeepEqual(cfg.Unix, updatedCfg.Unix) && (updatedCfg.Unix == nil || updatedCfg.Unix.Permissions != "") {
+		cfg.Unix = updatedCfg.Unix
+		log.WithField("enabled", cfg.Unix != nil).Info("Updated authentication of unix accounts")
+	}
+
+	// Update the policy for users without subdir
+	if cfg.SubdirPolicy != updatedCfg.SubdirPolicy && validSubdirPolicy(updatedCfg.SubdirPolicy) {
+		cfg.SubdirPolicy = updatedCfg.SubdirPolicy
+		log.WithField("policy", cfg.SubdirPolicy).Info("Updated subdir policy")
+	}
+
+	// Update whether symlinks may lead out of the directories of the users
+	if cfg.FollowSymlinks != updatedCfg.FollowSymlinks {
+		cfg.FollowSymlinks = updatedCfg.FollowSymlinks
+		log.WithField("enabled", cfg.FollowSymlinks).Info("Updated following of symlinks")
+	}
+
+	// Update whether paths ignore their case
+	if cfg.CaseInsensitive != updatedCfg.CaseInsensitive {
+		cfg.CaseInsensitive = updatedCfg.CaseInsensitive
+		log.WithField("enabled", cfg.CaseInsensitive).Info("Updated case-insensitive paths")
+	}
+
+	// Update per-user prefixes
+	if cfg.UserPrefix != updatedCfg.UserPrefix {
+		cfg.UserPrefix = updatedCfg.UserPrefix
+		log.WithField("enabled", cfg.UserPrefix).Info("Updated per-user prefixes")
+	}
+
+	// Update the behavior of the HTTP listener, its address can't change without a restart
+	if cfg.HTTP != nil && updatedCfg.HTTP != nil && *cfg.HTTP != *updatedCfg.HTTP {
+		cfg.HTTP.AllowAuth, cfg.HTTP.RequireTLSForWrite = updatedCfg.HTTP.AllowAuth, updatedCfg.HTTP.RequireTLSForWrite
+		log.WithFields(log.Fields{"allowAuth": cfg.HTTP.AllowAuth, "requireTLSForWrite": cfg.HTTP.RequireTLSForWrite}).Info("Updated http listener settings")
+	}
+
+	// Update upload staging, temp files of running uploads are completed at their previous location
+	if !reflect.DeepEqual(cfg.Staging, updatedCfg.Staging) {
+		cfg.Staging = updatedCfg.Staging
+		log.WithField("enabled", cfg.Staging != nil).Info("Updated upload staging")
+	}
+
+	// Update the tuning of uploads
+	if cfg.Preallocate != updatedCfg.Preallocate || cfg.WriteBufferSize != updatedCfg.WriteBufferSize {
+		cfg.Preallocate, cfg.WriteBufferSize = updatedCfg.Preallocate, updatedCfg.WriteBufferSize
+		log.WithFields(log.Fields{"preallocate": cfg.Preallocate, "writeBufferSize": cfg.WriteBufferSize}).Info("Updated upload tuning")
+	}
+
+	// Update whether admins can open the statistics dashboard
+	if cfg.Stats != updatedCfg.Stats {
+		cfg.Stats = updatedCfg.Stats
+		log.WithField("enabled", cfg.Stats).Info("Updated statistics dashboard")
+	}
+
+	// Update sparse file handling
+	if cfg.Sparse != updatedCfg.Sparse {
+		cfg.Sparse = updatedCfg.Sparse
+		log.WithField("enabled", cfg.Sparse).Info("Updated sparse file handling")
+	}
+
+	// Update append-only directories
+	if !reflect.DeepEqual(cfg.AppendOnly, updatedCfg.AppendOnly) {
+		cfg.AppendOnly = updatedCfg.AppendOnly
+		log.WithField("dirs", cfg.AppendOnly).Info("Updated append-only directories")
+	}
+	if !reflect.DeepEqual(cfg.OwnerOnly, updatedCfg.OwnerOnly) {
+		if len(updatedCfg.OwnerOnly) != 0 && cfg.propertyStore() == nil {
+			log.Error("Owner-only directories need properties or ha, restart to enable them")
+		} else {
+			cfg.OwnerOnly = updatedCfg.OwnerOnly
+			log.WithField("dirs", cfg.OwnerOnly).Info("Updated owner-only directories")
+		}
+	}
+	if cfg.TrackOwners != updatedCfg.TrackOwners {
+		if updatedCfg.TrackOwners && cfg.propertyStore() == nil {
+			log.Error("Tracking owners needs properties or ha, restart to enable it")
+		} else {
+			cfg.TrackOwners = updatedCfg.TrackOwners
+			log.WithField("enabled", cfg.TrackOwners).Info("Updated tracking of owners")
+		}
+	}
+	if !reflect.DeepEqual(cfg.StripMetadata, updatedCfg.StripMetadata) {
+		cfg.StripMetadata = updatedCfg.StripMetadata
+		log.WithField("dirs", cfg.StripMetadata).Info("Updated directories stripping image metadata")
+	}
+
+	// Update retention rules and the audit log
+	if !reflect.DeepEqual(cfg.Retention, updatedCfg.Retention) {
+		cfg.Retention = updatedCfg.Retention
+		log.WithField("rules", len(cfg.Retention)).Info("Updated retention rules")
+	}
+	if !reflect.DeepEqual(cfg.Audit, updatedCfg.Audit) {
+		cfg.Audit = updatedCfg.Audit
+		log.WithField("enabled", cfg.Audit != nil).Info("Updated audit log")
+	}
+
+	// Update the maintenance windows, invalid ones keep the previous windows active
+	if !reflect.DeepEqual(cfg.Maintenance, updatedCfg.Maintenance) {
+		var err error
+		for _, window := range updatedCfg.Maintenance {
+			if err == nil {
+				err = window.validate()
+			}
+		}
+		if err != nil {
+			log.WithError(err).Error("Error updating maintenance windows")
+		} else {
+			cfg.Maintenance = updatedCfg.Maintenance
+			log.WithField("windows", len(cfg.Maintenance)).Info("Updated maintenance windows")
+		}
+	}
+
+	// Update the settings of the janitor, changing its interval or enabling it requires a restart
+	if !reflect.DeepEqual(cfg.Janitor, updatedCfg.Janitor) {
+		cfg.Janitor = updatedCfg.Janitor
+		log.WithField("enabled", cfg.Janitor != nil).Info("Updated janitor")
+	}
+
+	// Update the expiry rules, changing their interval or adding the first requires a restart
+	if !reflect.DeepEqual(cfg.Expiry, updatedCfg.Expiry) {
+		var err error
+		for _, rule := range updatedCfg.Expiry {
+			if err == nil {
+				err = rule.validate()
+			}
+		}
+		if err != nil {
+			log.WithError(err).Error("Error updating expiry rules")
+		} else {
+			cfg.Expiry = updatedCfg.Expiry
+			log.WithField("rules", len(cfg.Expiry)).Info("Updated expiry rules")
+		}
+	}
+
+	// Update the trash and the versions, changing the purge interval or enabling them requires a restart
+	if !reflect.DeepEqual(cfg.Trash, updatedCfg.Trash) {
+		if t := updatedCfg.Trash; t != nil && (t.Dir == "" || os.MkdirAll(t.Dir, 0700) != nil) {
+			log.WithField("dir", t.Dir).Error("Error updating trash, can't create its directory")
+		} else {
+			cfg.Trash = updatedCfg.Trash
+			log.WithField("enabled", cfg.Trash != nil).Info("Updated trash")
+		}
+	}
+	if !reflect.DeepEqual(cfg.Versions, updatedCfg.Versions) {
+		if v := updatedCfg.Versions; v != nil && (v.Dir == "" || os.MkdirAll(v.Dir, 0700) != nil) {
+			log.WithField("dir", v.Dir).Error("Error updating versions, can't create their directory")
+		} else {
+			cfg.Versions = updatedCfg.Versions
+			log.WithField("enabled", cfg.Versions != nil).Info("Updated versions")
+		}
+	}
+
+	// Update the upload limit
+	if cfg.MaxUploadSize != updatedCfg.MaxUploadSize {
+		cfg.MaxUploadSize = updatedCfg.MaxUploadSize
+		log.WithField("limit", cfg.MaxUploadSize).Info("Updated upload limit")
+	}
+
+	// Update the limits of paths
+	if cfg.MaxPathLength != updatedCfg.MaxPathLength || cfg.MaxPathDepth != updatedCfg.MaxPathDepth {
+		cfg.MaxPathLength, cfg.MaxPathDepth = updatedCfg.MaxPathLength, updatedCfg.MaxPathDepth
+		log.WithFields(log.Fields{"length": cfg.MaxPathLength, "depth": cfg.MaxPathDepth}).Info("Updated path limits")
+	}
+
+	// Update the limit of concurrent writes
+	if cfg.MaxWrites != updatedCfg.MaxWrites {
+		cfg.MaxWrites = updatedCfg.MaxWrites
+		log.WithField("limit", cfg.MaxWrites).Info("Updated concurrent write limit")
+	}
+
+	// Reload the error pages, broken templates keep the previous pages active
+	if updatedCfg.ErrorPages == "" {
+		cfg.ErrorPages, cfg.errorPages = "", nil
+	} else if pages, err := loadErrorPages(updatedCfg.ErrorPages); err != nil {
+		log.WithError(err).WithField("path", updatedCfg.ErrorPages).Error("Error reloading error pages")
+	} else {
+		cfg.ErrorPages, cfg.errorPages = updatedCfg.ErrorPages, pages
+		log.WithField("path", updatedCfg.ErrorPages).Debug("Reloaded error pages")
+	}
+
+	// Update pre-signed url settings, rotating the secret invalidates all issued links
+	if !reflect.DeepEqual(cfg.Presign, updatedCfg.Presign) && (updatedCfg.Presign == nil || updatedCfg.Presign.Secret != "") {
+		cfg.Presign = updatedCfg.Presign
+		log.WithField("enabled", cfg.Presign != nil).Debug("Updated pre-signed url settings")
+	}
+
+	// Apply the changes to the tenants
+	updateTenants(cfg, updatedCfg)
 }
 
 // createBaseAndUserDirectoriesIfNeeded creates the base directory and individual
@@ -237,10 +1215,10 @@ func (cfg *Config) createBaseAndUserDirectoriesIfNeeded() {
 		log.WithField("path", cfg.Dir).Info("Created base dir")
 	}
 
-	// Create individual user directories if they have a defined subdirectory.
-	for _, user := range cfg.Users {
-		if user.Subdir != nil {
-			path := filepath.Join(cfg.Dir, *user.Subdir) // Use path.Join directly for clarity.
+	// Create individual user directories if they have a defined or assigned subdirectory.
+	for username, user := range cfg.Users {
+		if subdir, _ := cfg.subdirOf(username, user); subdir != "" {
+			path := filepath.Join(cfg.Dir, subdir) // Use path.Join directly for clarity.
 			_, pathErr := os.Stat(path)
 			if os.IsNotExist(pathErr) {
 				os.Mkdir(path, os.ModePerm)
@@ -7,78 +7,45 @@ import (
 )
 
 type CrudType struct {
-	// Create, Read, Update, Delete
+	// Create, Read, Update, Delete and List, which only matters with ListPermission. Append allows to create
+	// files, but neither to overwrite nor to delete existing ones, regardless of Update and Delete.
 	Crud   string
 	Create bool
 	Read   bool
 	Update bool
 	Delete bool
+	List   bool
+	Append bool
 }
 
 type contextKey int
 
-var crudContextKey contextKey
-
-// FormatCrud formats and validates a CRUD type string based on the provided context, user name, configuration.
-// This function takes a context (`ctx`), user name (`name`), configuration (`c`), and a `CrudType` object (`crud`) as input.
+// FormatCrud validates the CRUD string of the user with the given name and sets their effective permissions,
+// which include the ones granted by their role and groups. The permissions are computed into a new CrudType
+// that keeps the configured CRUD string, so formatting again starts over from the configuration.
 func FormatCrud(ctx context.Context, name string, cfg *Config) error {
 	// Check if user exists in config file and if crud exists in config file.
-	if cfg.Users[name] != nil && cfg.Users[name].Crud != nil {
-		crud := cfg.Users[name].Crud
-
-		// Validate CRUD string length.
-		if len(crud.Crud) > 4 {
-			cfg.Users[name].Crud.Create = false
-			cfg.Users[name].Crud.Read = false
-			cfg.Users[name].Crud.Update = false
-			cfg.Users[name].Crud.Delete = false
-			return errors.New("invalid CRUD type string: length must be between 1 and 4")
-		} else if len(crud.Crud) < 1 {
-			cfg.Users[name].Crud.Crud = ""
-			cfg.Users[name].Crud.Create = false
-			cfg.Users[name].Crud.Read = false
-			cfg.Users[name].Crud.Update = false
-			cfg.Users[name].Crud.Delete = false
-			return nil
-		}
-
-		// Convert CRUD string to lowercase and update the config.users.crud.crud string to be lowercase.
-		cfg.Users[name].Crud.Crud = strings.ToLower(crud.Crud)
-
-		// Initialize individual operation flags.
-		var create, read, update, delete bool
-
-		// Analyze each character and set corresponding flag.
-		for _, ch := range cfg.Users[name].Crud.Crud {
-			switch ch {
-			case 'c':
-				create = true
-			case 'r':
-				read = true
-			case 'u':
-				update = true
-			case 'd':
-				delete = true
-			default:
-				// Ignore invalid characters.
-			}
-		}
+	user := cfg.user(name)
+	if user == nil || user.Crud == nil {
+		return errors.New("either user was not found in config file, or crud was not found in config file")
+	}
+	configured := user.Crud.Crud
 
-		// update the context with the CrudType object.
-		ctx = context.WithValue(ctx, crudContextKey, CrudType{crud.Crud, create, read, update, delete})
-		if ctx == nil {
-			return errors.New("failed to update context with CrudType")
-		}
+	// Validate CRUD string length.
+	if len(configured) > 6 {
+		user.Crud = &CrudType{Crud: configured}
+		return errors.New("invalid CRUD type string: length must be between 1 and 6")
+	}
 
-		// Update the fileds of the config.users.crud object.
-		cfg.Users[name].Crud.Create = create
-		cfg.Users[name].Crud.Read = read
-		cfg.Users[name].Crud.Update = update
-		cfg.Users[name].Crud.Delete = delete
+	// Users are granted the permissions of their role and groups as well.
+	crud := newCrudType(strings.ToLower(configured) + cfg.grantedPermissions(user))
+	crud.Crud = configured
+	user.Crud = crud
+	return nil
+}
 
-		// Return formatted CrudType with updated flags.
-		return nil
-	} else {
-		return errors.New("either user was not found in config file, or crud was not found in config file")
-	}
+// mayList reports whether the permissions allow to list the contents of directories. Unless ListPermission
+// requires the list permission, it comes with the read permission.
+func (cfg *Config) mayList(crud *CrudType) bool {
+	return crud.List || !cfg.ListPermission && crud.Read
 }
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// davidNamespace is the XML namespace of the error conditions specific to david.
+const davidNamespace = "https://github.com/audstanley/david"
+
+// davCondition is a precondition or postcondition element of a DAV:error body (RFC 4918, section 16).
+type davCondition struct {
+	space string
+	name  string
+}
+
+// Conditions reported in DAV:error bodies, the ones in the DAV: namespace are defined by RFC 4918, 3253, 3744 and 4331.
+var (
+	conditionLockTokenSubmitted  = davCondition{"DAV:", "lock-token-submitted"}
+	conditionNoConflictingLock   = davCondition{"DAV:", "no-conflicting-lock"}
+	conditionNeedPrivileges      = davCondition{"DAV:", "need-privileges"}
+	conditionSupportedReport     = davCondition{"DAV:", "supported-report"}
+	conditionQuotaNotExceeded    = davCondition{"DAV:", "quota-not-exceeded"}
+	conditionSufficientDiskSpace = davCondition{"DAV:", "sufficient-disk-space"}
+	conditionMethodNotAllowed    = davCondition{davidNamespace, "method-not-allowed"}
+	conditionOperationDenied     = davCondition{davidNamespace, "operation-denied"}
+	conditionTLSRequired         = davCondition{davidNamespace, "tls-required"}
+	conditionChecksumMismatch    = davCondition{davidNamespace, "checksum-mismatch"}
+	conditionAppendOnly          = davCondition{davidNamespace, "append-only"}
+	conditionRetention           = davCondition{davidNamespace, "retention-period"}
+	conditionMaintenance         = davCondition{davidNamespace, "maintenance"}
+	conditionCaseConflict        = davCondition{davidNamespace, "case-conflict"}
+	conditionReservedName        = davCondition{davidNamespace, "reserved-name"}
+	conditionPathTooLong         = davCondition{davidNamespace, "path-too-long"}
+	conditionPathTooDeep         = davCondition{davidNamespace, "path-too-deep"}
+	conditionOutOfScope          = davCondition{davidNamespace, "out-of-scope"}
+)
+
+// davErrorBody renders a DAV:error body holding the condition and the hrefs of the affected resources.
+func davErrorBody(condition davCondition, hrefs ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	prefix := "D"
+	if condition.space == davidNamespace {
+		prefix = "david"
+		fmt.Fprintf(&b, `<D:error xmlns:D="DAV:" xmlns:david="%s">`, davidNamespace)
+	} else {
+		b.WriteString(`<D:error xmlns:D="DAV:">`)
+	}
+	if len(hrefs) == 0 {
+		fmt.Fprintf(&b, "<%s:%s/>", prefix, condition.name)
+	} else {
+		fmt.Fprintf(&b, "<%s:%s>", prefix, condition.name)
+		for _, href := range hrefs {
+			b.WriteString("<D:href>")
+			xml.EscapeText(&b, []byte(href))
+			b.WriteString("</D:href>")
+		}
+		fmt.Fprintf(&b, "</%s:%s>", prefix, condition.name)
+	}
+	b.WriteString("</D:error>\n")
+	return b.Bytes()
+}
+
+// writeDAVError responds with the status and a DAV:error body, so clients can tell the reason of a failure.
+func writeDAVError(w http.ResponseWriter, status int, condition davCondition, hrefs ...string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := w.Write(davErrorBody(condition, hrefs...)); err != nil {
+		log.WithError(err).Error("Error sending DAV error response")
+	}
+}
+
+// davErrorWriter replaces the plain text bodies of failed lock checks of the webdav handler with DAV:error bodies.
+type davErrorWriter struct {
+	http.ResponseWriter
+	req      *http.Request
+	replaced bool
+}
+
+// WriteHeader writes a DAV:error body for locked resources and passes all other statuses.
+func (w *davErrorWriter) WriteHeader(status int) {
+	if status != http.StatusLocked {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	// A LOCK conflicts with an existing lock, other methods lack the token of the lock
+	condition := conditionLockTokenSubmitted
+	if w.req.Method == Lock {
+		condition = conditionNoConflictingLock
+	}
+	writeDAVError(w.ResponseWriter, status, condition, w.req.URL.Path)
+	w.replaced = true
+}
+
+// Write discards the plain text body after it has been replaced.
+func (w *davErrorWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
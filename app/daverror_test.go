@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestDAVErrorBody(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition davCondition
+		hrefs     []string
+		want      string
+	}{
+		{"standard condition", conditionNeedPrivileges, nil, `<D:error xmlns:D="DAV:"><D:need-privileges/></D:error>`},
+		{"escaped href", conditionLockTokenSubmitted, []string{"/a&b"}, `<D:error xmlns:D="DAV:"><D:lock-token-submitted><D:href>/a&amp;b</D:href></D:lock-token-submitted></D:error>`},
+		{"david condition", conditionTLSRequired, nil, `<D:error xmlns:D="DAV:" xmlns:david="` + davidNamespace + `"><david:tls-required/></D:error>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := davErrorBody(tt.condition, tt.hrefs...)
+			if got := strings.TrimSpace(strings.TrimPrefix(string(body), xml.Header)); got != tt.want {
+				t.Errorf("davErrorBody() = %s, want %s", got, tt.want)
+			}
+			// The body has to be well formed with the condition in its namespace
+			var parsed struct {
+				XMLName   xml.Name
+				Condition struct{ XMLName xml.Name } `xml:",any"`
+			}
+			if err := xml.Unmarshal(body, &parsed); err != nil {
+				t.Fatalf("xml.Unmarshal() error = %v", err)
+			}
+			if parsed.XMLName != (xml.Name{Space: "DAV:", Local: "error"}) || parsed.Condition.XMLName != (xml.Name{Space: tt.condition.space, Local: tt.condition.name}) {
+				t.Errorf("parsed %v, want DAV:error with %v", parsed, tt.condition)
+			}
+		})
+	}
+}
+
+func TestServeWebdavLockErrors(t *testing.T) {
+	a := &App{
+		Config:  &Config{},
+		Handler: &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()},
+	}
+	serve := func(method string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		serveWebdav(a, context.Background(), w, httptest.NewRequest(method, "/file.txt", strings.NewReader(body)), "")
+		return w
+	}
+	lockInfo := `<?xml version="1.0" encoding="utf-8"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`
+	if w := serve(Lock, lockInfo); w.Code != http.StatusCreated {
+		t.Fatalf("LOCK = %d, want %d", w.Code, http.StatusCreated)
+	}
+
+	tests := []struct {
+		method    string
+		body      string
+		condition string
+	}{
+		{http.MethodPut, "content", "<D:lock-token-submitted><D:href>/file.txt</D:href></D:lock-token-submitted>"},
+		{Lock, lockInfo, "<D:no-conflicting-lock><D:href>/file.txt</D:href></D:no-conflicting-lock>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			w := serve(tt.method, tt.body)
+			if w.Code != http.StatusLocked || !strings.Contains(w.Body.String(), tt.condition) || strings.Contains(w.Body.String(), "Locked") {
+				t.Errorf("%s = %d %s, want %d with %s", tt.method, w.Code, w.Body.String(), http.StatusLocked, tt.condition)
+			}
+		})
+	}
+}
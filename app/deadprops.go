@@ -0,0 +1,203 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// redisGlobEscaper escapes the characters with a special meaning in the patterns of SCAN.
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// propertyStore keeps the dead properties set by PROPPATCH, keyed by the physical path of their file.
+// Removing and moving a path applies to the paths below it as well.
+type propertyStore interface {
+	props(ctx context.Context, name string) (map[xml.Name]webdav.Property, error)
+	patch(ctx context.Context, name string, patches []webdav.Proppatch) error
+	remove(ctx context.Context, name string) error
+	move(ctx context.Context, oldName, newName string) error
+}
+
+// propertyStore returns the store of the dead properties, redis in high availability mode so all instances
+// serve the same ones, or nil if dead properties aren't supported.
+func (cfg *Config) propertyStore() propertyStore {
+	if cfg.HA {
+		return redisPropertyStore{cfg.redis}
+	}
+	if cfg.properties != nil {
+		return cfg.properties
+	}
+	return nil
+}
+
+// redisPropertyStore keeps the properties of a file in a hash.
+type redisPropertyStore struct {
+	state *redisState
+}
+
+// key returns the key of the properties of the file.
+func (s redisPropertyStore) key(name string) string {
+	return s.state.prefix + "props:" + name
+}
+
+// keys returns the keys of the properties of the file and the files below it.
+func (s redisPropertyStore) keys(ctx context.Context, name string) ([]string, error) {
+	key := s.key(name)
+	keys := []string{key}
+	iter := s.state.client.Scan(ctx, 0, redisGlobEscaper.Replace(key)+"/*", 0).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// propertyField returns the field of the hash holding a property.
+func propertyField(name xml.Name) string {
+	return name.Space + " " + name.Local
+}
+
+func (s redisPropertyStore) props(ctx context.Context, name string) (map[xml.Name]webdav.Property, error) {
+	stored, err := s.state.client.HGetAll(ctx, s.key(name)).Result()
+	if err != nil {
+		return nil, err
+	}
+	props := map[xml.Name]webdav.Property{}
+	for _, value := range stored {
+		var p webdav.Property
+		if err := json.Unmarshal([]byte(value), &p); err == nil {
+			props[p.XMLName] = p
+		}
+	}
+	return props, nil
+}
+
+// patch sets and removes the properties in a single transaction.
+func (s redisPropertyStore) patch(ctx context.Context, name string, patches []webdav.Proppatch) error {
+	key := s.key(name)
+	_, err := s.state.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, patch := range patches {
+			for _, p := range patch.Props {
+				if patch.Remove {
+					pipe.HDel(ctx, key, propertyField(p.XMLName))
+					continue
+				}
+				value, err := json.Marshal(p)
+				if err != nil {
+					return err
+				}
+				pipe.HSet(ctx, key, propertyField(p.XMLName), value)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (s redisPropertyStore) remove(ctx context.Context, name string) error {
+	keys, err := s.keys(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.state.client.Del(ctx, keys...).Err()
+}
+
+func (s redisPropertyStore) move(ctx context.Context, oldName, newName string) error {
+	keys, err := s.keys(ctx, oldName)
+	if err != nil {
+		return err
+	}
+	oldKey, newKey := s.key(oldName), s.key(newName)
+	for _, key := range keys {
+		// Files without properties have no key
+		err := s.state.client.Rename(ctx, key, newKey+strings.TrimPrefix(key, oldKey)).Err()
+		if err != nil && !strings.Contains(err.Error(), "no such key") {
+			return err
+		}
+	}
+	return nil
+}
+
+// deadPropsFS serves the dead properties of the property store, which move along with the files.
+type deadPropsFS struct {
+	webdav.FileSystem
+	store  propertyStore
+	config *Config
+}
+
+// OpenFile opens the file with its dead properties. PROPPATCH opens files for writing, which isn't
+// possible for directories, so they're opened read-only.
+func (fs deadPropsFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag == os.O_RDWR {
+		if info, err := fs.FileSystem.Stat(ctx, name); err == nil && info.IsDir() {
+			flag = os.O_RDONLY
+		}
+	}
+	f, err := fs.FileSystem.OpenFile(ctx, name, flag, perm)
+	if err != nil || f == nil {
+		return f, err
+	}
+	return &deadPropsFile{File: f, store: fs.store, name: Resolve(ctx, name, Dir{fs.config})}, nil
+}
+
+// RemoveAll removes the file and the properties of everything removed.
+func (fs deadPropsFS) RemoveAll(ctx context.Context, name string) error {
+	if err := fs.FileSystem.RemoveAll(ctx, name); err != nil {
+		return err
+	}
+	if err := fs.store.remove(ctx, Resolve(ctx, name, Dir{fs.config})); err != nil {
+		log.WithError(err).WithField("path", name).Error("Error removing dead properties")
+	}
+	return nil
+}
+
+// Rename renames the file and moves the properties of everything renamed.
+func (fs deadPropsFS) Rename(ctx context.Context, oldName, newName string) error {
+	if err := fs.FileSystem.Rename(ctx, oldName, newName); err != nil {
+		return err
+	}
+	if err := fs.store.move(ctx, Resolve(ctx, oldName, Dir{fs.config}), Resolve(ctx, newName, Dir{fs.config})); err != nil {
+		log.WithError(err).WithField("path", oldName).Error("Error moving dead properties")
+	}
+	return nil
+}
+
+// deadPropsFile implements webdav.DeadPropsHolder with the properties of the property store.
+type deadPropsFile struct {
+	webdav.File
+	store propertyStore
+	name  string
+}
+
+// DeadProps returns the stored properties of the file.
+func (f *deadPropsFile) DeadProps() (map[xml.Name]webdav.Property, error) {
+	return f.store.props(context.Background(), f.name)
+}
+
+// Patch sets and removes the properties at once. The users who created and last modified the file are kept by
+// david and can't be patched.
+func (f *deadPropsFile) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			if p.XMLName == ownerProperty || p.XMLName == modifierProperty {
+				return []webdav.Propstat{{Status: http.StatusForbidden, Props: []webdav.Property{{XMLName: p.XMLName}}}}, nil
+			}
+		}
+	}
+	if err := f.store.patch(context.Background(), f.name, patches); err != nil {
+		return nil, err
+	}
+	pstat := webdav.Propstat{Status: http.StatusOK}
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			pstat.Props = append(pstat.Props, webdav.Property{XMLName: p.XMLName})
+		}
+	}
+	return []webdav.Propstat{pstat}, nil
+}
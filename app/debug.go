@@ -0,0 +1,57 @@
+package app
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+)
+
+// Debug configures the listener of the profiling and runtime endpoints. It must be bound separately from the
+// WebDAV listener, as the endpoints aren't protected by authentication and reveal the internals of the server.
+type Debug struct {
+	Address string
+}
+
+// Lookups of the caches by cache name, published on the debug listener.
+var (
+	cacheHits   = expvar.NewMap("cache_hits")
+	cacheMisses = expvar.NewMap("cache_misses")
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+	expvar.Publish("open_files", expvar.Func(func() any { return openFiles() }))
+}
+
+// cacheLookup counts a hit or a miss of the cache.
+func cacheLookup(cache string, hit bool) {
+	if hit {
+		cacheHits.Add(cache, 1)
+	} else {
+		cacheMisses.Add(cache, 1)
+	}
+}
+
+// openFiles returns the number of file descriptors of the process, -1 where it can't be determined.
+func openFiles() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
+
+// NewDebugHandler returns the handler of the debug listener.
+// It serves the profiles of net/http/pprof at /debug/pprof/ and the variables of expvar at /debug/vars.
+func NewDebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	cacheLookup("test", true)
+	cacheLookup("test", false)
+	cacheLookup("test", false)
+
+	handler := NewDebugHandler()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	var vars struct {
+		Goroutines  int            `json:"goroutines"`
+		CacheHits   map[string]int `json:"cache_hits"`
+		CacheMisses map[string]int `json:"cache_misses"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("error parsing variables: %v", err)
+	}
+	if vars.Goroutines == 0 || vars.CacheHits["test"] != 1 || vars.CacheMisses["test"] != 2 {
+		t.Errorf("variables = %+v", vars)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /debug/pprof/ = %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// Reasons of writes failing for lack of storage.
+const (
+	diskFullNoSpace = "no-space"
+	diskFullQuota   = "quota"
+)
+
+// diskFullAlertInterval limits how often the disk full hook runs while the disk stays full.
+const diskFullAlertInterval = time.Minute
+
+// lastDiskFullAlert is the unix time the disk full hook last ran.
+var lastDiskFullAlert atomic.Int64
+
+// noteDiskFull records err as failure of the request if it was caused by a full disk or quota, and returns it.
+// RFC 4331 defines the conditions of exhausted disks and quotas.
+func noteDiskFull(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch reason := diskFullReason(err); reason {
+	case diskFullNoSpace:
+		recordFailure(ctx, http.StatusInsufficientStorage, conditionSufficientDiskSpace, reason)
+	case diskFullQuota:
+		recordFailure(ctx, http.StatusInsufficientStorage, conditionQuotaNotExceeded, reason)
+	}
+	return err
+}
+
+// diskFullFile records failed writes of a file opened for writing.
+type diskFullFile struct {
+	webdav.File
+	ctx context.Context
+}
+
+// Write records a write failing for lack of storage.
+func (f *diskFullFile) Write(b []byte) (int, error) {
+	n, err := f.File.Write(b)
+	return n, noteDiskFull(f.ctx, err)
+}
+
+// Close records a flush failing for lack of storage, some file systems only report it then.
+func (f *diskFullFile) Close() error {
+	return noteDiskFull(f.ctx, f.File.Close())
+}
+
+// reportDiskFull logs and counts a request which failed for lack of storage, and runs the disk full hook
+// at most once per diskFullAlertInterval.
+func reportDiskFull(cfg *Config, username string, req *http.Request, reason string) {
+	log.WithFields(log.Fields{"user": username, "path": req.URL.Path, "reason": reason}).Error("Write failed for lack of storage")
+	metrics.Add("david_storage_full_total", "Writes failed for lack of disk space or quota.", 1, "reason", reason)
+
+	if cfg.Hooks.DiskFull == "" {
+		return
+	}
+	now := time.Now().Unix()
+	last := lastDiskFullAlert.Load()
+	if now-last < int64(diskFullAlertInterval/time.Second) || !lastDiskFullAlert.CompareAndSwap(last, now) {
+		return
+	}
+	event := &Event{
+		Operation: operationFromMethod(req.Method),
+		User:      username,
+		Path:      path.Clean("/" + strings.TrimPrefix(req.URL.Path, cfg.prefixOf(username))),
+		Size:      req.ContentLength,
+		Result:    reason,
+	}
+	go func() {
+		if err := runHook(cfg.Hooks.DiskFull, event, cfg.Hooks.Timeout); err != nil {
+			log.WithError(err).Error("Disk full hook failed")
+		}
+	}()
+}
@@ -0,0 +1,69 @@
+//go:build !windows
+
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+// fullStorage is a storage backend whose files fail all writes with err.
+type fullStorage struct {
+	osStorage
+	err error
+}
+
+// fullFile is a file failing all writes with err.
+type fullFile struct {
+	*os.File
+	err error
+}
+
+func (f *fullFile) Write(b []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.Name(), Err: f.err}
+}
+
+func (s fullStorage) OpenFile(name string, flag int, perm os.FileMode) (webdav.File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &fullFile{File: f, err: s.err}, nil
+}
+
+func TestServeWebdavDiskFull(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		status    int
+		condition string
+	}{
+		{"no space", syscall.ENOSPC, http.StatusInsufficientStorage, "<D:sufficient-disk-space/>"},
+		{"quota", syscall.EDQUOT, http.StatusInsufficientStorage, "<D:quota-not-exceeded/>"},
+		{"other error", syscall.EIO, http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Dir:     t.TempDir(),
+				Log:     Logging{Create: true},
+				Users:   map[string]*UserInfo{"foo": {Crud: newCrudType("crud")}},
+				storage: fullStorage{err: tt.err},
+			}
+			a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+			ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "foo", Authenticated: true})
+			w := httptest.NewRecorder()
+			serveWebdav(a, ctx, w, httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("abc")), "foo")
+			if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.condition) {
+				t.Errorf("PUT = %d %s, want %d with %s", w.Code, w.Body.String(), tt.status, tt.condition)
+			}
+		})
+	}
+}
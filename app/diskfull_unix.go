@@ -0,0 +1,19 @@
+//go:build !windows
+
+package app
+
+import (
+	"errors"
+	"syscall"
+)
+
+// diskFullReason reports whether err was caused by a full disk (no-space) or an exhausted quota (quota).
+func diskFullReason(err error) string {
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		return diskFullNoSpace
+	case errors.Is(err, syscall.EDQUOT):
+		return diskFullQuota
+	}
+	return ""
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package app
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows error codes of full disks and exhausted quotas, not exported by the syscall package.
+const (
+	errorHandleDiskFull    = syscall.Errno(39)
+	errorDiskFull          = syscall.Errno(112)
+	errorDiskQuotaExceeded = syscall.Errno(1295)
+)
+
+// diskFullReason reports whether err was caused by a full disk (no-space) or an exhausted quota (quota).
+func diskFullReason(err error) string {
+	switch {
+	case errors.Is(err, errorDiskFull), errors.Is(err, errorHandleDiskFull):
+		return diskFullNoSpace
+	case errors.Is(err, errorDiskQuotaExceeded):
+		return diskFullQuota
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+package app
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Results of the checks of the doctor.
+const (
+	DoctorOK   = "ok"
+	DoctorWarn = "warn"
+	DoctorFail = "fail"
+)
+
+// clockSkew is how far in the future a modification time may be before the clock is taken to be behind.
+const clockSkew = 5 * time.Minute
+
+// DoctorCheck is the result of one check of the environment, with a hint how to fix it if it didn't pass.
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// Doctor checks the environment the configuration is served in: the base directories of the server and its
+// tenants exist and are writable, the user subdirs resolve inside them, the TLS files form a valid pair,
+// the ports can be bound and the clock is sane.
+func Doctor(cfg *Config) []DoctorCheck {
+	var checks []DoctorCheck
+	checks = append(checks, doctorDirs(cfg, "")...)
+	hosts := make([]string, 0, len(cfg.TenantConfigs()))
+	for host := range cfg.TenantConfigs() {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		checks = append(checks, doctorDirs(cfg.TenantConfigs()[host], host+": ")...)
+	}
+	checks = append(checks, doctorTLS(cfg)...)
+	checks = append(checks, doctorListen("listener", cfg.Address, cfg.Port))
+	if cfg.HTTP != nil {
+		checks = append(checks, doctorListen("http listener", cfg.HTTP.Address, cfg.HTTP.Port))
+	}
+	checks = append(checks, doctorClock(cfg.Dir, time.Now()))
+	return checks
+}
+
+// doctorDirs checks the base directory of cfg and the subdirs of its users, label prefixes the check names.
+func doctorDirs(cfg *Config, label string) []DoctorCheck {
+	info, err := os.Stat(cfg.Dir)
+	switch {
+	case err != nil:
+		return []DoctorCheck{{label + "base dir", DoctorFail, err.Error(), "create the directory or fix dir in the configuration"}}
+	case !info.IsDir():
+		return []DoctorCheck{{label + "base dir", DoctorFail, cfg.Dir + " is not a directory", "point dir in the configuration to a directory"}}
+	}
+	checks := []DoctorCheck{doctorWritable(label+"base dir", cfg.Dir)}
+
+	usernames := make([]string, 0, len(cfg.Users))
+	for username := range cfg.Users {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	for _, username := range usernames {
+		name := label + "subdir of " + username
+		subdir, ok := cfg.subdirOf(username, cfg.Users[username])
+		if !ok {
+			checks = append(checks, DoctorCheck{name, DoctorWarn, "the subdir policy denies the user all files", "set a subdir for the user or change subdirPolicy"})
+			continue
+		}
+		if subdir == "" {
+			continue
+		}
+		root := filepath.Join(cfg.Dir, subdir)
+		if !withinDir(cfg.Dir, root) {
+			checks = append(checks, DoctorCheck{name, DoctorFail, root + " is outside of the base dir", "use a subdir relative to the base dir"})
+			continue
+		}
+		info, err := os.Stat(root)
+		switch {
+		case os.IsNotExist(err) && cfg.SubdirPolicy == subdirPolicyAuto && cfg.Users[username].Subdir == nil:
+			checks = append(checks, DoctorCheck{name, DoctorOK, root + " is created on the first request", ""})
+		case err != nil:
+			checks = append(checks, DoctorCheck{name, DoctorFail, err.Error(), "create the directory or fix the subdir of the user"})
+		case !info.IsDir():
+			checks = append(checks, DoctorCheck{name, DoctorFail, root + " is not a directory", "fix the subdir of the user"})
+		default:
+			checks = append(checks, doctorWritable(name, root))
+		}
+	}
+	return checks
+}
+
+// doctorWritable checks that the runtime user can create files in dir.
+func doctorWritable(name, dir string) DoctorCheck {
+	f, err := os.CreateTemp(dir, ".david-doctor-")
+	if err != nil {
+		return DoctorCheck{name, DoctorFail, dir + " is not writable: " + err.Error(), fmt.Sprintf("grant user %d write access to the directory", os.Getuid())}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return DoctorCheck{name, DoctorOK, dir + " is writable", ""}
+}
+
+// doctorTLS checks that the certificate and key files of the server and its tenants form valid pairs.
+func doctorTLS(cfg *Config) []DoctorCheck {
+	files := map[string]*TLS{"tls": cfg.TLS}
+	for _, tenant := range cfg.Tenants {
+		if tenant.TLS != nil {
+			files["tls of "+tenant.Host] = tenant.TLS
+		}
+	}
+	names := make([]string, 0, len(files))
+	for name, f := range files {
+		if f != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var checks []DoctorCheck
+	for _, name := range names {
+		f := files[name]
+		certificate, err := f.keyPair()
+		if err != nil {
+			checks = append(checks, DoctorCheck{name, DoctorFail, err.Error(), "check that certFile and keyFile are readable PEM files of the same key"})
+			continue
+		}
+		leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			checks = append(checks, DoctorCheck{name, DoctorFail, err.Error(), "replace the certificate"})
+			continue
+		}
+		switch now := time.Now(); {
+		case now.After(leaf.NotAfter):
+			checks = append(checks, DoctorCheck{name, DoctorFail, "certificate expired on " + leaf.NotAfter.Format(time.DateOnly), "renew the certificate"})
+		case now.Before(leaf.NotBefore):
+			checks = append(checks, DoctorCheck{name, DoctorFail, "certificate is valid from " + leaf.NotBefore.Format(time.DateOnly), "check the clock or the certificate"})
+		case leaf.NotAfter.Sub(now) < 14*24*time.Hour:
+			checks = append(checks, DoctorCheck{name, DoctorWarn, "certificate expires on " + leaf.NotAfter.Format(time.DateOnly), "renew the certificate"})
+		default:
+			checks = append(checks, DoctorCheck{name, DoctorOK, "certificate and key match, valid until " + leaf.NotAfter.Format(time.DateOnly), ""})
+		}
+	}
+	if cfg.TLS != nil && cfg.TLS.ClientCAFile != "" {
+		if _, err := loadCertPool(cfg.TLS.ClientCAFile); err != nil {
+			checks = append(checks, DoctorCheck{"tls client ca", DoctorFail, err.Error(), "check clientCAFile"})
+		} else {
+			checks = append(checks, DoctorCheck{"tls client ca", DoctorOK, cfg.TLS.ClientCAFile + " is valid", ""})
+		}
+	}
+	return checks
+}
+
+// doctorListen checks that the address can be bound, which fails if david already runs.
+func doctorListen(name, address, port string) DoctorCheck {
+	addr := net.JoinHostPort(address, port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return DoctorCheck{name, DoctorFail, err.Error(), "stop the process using " + addr + ", choose another port or grant the permission to bind it"}
+	}
+	listener.Close()
+	return DoctorCheck{name, DoctorOK, addr + " can be bound", ""}
+}
+
+// doctorClock checks that the clock isn't behind the modification time of dir, which presigned links and
+// the validity of certificates and SAML assertions depend on.
+func doctorClock(dir string, now time.Time) DoctorCheck {
+	if now.Year() < 2020 {
+		return DoctorCheck{"clock", DoctorFail, "the clock is at " + now.Format(time.RFC3339), "synchronize the clock, e.g. with NTP"}
+	}
+	if info, err := os.Stat(dir); err == nil && info.ModTime().Sub(now) > clockSkew {
+		return DoctorCheck{"clock", DoctorFail, fmt.Sprintf("%s was modified %s in the future", dir, info.ModTime().Sub(now).Round(time.Second)), "synchronize the clock, e.g. with NTP"}
+	}
+	return DoctorCheck{"clock", DoctorOK, now.Format(time.RFC3339), ""}
+}
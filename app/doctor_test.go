@@ -0,0 +1,72 @@
+package app
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDoctor(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "alice"), 0700)
+	alice, bob := "/alice", "/bob"
+	cfg := &Config{
+		Dir:     dir,
+		Address: "127.0.0.1",
+		Port:    "0",
+		Users: map[string]*UserInfo{
+			"alice": {Subdir: &alice},
+			"bob":   {Subdir: &bob},
+			"carol": {},
+		},
+		SubdirPolicy: subdirPolicyAuto,
+	}
+	results := map[string]string{}
+	for _, check := range Doctor(cfg) {
+		results[check.Name] = check.Result
+		if check.Result != DoctorOK && check.Fix == "" {
+			t.Errorf("check %s has no fix", check.Name)
+		}
+	}
+	want := map[string]string{
+		"base dir":        DoctorOK,
+		"subdir of alice": DoctorOK,
+		"subdir of bob":   DoctorFail,
+		"subdir of carol": DoctorOK,
+		"listener":        DoctorOK,
+		"clock":           DoctorOK,
+	}
+	for name, result := range want {
+		if results[name] != result {
+			t.Errorf("check %s = %q, want %q", name, results[name], result)
+		}
+	}
+}
+
+func TestDoctorListen(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	if check := doctorListen("listener", "127.0.0.1", port); check.Result != DoctorFail {
+		t.Errorf("doctorListen() of a bound port = %q, want %q", check.Result, DoctorFail)
+	}
+}
+
+func TestDoctorClock(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	if check := doctorClock(dir, now); check.Result != DoctorOK {
+		t.Errorf("doctorClock() = %q, want %q", check.Result, DoctorOK)
+	}
+	if check := doctorClock(dir, now.Add(-time.Hour)); check.Result != DoctorFail {
+		t.Errorf("doctorClock() of a clock behind = %q, want %q", check.Result, DoctorFail)
+	}
+	if check := doctorClock(dir, time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)); check.Result != DoctorFail {
+		t.Errorf("doctorClock() in 1970 = %q, want %q", check.Result, DoctorFail)
+	}
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// clientEncryptedHeader marks an upload as encrypted by the client, and is returned for the files marked so.
+const clientEncryptedHeader = "X-Client-Encrypted"
+
+// nextcloudNamespace is the XML namespace of the properties of Nextcloud clients.
+const nextcloudNamespace = "http://nextcloud.org/ns"
+
+// Dead properties of clients which encrypt files before uploading them. The flags mark files and directories
+// (with everything below them) as encrypted, the metadata holds the keys of the client, encrypted as well.
+var (
+	encryptedProperty          = xml.Name{Space: davidNamespace, Local: "encrypted"}
+	encryptionMetadataProperty = xml.Name{Space: davidNamespace, Local: "encryption-metadata"}
+	nextcloudEncryptedProperty = xml.Name{Space: nextcloudNamespace, Local: "is-encrypted"}
+)
+
+// clientEncryptedKey marks the upload of a request with the header of client side encryption in the context.
+var clientEncryptedKey contextKey = 6
+
+// opaqueProperties are the properties holding data only the clients can read, which aren't indexed.
+var opaqueProperties = map[xml.Name]bool{encryptionMetadataProperty: true}
+
+// isEncryptedFlag reports whether a flag property is set.
+func isEncryptedFlag(p webdav.Property) bool {
+	switch strings.ToLower(propertyText(p)) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// clientEncrypted reports whether the physical path or a directory above it up to the base directory is marked
+// as encrypted by its client. Their content is left alone: it isn't indexed, stripped or thumbnailed.
+func (cfg *Config) clientEncrypted(ctx context.Context, name string) bool {
+	if encrypted, _ := ctx.Value(clientEncryptedKey).(bool); encrypted {
+		return true
+	}
+	store := cfg.propertyStore()
+	if store == nil {
+		return false
+	}
+	root := filepath.Clean(cfg.Dir)
+	for name = filepath.Clean(name); ; name = filepath.Dir(name) {
+		props, err := store.props(ctx, name)
+		if err != nil {
+			log.WithError(err).WithField("path", name).Warn("Error reading dead properties")
+			return false
+		}
+		for _, flag := range []xml.Name{encryptedProperty, nextcloudEncryptedProperty} {
+			if p, ok := props[flag]; ok && isEncryptedFlag(p) {
+				return true
+			}
+		}
+		if name == root || filepath.Dir(name) == name {
+			return false
+		}
+		if _, ok := cfg.relPath(name); !ok {
+			return false
+		}
+	}
+}
+
+// markClientEncrypted flags the file uploaded with the header of client side encryption as encrypted.
+func markClientEncrypted(a *App, ctx context.Context, req *http.Request, prefix string) {
+	if req.Method != http.MethodPut || !strings.EqualFold(req.Header.Get(clientEncryptedHeader), "true") {
+		return
+	}
+	store := a.Config.propertyStore()
+	if store == nil {
+		return
+	}
+	name := Resolve(ctx, strings.TrimPrefix(req.URL.Path, prefix), Dir{a.Config})
+	patch := []webdav.Proppatch{{Props: []webdav.Property{textProperty(encryptedProperty, "true")}}}
+	if err := store.patch(ctx, name, patch); err != nil {
+		log.WithError(err).WithField("path", name).Error("Error marking file as encrypted")
+		return
+	}
+	if a.Config.indexer != nil {
+		a.Config.indexer.enqueue(indexUpdate{meta: name})
+	}
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestClientEncryption(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "vault"), 0700)
+	store, err := openPropertyStore(&Properties{File: filepath.Join(t.TempDir(), "props.db")})
+	if err != nil {
+		t.Fatalf("openPropertyStore() error = %v", err)
+	}
+	cfg := &Config{
+		Dir:           dir,
+		Log:           Logging{Create: true},
+		StripMetadata: []string{"/"},
+		Users:         map[string]*UserInfo{"foo": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")}},
+		properties:    store,
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	serve := func(method, path, body string, headers ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.SetBasicAuth("foo", "password")
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		if method != http.MethodGet {
+			handle(context.Background(), w, r, a)
+			return w
+		}
+		// GET is served by the webdav handler directly
+		ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "foo", Authenticated: true, CrudType: newCrudType("crud")})
+		serveWebdav(a, ctx, w, r, "foo")
+		return w
+	}
+	const patch = `<?xml version="1.0"?><D:propertyupdate xmlns:D="DAV:" xmlns:nc="http://nextcloud.org/ns" xmlns:david="https://github.com/audstanley/david">
+		<D:set><D:prop><nc:is-encrypted>1</nc:is-encrypted><david:encryption-metadata>eyJrZXlzIjpbXX0=</david:encryption-metadata></D:prop></D:set></D:propertyupdate>`
+	const propfind = `<?xml version="1.0"?><D:propfind xmlns:D="DAV:" xmlns:nc="http://nextcloud.org/ns" xmlns:david="https://github.com/audstanley/david">
+		<D:prop><nc:is-encrypted/><david:encrypted/><david:encryption-metadata/></D:prop></D:propfind>`
+	image := string(testJPEG())
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		headers  []string
+		want     int
+		contains string
+	}{
+		{"upload marked as encrypted", http.MethodPut, "/photo.jpg", image, []string{clientEncryptedHeader, "true"}, http.StatusCreated, ""},
+		{"flag of upload", "PROPFIND", "/photo.jpg", propfind, []string{"Depth", "0"}, http.StatusMultiStatus, "<encrypted xmlns=\"https://github.com/audstanley/david\">true</encrypted>"},
+		{"mark directory", "PROPPATCH", "/vault", patch, nil, http.StatusMultiStatus, "200 OK"},
+		{"metadata round-trips", "PROPFIND", "/vault", propfind, []string{"Depth", "0"}, http.StatusMultiStatus, "eyJrZXlzIjpbXX0="},
+		{"upload to encrypted directory", http.MethodPut, "/vault/photo.jpg", image, nil, http.StatusCreated, ""},
+		{"header of encrypted file", http.MethodGet, "/vault/photo.jpg", "", nil, http.StatusOK, ""},
+		{"upload of plain image", http.MethodPut, "/plain.jpg", image, nil, http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.method, tt.path, tt.body, tt.headers...)
+			if w.Code != tt.want {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body.String(), tt.want)
+			}
+			if !strings.Contains(w.Body.String(), tt.contains) {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.contains)
+			}
+			if tt.method == http.MethodGet && w.Header().Get(clientEncryptedHeader) != "true" {
+				t.Errorf("%s header is missing", clientEncryptedHeader)
+			}
+		})
+	}
+
+	// The content of encrypted files is never altered
+	for name, kept := range map[string]bool{"photo.jpg": true, "vault/photo.jpg": true, "plain.jpg": false} {
+		content, _ := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if got := bytes.Equal(content, []byte(image)); got != kept {
+			t.Errorf("content of %s kept = %v, want %v", name, got, kept)
+		}
+	}
+}
@@ -0,0 +1,535 @@
+package app
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/net/webdav"
+)
+
+// Layout of encrypted files: a header with a random file id, followed by the chunks of the content sealed
+// with AES-GCM under a key derived from the key of the user and the file id.
+const (
+	encryptionMagic     = "DAVIDENC"
+	encryptionVersion   = 1
+	encryptionFileID    = 16
+	encryptionHeader    = len(encryptionMagic) + 1 + encryptionFileID
+	encryptionChunkSize = 64 << 10
+	encryptionTagSize   = 16
+	encryptionKeySize   = 32
+)
+
+// Parameters of the Argon2id derivation of the key wrapping the key of a user from their password.
+const (
+	encryptionKDFTime    = 2
+	encryptionKDFMemory  = 19 << 10
+	encryptionKDFThreads = 1
+)
+
+// encryptionKeyKey holds the key of the files of an encrypted user in the request context.
+var encryptionKeyKey contextKey = 5
+
+// errEncryptionLocked is returned for encrypted users whose key isn't available.
+var errEncryptionLocked = errors.New("encryption key isn't available")
+
+// Encryption configures the directory Keys holding the wrapped keys of the users whose files are encrypted.
+type Encryption struct {
+	Keys string
+}
+
+// tenant returns the encryption of a tenant, whose keys are kept in a subdirectory named after its host.
+func (e *Encryption) tenant(host string) *Encryption {
+	if e == nil {
+		return nil
+	}
+	return &Encryption{Keys: filepath.Join(e.Keys, host)}
+}
+
+// wrappedKey is the random key of a user sealed with the key derived from their password, as stored in the
+// key directory.
+type wrappedKey struct {
+	Salt []byte `json:"salt"`
+	Key  []byte `json:"key"`
+}
+
+// unlockedKey is a key of a user kept in memory, with a MAC of the password which unlocked it.
+type unlockedKey struct {
+	key      []byte
+	password []byte
+}
+
+// unlockedKeys caches the keys of the users by the file of their wrapped key, deriving them is slow on purpose.
+var unlockedKeys sync.Map
+
+// encrypts reports whether the files of the user are encrypted.
+func (cfg *Config) encrypts(username string) bool {
+	user := cfg.user(username)
+	return user != nil && (user.Encrypt || user.KeyFile != "")
+}
+
+// readKeyFile reads a key of 32 bytes, raw or hex encoded.
+func readKeyFile(name string) ([]byte, error) {
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := hex.DecodeString(strings.TrimSpace(string(content))); err == nil && len(key) == encryptionKeySize {
+		return key, nil
+	}
+	if len(content) != encryptionKeySize {
+		return nil, errors.New("key file must hold 32 bytes")
+	}
+	return content, nil
+}
+
+// sealKey seals data with AES-GCM under key, the nonce is prepended.
+func sealKey(key, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// openKey opens data sealed by sealKey.
+func openKey(key, sealed []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("invalid wrapped key")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+// newAEAD returns AES-GCM with the key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// userKey returns the key of the files of the user. It's read from the key file of the user, or else unwrapped
+// with their password, a random key is created and wrapped on their first login.
+func (cfg *Config) userKey(username, password string) ([]byte, error) {
+	user := cfg.user(username)
+	if user == nil || !cfg.encrypts(username) {
+		return nil, nil
+	}
+	if user.KeyFile != "" {
+		return readKeyFile(user.KeyFile)
+	}
+	if password == "" || cfg.Encryption == nil {
+		return nil, errEncryptionLocked
+	}
+	name := filepath.Join(cfg.Encryption.Keys, username+".key")
+	if cached, ok := unlockedKeys.Load(name); ok {
+		mac := hmac.New(sha256.New, cached.(*unlockedKey).key)
+		mac.Write([]byte(password))
+		if hmac.Equal(mac.Sum(nil), cached.(*unlockedKey).password) {
+			cacheLookup("keys", true)
+			return cached.(*unlockedKey).key, nil
+		}
+	}
+	cacheLookup("keys", false)
+	var key []byte
+	content, err := os.ReadFile(name)
+	switch {
+	case err == nil:
+		var wrapped wrappedKey
+		if err := json.Unmarshal(content, &wrapped); err != nil {
+			return nil, err
+		}
+		kek := argon2.IDKey([]byte(password), wrapped.Salt, encryptionKDFTime, encryptionKDFMemory, encryptionKDFThreads, encryptionKeySize)
+		if key, err = openKey(kek, wrapped.Key); err != nil {
+			return nil, errors.New("wrapped key doesn't match the password")
+		}
+	case errors.Is(err, os.ErrNotExist):
+		key = make([]byte, encryptionKeySize)
+		wrapped := wrappedKey{Salt: make([]byte, 16)}
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if _, err := rand.Read(wrapped.Salt); err != nil {
+			return nil, err
+		}
+		kek := argon2.IDKey([]byte(password), wrapped.Salt, encryptionKDFTime, encryptionKDFMemory, encryptionKDFThreads, encryptionKeySize)
+		if wrapped.Key, err = sealKey(kek, key); err != nil {
+			return nil, err
+		}
+		content, err := json.Marshal(wrapped)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(cfg.Encryption.Keys, 0o700); err != nil {
+			return nil, err
+		}
+		// The key must never be replaced, the files encrypted with it would be lost
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(content); err != nil {
+			f.Close()
+			os.Remove(name)
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(password))
+	unlockedKeys.Store(name, &unlockedKey{key: key, password: mac.Sum(nil)})
+	return key, nil
+}
+
+// encryptionKeyOf returns the key of the authenticated user in the context, or nil.
+func encryptionKeyOf(ctx context.Context) []byte {
+	key, _ := ctx.Value(encryptionKeyKey).([]byte)
+	return key
+}
+
+// userFileSystem returns the file system serving the files of a user outside of their own requests, like the
+// ones of pre-signed urls and share links: their Dir, encrypted with their key file if their files are
+// encrypted. Keys wrapped with the password of the user aren't available then, errEncryptionLocked is returned.
+func (cfg *Config) userFileSystem(username string) (webdav.FileSystem, error) {
+	fs := webdav.FileSystem(Dir{cfg})
+	if !cfg.encrypts(username) {
+		return fs, nil
+	}
+	key, err := cfg.userKey(username, "")
+	if err != nil {
+		return nil, err
+	}
+	return encryptedFS{FileSystem: fs, key: key}, nil
+}
+
+// encryptedFS encrypts the content of the files written to the wrapped file system with the key of the user,
+// and decrypts them when read. Files without the header of encrypted files are served as they are, like the
+// ones written before encryption was enabled.
+type encryptedFS struct {
+	webdav.FileSystem
+	key []byte
+}
+
+// encryptedSize returns the size of the content of an encrypted file of the given size.
+func encryptedSize(size int64) int64 {
+	rest := size - int64(encryptionHeader)
+	chunks, last := rest/(encryptionChunkSize+encryptionTagSize), rest%(encryptionChunkSize+encryptionTagSize)
+	if last > 0 {
+		last -= encryptionTagSize
+	}
+	return chunks*encryptionChunkSize + max(last, 0)
+}
+
+// readHeader reads the header of the file and returns its file id, or nil if it isn't encrypted.
+func readHeader(f io.ReadSeeker) ([]byte, error) {
+	header := make([]byte, encryptionHeader)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	n, err := io.ReadFull(f, header)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n != encryptionHeader || string(header[:len(encryptionMagic)]) != encryptionMagic || header[len(encryptionMagic)] != encryptionVersion {
+		return nil, nil
+	}
+	return header[len(encryptionMagic)+1:], nil
+}
+
+// encryptedInfo is the information of an encrypted file with the size of its content.
+type encryptedInfo struct {
+	os.FileInfo
+	size int64
+}
+
+// Size returns the size of the content.
+func (fi encryptedInfo) Size() int64 {
+	return fi.size
+}
+
+// stat returns the information of the file with the size of its content if it's encrypted.
+func (fs encryptedFS) stat(ctx context.Context, name string, info os.FileInfo) (os.FileInfo, error) {
+	if info.IsDir() || info.Size() < int64(encryptionHeader) {
+		return info, nil
+	}
+	f, err := fs.FileSystem.OpenFile(ctx, name, os.O_RDONLY, 0)
+	if err != nil || f == nil {
+		return info, err
+	}
+	defer f.Close()
+	id, err := readHeader(f)
+	if err != nil || id == nil {
+		return info, err
+	}
+	return encryptedInfo{FileInfo: info, size: encryptedSize(info.Size())}, nil
+}
+
+// Stat returns the file information with the size of the content.
+func (fs encryptedFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	info, err := fs.FileSystem.Stat(ctx, name)
+	if err != nil || info == nil {
+		return info, err
+	}
+	return fs.stat(ctx, name, info)
+}
+
+// OpenFile opens the file for decryption, or for encryption if it's truncated by the opening.
+func (fs encryptedFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	f, err := fs.FileSystem.OpenFile(ctx, name, flag, perm)
+	if err != nil || f == nil {
+		return f, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		return &encryptedDir{File: f, fs: fs, ctx: ctx, name: name}, nil
+	}
+	if flag&os.O_TRUNC != 0 && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		id := make([]byte, encryptionFileID)
+		if _, err := rand.Read(id); err != nil {
+			f.Close()
+			return nil, err
+		}
+		header := append(append([]byte(encryptionMagic), encryptionVersion), id...)
+		if _, err := f.Write(header); err != nil {
+			f.Close()
+			return nil, err
+		}
+		ef, err := newEncryptedFile(f, fs.key, id)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		ef.writing = true
+		return ef, nil
+	}
+	id, err := readHeader(f)
+	if err == nil && id == nil {
+		_, err = f.Seek(0, io.SeekStart)
+		return f, err
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ef, err := newEncryptedFile(f, fs.key, id)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ef.size = encryptedSize(info.Size())
+	ef.stored = info.Size()
+	return ef, nil
+}
+
+// encryptedDir lists the entries of a directory with the sizes of their content.
+type encryptedDir struct {
+	webdav.File
+	fs   encryptedFS
+	ctx  context.Context
+	name string
+}
+
+// Readdir returns the entries with the sizes of their content.
+func (d *encryptedDir) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := d.File.Readdir(count)
+	for i, info := range infos {
+		if decrypted, statErr := d.fs.stat(d.ctx, path.Join(d.name, info.Name()), info); statErr == nil {
+			infos[i] = decrypted
+		}
+	}
+	return infos, err
+}
+
+// encryptedFile reads and writes the content of an encrypted file. Writing is sequential, the last chunk is
+// sealed as such on Close, so truncated files are detected.
+type encryptedFile struct {
+	webdav.File
+	aead    cipher.AEAD
+	writing bool
+	// Reading
+	size   int64
+	stored int64
+	offset int64
+	chunk  int64
+	plain  []byte
+	// Writing
+	buffer  []byte
+	index   int64
+	written int64
+}
+
+// newEncryptedFile returns the encrypted file with the key of the file id.
+func newEncryptedFile(f webdav.File, key, id []byte) (*encryptedFile, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(id)
+	aead, err := newAEAD(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedFile{File: f, aead: aead, chunk: -1}, nil
+}
+
+// chunkNonce returns the nonce and additional data of a chunk, which bind it to its position and mark the last one.
+func chunkNonce(index int64, last bool) ([]byte, []byte) {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], uint64(index))
+	additional := append(append([]byte{}, nonce...), 0)
+	if last {
+		additional[len(additional)-1] = 1
+	}
+	return nonce, additional
+}
+
+// load decrypts the chunk of the given index.
+func (f *encryptedFile) load(index int64) error {
+	if f.chunk == index {
+		return nil
+	}
+	offset := int64(encryptionHeader) + index*(encryptionChunkSize+encryptionTagSize)
+	sealed := make([]byte, min(encryptionChunkSize+encryptionTagSize, f.stored-offset))
+	if _, err := f.File.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(f.File, sealed); err != nil {
+		return err
+	}
+	nonce, additional := chunkNonce(index, offset+int64(len(sealed)) == f.stored)
+	plain, err := f.aead.Open(sealed[:0], nonce, sealed, additional)
+	if err != nil {
+		return errors.New("encrypted file is corrupt")
+	}
+	f.chunk, f.plain = index, plain
+	return nil
+}
+
+// Read decrypts the content at the current offset.
+func (f *encryptedFile) Read(p []byte) (int, error) {
+	if f.writing {
+		return 0, os.ErrInvalid
+	}
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	index := f.offset / encryptionChunkSize
+	if err := f.load(index); err != nil {
+		return 0, err
+	}
+	n := copy(p, f.plain[f.offset-index*encryptionChunkSize:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+// Seek sets the offset of reading in the content.
+func (f *encryptedFile) Seek(offset int64, whence int) (int64, error) {
+	if f.writing {
+		if offset == 0 && whence == io.SeekCurrent {
+			return f.written, nil
+		}
+		return 0, os.ErrInvalid
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// flush seals the buffered chunk and writes it.
+func (f *encryptedFile) flush(last bool) error {
+	nonce, additional := chunkNonce(f.index, last)
+	if _, err := f.File.Write(f.aead.Seal(nil, nonce, f.buffer, additional)); err != nil {
+		return err
+	}
+	f.index++
+	f.buffer = f.buffer[:0]
+	return nil
+}
+
+// Write encrypts the content, a full chunk is only written once more content follows.
+func (f *encryptedFile) Write(p []byte) (int, error) {
+	if !f.writing {
+		return 0, os.ErrInvalid
+	}
+	var n int
+	for len(p) > 0 {
+		if len(f.buffer) == encryptionChunkSize {
+			if err := f.flush(false); err != nil {
+				return n, err
+			}
+		}
+		if f.buffer == nil {
+			f.buffer = make([]byte, 0, encryptionChunkSize)
+		}
+		copied := copy(f.buffer[len(f.buffer):encryptionChunkSize], p)
+		f.buffer = f.buffer[:len(f.buffer)+copied]
+		p = p[copied:]
+		n += copied
+	}
+	f.written += int64(n)
+	return n, nil
+}
+
+// Stat returns the information of the file with the size of its content.
+func (f *encryptedFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if f.writing {
+		return encryptedInfo{FileInfo: info, size: f.written}, nil
+	}
+	return encryptedInfo{FileInfo: info, size: f.size}, nil
+}
+
+// Close seals the last chunk of a written file before closing it.
+func (f *encryptedFile) Close() error {
+	var err error
+	if f.writing {
+		err = f.flush(true)
+		f.writing = false
+	}
+	if closeErr := f.File.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestEncryptedSize(t *testing.T) {
+	header := int64(encryptionHeader)
+	tests := []struct {
+		name    string
+		content int64
+	}{
+		{"empty", 0},
+		{"single byte", 1},
+		{"full chunk", encryptionChunkSize},
+		{"more than a chunk", encryptionChunkSize + 1},
+		{"several chunks", 3*encryptionChunkSize + 42},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := (tt.content + encryptionChunkSize - 1) / encryptionChunkSize
+			if chunks == 0 {
+				chunks = 1
+			}
+			if got := encryptedSize(header + tt.content + chunks*encryptionTagSize); got != tt.content {
+				t.Errorf("encryptedSize() = %d, want %d", got, tt.content)
+			}
+		})
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	dir := t.TempDir()
+	keys := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "plain.txt"), []byte("written before encryption"), 0600)
+	content := make([]byte, 2*encryptionChunkSize+1000)
+	rand.Read(content)
+	cfg := &Config{
+		Dir:        dir,
+		Log:        Logging{Create: true},
+		Encryption: &Encryption{Keys: keys},
+		Users: map[string]*UserInfo{
+			"foo": {Password: GenHash([]byte("password")), Crud: newCrudType("crud"), Encrypt: true},
+		},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	serve := func(method, path string, body []byte, headers ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, bytes.NewReader(body))
+		r.SetBasicAuth("foo", "password")
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		if method != http.MethodGet {
+			handle(context.Background(), w, r, a)
+			return w
+		}
+		// GET is served by the webdav handler directly
+		ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "foo", Authenticated: true, CrudType: newCrudType("crud")})
+		if key, err := cfg.userKey("foo", "password"); err == nil && key != nil {
+			ctx = context.WithValue(ctx, encryptionKeyKey, key)
+		}
+		serveWebdav(a, ctx, w, r, "foo")
+		return w
+	}
+
+	if w := serve(http.MethodPut, "/secret.bin", content); w.Code != http.StatusCreated {
+		t.Fatalf("PUT = %d, want %d", w.Code, http.StatusCreated)
+	}
+	stored, _ := os.ReadFile(filepath.Join(dir, "secret.bin"))
+	if !bytes.HasPrefix(stored, []byte(encryptionMagic)) || bytes.Contains(stored, content[:64]) {
+		t.Errorf("stored file isn't encrypted")
+	}
+	if _, err := os.Stat(filepath.Join(keys, "foo.key")); err != nil {
+		t.Errorf("wrapped key wasn't stored: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers []string
+		want    int
+		body    []byte
+	}{
+		{"read", http.MethodGet, "/secret.bin", nil, http.StatusOK, content},
+		{"read range across chunks", http.MethodGet, "/secret.bin", []string{"Range", "bytes=65530-65545"}, http.StatusPartialContent, content[65530:65546]},
+		{"read end", http.MethodGet, "/secret.bin", []string{"Range", "bytes=-10"}, http.StatusPartialContent, content[len(content)-10:]},
+		{"read file written before encryption", http.MethodGet, "/plain.txt", nil, http.StatusOK, []byte("written before encryption")},
+		{"size of content", "PROPFIND", "/", []string{"Depth", "1"}, http.StatusMultiStatus, []byte("<D:getcontentlength>132072</D:getcontentlength>")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.method, tt.path, nil, tt.headers...)
+			if w.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+			}
+			if tt.method == http.MethodGet && !bytes.Equal(w.Body.Bytes(), tt.body) {
+				t.Errorf("body differs from the content")
+			}
+			if tt.method != http.MethodGet && !bytes.Contains(w.Body.Bytes(), tt.body) {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.body)
+			}
+		})
+	}
+
+	t.Run("wrong key", func(t *testing.T) {
+		f, err := encryptedFS{FileSystem: Dir{Config: cfg}, key: make([]byte, encryptionKeySize)}.OpenFile(
+			context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "foo", Authenticated: true}), "/secret.bin", os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatalf("OpenFile() error = %v", err)
+		}
+		defer f.Close()
+		if _, err := io.ReadAll(f); err == nil || !strings.Contains(err.Error(), "corrupt") {
+			t.Errorf("ReadAll() error = %v, want corrupt", err)
+		}
+	})
+	t.Run("truncated file", func(t *testing.T) {
+		os.WriteFile(filepath.Join(dir, "secret.bin"), stored[:len(stored)-1000-encryptionTagSize], 0600)
+		w := serve(http.MethodGet, "/secret.bin", nil)
+		if w.Code == http.StatusOK && bytes.Equal(w.Body.Bytes(), content[:2*encryptionChunkSize]) {
+			t.Errorf("truncation wasn't detected")
+		}
+	})
+	t.Run("locked without key", func(t *testing.T) {
+		delete(cfg.Users, "foo")
+		cfg.Users["foo"] = &UserInfo{Password: GenHash([]byte("password")), Crud: newCrudType("crud"), KeyFile: filepath.Join(keys, "missing")}
+		if w := serve("PROPFIND", "/plain.txt", nil); w.Code != http.StatusForbidden {
+			t.Errorf("PROPFIND = %d, want %d", w.Code, http.StatusForbidden)
+		}
+	})
+}
+
+func TestEncryptedLinks(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(t.TempDir(), "foo.key")
+	os.WriteFile(keyFile, bytes.Repeat([]byte{7}, encryptionKeySize), 0600)
+	os.Mkdir(filepath.Join(dir, "inbox"), 0700)
+	cfg := &Config{
+		Dir:        dir,
+		Log:        Logging{Create: true},
+		Encryption: &Encryption{Keys: t.TempDir()},
+		Presign:    &Presign{Secret: "s3cr3t"},
+		Shares:     &Shares{File: filepath.Join(t.TempDir(), "shares.db")},
+		Users: map[string]*UserInfo{
+			"foo": {Password: GenHash([]byte("password")), Crud: newCrudType("crud"), KeyFile: keyFile},
+			"bar": {Password: GenHash([]byte("password")), Crud: newCrudType("crud"), Encrypt: true},
+		},
+	}
+	var err error
+	if cfg.shares, err = openShareStore(cfg.Shares); err != nil {
+		t.Fatal(err)
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, httptest.NewRequest(method, path, strings.NewReader(body)), a)
+		return w
+	}
+	dropbox := &share{Token: "dropbox", User: "foo", Path: "/inbox", Permission: shareDropbox, Created: time.Now()}
+	if err := cfg.shares.put(dropbox); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop-box uploads are encrypted like the ones of the user
+	if w := do(http.MethodPut, "/s/dropbox/report.txt", "confidential"); w.Code != http.StatusCreated {
+		t.Fatalf("PUT to drop-box = %d, want %d", w.Code, http.StatusCreated)
+	}
+	stored, _ := os.ReadFile(filepath.Join(dir, "inbox", "report.txt"))
+	if !bytes.HasPrefix(stored, []byte(encryptionMagic)) || bytes.Contains(stored, []byte("confidential")) {
+		t.Errorf("uploaded file isn't encrypted")
+	}
+	// And downloads are decrypted
+	if w := do(http.MethodGet, PresignURL(cfg, "foo", "/inbox/report.txt", time.Now().Add(time.Hour)), ""); w.Code != http.StatusOK || w.Body.String() != "confidential" {
+		t.Errorf("GET of pre-signed url = %d %q, want the content", w.Code, w.Body.String())
+	}
+	// The key of users whose key is wrapped with their password isn't at hand, their links are refused
+	os.WriteFile(filepath.Join(dir, "plain.txt"), []byte("plain"), 0600)
+	if w := do(http.MethodGet, PresignURL(cfg, "bar", "/plain.txt", time.Now().Add(time.Hour)), ""); w.Code != http.StatusForbidden {
+		t.Errorf("GET of pre-signed url of locked user = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
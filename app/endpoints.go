@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// usageEndpoint is the path (relative to the configured prefix) returning the accounting of the authenticated user.
+const usageEndpoint = "/_usage"
+
+// serveInternalEndpoint serves the endpoints of david itself, which aren't part of the webdav tree.
+// It returns false if the request has to be served by the webdav handler.
+func serveInternalEndpoint(a *App, ctx context.Context, w http.ResponseWriter, req *http.Request, authInfo *AuthInfo) bool {
+	name := strings.TrimPrefix(req.URL.Path, a.Config.Prefix)
+	if a.Config.userStore != nil && hasPathPrefix(name, adminUsersEndpoint) {
+		handleAdminUsersRequest(a, ctx, w, req, authInfo)
+		return true
+	}
+	if a.Config.propertyStore() != nil && hasPathPrefix(name, metaEndpoint) {
+		handleMetaRequest(a, ctx, w, req, authInfo)
+		return true
+	}
+	if a.Config.shares != nil && hasPathPrefix(name, sharesEndpoint) {
+		handleSharesRequest(a, ctx, w, req, authInfo)
+		return true
+	}
+	if a.Config.thumbnailer != nil && hasPathPrefix(name, thumbnailEndpoint) {
+		handleThumbnailRequest(a, ctx, w, req, authInfo)
+		return true
+	}
+	if a.Config.indexer != nil && (req.Method == Search || req.Method == Report) {
+		handleSearchMethod(a, ctx, w, req, authInfo)
+		return true
+	}
+	switch name {
+	case searchEndpoint:
+		if a.Config.indexer == nil {
+			return false
+		}
+		handleSearchRequest(a, ctx, w, req, authInfo)
+	case presignEndpoint:
+		if a.Config.Presign == nil {
+			return false
+		}
+		handlePresignRequest(a, ctx, w, req, authInfo)
+	case usageEndpoint:
+		handleUsageRequest(w, authInfo)
+	case statsEndpoint:
+		if !a.Config.Stats {
+			return false
+		}
+		handleStatsRequest(a, w, authInfo)
+	default:
+		return false
+	}
+	return true
+}
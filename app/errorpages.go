@@ -0,0 +1,86 @@
+package app
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errorPageStatuses are the statuses which can be answered with a custom page.
+var errorPageStatuses = []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError}
+
+// errorPage holds the data available to the templates of the error pages.
+type errorPage struct {
+	Status     int
+	StatusText string
+	Path       string
+	Realm      string
+}
+
+// loadErrorPages parses the templates named after their status (like 401.html) in dir.
+// Statuses without a template keep their default response.
+func loadErrorPages(dir string) (map[int]*template.Template, error) {
+	if info, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, errors.New(dir + " is not a directory")
+	}
+	pages := map[int]*template.Template{}
+	for _, status := range errorPageStatuses {
+		file := filepath.Join(dir, strconv.Itoa(status)+".html")
+		if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		page, err := template.ParseFiles(file)
+		if err != nil {
+			return nil, err
+		}
+		pages[status] = page
+	}
+	return pages, nil
+}
+
+// acceptsHTML reports whether the client, usually a browser, prefers an HTML response.
+func acceptsHTML(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "text/html")
+}
+
+// errorPageWriter replaces the body of error responses with the custom page of their status.
+type errorPageWriter struct {
+	http.ResponseWriter
+	req      *http.Request
+	realm    string
+	pages    map[int]*template.Template
+	replaced bool
+}
+
+// WriteHeader renders the page of the status if there is one, and passes all other statuses.
+func (w *errorPageWriter) WriteHeader(status int) {
+	page, ok := w.pages[status]
+	if !ok || w.replaced {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(status)
+	data := errorPage{Status: status, StatusText: http.StatusText(status), Path: w.req.URL.Path, Realm: w.realm}
+	if err := page.Execute(w.ResponseWriter, data); err != nil {
+		log.WithError(err).WithField("status", status).Error("Error rendering error page")
+	}
+	w.replaced = true
+}
+
+// Write discards the original body after it has been replaced.
+func (w *errorPageWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
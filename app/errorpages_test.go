@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestErrorPages(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "401.html"), []byte(`<h1>{{.Status}} {{.StatusText}}</h1><p>Log in to {{.Realm}} to open {{.Path}}</p>`), 0600)
+	pages, err := loadErrorPages(dir)
+	if err != nil {
+		t.Fatalf("loadErrorPages() error = %v", err)
+	}
+	if len(pages) != 1 {
+		t.Errorf("loadErrorPages() = %d pages, want 1", len(pages))
+	}
+	if _, err := loadErrorPages(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("loadErrorPages() of missing dir error = nil, want error")
+	}
+	broken := t.TempDir()
+	os.WriteFile(filepath.Join(broken, "404.html"), []byte("{{"), 0600)
+	if _, err := loadErrorPages(broken); err == nil {
+		t.Errorf("loadErrorPages() of broken template error = nil, want error")
+	}
+
+	a := &App{Config: &Config{
+		Realm:      "david",
+		Users:      map[string]*UserInfo{"foo": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")}},
+		errorPages: pages,
+	}}
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{"browser", "text/html,application/xhtml+xml", "<h1>401 Unauthorized</h1><p>Log in to david to open /a&amp;b</p>"},
+		{"webdav client", "*/*", "401 Unauthorized"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PROPFIND", "/a&b", nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, r, a)
+			if w.Code != http.StatusUnauthorized || w.Body.String() != tt.want {
+				t.Errorf("handle() = %d %q, want %d %q", w.Code, w.Body.String(), http.StatusUnauthorized, tt.want)
+			}
+			// The challenge is still sent, so browsers show their login dialog first
+			if w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("handle() without WWW-Authenticate header")
+			}
+			if tt.name == "browser" && !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+				t.Errorf("handle() Content-Type = %s, want text/html", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+
+	"golang.org/x/net/webdav"
+)
+
+// etagInfo derives a strong ETag from the identity of a file besides its modification time and size.
+// Unlike the default of the webdav handler it changes with every write even if the modification time
+// is restored, and it stays the same across restarts, so If-Range resumes never mix versions of a file.
+type etagInfo struct {
+	os.FileInfo
+}
+
+// ETag hashes the version of the file, so inode numbers aren't exposed.
+func (fi etagInfo) ETag(ctx context.Context) (string, error) {
+	h := sha256.New()
+	var b [8]byte
+	for _, v := range append([]int64{fi.ModTime().UnixNano(), fi.Size()}, fileVersion(fi.FileInfo)...) {
+		binary.BigEndian.PutUint64(b[:], uint64(v))
+		h.Write(b[:])
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, nil
+}
+
+// etagFS provides strong ETags for the files of the wrapped file system.
+type etagFS struct {
+	webdav.FileSystem
+}
+
+// OpenFile opens the file with the ETags of its information.
+func (fs etagFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	f, err := fs.FileSystem.OpenFile(ctx, name, flag, perm)
+	if err != nil || f == nil {
+		return f, err
+	}
+	return &etagFile{File: f}, nil
+}
+
+// Stat returns the file information with its ETag.
+func (fs etagFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	info, err := fs.FileSystem.Stat(ctx, name)
+	if err != nil || info == nil {
+		return info, err
+	}
+	return etagInfo{info}, nil
+}
+
+// etagFile provides the strong ETags of a file and the entries of a directory.
+type etagFile struct {
+	webdav.File
+}
+
+// Stat returns the file information with its ETag.
+func (f *etagFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil || info == nil {
+		return info, err
+	}
+	return etagInfo{info}, nil
+}
+
+// Readdir returns the entries of the directory with their ETags.
+func (f *etagFile) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(count)
+	for i, info := range infos {
+		infos[i] = etagInfo{info}
+	}
+	return infos, err
+}
@@ -0,0 +1,15 @@
+package app
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileVersion returns the inode and the change time of a file, the change time can't be set by clients.
+func fileVersion(info os.FileInfo) []int64 {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return []int64{int64(st.Ino), st.Ctim.Nano()}
+}
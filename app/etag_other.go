@@ -0,0 +1,10 @@
+//go:build !linux
+
+package app
+
+import "os"
+
+// fileVersion has nothing to add to the modification time and size where the change time isn't available.
+func fileVersion(info os.FileInfo) []int64 {
+	return nil
+}
@@ -0,0 +1,61 @@
+//go:build linux
+
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestETagResume(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.txt")
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	os.WriteFile(name, []byte("0123456789"), 0600)
+	os.Chtimes(name, modTime, modTime)
+
+	newApp := func() *App {
+		cfg := &Config{
+			Dir: dir,
+			Users: map[string]*UserInfo{
+				"alice": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")},
+			},
+		}
+		return &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	}
+	get := func(a *App, ifRange string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+		r.SetBasicAuth("alice", "password")
+		r.Header.Set("Range", "bytes=5-")
+		if ifRange != "" {
+			r.Header.Set("If-Range", ifRange)
+		}
+		w := httptest.NewRecorder()
+		NewBasicAuthWebdavHandler(a).ServeHTTP(w, r)
+		return w
+	}
+	etag := get(newApp(), "").Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("ETag = %s, want a strong ETag", etag)
+	}
+
+	// A restarted server derives the same ETag, the resume is valid
+	if w := get(newApp(), etag); w.Code != http.StatusPartialContent || w.Body.String() != "56789" {
+		t.Errorf("resume after restart = %d %q, want %d 56789", w.Code, w.Body.String(), http.StatusPartialContent)
+	}
+
+	// Replacing the content with the same size and modification time invalidates the ETag
+	os.Remove(name)
+	os.WriteFile(name, []byte("abcdefghij"), 0600)
+	os.Chtimes(name, modTime, modTime)
+	if w := get(newApp(), etag); w.Code != http.StatusOK || w.Body.String() != "abcdefghij" {
+		t.Errorf("resume of changed file = %d %q, want %d with the full content", w.Code, w.Body.String(), http.StatusOK)
+	}
+}
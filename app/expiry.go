@@ -0,0 +1,136 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Actions of an expiry rule.
+const (
+	ExpiryDelete = "delete"
+	ExpiryMove   = "move"
+)
+
+// defaultExpiryInterval is used when no interval of the expiry rules is configured.
+const defaultExpiryInterval = time.Hour
+
+// expiryUser is recorded in the audit log as the user of expired files.
+const expiryUser = "expiry"
+
+// ExpiryRule deletes the files below Path (relative to the base directory) which weren't modified for MaxAge,
+// or moves them to Destination keeping their path below Path.
+type ExpiryRule struct {
+	Path        string
+	MaxAge      time.Duration
+	Action      string
+	Destination string
+}
+
+// validate checks the age, action and destination of the rule.
+func (r *ExpiryRule) validate() error {
+	if r.MaxAge <= 0 {
+		return errors.New("expiry rule for " + r.Path + " without maxAge")
+	}
+	switch r.Action {
+	case "", ExpiryDelete:
+	case ExpiryMove:
+		if r.Destination == "" {
+			return errors.New("expiry rule for " + r.Path + " moves files without destination")
+		}
+		// Moved files would expire again right away
+		if hasPathPrefix(path.Clean("/"+r.Destination), path.Clean("/"+r.Path)) {
+			return errors.New("destination of expiry rule for " + r.Path + " is below its path")
+		}
+	default:
+		return errors.New("invalid action " + r.Action + " of expiry rule for " + r.Path)
+	}
+	return nil
+}
+
+// expire deletes or moves an expired file according to the rule, unless it's protected by a retention period
+// or an append-only directory, and records it in the audit log. It returns whether the file expired.
+func (cfg *Config) expire(r *ExpiryRule, name, rel string, age time.Duration, now time.Time) (bool, error) {
+	if age < cfg.retentionOf(rel) || cfg.inAppendOnly(name, false) {
+		return false, nil
+	}
+	storage := Dir{Config: cfg}.storage()
+	if r.Action == ExpiryMove {
+		below := path.Clean("/" + rel[len(path.Clean("/"+r.Path)):])
+		target := path.Join(path.Clean("/"+r.Destination), below)
+		physical := filepath.Join(cfg.Dir, filepath.FromSlash(target))
+		if err := os.MkdirAll(filepath.Dir(physical), 0700); err != nil {
+			return false, err
+		}
+		if err := storage.Rename(name, physical); err != nil {
+			return false, err
+		}
+		writeAudit(cfg, AuditEntry{User: expiryUser, Action: "expire-move", Path: rel, Detail: "moved to " + target + " after " + age.Round(time.Second).String()})
+		return true, nil
+	}
+	var err error
+	if cfg.Trash != nil {
+		err = cfg.moveToTrash(name, now)
+	} else {
+		err = storage.RemoveAll(name)
+	}
+	if err != nil {
+		return false, err
+	}
+	writeAudit(cfg, AuditEntry{User: expiryUser, Action: "expire-delete", Path: rel, Detail: "deleted after " + age.Round(time.Second).String()})
+	return true, nil
+}
+
+// applyExpiry deletes or moves the files matching the expiry rules and returns their number.
+func (cfg *Config) applyExpiry(now time.Time) int {
+	expired := 0
+	for _, rule := range cfg.Expiry {
+		root := filepath.Join(cfg.Dir, filepath.FromSlash(path.Clean("/"+rule.Path)))
+		filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			age := now.Sub(info.ModTime())
+			if age < rule.MaxAge {
+				return nil
+			}
+			rel, ok := cfg.relPath(name)
+			if !ok {
+				return nil
+			}
+			done, err := cfg.expire(rule, name, rel, age, now)
+			if err != nil {
+				log.WithError(err).WithField("path", rel).Error("Error expiring file")
+			} else if done {
+				expired++
+			}
+			return nil
+		})
+	}
+	return expired
+}
+
+// startExpiry periodically applies the expiry rules of the main configuration and the tenants.
+func (cfg *Config) startExpiry() {
+	interval := cfg.ExpiryInterval
+	if interval <= 0 {
+		interval = defaultExpiryInterval
+	}
+	go func() {
+		for now := range time.Tick(interval) {
+			configs := []*Config{cfg}
+			for _, tenant := range cfg.tenants {
+				configs = append(configs, tenant)
+			}
+			for _, c := range configs {
+				if expired := c.applyExpiry(now); expired != 0 {
+					log.WithFields(log.Fields{"path": c.Dir, "expired": expired}).Info("Expired files")
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiredUsers(t *testing.T) {
+	now := time.Now()
+	newCfg := func() *Config {
+		return &Config{Users: map[string]*UserInfo{
+			"alice":      {Password: GenHash([]byte("password")), Crud: newCrudType("crud")},
+			"contractor": {Password: GenHash([]byte("password")), Crud: newCrudType("crud"), ExpiresAt: now.Add(time.Hour)},
+			"former":     {Password: GenHash([]byte("password")), Crud: newCrudType("crud"), ExpiresAt: now.Add(-time.Hour)},
+		}}
+	}
+
+	cfg := newCfg()
+	for username, want := range map[string]bool{"alice": true, "contractor": true, "former": false} {
+		info, err := authenticate(cfg, username, "password")
+		if got := err == nil && info.Authenticated; got != want {
+			t.Errorf("authenticate(%s) = %v, %v, want authenticated %v", username, info, err, want)
+		}
+	}
+
+	updated := newCfg()
+	updated.pruneExpiredUsers(now)
+	updateConfig(cfg, updated)
+	if cfg.Users["former"] != nil || cfg.Users["alice"] == nil || cfg.Users["contractor"] == nil {
+		t.Errorf("users after reload = %v, want the expired one pruned", cfg.Users)
+	}
+
+	// Extending the expiry on reload applies to the running configuration
+	updated = newCfg()
+	updated.Users["contractor"].ExpiresAt = now.Add(48 * time.Hour)
+	updateConfig(cfg, updated)
+	if !cfg.Users["contractor"].ExpiresAt.Equal(now.Add(48 * time.Hour)) {
+		t.Errorf("expiry after reload = %s", cfg.Users["contractor"].ExpiresAt)
+	}
+}
+
+func TestPasswordExpiry(t *testing.T) {
+	now := time.Now()
+	cfg := &Config{
+		Security: &Security{MaxPasswordAge: 90 * 24 * time.Hour},
+		Users: map[string]*UserInfo{
+			"fresh":  {Password: GenHash([]byte("password")), Crud: newCrudType("r"), PasswordSetAt: now.Add(-24 * time.Hour)},
+			"stale":  {Password: GenHash([]byte("password")), Crud: newCrudType("r"), PasswordSetAt: now.Add(-100 * 24 * time.Hour)},
+			"legacy": {Password: GenHash([]byte("password")), Crud: newCrudType("r")},
+		},
+	}
+	for username, want := range map[string]bool{"fresh": true, "stale": false, "legacy": true} {
+		info, err := authenticate(cfg, username, "password")
+		if got := err == nil && info.Authenticated; got != want {
+			t.Errorf("authenticate(%s) = %v, %v, want authenticated %v", username, info, err, want)
+		}
+	}
+
+	cfg.Security.PasswordAgeWarnOnly = true
+	if info, err := authenticate(cfg, "stale", "password"); err != nil || !info.Authenticated {
+		t.Errorf("authenticate() of expired password in warn-only mode = %v, %v", info, err)
+	}
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// failedLoginLog appends failed logins to a file in a stable single-line format for fail2ban or crowdsec,
+// independent of the format of the log:
+//
+//	2024-01-31T12:00:00Z david failed login from 192.0.2.1 user "alice"
+type failedLoginLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// openFailedLoginLog opens the file at path for appending, creating it and its directory if needed.
+func openFailedLoginLog(path string) (*failedLoginLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &failedLoginLog{f: f}, nil
+}
+
+// write appends a failed login. The username is quoted, so it can't forge lines or addresses.
+func (l *failedLoginLog) write(now time.Time, address, username string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := fmt.Fprintf(l.f, "%s david failed login from %s user %s\n", now.UTC().Format(time.RFC3339), address, strconv.Quote(username))
+	return err
+}
+
+// logFailedLogin records a failed login to the failed login log if configured. The address is the one of the
+// client as far as trusted proxies tell, so clients can't get others banned with a forged X-Forwarded-For.
+func logFailedLogin(cfg *Config, req *http.Request, username string) {
+	if cfg.failedLogins == nil {
+		return
+	}
+	addr, ok := cfg.sourceAddress(req)
+	if !ok {
+		return
+	}
+	if err := cfg.failedLogins.write(time.Now(), addr.String(), username); err != nil {
+		log.WithError(err).Error("Error writing failed login log")
+	}
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestFailedLoginLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log", "failed.log")
+	failedLogins, err := openFailedLoginLog(path)
+	if err != nil {
+		t.Fatalf("openFailedLoginLog() error = %v", err)
+	}
+	cfg := &Config{
+		Dir:            t.TempDir(),
+		TrustedProxies: []string{"10.0.0.1"},
+		Users:          map[string]*UserInfo{"alice": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")}},
+		failedLogins:   failedLogins,
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	for _, tt := range []struct{ remote, forwarded, user, password string }{
+		{"192.0.2.1:1234", "", "alice", "wrong"},
+		{"192.0.2.1:1234", "198.51.100.7", "mallory\ninjected", "password"},
+		{"10.0.0.1:1234", "198.51.100.8", "alice", "wrong"},
+		{"192.0.2.1:1234", "", "alice", "password"},
+	} {
+		r := httptest.NewRequest("PROPFIND", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		r.SetBasicAuth(tt.user, tt.password)
+		handle(context.Background(), httptest.NewRecorder(), r, a)
+	}
+
+	content, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	line := regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z david failed login from (\S+) user (".*")$`)
+	want := [][2]string{{"192.0.2.1", `"alice"`}, {"192.0.2.1", `"mallory\ninjected"`}, {"198.51.100.8", `"alice"`}}
+	if len(lines) != len(want) {
+		t.Fatalf("failed login log = %q, want %d lines", content, len(want))
+	}
+	for i, l := range lines {
+		match := line.FindStringSubmatch(l)
+		if match == nil || match[1] != want[i][0] || match[2] != want[i][1] {
+			t.Errorf("line %d = %q, want address %s and user %s", i, l, want[i][0], want[i][1])
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"context"
+	"net/http"
+)
+
+// failureKey holds the failureRecorder of a request in its context.
+var failureKey contextKey = 2
+
+// failureRecorder remembers why the file system refused a request. The webdav handler maps all errors of the
+// file system to generic statuses, the recorded failure is answered with its precise status and DAV:error body.
+type failureRecorder struct {
+	status    int
+	condition davCondition
+	reason    string
+}
+
+// recordFailure records the first failure of the request served in ctx.
+func recordFailure(ctx context.Context, status int, condition davCondition, reason string) {
+	if r, ok := ctx.Value(failureKey).(*failureRecorder); ok && r.status == 0 {
+		r.status, r.condition, r.reason = status, condition, reason
+	}
+}
+
+// failureWriter answers failed requests with the recorded failure instead of the status of the webdav handler.
+type failureWriter struct {
+	http.ResponseWriter
+	recorder *failureRecorder
+	replaced bool
+}
+
+// WriteHeader writes the DAV:error body of the recorded failure and passes all other statuses.
+func (w *failureWriter) WriteHeader(status int) {
+	if status < http.StatusBadRequest || w.recorder.status == 0 || w.replaced {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	writeDAVError(w.ResponseWriter, w.recorder.status, w.recorder.condition)
+	w.replaced = true
+}
+
+// Write discards the original body after it has been replaced.
+func (w *failureWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
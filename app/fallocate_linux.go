@@ -0,0 +1,11 @@
+package app
+
+import "syscall"
+
+// fallocateKeepSize keeps the size of the file while allocating, so interrupted uploads aren't padded with zeros.
+const fallocateKeepSize = 0x1
+
+// fallocate allocates size bytes for the file.
+func fallocate(fd uintptr, size int64) error {
+	return syscall.Fallocate(int(fd), fallocateKeepSize, 0, size)
+}
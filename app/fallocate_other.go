@@ -0,0 +1,8 @@
+//go:build !linux
+
+package app
+
+// fallocate is a no-op on systems without fallocate.
+func fallocate(fd uintptr, size int64) error {
+	return nil
+}
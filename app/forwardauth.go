@@ -0,0 +1,103 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultForwardAuthTimeout bounds the requests to the forward-auth endpoint if no timeout is configured.
+const defaultForwardAuthTimeout = 5 * time.Second
+
+// Modes of the forward authentication.
+const (
+	// forwardCredentials posts the username, password and address as JSON.
+	forwardCredentials = "credentials"
+	// forwardHeader passes the Authorization header of the request on.
+	forwardHeader = "header"
+)
+
+// ForwardAuth authenticates users unknown to the configuration with an external HTTP endpoint at URL. It
+// answers 200 with the permissions and subdir of the user, 401 or 403 if the credentials are wrong.
+type ForwardAuth struct {
+	URL     string
+	Mode    string
+	Timeout time.Duration
+}
+
+// forwardAuthRequest is the body posted to the endpoint in the credentials mode.
+type forwardAuthRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Address  string `json:"address"`
+}
+
+// forwardAuthResponse is the body of an answer of the endpoint accepting the credentials.
+type forwardAuthResponse struct {
+	Crud   string `json:"crud"`
+	Subdir string `json:"subdir"`
+}
+
+// errForwardAuthDenied is returned if the endpoint refused the credentials.
+var errForwardAuthDenied = errors.New("forward auth endpoint refused the credentials")
+
+// authenticateWithForwardAuth asks the forward-auth endpoint whether the credentials of the request are valid.
+func authenticateWithForwardAuth(cfg *Config, req *http.Request, username, password string) (*AuthInfo, error) {
+	timeout := cfg.ForwardAuth.Timeout
+	if timeout <= 0 {
+		timeout = defaultForwardAuthTimeout
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	var body []byte
+	if cfg.ForwardAuth.Mode != forwardHeader {
+		body, _ = json.Marshal(forwardAuthRequest{Username: username, Password: password, Address: clientAddress(req)})
+	}
+	forward, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.ForwardAuth.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ForwardAuth.Mode == forwardHeader {
+		forward.Header.Set("Authorization", req.Header.Get("Authorization"))
+		forward.Header.Set("X-Forwarded-For", clientAddress(req))
+	} else {
+		forward.Header.Set("Content-Type", "application/json")
+	}
+	res, err := http.DefaultClient.Do(forward)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, errForwardAuthDenied
+	default:
+		return nil, fmt.Errorf("forward auth endpoint answered %s", res.Status)
+	}
+	var reply forwardAuthResponse
+	if err := json.NewDecoder(res.Body).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("invalid answer of forward auth endpoint: %s", err)
+	}
+	if reply.Crud == "" {
+		return nil, errors.New("forward auth endpoint granted no permissions")
+	}
+
+	user := &UserInfo{Permissions: reply.Crud, Crud: &CrudType{Crud: reply.Crud}}
+	if reply.Subdir != "" {
+		user.Subdir = &reply.Subdir
+	}
+	cfg.externalUsers.Store(username, user)
+	if err := FormatCrud(context.Background(), username, cfg); err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{"user": username, "crud": user.Crud}).Debug("User was authenticated by forward auth")
+	return &AuthInfo{Username: username, Authenticated: true, CrudType: user.Crud}, nil
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestForwardAuth(t *testing.T) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var credentials forwardAuthRequest
+		if r.Header.Get("Authorization") != "" {
+			credentials.Username, credentials.Password, _ = r.BasicAuth()
+		} else {
+			json.NewDecoder(r.Body).Decode(&credentials)
+		}
+		switch {
+		case credentials.Username == "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case credentials.Password != "secret":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			json.NewEncoder(w).Encode(forwardAuthResponse{Crud: "cr", Subdir: "/" + credentials.Username})
+		}
+	}))
+	defer endpoint.Close()
+
+	for _, mode := range []string{forwardCredentials, forwardHeader} {
+		dir := t.TempDir()
+		os.Mkdir(filepath.Join(dir, "alice"), 0o755)
+		cfg := &Config{Dir: dir, Log: Logging{Create: true}, ForwardAuth: &ForwardAuth{URL: endpoint.URL, Mode: mode}}
+		a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+		tests := []struct {
+			user, password string
+			want           int
+		}{
+			{"alice", "secret", http.StatusCreated},
+			{"alice", "wrong", http.StatusUnauthorized},
+			{"broken", "secret", http.StatusUnauthorized},
+		}
+		for _, tt := range tests {
+			r := httptest.NewRequest(http.MethodPut, "/file.txt", nil)
+			r.SetBasicAuth(tt.user, tt.password)
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, r, a)
+			if w.Code != tt.want {
+				t.Errorf("%s: PUT as %s:%s = %d, want %d", mode, tt.user, tt.password, w.Code, tt.want)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "alice", "file.txt")); err != nil {
+			t.Errorf("%s: file wasn't written to the subdir of the endpoint: %s", mode, err)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/webdav"
@@ -29,17 +30,30 @@ func (d Dir) resolveUser(ctx context.Context) string {
 	return ""
 }
 
-// authorizationFromContext retrieves and formats the user's CRUD permissions based on the given context.
+// authorizationFromContext checks that the user of the given context has permissions.
 func (d Dir) authorizationFromContext(ctx context.Context) error {
 	// Extract the authenticated user name from the provided context.
 	user := d.resolveUser(ctx)
 	// If no user is identified return an error
 	if user == "" {
 		return errors.New("no user identified")
-	} else {
-		// Format and validate the retrieved CRUD permissions for the identified user using the FormatCrud function.
-		return FormatCrud(ctx, user, d.Config)
 	}
+	// The permissions were formatted when the user was configured or authenticated, requests only read them
+	if info := d.Config.user(user); info == nil || info.Crud == nil {
+		return errors.New("either user was not found in config file, or crud was not found in config file")
+	}
+	return nil
+}
+
+// crud returns the permissions of the request, which may differ from the configured ones of the user.
+func (d Dir) crud(ctx context.Context) *CrudType {
+	if authInfo := AuthFromContext(ctx); authInfo != nil && authInfo.CrudType != nil {
+		return authInfo.CrudType
+	}
+	if user := d.Config.user(d.resolveUser(ctx)); user != nil && user.Crud != nil {
+		return user.Crud
+	}
+	return &CrudType{}
 }
 
 // resolve builds the physical path for a given name based on user information and configuration settings.
@@ -73,6 +87,7 @@ func (d Dir) authorizationFromContext(ctx context.Context) error {
 // Mkdir attempts to create a directory at the resolved physical path.
 func (d Dir) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
 	// Resolve the physical path of the directory based on user information and configuration.
+	requested := name
 	if name = Resolve(ctx, name, d); name == "" {
 		return os.ErrNotExist
 	}
@@ -87,8 +102,8 @@ func (d Dir) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
 	// resolve the user based on context.
 	user := d.resolveUser(ctx)
 
-	// Check for create permission.
-	if !d.Config.Users[user].Crud.Create {
+	// Check for create permission, which the ACL of the user may deny at the path.
+	if !d.crudAt(ctx, name).Create {
 		if d.Config.Log.Create {
 			log.WithField("user", user).Warn("unauthorized to create directory")
 			return errors.New("unauthorized to create directory")
@@ -97,12 +112,26 @@ func (d Dir) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
 		}
 	}
 
-	// Create the directory using os.Mkdir.
-	err = os.Mkdir(name, perm)
+	// Names differing from existing ones only by case can't be created if paths ignore their case.
+	if err := d.denyCaseConflict(ctx, requested, name); err != nil {
+		return err
+	}
+	// Reserved names and the directories of david can't be created.
+	if err := d.denyReservedName(ctx, name); err != nil {
+		return err
+	}
+	// Directories of other users in owner-only directories can't be created in.
+	if d.hiddenFromUser(ctx, name) {
+		return os.ErrNotExist
+	}
+
+	// Create the directory using the storage backend.
+	err = noteDiskFull(ctx, d.storage().Mkdir(name, perm))
 	// Check for errors and return if any occur.
 	if err != nil {
 		return err
 	}
+	d.recordWrite(ctx, name, true)
 	// Log the directory creation action if logging is enabled in the configuration.
 	if d.Config.Log.Create {
 		log.WithFields(log.Fields{
@@ -120,6 +149,7 @@ func (d Dir) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
 // and a permission mode (`perm`) for the file as input.
 func (d Dir) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
 	// Resolve the physical path of the file.
+	requested := name
 	if name = Resolve(ctx, name, d); name == "" {
 		return nil, os.ErrNotExist
 	}
@@ -135,21 +165,19 @@ func (d Dir) OpenFile(ctx context.Context, name string, flag int, perm os.FileMo
 	user := d.resolveUser(ctx)
 
 	// Check for the file existence.
-	_, err = os.Stat(name)
+	_, err = d.storage().Stat(name)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			if !d.Config.Log.Create {
-				log.WithFields(log.Fields{
-					"path": name,
-					"user": user,
-				}).Warn("User does not have the permission to open a non-existant file they tried to create")
-				return nil, errors.New("the file: " + name + " does not exist and user " + user + " has no write permission to create it")
-			}
+		if errors.Is(err, os.ErrNotExist) && flag&os.O_CREATE != 0 && !d.crudAt(ctx, name).Create {
+			log.WithFields(log.Fields{
+				"path": name,
+				"user": user,
+			}).Warn("User does not have the permission to open a non-existant file they tried to create")
+			return nil, errors.New("the file: " + name + " does not exist and user " + user + " has no write permission to create it")
 		}
 	}
 
 	// Check permissions based on access mode.
-	if flag&os.O_RDONLY == 0 && !d.Config.Users[user].Crud.Read {
+	if flag&os.O_RDONLY == 0 && !d.crudAt(ctx, name).Read {
 		return nil, errors.New("unauthorized to read file")
 	}
 
@@ -158,26 +186,141 @@ func (d Dir) OpenFile(ctx context.Context, name string, flag int, perm os.FileMo
 	// to open the that file. If they have read only permissions, they'll be able to open the any EXISTING file, but
 	// if they have the permission of "read" ONLY and the file doesn't exist, they won't be able to create it, and
 	// they shouldn't be able to open it, else an error will occur when the stats function inevitably runs on a non existsnt file.
-	hasCreatePermission := d.Config.Users[user].Crud.Create
+	hasCreatePermission := d.crudAt(ctx, name).Create
 	if flag&(os.O_WRONLY|os.O_RDWR) != 0 && !hasCreatePermission {
 		if !hasCreatePermission { // This user don't have the permission to create a file!
 			if d.Config.Log.Create {
 				log.WithField("user", user).Warn("unauthorized to create file")
 			}
-			return nil, nil
+			return nil, os.ErrPermission
 		} else { // This user has the permission to create a file, but the operating system's file permissions don't allow it.
 			return nil, errors.New("unauthorized to write file based on the operating system's file permissions")
 		}
 	}
 
-	// Open the file using os.OpenFile.
-	f, err := os.OpenFile(name, flag, perm)
+	// Names differing from existing ones only by case can't be created if paths ignore their case.
+	if flag&os.O_CREATE != 0 {
+		if err := d.denyCaseConflict(ctx, requested, name); err != nil {
+			return nil, err
+		}
+		// Reserved names and files in the directories of david can't be created.
+		if _, err := d.storage().Stat(name); errors.Is(err, os.ErrNotExist) {
+			if err := d.denyReservedName(ctx, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Files of other users in owner-only directories don't exist for the user, they can't be overwritten either.
+	if d.hiddenFromUser(ctx, name) {
+		if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			return nil, os.ErrPermission
+		}
+		return nil, os.ErrNotExist
+	}
+	_, statErr := d.storage().Stat(name)
+	created := flag&os.O_CREATE != 0 && errors.Is(statErr, os.ErrNotExist)
+
+	// Existing files in append-only directories or of users who may only append can't be overwritten, retained
+	// ones not before their retention period.
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 && d.Config.inAppendOnly(name, false) {
+		if _, err := d.storage().Stat(name); err == nil {
+			if err := d.denyAppendOnly(ctx, name, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		if err := d.denyAppendingUser(ctx, name); err != nil {
+			return nil, err
+		}
+		if d.crud(ctx).Append && flag&os.O_CREATE != 0 {
+			// A file created meanwhile isn't overwritten either
+			flag |= os.O_EXCL
+		}
+	}
+	if flag&os.O_TRUNC != 0 {
+		if err := d.denyRetained(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+
+	// Open the file using the storage backend, uploads are staged in a temp file if configured.
+	upload := flag&os.O_TRUNC != 0 && flag&(os.O_WRONLY|os.O_RDWR) != 0
+	staging := d.Config.Staging
+	if body := uploadFromContext(ctx); upload && staging == nil && body != nil && body.verifies() {
+		// Uploads with a checksum only become visible once it matched
+		staging = &Staging{}
+	}
+	if body := uploadFromContext(ctx); upload && staging == nil && body != nil && statErr == nil && d.Config.uploadLimit(user) > 0 {
+		// Overwrites which may exceed the upload limit only replace the file once they are complete
+		staging = &Staging{}
+	}
+	stripMetadata := upload && len(d.Config.StripMetadata) != 0 && d.Config.stripsMetadata(name) && !d.Config.clientEncrypted(ctx, name)
+	if stripMetadata && staging == nil {
+		// Images are stripped before they become visible
+		staging = &Staging{}
+	}
+	if upload && d.Config.Versions != nil {
+		if err := d.Config.keepVersion(ctx, name, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	target := name
+	if upload && staging != nil {
+		if target, err = staging.stagingPath(name); err != nil {
+			return nil, err
+		}
+		flag = os.O_RDWR | os.O_CREATE | os.O_EXCL
+	}
+	f, err := d.storage().OpenFile(target, flag, perm)
 	if err != nil {
-		return nil, err
+		return nil, noteDiskFull(ctx, err)
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		d.recordWrite(ctx, name, created)
+	}
+	if upload {
+		if _, ok := f.(truncater); ok && d.Config.Sparse {
+			// Holes aren't allocated, so preallocation is skipped for sparse uploads
+			f = &sparseFile{File: f}
+		} else if d.Config.Preallocate {
+			if err := preallocate(ctx, f); err != nil {
+				f.Close()
+				if target != name {
+					d.storage().RemoveAll(target)
+				}
+				return nil, noteDiskFull(ctx, err)
+			}
+		}
+		if target != name {
+			f = &stagedFile{File: f, ctx: ctx, storage: d.storage(), staging: staging, temp: target, name: name, stripMetadata: stripMetadata}
+		}
+		if d.Config.WriteBufferSize > 0 {
+			f = newBufferedFile(f, d.Config.WriteBufferSize)
+		}
+	}
+	if d.Config.Sparse && flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		f = newSparseReader(f)
+	}
+	if staging != nil && staging.Dir == "" && flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		f = &stagingDir{File: f, suffix: staging.suffix()}
+	}
+	if len(d.Config.OwnerOnly) != 0 && flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		// Listings of owner-only directories only show the files of the user
+		f = &ownedDir{File: f, ctx: ctx, dir: d, name: name}
+	}
+	if d.hasACL(ctx) && flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		// Listings leave out the entries the ACL of the user denies
+		f = &aclDir{File: f, ctx: ctx, dir: d, name: name}
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		// Failed writes for lack of storage are answered with 507 Insufficient Storage
+		f = &diskFullFile{File: f, ctx: ctx}
 	}
 
-	// Log the file opening action if configured.
-	if d.Config.Log.Read {
+	// Log the file opening action if configured, only a sample of them if reads are sampled.
+	if d.Config.Log.Read && d.Config.Log.sampleRead() {
 		log.WithFields(log.Fields{
 			"path": name,
 			"user": user,
@@ -210,13 +353,30 @@ func (d Dir) RemoveAll(ctx context.Context, name string) error {
 	// resolve the user based on context.
 	user := d.resolveUser(ctx)
 
-	// Check for delete permission.
-	if !d.Config.Users[user].Crud.Delete {
+	// Check for delete permission, of everything below the path as well.
+	if !d.crudBelow(ctx, name).Delete {
 		return errors.New("unauthorized to delete file or directory")
 	}
 
-	// Attempt to remove the file or directory using os.RemoveAll.
-	err = os.RemoveAll(name)
+	// Files of other users in owner-only directories don't exist for the user.
+	if d.hiddenFromUser(ctx, name) {
+		return os.ErrNotExist
+	}
+
+	// Check for append-only directories and retained files affected by the deletion.
+	if err := d.denyAppendOnly(ctx, name, true); err != nil {
+		return err
+	}
+	if err := d.denyRetained(ctx, name); err != nil {
+		return err
+	}
+
+	// Attempt to remove the file or directory using the storage backend, or move it into the trash if configured.
+	if d.Config.Trash != nil {
+		err = noteDiskFull(ctx, d.Config.moveToTrash(name, time.Now()))
+	} else {
+		err = d.storage().RemoveAll(name)
+	}
 	if err != nil {
 		return err
 	}
@@ -232,12 +392,13 @@ func (d Dir) RemoveAll(ctx context.Context, name string) error {
 	return nil
 }
 
-// Rename resolves the physical file and delegates this to an os.Rename execution
+// Rename resolves the physical file and delegates this to the storage backend
 func (d Dir) Rename(ctx context.Context, oldName, newName string) error {
 	// Resolve the physical paths of the old and new names.
 	if oldName = Resolve(ctx, oldName, d); oldName == "" {
 		return os.ErrNotExist
 	}
+	requested := newName
 	if newName = Resolve(ctx, newName, d); newName == "" {
 		return os.ErrNotExist
 	}
@@ -258,13 +419,46 @@ func (d Dir) Rename(ctx context.Context, oldName, newName string) error {
 	// resolve the user based on context.
 	user := d.resolveUser(ctx)
 
-	// Check for rename permission.
-	if !d.Config.Users[user].Crud.Update {
+	// Check for rename permission, the ACL of the user has to allow creating at the new path as well.
+	if !d.crudBelow(ctx, oldName).Update {
 		return errors.New("unauthorized to rename file or directory")
 	}
+	if d.hasACL(ctx) && !d.crudBelow(ctx, newName).Create {
+		return os.ErrPermission
+	}
+
+	// Files of other users in owner-only directories can neither be renamed nor be replaced.
+	if d.hiddenFromUser(ctx, oldName) {
+		return os.ErrNotExist
+	}
+	if d.hiddenFromUser(ctx, newName) {
+		return os.ErrPermission
+	}
+
+	// Check for append-only directories and retained files affected by the rename, files may only be moved into them.
+	if err := d.denyAppendOnly(ctx, oldName, true); err != nil {
+		return err
+	}
+	if err := d.denyRetained(ctx, oldName); err != nil {
+		return err
+	}
+	if err := d.denyCaseConflict(ctx, requested, newName); err != nil {
+		return err
+	}
+	if err := d.denyReservedName(ctx, newName); err != nil {
+		return err
+	}
+	if _, err := d.storage().Stat(newName); err == nil {
+		if err := d.denyAppendOnly(ctx, newName, true); err != nil {
+			return err
+		}
+		if err := d.denyRetained(ctx, newName); err != nil {
+			return err
+		}
+	}
 
-	// Attempt to rename the file or directory using os.Rename.
-	err = os.Rename(oldName, newName)
+	// Attempt to rename the file or directory using the storage backend.
+	err = noteDiskFull(ctx, d.storage().Rename(oldName, newName))
 	if err != nil {
 		return err
 	}
@@ -281,7 +475,7 @@ func (d Dir) Rename(ctx context.Context, oldName, newName string) error {
 	return nil
 }
 
-// Stat resolves the physical file and delegates this to an os.Stat execution
+// Stat resolves the physical file and delegates this to the storage backend
 func (d Dir) Stat(ctx context.Context, name string) (os.FileInfo, error) {
 	// 1. Resolve the provided path within the directory:
 	name = Resolve(ctx, name, d)
@@ -294,31 +488,35 @@ func (d Dir) Stat(ctx context.Context, name string) (os.FileInfo, error) {
 	// 3. Determine the user accessing the file.
 	user := d.resolveUser(ctx)
 
-	// 4. Check if the user has read permission.
-	if !d.Config.Users[user].Crud.Read {
+	// 4. Check if the user has read permission, which the ACL of the user may deny at the path.
+	if !d.crudAt(ctx, name).Read {
 		return nil, errors.New("unauthorized to read file")
 	}
 
-	// 5. Attempt to stat the resolved path.
-	fileInfo, err := os.Stat(name)
-	// 5.1 Handle different error cases:
+	// 5. Files of other users in owner-only directories don't exist for the user.
+	if d.hiddenFromUser(ctx, name) {
+		return nil, os.ErrNotExist
+	}
+
+	// 6. Attempt to stat the resolved path.
+	fileInfo, err := d.storage().Stat(name)
+	// 6.1 Handle different error cases:
 	if err != nil {
 		// File doesn't exist, and user is trying to create it when they don't have the permission to do so.
-		if errors.Is(err, os.ErrNotExist) && d.Config.Users[user].Crud.Read && !d.Config.Users[user].Crud.Create {
+		if errors.Is(err, os.ErrNotExist) && d.crud(ctx).Read && !d.crud(ctx).Create {
 			if d.Config.Log.Create { // Logging enabled for file creation
 				log.WithFields(log.Fields{ // Log a slightly more detailed warning if file creation is not permitted.
 					"path":  name,
 					"user":  user,
-					"crud":  d.Config.Users[user].Crud,
+					"crud":  d.crud(ctx),
 					"issue": "file does not exist and user does not have the write permission to create it",
 				}).Warn("User does not have the write permission to create this file")
-				return nil, nil
 			}
 		}
-		// 5.2 Other errors (including the create permission issues) are passed along.
+		// 6.2 Errors are passed along, missing files are answered with 404.
 		return nil, err
 	}
 
-	// 6. If no errors, return the file information.
+	// 7. If no errors, return the file information.
 	return fileInfo, nil
 }
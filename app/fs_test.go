@@ -2,13 +2,18 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strconv"
 	"testing"
 	"time"
+
+	"golang.org/x/net/webdav"
 )
 
 func TestDirResolveUser(t *testing.T) {
@@ -202,7 +207,7 @@ func TestDirResolve(t *testing.T) {
 			d := Dir{ // Call the `Dir.resolve` method with the test case's context and name.
 				Config: tt.cfg,
 			}
-			if got := Resolve(tt.ctx, tt.name, d); got != tt.want {
+			if got := Resolve(tt.ctx, tt.name, d); got != filepath.FromSlash(tt.want) {
 				// Compare the returned resolved directory path (`got`) with the expected value (`tt.want`).
 				t.Errorf("Dir.resolve() = %v, want %v. Base dir is %v", got, tt.want, tt.cfg.Dir) // If they differ, report an error with details.
 				// Include the resolved path (`got`), expected path (`tt.want`), and base directory from the config for context.
@@ -668,3 +673,36 @@ func createTestConfig(dir string) *Config {
 	}
 	return config
 }
+
+func TestMissingPathsOfReadOnlyUsers(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "exists.txt"), []byte("content"), 0600)
+	for _, logCreate := range []bool{false, true} {
+		cfg := &Config{
+			Dir: dir,
+			Log: Logging{Create: logCreate},
+			Users: map[string]*UserInfo{
+				"reader": {Password: GenHash([]byte("password")), Permissions: "r", Crud: newCrudType("r")},
+			},
+		}
+		a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+		reader := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "reader", Authenticated: true, CrudType: newCrudType("r")})
+
+		if info, err := (Dir{Config: cfg}).Stat(reader, "/missing.txt"); info != nil || !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Stat() with create logging %v = %v, %v, want not exist", logCreate, info, err)
+		}
+		if f, err := (Dir{Config: cfg}).OpenFile(reader, "/exists.txt", os.O_RDWR, 0); f != nil || !errors.Is(err, os.ErrPermission) {
+			t.Errorf("OpenFile() with create logging %v = %v, %v, want permission error", logCreate, f, err)
+		}
+		for path, want := range map[string]int{"/missing.txt": http.StatusNotFound, "/missing/": http.StatusNotFound, "/exists.txt": http.StatusMultiStatus} {
+			r := httptest.NewRequest("PROPFIND", path, nil)
+			r.Header.Set("Depth", "0")
+			r.SetBasicAuth("reader", "password")
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, r, a)
+			if w.Code != want {
+				t.Errorf("PROPFIND %s with create logging %v = %d, want %d", path, logCreate, w.Code, want)
+			}
+		}
+	}
+}
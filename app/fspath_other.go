@@ -0,0 +1,24 @@
+//go:build !windows
+
+package app
+
+// invalidName reports whether the name contains characters the file system wouldn't take as a part of the name.
+// Slashes are separators of the name already.
+func invalidName(name string) bool {
+	return false
+}
+
+// rootDir returns the directory as it is, there are no drive letters.
+func rootDir(dir string) string {
+	return dir
+}
+
+// foldPath returns the path as it is, names differing in case are different files.
+func foldPath(name string) string {
+	return name
+}
+
+// longPath returns the path as it is, its length is only limited by the file system.
+func longPath(name string) string {
+	return name
+}
@@ -0,0 +1,47 @@
+//go:build windows
+
+package app
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxDirPath is the longest path of a directory Windows accepts without the extended-length prefix, the names
+// of files in it need the last 12 of the 260 characters of the path.
+const maxDirPath = 248
+
+// invalidName reports whether the name contains backslashes or colons, Windows would take them as separators,
+// drives or alternate data streams instead of a part of the name.
+func invalidName(name string) bool {
+	return strings.ContainsAny(name, `\:`)
+}
+
+// rootDir makes a drive letter alone denote the root of the drive, not the current directory on the drive.
+func rootDir(dir string) string {
+	if len(dir) == 2 && dir[1] == ':' {
+		return dir + `\`
+	}
+	return dir
+}
+
+// foldPath folds the case of the path, the file systems of Windows don't tell names apart by their case.
+func foldPath(name string) string {
+	return strings.ToLower(name)
+}
+
+// longPath prefixes long paths with \\?\, which lifts their limit of 260 characters. Windows doesn't clean up
+// prefixed paths, they are made absolute and cleaned here.
+func longPath(name string) string {
+	if len(name) < maxDirPath || strings.HasPrefix(name, `\\?\`) {
+		return name
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return name
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
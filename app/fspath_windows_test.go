@@ -0,0 +1,62 @@
+//go:build windows
+
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestResolveWindows(t *testing.T) {
+	ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "admin", Authenticated: true, CrudType: newCrudType("crud")})
+	tests := []struct {
+		dir  string
+		name string
+		want string
+	}{
+		{`C:\data`, "/a/b", `C:\data\a\b`},
+		{"C:/data", "/a/../../b", `C:\data\b`},
+		{rootDir("C:"), "/a", `C:\a`},
+		{`\\server\share`, "/a", `\\server\share\a`},
+		{`C:\data`, `a\..\..\b`, ""},
+		{`C:\data`, "/C:/Windows", ""},
+		{`C:\data`, "/file.txt::$DATA", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir+" "+tt.name, func(t *testing.T) {
+			cfg := &Config{Dir: tt.dir, FollowSymlinks: true, Users: map[string]*UserInfo{"admin": {Crud: newCrudType("crud")}}}
+			if got := Resolve(ctx, tt.name, Dir{Config: cfg}); got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendOnlyIgnoresCase(t *testing.T) {
+	cfg := &Config{Dir: `C:\data`, AppendOnly: []string{"/Logs"}}
+	for _, name := range []string{`C:\data\logs\app.log`, `c:\DATA\LOGS`} {
+		if !cfg.inAppendOnly(name, false) {
+			t.Errorf("inAppendOnly(%q) = false, want true", name)
+		}
+	}
+}
+
+func TestLongPath(t *testing.T) {
+	long := strings.Repeat("d", 300)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{`C:\data\file.txt`, `C:\data\file.txt`},
+		{`C:\data\` + long, `\\?\C:\data\` + long},
+		{`C:\data\..\` + long, `\\?\C:\` + long},
+		{`\\server\share\` + long, `\\?\UNC\server\share\` + long},
+		{`\\?\C:\` + long, `\\?\C:\` + long},
+	}
+	for _, tt := range tests {
+		if got := longPath(tt.name); got != tt.want {
+			t.Errorf("longPath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Group holds the settings shared by its members. Members are granted the Permissions of all their groups on
+// top of their own. The Subdir, in which $user is replaced by the username, and the limits apply to members
+// which don't set their own, the first of their groups setting one wins.
+type Group struct {
+	Permissions   string
+	Subdir        *string
+	MaxUploadSize int64
+	MaxWrites     int
+}
+
+// groupsOf returns the groups of a user, skipping unknown ones. Group names ignore their case, as the ones of
+// the configuration file are lowercase.
+func (cfg *Config) groupsOf(user *UserInfo) []*Group {
+	var groups []*Group
+	for _, name := range user.Groups {
+		if group := cfg.Groups[strings.ToLower(name)]; group != nil {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// grantedPermissions returns the permissions a user is granted by their role and groups besides their own.
+// Role and group names ignore their case.
+func (cfg *Config) grantedPermissions(user *UserInfo) string {
+	granted := ""
+	if user.Role != "" {
+		granted += strings.ToLower(cfg.Roles[strings.ToLower(user.Role)])
+	}
+	for _, group := range cfg.groupsOf(user) {
+		granted += strings.ToLower(group.Permissions)
+	}
+	return granted
+}
+
+// applyGroups passes the subdir and limits of the groups on to their members which don't set their own. It
+// fails for users of unknown groups or roles.
+func (cfg *Config) applyGroups() error {
+	for username, user := range cfg.Users {
+		if _, ok := cfg.Roles[strings.ToLower(user.Role)]; user.Role != "" && !ok {
+			return fmt.Errorf("user %s has unknown role %s", username, user.Role)
+		}
+		for _, name := range user.Groups {
+			if cfg.Groups[strings.ToLower(name)] == nil {
+				return fmt.Errorf("user %s is member of unknown group %s", username, name)
+			}
+		}
+		for _, group := range cfg.groupsOf(user) {
+			if user.Subdir == nil && group.Subdir != nil {
+				subdir := strings.ReplaceAll(*group.Subdir, "$user", username)
+				user.Subdir = &subdir
+			}
+			if user.MaxUploadSize == 0 {
+				user.MaxUploadSize = group.MaxUploadSize
+			}
+			if user.MaxWrites == 0 {
+				user.MaxWrites = group.MaxWrites
+			}
+		}
+	}
+	return nil
+}
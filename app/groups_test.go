@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGroups(t *testing.T) {
+	staff := "/staff/$user"
+	own := "/own"
+	cfg := &Config{
+		Groups: map[string]*Group{
+			"staff":    {Permissions: "r", Subdir: &staff, MaxUploadSize: 1 << 20, MaxWrites: 2},
+			"uploader": {Permissions: "cu", MaxUploadSize: 1 << 30},
+		},
+		Users: map[string]*UserInfo{
+			"alice": {Groups: []string{"Staff", "uploader"}, Crud: &CrudType{}},
+			"bob":   {Groups: []string{"uploader", "staff"}, Subdir: &own, MaxWrites: 5, Crud: &CrudType{Crud: "d"}},
+		},
+	}
+	if err := cfg.applyGroups(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		username      string
+		own           string
+		crud          string
+		subdir        string
+		maxUploadSize int64
+		maxWrites     int
+	}{
+		{"alice", "", "cru", "/staff/alice", 1 << 20, 2},
+		{"bob", "d", "crud", "/own", 1 << 30, 5},
+	}
+	for _, tt := range tests {
+		if err := FormatCrud(context.Background(), tt.username, cfg); err != nil {
+			t.Fatal(err)
+		}
+		// Formatting again keeps the merged permissions
+		if err := FormatCrud(context.Background(), tt.username, cfg); err != nil {
+			t.Fatal(err)
+		}
+		user := cfg.Users[tt.username]
+		if !samePermissions(user.Crud, tt.crud) || user.Crud.Crud != tt.own {
+			t.Errorf("permissions of %s = %+v, want %s with own %q", tt.username, user.Crud, tt.crud, tt.own)
+		}
+		if user.Subdir == nil || *user.Subdir != tt.subdir {
+			t.Errorf("subdir of %s = %v, want %s", tt.username, user.Subdir, tt.subdir)
+		}
+		if user.MaxUploadSize != tt.maxUploadSize || user.MaxWrites != tt.maxWrites {
+			t.Errorf("limits of %s = %d, %d, want %d, %d", tt.username, user.MaxUploadSize, user.MaxWrites, tt.maxUploadSize, tt.maxWrites)
+		}
+	}
+
+	cfg.Users["carol"] = &UserInfo{Groups: []string{"unknown"}}
+	if err := cfg.applyGroups(); err == nil {
+		t.Errorf("applyGroups() with an unknown group succeeded")
+	}
+}
+
+func TestRoles(t *testing.T) {
+	newCfg := func(uploader string) *Config {
+		return &Config{
+			Roles: map[string]string{"uploader": uploader, "auditor": "r"},
+			Users: map[string]*UserInfo{
+				"alice": {Password: GenHash([]byte("password")), Role: "Uploader"},
+				"bob":   {Password: GenHash([]byte("password")), Role: "auditor", Permissions: "d"},
+			},
+		}
+	}
+	format := func(cfg *Config) {
+		for username, user := range cfg.Users {
+			user.Crud = &CrudType{Crud: user.Permissions}
+			if err := FormatCrud(context.Background(), username, cfg); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cfg := newCfg("cr")
+	if err := cfg.applyGroups(); err != nil {
+		t.Fatal(err)
+	}
+	format(cfg)
+	if crud := cfg.Users["alice"].Crud; !samePermissions(crud, "cr") {
+		t.Errorf("permissions of uploader = %+v, want cr", crud)
+	}
+	if crud := cfg.Users["bob"].Crud; !samePermissions(crud, "rd") || crud.Crud != "d" {
+		t.Errorf("permissions of auditor with own permissions = %+v, want rd", crud)
+	}
+
+	// Formatting again after the role changed doesn't keep the permissions it granted before
+	cfg.Roles["uploader"] = "r"
+	if err := FormatCrud(context.Background(), "alice", cfg); err != nil {
+		t.Fatal(err)
+	}
+	if crud := cfg.Users["alice"].Crud; !samePermissions(crud, "r") {
+		t.Errorf("permissions of uploader after the role changed = %+v, want r", crud)
+	}
+
+	// Changing a role on reload applies to all of its members
+	updateConfig(cfg, newCfg("cru"))
+	if crud := cfg.Users["alice"].Crud; !samePermissions(crud, "cru") {
+		t.Errorf("permissions of uploader after reload = %+v, want cru", crud)
+	}
+
+	unknown := newCfg("cr")
+	unknown.Users["carol"] = &UserInfo{Role: "editor"}
+	if err := unknown.applyGroups(); err == nil {
+		t.Errorf("applyGroups() with an unknown role succeeded")
+	}
+}
+
+// samePermissions reports whether crud grants exactly the given permissions, whatever its own CRUD string.
+func samePermissions(crud *CrudType, permissions string) bool {
+	want := *newCrudType(permissions)
+	got := *crud
+	got.Crud, want.Crud = "", ""
+	return got == want
+}
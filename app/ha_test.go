@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestRedisLockSystem(t *testing.T) {
+	_, first, second := openTestRedis(t)
+	ls0, ls1 := newRedisLockSystem(first, "/data"), newRedisLockSystem(second, "/data")
+	now := time.Now()
+
+	token, err := ls0.Create(now, webdav.LockDetails{Root: "/docs", Duration: time.Minute})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		details webdav.LockDetails
+		want    error
+	}{
+		{"same resource", webdav.LockDetails{Root: "/docs", ZeroDepth: true, Duration: time.Minute}, webdav.ErrLocked},
+		{"below infinite lock", webdav.LockDetails{Root: "/docs/a.txt", ZeroDepth: true, Duration: time.Minute}, webdav.ErrLocked},
+		{"infinite above lock", webdav.LockDetails{Root: "/", Duration: time.Minute}, webdav.ErrLocked},
+		{"zero depth above lock", webdav.LockDetails{Root: "/", ZeroDepth: true, Duration: time.Minute}, nil},
+		{"sibling", webdav.LockDetails{Root: "/docs2", Duration: time.Minute}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ls1.Create(now, tt.details); err != tt.want {
+				t.Errorf("Create() on other instance error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// A confirmed lock is held until released, on all instances
+	if _, err := ls1.Confirm(now, "/docs/a.txt", "", webdav.Condition{Token: "unknown"}); err != webdav.ErrConfirmationFailed {
+		t.Errorf("Confirm() with unknown token error = %v, want %v", err, webdav.ErrConfirmationFailed)
+	}
+	release, err := ls1.Confirm(now, "/docs/a.txt", "/docs/b.txt", webdav.Condition{Token: token})
+	if err != nil {
+		t.Fatalf("Confirm() error = %v", err)
+	}
+	if _, err := ls0.Confirm(now, "/docs/a.txt", "", webdav.Condition{Token: token}); err != webdav.ErrConfirmationFailed {
+		t.Errorf("Confirm() of held lock error = %v, want %v", err, webdav.ErrConfirmationFailed)
+	}
+	if err := ls0.Unlock(now, token); err != webdav.ErrLocked {
+		t.Errorf("Unlock() of held lock error = %v, want %v", err, webdav.ErrLocked)
+	}
+	release()
+
+	// Refreshing extends the lock beyond its original expiry
+	later := now.Add(80 * time.Second)
+	if _, err := ls0.Refresh(now.Add(30*time.Second), token, time.Minute); err != nil {
+		t.Errorf("Refresh() error = %v", err)
+	}
+	if err := ls1.Unlock(later, token); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+	if err := ls1.Unlock(later, token); err != webdav.ErrNoSuchLock {
+		t.Errorf("Unlock() of removed lock error = %v, want %v", err, webdav.ErrNoSuchLock)
+	}
+	if _, err := ls0.Create(now.Add(2*time.Minute), webdav.LockDetails{Root: "/docs2/a.txt", Duration: time.Minute}); err != nil {
+		t.Errorf("Create() below expired lock error = %v", err)
+	}
+}
+
+func TestDeadProps(t *testing.T) {
+	_, first, second := openTestRedis(t)
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "docs"), 0700)
+	os.WriteFile(filepath.Join(dir, "docs", "a.txt"), []byte("a"), 0600)
+	// Two instances serving the same directory
+	instance := func(state *redisState) *App {
+		cfg := &Config{Dir: dir, Log: Logging{Create: true}, HA: true, redis: state,
+			Users: map[string]*UserInfo{"foo": {Crud: newCrudType("crud")}}}
+		return &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: cfg.LockSystem()}}
+	}
+	apps := []*App{instance(first), instance(second)}
+	serve := func(a *App, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "foo", Authenticated: true})
+		serveWebdav(a, ctx, w, r, "foo")
+		return w
+	}
+	const patch = `<?xml version="1.0"?><D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:example"><D:set><D:prop><Z:color>red</Z:color></D:prop></D:set></D:propertyupdate>`
+	const find = `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:prop><Z:color xmlns:Z="urn:example"/></D:prop></D:propfind>`
+
+	for _, path := range []string{"/docs/a.txt", "/docs"} {
+		if w := serve(apps[0], "PROPPATCH", path, patch); w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "200 OK") {
+			t.Errorf("PROPPATCH %s = %d %s, want the property set", path, w.Code, w.Body.String())
+		}
+		if w := serve(apps[1], "PROPFIND", path, find, "Depth", "0"); !strings.Contains(w.Body.String(), ">red<") {
+			t.Errorf("PROPFIND %s on other instance = %s, want the property", path, w.Body.String())
+		}
+	}
+
+	// Properties move with the files, also below a renamed directory
+	if w := serve(apps[0], "MOVE", "/docs", "", "Destination", "http://example.com/moved"); w.Code != http.StatusCreated {
+		t.Fatalf("MOVE = %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(apps[1], "PROPFIND", "/moved/a.txt", find, "Depth", "0"); !strings.Contains(w.Body.String(), ">red<") {
+		t.Errorf("PROPFIND of moved file = %s, want the property", w.Body.String())
+	}
+	if w := serve(apps[1], "DELETE", "/moved", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d %s", w.Code, w.Body.String())
+	}
+	if keys, _ := first.client.Keys(context.Background(), first.prefix+"props:*").Result(); len(keys) != 0 {
+		t.Errorf("properties of deleted files = %v, want none", keys)
+	}
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// genHash hashes a password with the pepper and the algorithm and cost of the security settings.
+func (cfg *Config) genHash(password []byte) (string, error) {
+	password = []byte(PepperPassword(string(password), cfg.pepper))
+	if cfg.Security == nil {
+		return GenHashWith(HashBcrypt, password)
+	}
+	return GenHashWithCost(cfg.Security.HashAlgorithm, cfg.Security.HashCost, password)
+}
+
+// warnWeakHashes warns about the bcrypt hashes of users below the configured cost.
+func (cfg *Config) warnWeakHashes() {
+	if cfg.Security == nil || cfg.Security.HashCost == 0 {
+		return
+	}
+	for username, user := range cfg.Users {
+		if cost, err := bcrypt.Cost([]byte(user.Password)); err == nil && cost < cfg.Security.HashCost {
+			log.WithFields(log.Fields{"user": username, "cost": cost, "minimum": cfg.Security.HashCost}).Warn("Password hash of user is below the configured cost, rehash it or enable upgrade_hashes")
+		}
+	}
+}
+
+// upgradeHash rehashes the password of a user who just logged in with the configured algorithm, if the stored
+// hash is weaker, and persists it: in the configuration file for its users, in the user store for the ones of
+// the store. Users of the htpasswd file, of external sources and with referenced secrets keep their hashes.
+func (cfg *Config) upgradeHash(username string, user *UserInfo, password string) {
+	if cfg.Security == nil || !cfg.Security.UpgradeHashes || cfg.fileUsers[username] || user.passwordRef != "" ||
+		!needsRehash(user.Password, cfg.Security.HashAlgorithm, cfg.Security.HashCost) {
+		return
+	}
+	hash, err := cfg.genHash([]byte(password))
+	if err != nil {
+		log.WithError(err).WithField("user", username).Error("Error upgrading password hash of user")
+		return
+	}
+	switch {
+	case cfg.Users[username] == user:
+		err = rewritePasswords(viper.ConfigFileUsed(), map[string]string{username: hash})
+	case cfg.userStore != nil:
+		upgraded := *user
+		upgraded.Password = hash
+		err = cfg.userStore.put(username, &upgraded)
+	default:
+		return
+	}
+	if err != nil {
+		log.WithError(err).WithField("user", username).Error("Error persisting upgraded password hash of user")
+		return
+	}
+	user.Password = hash
+	log.WithField("user", username).WithField("algorithm", cfg.Security.HashAlgorithm).Info("Upgraded password hash of user")
+}
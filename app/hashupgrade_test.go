@@ -0,0 +1,79 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNeedsRehash(t *testing.T) {
+	cheap, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	current := GenHash([]byte("secret"))
+	argon, _ := GenHashWith(HashArgon2id, []byte("secret"))
+	tests := []struct {
+		hash, algorithm string
+		cost            int
+		want            bool
+	}{
+		{string(cheap), "", 0, true},
+		{current, "", 0, false},
+		{current, "", 12, true},
+		{current, HashBcrypt, 8, false},
+		{current, HashArgon2id, 0, true},
+		{argon, HashArgon2id, 0, false},
+		{"$argon2id$v=19$m=4096,t=1,p=1$c2FsdA$a2V5", HashArgon2id, 0, true},
+		{argon, HashBcrypt, 0, true},
+	}
+	for _, tt := range tests {
+		if got := needsRehash(tt.hash, tt.algorithm, tt.cost); got != tt.want {
+			t.Errorf("needsRehash(%s, %q, %d) = %v, want %v", tt.hash, tt.algorithm, tt.cost, got, tt.want)
+		}
+	}
+}
+
+func TestUpgradeHash(t *testing.T) {
+	cheap, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("users:\n  alice:\n    password: \""+string(cheap)+"\" # cheap\n"), 0o600)
+	viper.Reset()
+	viper.SetConfigFile(path)
+	defer viper.Reset()
+
+	cfg := &Config{
+		Security: &Security{HashAlgorithm: HashArgon2id, UpgradeHashes: true},
+		Users:    map[string]*UserInfo{"alice": {Password: string(cheap), Crud: newCrudType("r")}},
+	}
+	if info, err := authenticate(cfg, "alice", "secret"); err != nil || !info.Authenticated {
+		t.Fatalf("authenticate() = %v, %v", info, err)
+	}
+	hash := cfg.Users["alice"].Password
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		t.Fatalf("password after login = %s, want an argon2id hash", hash)
+	}
+	content, _ := os.ReadFile(path)
+	if !strings.Contains(string(content), `password: "`+hash+`" # cheap`) {
+		t.Errorf("configuration file = %s, want the upgraded hash", content)
+	}
+	if _, err := authenticate(cfg, "alice", "secret"); err != nil {
+		t.Errorf("authenticate() with the upgraded hash = %v", err)
+	}
+}
+
+func TestGenHashWithCost(t *testing.T) {
+	hash, err := GenHashWithCost(HashBcrypt, 11, []byte("secret"))
+	if err != nil {
+		t.Fatalf("GenHashWithCost() error = %v", err)
+	}
+	if cost, _ := bcrypt.Cost([]byte(hash)); cost != 11 {
+		t.Errorf("cost of hash = %d, want 11", cost)
+	}
+	cfg := &Config{Security: &Security{HashCost: 5}}
+	hash, _ = cfg.genHash([]byte("secret"))
+	if cost, _ := bcrypt.Cost([]byte(hash)); cost != 5 {
+		t.Errorf("cost of configured hash = %d, want 5", cost)
+	}
+}
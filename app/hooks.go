@@ -0,0 +1,264 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultHookTimeout bounds the runtime of a hook if no timeout is configured.
+const defaultHookTimeout = 30 * time.Second
+
+// Operations which can trigger hooks.
+const (
+	OperationUpload = "upload"
+	OperationDelete = "delete"
+	OperationMove   = "move"
+)
+
+// Event describes a file operation passed to hooks.
+type Event struct {
+	Operation   string
+	User        string
+	Path        string
+	Destination string
+	Size        int64
+	Result      string
+}
+
+// statusWriter records the status code and the number of bytes written by the wrapped handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	written atomic.Int64
+}
+
+// WriteHeader records the status code before passing it on.
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write records an implicit 200 status before passing the data on.
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written.Add(int64(n))
+	return n, err
+}
+
+// hookFor returns the configured hook for the given operation.
+func (hooks *Hooks) hookFor(operation string) Hook {
+	switch operation {
+	case OperationUpload:
+		return hooks.Upload
+	case OperationDelete:
+		return hooks.Delete
+	case OperationMove:
+		return hooks.Move
+	}
+	return Hook{}
+}
+
+// operationFromMethod maps a request method to an operation which can trigger hooks.
+func operationFromMethod(method string) string {
+	switch method {
+	case http.MethodPut:
+		return OperationUpload
+	case http.MethodDelete:
+		return OperationDelete
+	case Move:
+		return OperationMove
+	}
+	return ""
+}
+
+// eventFromRequest builds the event of a request, the paths are relative to the configured prefix.
+func eventFromRequest(a *App, operation, username string, req *http.Request) *Event {
+	event := &Event{
+		Operation: operation,
+		User:      username,
+		Path:      path.Clean("/" + strings.TrimPrefix(req.URL.Path, a.Config.prefixOf(username))),
+		Size:      req.ContentLength,
+	}
+	if destination := req.Header.Get("Destination"); destination != "" {
+		if u, err := url.Parse(destination); err == nil {
+			event.Destination = path.Clean("/" + strings.TrimPrefix(u.Path, a.Config.prefixOf(username)))
+		}
+	}
+	return event
+}
+
+// runHook executes command with the event exposed as environment variables.
+func runHook(command string, event *Event, timeout time.Duration) error {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+	cmd.Env = append(os.Environ(),
+		"DAVID_OPERATION="+event.Operation,
+		"DAVID_USER="+event.User,
+		"DAVID_PATH="+event.Path,
+		"DAVID_DESTINATION="+event.Destination,
+		"DAVID_SIZE="+strconv.FormatInt(event.Size, 10),
+		"DAVID_RESULT="+event.Result,
+	)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return errors.New("hook timed out")
+	}
+	if err != nil && len(output) > 0 {
+		return errors.New(strings.TrimSpace(string(output)))
+	}
+	return err
+}
+
+// serveWebdav serves the request with the webdav handler, surrounded by the configured hooks.
+// A failing pre hook vetoes the operation with 403 Forbidden, post hooks and event plugins run in the background.
+// The transferred bytes are accounted to the user, uploads beyond the limit of the user are aborted with 413
+// and writes failing for lack of storage are answered with 507. Uploads not matching their checksum are answered with 400.
+func serveWebdav(a *App, ctx context.Context, w http.ResponseWriter, req *http.Request, username string) {
+	// The files of encrypted users are only served with their key, which pre-signed links don't carry
+	if a.Config.encrypts(username) && encryptionKeyOf(ctx) == nil {
+		writeDAVError(w, http.StatusForbidden, conditionOperationDenied)
+		return
+	}
+	// Paths beyond the limits of length and depth can't be created
+	if rejectPathLimits(a.Config, w, req, username) {
+		return
+	}
+	// Writes beyond the concurrency limit of the user are refused until others finish
+	release, ok := acquireWrite(a.Config, w, req, username)
+	if !ok {
+		return
+	}
+	defer release()
+	operation := operationFromMethod(req.Method)
+	hook := a.Config.Hooks.hookFor(operation)
+	var event *Event
+	if operation != "" && (hook.Pre != "" || hook.Post != "" || len(a.Config.eventPlugins) != 0 || a.Config.thumbnailer != nil || a.Config.siem != nil) {
+		event = eventFromRequest(a, operation, username, req)
+	}
+
+	// Run the pre hook, any non zero exit code vetoes the operation
+	if event != nil && hook.Pre != "" {
+		if err := runHook(hook.Pre, event, a.Config.Hooks.Timeout); err != nil {
+			log.WithFields(log.Fields{"operation": operation, "user": username, "path": event.Path}).WithError(err).Warn("Pre hook vetoed operation")
+			writeDAVError(w, http.StatusForbidden, conditionOperationDenied)
+			return
+		}
+	}
+
+	if req.Body == nil {
+		req.Body = http.NoBody
+	}
+	lw, cleanup := limitUpload(a, ctx, w, req, username)
+	if lw == nil {
+		return
+	}
+	defer cleanup()
+	if req.Method == http.MethodPut {
+		// Staged uploads are discarded if their body couldn't be read completely or doesn't match its checksum,
+		// the size is preallocated
+		upload, err := newUploadBody(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Body = upload
+		ctx = context.WithValue(ctx, uploadBodyKey, upload)
+		lw = &checksumWriter{ResponseWriter: lw, body: upload}
+	}
+	body := &countingReader{ReadCloser: req.Body}
+	req.Body = body
+	failure := &failureRecorder{}
+	ctx = context.WithValue(ctx, failureKey, failure)
+	if req.Method == http.MethodPut && strings.EqualFold(req.Header.Get(clientEncryptedHeader), "true") {
+		ctx = context.WithValue(ctx, clientEncryptedKey, true)
+	}
+	if reason := req.Header.Get(retentionOverrideHeader); reason != "" {
+		ctx = context.WithValue(ctx, retentionOverrideKey, reason)
+	}
+	sw := &statusWriter{ResponseWriter: &davErrorWriter{ResponseWriter: &failureWriter{ResponseWriter: lw, recorder: failure}, req: req}}
+	t := &transfer{User: username, Method: req.Method, Path: req.URL.Path, Started: time.Now(), Size: req.ContentLength, body: body, writer: sw}
+	stats.begin(t)
+	// The hrefs in the responses have to contain the prefix of the user, files get strong ETags
+	handler := *a.Handler
+	handler.Prefix = a.Config.prefixOf(username)
+	handler.FileSystem = etagFS{a.Handler.FileSystem}
+	// The files of encrypted users are encrypted with their key, below the ETags which hash the size of the content
+	if key := encryptionKeyOf(ctx); key != nil {
+		handler.FileSystem = etagFS{encryptedFS{FileSystem: a.Handler.FileSystem, key: key}}
+	}
+	// Dead properties are kept in the property store, shared by all instances in high availability mode
+	if store := a.Config.propertyStore(); store != nil {
+		handler.FileSystem = deadPropsFS{FileSystem: handler.FileSystem, store: store, config: a.Config}
+	}
+	if (req.Method == http.MethodGet || req.Method == http.MethodHead) && a.Config.clientEncrypted(ctx, Resolve(ctx, strings.TrimPrefix(req.URL.Path, handler.Prefix), Dir{a.Config})) {
+		w.Header().Set(clientEncryptedHeader, "true")
+	}
+	coalesceRequestRanges(ctx, handler.FileSystem, req, strings.TrimPrefix(req.URL.Path, handler.Prefix))
+	handler.ServeHTTP(sw, req.WithContext(ctx))
+	stats.end(t)
+	if sw.status < http.StatusBadRequest {
+		markClientEncrypted(a, ctx, req, handler.Prefix)
+	}
+	if a.Config.indexer != nil && sw.status < http.StatusBadRequest {
+		a.Config.indexer.indexRequest(ctx, a.Config, req, handler.Prefix)
+	}
+	if failure.status == http.StatusInsufficientStorage {
+		reportDiskFull(a.Config, username, req, failure.reason)
+	}
+	if username != "" {
+		// Only file contents are accounted as transfer, not the XML bodies of webdav methods
+		var uploaded, downloaded int64
+		switch req.Method {
+		case http.MethodPut:
+			uploaded = body.n.Load()
+		case http.MethodGet:
+			downloaded = sw.written.Load()
+		}
+		usage.record(username, req.Method, uploaded, downloaded)
+	}
+	if event == nil {
+		return
+	}
+
+	// Record the outcome of the operation
+	event.Result = "success"
+	if sw.status >= http.StatusBadRequest {
+		event.Result = "failure"
+	}
+	publishEvent(a.Config, event)
+	siemOperation(a.Config, event, a.Config.sourceAddressString(req))
+
+	// Run the post hook with the outcome of the operation
+	if hook.Post != "" {
+		go func() {
+			if err := runHook(hook.Post, event, a.Config.Hooks.Timeout); err != nil {
+				log.WithFields(log.Fields{"operation": operation, "user": username, "path": event.Path}).WithError(err).Error("Post hook failed")
+			}
+		}()
+	}
+}
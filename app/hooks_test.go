@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestRunHook(t *testing.T) {
+	event := &Event{Operation: OperationUpload, User: "foo", Path: "/a.txt", Size: 3}
+
+	// A script asserting the environment passed to the hook
+	script := filepath.Join(t.TempDir(), "hook.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\ntest \"$DAVID_USER:$DAVID_PATH:$DAVID_SIZE\" = foo:/a.txt:3\n"), 0700)
+
+	tests := []struct {
+		name    string
+		command string
+		wantErr bool
+	}{
+		{"empty command", "", false},
+		{"successful command", "true", false},
+		{"failing command", "false", true},
+		{"environment", "sh " + script, false},
+		{"missing command", "/does/not/exist", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := runHook(tt.command, event, 0); (err != nil) != tt.wantErr {
+				t.Errorf("runHook() command = %v, error = %v, wantErr %v", tt.command, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServeWebdavPreHook(t *testing.T) {
+	tests := []struct {
+		name       string
+		pre        string
+		statusCode int
+	}{
+		{"allowed", "true", http.StatusCreated},
+		{"vetoed", "false", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{
+				Config: &Config{Hooks: Hooks{Upload: Hook{Pre: tt.pre}}},
+				Handler: &webdav.Handler{
+					FileSystem: webdav.NewMemFS(),
+					LockSystem: webdav.NewMemLS(),
+				},
+			}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("abc"))
+			serveWebdav(a, context.Background(), w, r, "foo")
+
+			if resp := w.Result(); resp.StatusCode != tt.statusCode {
+				t.Errorf("serveWebdav() = %v, want %v", resp.StatusCode, tt.statusCode)
+			}
+		})
+	}
+}
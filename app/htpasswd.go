@@ -0,0 +1,128 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// UsersFile configures an htpasswd file of additional users, managed with the standard tooling. Its users get
+// the default Permissions and Subdir, in which $user is replaced by the username.
+type UsersFile struct {
+	Path        string
+	Permissions string
+	Subdir      string
+}
+
+// readHtpasswd reads the users and their password hashes from an htpasswd file. Hashes david can't verify,
+// like the MD5 and SHA1 ones of Apache, are skipped with a warning.
+func readHtpasswd(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	users := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		username, hash, ok := strings.Cut(line, ":")
+		if !ok || username == "" {
+			return nil, fmt.Errorf("line %d: malformed entry", number)
+		}
+		if !isPasswordHash(hash) {
+			log.WithFields(log.Fields{"path": path, "user": username}).Warn("Skipped user of htpasswd file with an unsupported hash, use bcrypt (htpasswd -B)")
+			continue
+		}
+		users[username] = hash
+	}
+	return users, scanner.Err()
+}
+
+// loadUsersFile merges the users of the htpasswd file into the users of the configuration, replacing the ones
+// merged before. Users of the configuration file take precedence over the ones of the htpasswd file.
+func (cfg *Config) loadUsersFile() error {
+	if cfg.UsersFile == nil {
+		return nil
+	}
+	hashes, err := readHtpasswd(cfg.UsersFile.Path)
+	if err != nil {
+		return err
+	}
+	// The users are replaced at once, requests keep reading the previous ones meanwhile
+	users := make(map[string]*UserInfo, len(cfg.Users)+len(hashes))
+	for username, user := range cfg.Users {
+		if _, ok := hashes[username]; !ok && cfg.fileUsers[username] {
+			log.WithField("user", username).Info("Removed user of htpasswd file")
+			continue
+		}
+		users[username] = user
+	}
+	merged := map[string]bool{}
+	for username, hash := range hashes {
+		if users[username] != nil && !cfg.fileUsers[username] {
+			log.WithField("user", username).Warn("User of htpasswd file is defined in the configuration, which takes precedence")
+			continue
+		}
+		user := &UserInfo{Password: hash, Permissions: cfg.UsersFile.Permissions, Crud: newCrudType(strings.ToLower(cfg.UsersFile.Permissions))}
+		if cfg.UsersFile.Subdir != "" {
+			subdir := strings.ReplaceAll(cfg.UsersFile.Subdir, "$user", username)
+			user.Subdir = &subdir
+		}
+		if previous := users[username]; previous == nil {
+			log.WithField("user", username).Info("Added user of htpasswd file")
+		} else if previous.Password != hash {
+			log.WithField("user", username).Info("Updated password of user of htpasswd file")
+		}
+		users[username] = user
+		merged[username] = true
+	}
+	cfg.Users = users
+	cfg.fileUsers = merged
+	return nil
+}
+
+// watchUsersFile reloads the htpasswd file whenever it changes. The directory is watched, as tools replace the
+// file instead of writing it.
+func (cfg *Config) watchUsersFile() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	path := filepath.Clean(cfg.UsersFile.Path)
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != path || !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+					continue
+				}
+				if err := cfg.loadUsersFile(); err != nil && !errors.Is(err, os.ErrNotExist) {
+					log.WithError(err).WithField("path", path).Error("Error reloading htpasswd file")
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.WithError(err).WithField("path", path).Error("Error watching htpasswd file")
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadUsersFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	bob, _ := GenHashWith(HashArgon2id, []byte("password"))
+	os.WriteFile(path, []byte("# managed by htpasswd\n"+
+		"alice:"+GenHash([]byte("password"))+"\n"+
+		"bob:"+bob+"\n"+
+		"carol:$apr1$Ol/TNq5b$KqmVRrhHeNjzMK3TxD3An0\n"+
+		"admin:"+GenHash([]byte("other"))+"\n"), 0600)
+	admin := GenHash([]byte("password"))
+	cfg := &Config{
+		Users:     map[string]*UserInfo{"admin": {Password: admin, Crud: newCrudType("crud")}},
+		UsersFile: &UsersFile{Path: path, Permissions: "cr", Subdir: "/home/$user"},
+	}
+	if err := cfg.loadUsersFile(); err != nil {
+		t.Fatal(err)
+	}
+	for _, username := range []string{"alice", "bob"} {
+		info, err := authenticate(cfg, username, "password")
+		if err != nil || !info.Authenticated || !info.CrudType.Create || info.CrudType.Delete {
+			t.Errorf("authenticate(%s) = %v, %v", username, info, err)
+		}
+	}
+	if user := cfg.Users["alice"]; user.Subdir == nil || *user.Subdir != "/home/alice" {
+		t.Errorf("subdir of alice = %v, want /home/alice", user.Subdir)
+	}
+	if cfg.Users["carol"] != nil {
+		t.Errorf("user with an unsupported hash was added")
+	}
+	if cfg.Users["admin"].Password != admin {
+		t.Errorf("user of the configuration was replaced")
+	}
+
+	// Users removed from the file are removed, the ones of the configuration are kept
+	os.WriteFile(path, []byte("alice:"+GenHash([]byte("changed"))+"\n"), 0600)
+	if err := cfg.loadUsersFile(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Users["bob"] != nil || cfg.Users["admin"] == nil {
+		t.Errorf("users after reload = %v", cfg.Users)
+	}
+	if _, err := authenticate(cfg, "alice", "changed"); err != nil {
+		t.Errorf("authenticate() with the changed password = %v", err)
+	}
+
+	os.WriteFile(path, []byte("malformed\n"), 0600)
+	if err := cfg.loadUsersFile(); err == nil {
+		t.Errorf("loadUsersFile() of a malformed file succeeded")
+	}
+}
+
+func TestWatchUsersFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	os.WriteFile(path, nil, 0600)
+	cfg := &Config{UsersFile: &UsersFile{Path: path, Permissions: "r"}}
+	if err := cfg.loadUsersFile(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.watchUsersFile(); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, []byte("alice:"+GenHash([]byte("password"))+"\n"), 0600)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := authenticate(cfg, "alice", "password"); err == nil {
+			return
+		}
+	}
+	t.Errorf("user added to the htpasswd file wasn't loaded")
+}
@@ -0,0 +1,388 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults of the content indexer.
+const (
+	defaultIndexInterval       = time.Hour
+	defaultIndexMaxContentSize = 10 << 20
+	indexPDFTimeout            = 30 * time.Second
+)
+
+// Index configures the search index of file names kept in the SQLite database File. With Content, the text of
+// files up to MaxContentSize is indexed as well, PDFs are converted by PDFCommand (e.g. "pdftotext") if set.
+// The index is updated by the requests changing files and reconciled with the tree every Interval.
+type Index struct {
+	File           string
+	Content        bool
+	MaxContentSize int64
+	PDFCommand     string
+	Interval       time.Duration
+}
+
+// indexSchema creates the tables of the index, files hold the metadata and text the full text searchable columns
+// with the same rowid. Meta holds the tags (with an empty name) and the text of the dead properties of the files.
+var indexSchema = []string{
+	`CREATE TABLE IF NOT EXISTS david_index_files (
+		id INTEGER PRIMARY KEY,
+		path TEXT NOT NULL UNIQUE,
+		size INTEGER NOT NULL,
+		modified INTEGER NOT NULL,
+		dir BOOLEAN NOT NULL
+	)`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS david_index_text USING fts5(name, content)`,
+	`CREATE TABLE IF NOT EXISTS david_index_meta (
+		file_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		value TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS david_index_meta_file ON david_index_meta (file_id)`,
+	`CREATE INDEX IF NOT EXISTS david_index_meta_value ON david_index_meta (name, value)`,
+}
+
+// indexUpdate is a change of the tree to apply to the index, the removal is applied first.
+// Meta is a path whose tags and metadata changed.
+type indexUpdate struct {
+	remove string
+	add    string
+	meta   string
+}
+
+// indexer maintains the search index of the physical paths of the served trees, tenants share it.
+type indexer struct {
+	db      *sql.DB
+	config  *Index
+	props   propertyStore
+	updates chan indexUpdate
+}
+
+// openIndexer opens the index database and creates its tables if necessary.
+func openIndexer(cfg *Index) (*indexer, error) {
+	db, err := sql.Open("sqlite", cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite doesn't allow concurrent writers, a single connection serializes them
+	db.SetMaxOpenConns(1)
+	for _, statement := range indexSchema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &indexer{db: db, config: cfg, updates: make(chan indexUpdate, 1024)}, nil
+}
+
+// content returns the text of a file to index, empty if content indexing is disabled or it isn't text.
+func (ix *indexer) content(name string, size int64) string {
+	maxSize := ix.config.MaxContentSize
+	if maxSize <= 0 {
+		maxSize = defaultIndexMaxContentSize
+	}
+	if !ix.config.Content || size == 0 || size > maxSize {
+		return ""
+	}
+	if strings.EqualFold(filepath.Ext(name), ".pdf") {
+		if ix.config.PDFCommand == "" {
+			return ""
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), indexPDFTimeout)
+		defer cancel()
+		fields := strings.Fields(ix.config.PDFCommand)
+		output, err := exec.CommandContext(ctx, fields[0], append(fields[1:], name, "-")...).Output()
+		if err != nil {
+			log.WithError(err).WithField("path", name).Debug("Error extracting text of PDF")
+			return ""
+		}
+		return strings.ToValidUTF8(string(output), "")
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	b, err := io.ReadAll(io.LimitReader(f, maxSize))
+	if err != nil || !strings.HasPrefix(http.DetectContentType(b), "text/") || !utf8.Valid(b) {
+		return ""
+	}
+	return string(b)
+}
+
+// indexFile adds or updates a file or directory of the tree of cfg, unchanged ones are skipped.
+// The content of files encrypted by their clients isn't indexed.
+func (ix *indexer) indexFile(cfg *Config, name string, info os.FileInfo) error {
+	var id, size, modified int64
+	err := ix.db.QueryRow(`SELECT id, size, modified FROM david_index_files WHERE path = ?`, name).Scan(&id, &size, &modified)
+	if err == nil && size == info.Size() && modified == info.ModTime().UnixNano() {
+		return nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	var content string
+	if !info.IsDir() && !cfg.clientEncrypted(context.Background(), name) {
+		content = ix.content(name, info.Size())
+	}
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if id != 0 {
+		if _, err := tx.Exec(`UPDATE david_index_files SET size = ?, modified = ?, dir = ? WHERE id = ?`, info.Size(), info.ModTime().UnixNano(), info.IsDir(), id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM david_index_text WHERE rowid = ?`, id); err != nil {
+			return err
+		}
+	} else {
+		result, err := tx.Exec(`INSERT INTO david_index_files (path, size, modified, dir) VALUES (?, ?, ?, ?)`, name, info.Size(), info.ModTime().UnixNano(), info.IsDir())
+		if err != nil {
+			return err
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO david_index_text (rowid, name, content) VALUES (?, ?, ?)`, id, filepath.Base(name), content); err != nil {
+		return err
+	}
+	if err := ix.indexMeta(tx, id, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// indexMeta replaces the tags and dead properties of an indexed file by the ones of the property store.
+func (ix *indexer) indexMeta(tx *sql.Tx, id int64, name string) error {
+	if _, err := tx.Exec(`DELETE FROM david_index_meta WHERE file_id = ?`, id); err != nil {
+		return err
+	}
+	if ix.props == nil {
+		return nil
+	}
+	props, err := ix.props.props(context.Background(), name)
+	if err != nil {
+		return err
+	}
+	for _, tag := range metadataOf(props).Tags {
+		if _, err := tx.Exec(`INSERT INTO david_index_meta (file_id, name, value) VALUES (?, '', ?)`, id, tag); err != nil {
+			return err
+		}
+	}
+	for name, p := range props {
+		if opaqueProperties[name] {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO david_index_meta (file_id, name, value) VALUES (?, ?, ?)`, id, propertyField(name), propertyText(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshMeta updates the tags and metadata of an indexed file after its properties changed.
+func (ix *indexer) refreshMeta(name string) error {
+	var id int64
+	if err := ix.db.QueryRow(`SELECT id FROM david_index_files WHERE path = ?`, name).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := ix.indexMeta(tx, id, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// remove removes a path and everything below it from the index.
+func (ix *indexer) remove(name string) error {
+	return ix.removeExcept(name, nil)
+}
+
+// removeExcept removes a path and everything below it from the index, except the paths kept.
+func (ix *indexer) removeExcept(name string, keep map[string]bool) error {
+	prefix := below(name)
+	rows, err := ix.db.Query(`SELECT id, path FROM david_index_files WHERE path = ? OR path >= ? AND path < ? || x'ff'`, name, prefix, prefix)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var p string
+		if err := rows.Scan(&id, &p); err != nil {
+			rows.Close()
+			return err
+		}
+		if !keep[p] {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, id := range ids {
+		if _, err := tx.Exec(`DELETE FROM david_index_files WHERE id = ?`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM david_index_text WHERE rowid = ?`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM david_index_meta WHERE file_id = ?`, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// indexTree indexes a path and everything below it and returns the indexed paths.
+// Staged uploads aren't indexed.
+func (ix *indexer) indexTree(cfg *Config, root string) (map[string]bool, error) {
+	seen := map[string]bool{}
+	err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if name == root {
+				return err
+			}
+			return nil
+		}
+		if cfg.Staging != nil {
+			if cfg.Staging.Dir != "" && filepath.Clean(cfg.Staging.Dir) == name {
+				return filepath.SkipDir
+			}
+			if cfg.Staging.Dir == "" && strings.HasSuffix(name, cfg.Staging.suffix()) {
+				return nil
+			}
+		}
+		seen[name] = true
+		if err := ix.indexFile(cfg, name, info); err != nil {
+			log.WithError(err).WithField("path", name).Warn("Error indexing file")
+		}
+		return nil
+	})
+	return seen, err
+}
+
+// reconcile brings the index of the base directory in sync with the tree, which covers the changes
+// not made through the server.
+func (ix *indexer) reconcile(cfg *Config) error {
+	root := filepath.Clean(cfg.Dir)
+	seen, err := ix.indexTree(cfg, root)
+	if err != nil {
+		return err
+	}
+	return ix.removeExcept(root, seen)
+}
+
+// enqueue schedules an update of the index, which is dropped if the queue is full;
+// the next reconciliation catches up with it.
+func (ix *indexer) enqueue(update indexUpdate) {
+	select {
+	case ix.updates <- update:
+	default:
+		log.WithFields(log.Fields{"remove": update.remove, "add": update.add, "meta": update.meta}).Warn("Index queue is full, dropping update")
+	}
+}
+
+// indexRequest schedules the update of the index for a successful request changing the tree.
+func (ix *indexer) indexRequest(ctx context.Context, cfg *Config, req *http.Request, prefix string) {
+	source := Resolve(ctx, strings.TrimPrefix(req.URL.Path, prefix), Dir{Config: cfg})
+	var destination string
+	if u, err := url.Parse(req.Header.Get("Destination")); err == nil && u.Path != "" {
+		destination = Resolve(ctx, path.Clean("/"+strings.TrimPrefix(u.Path, prefix)), Dir{Config: cfg})
+	}
+	switch req.Method {
+	case http.MethodPut, "MKCOL":
+		ix.enqueue(indexUpdate{add: source})
+	case http.MethodDelete:
+		ix.enqueue(indexUpdate{remove: source})
+	case Move:
+		ix.enqueue(indexUpdate{remove: source, add: destination})
+	case "COPY":
+		ix.enqueue(indexUpdate{add: destination})
+	case Propatch:
+		ix.enqueue(indexUpdate{meta: source})
+	}
+}
+
+// start applies the queued updates and periodically reconciles the index of the main configuration and the tenants.
+func (ix *indexer) start(cfg *Config) {
+	go func() {
+		for update := range ix.updates {
+			if update.remove != "" {
+				if err := ix.remove(update.remove); err != nil {
+					log.WithError(err).WithField("path", update.remove).Warn("Error removing path from index")
+				}
+			}
+			if update.add != "" {
+				if _, err := ix.indexTree(cfg.configOf(update.add), update.add); err != nil {
+					log.WithError(err).WithField("path", update.add).Debug("Error indexing path")
+				}
+			}
+			if update.meta != "" {
+				if err := ix.refreshMeta(update.meta); err != nil {
+					log.WithError(err).WithField("path", update.meta).Warn("Error indexing metadata")
+				}
+			}
+		}
+	}()
+	interval := ix.config.Interval
+	if interval <= 0 {
+		interval = defaultIndexInterval
+	}
+	go func() {
+		for {
+			configs := []*Config{cfg}
+			for _, tenant := range cfg.tenants {
+				configs = append(configs, tenant)
+			}
+			for _, c := range configs {
+				if err := ix.reconcile(c); err != nil {
+					log.WithError(err).WithField("path", c.Dir).Error("Error reconciling index")
+				}
+			}
+			var files int
+			ix.db.QueryRow(`SELECT COUNT(*) FROM david_index_files`).Scan(&files)
+			metrics.Set("david_index_files", "Files and directories in the search index.", float64(files))
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// configOf returns the configuration of the main directory or tenant holding the physical path.
+func (cfg *Config) configOf(name string) *Config {
+	for _, tenant := range cfg.tenants {
+		if _, ok := tenant.relPath(name); ok {
+			return tenant
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexer(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "docs"), 0700)
+	os.WriteFile(filepath.Join(dir, "docs", "notes.txt"), []byte("the quick brown fox"), 0600)
+	os.WriteFile(filepath.Join(dir, "docs", "holiday_photo.jpg"), []byte{0xff, 0xd8, 0xff, 0xe0, 0, 0x10}, 0600)
+	os.WriteFile(filepath.Join(dir, "docs", "upload.txt.part"), []byte("staged"), 0600)
+	ix, err := openIndexer(&Index{File: filepath.Join(t.TempDir(), "index.db"), Content: true})
+	if err != nil {
+		t.Fatalf("openIndexer() error = %v", err)
+	}
+	cfg := &Config{Dir: dir, Staging: &Staging{Suffix: ".part"}}
+	if err := ix.reconcile(cfg); err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+
+	match := func(query string) []string {
+		rows, err := ix.db.Query(`SELECT f.path FROM david_index_text t JOIN david_index_files f ON f.id = t.rowid WHERE david_index_text MATCH ? ORDER BY f.path`, query)
+		if err != nil {
+			t.Fatalf("MATCH %q error = %v", query, err)
+		}
+		defer rows.Close()
+		var paths []string
+		for rows.Next() {
+			var p string
+			rows.Scan(&p)
+			rel, _ := filepath.Rel(dir, p)
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		return paths
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"quick", []string{"docs/notes.txt"}},
+		{"name:holiday", []string{"docs/holiday_photo.jpg"}},
+		{"docs", []string{"docs"}},
+		{"staged", nil},
+	}
+	for _, tt := range tests {
+		if got := match(tt.query); len(got) != len(tt.want) || len(got) != 0 && got[0] != tt.want[0] {
+			t.Errorf("MATCH %q = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// Changes made outside of the server are picked up by the next reconciliation
+	os.Remove(filepath.Join(dir, "docs", "notes.txt"))
+	os.WriteFile(filepath.Join(dir, "docs", "todo.txt"), []byte("quick wins"), 0600)
+	if err := ix.reconcile(cfg); err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	if got := match("quick"); len(got) != 1 || got[0] != "docs/todo.txt" {
+		t.Errorf("MATCH quick after changes = %v, want [docs/todo.txt]", got)
+	}
+	if err := ix.remove(filepath.Join(dir, "docs")); err != nil {
+		t.Fatalf("remove() error = %v", err)
+	}
+	var files int
+	ix.db.QueryRow(`SELECT COUNT(*) FROM david_index_files`).Scan(&files)
+	if files != 1 {
+		t.Errorf("indexed files after removing docs = %d, want only the base directory", files)
+	}
+
+	// Directories with multibyte names are removed with everything below them
+	os.MkdirAll(filepath.Join(dir, "Ä"), 0700)
+	os.WriteFile(filepath.Join(dir, "Ä", "umlaut.txt"), []byte("umlaut"), 0600)
+	if err := ix.reconcile(cfg); err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	if err := ix.remove(filepath.Join(dir, "Ä")); err != nil {
+		t.Fatalf("remove() error = %v", err)
+	}
+	if got := match("umlaut"); len(got) != 0 {
+		t.Errorf("MATCH umlaut after removing Ä = %v, want none", got)
+	}
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultJanitorInterval is used when no interval of the janitor is configured.
+const defaultJanitorInterval = time.Hour
+
+// Janitor configures the periodic removal of empty directories, which sync clients tend to leave behind.
+// Directories modified within MinAge and the Exclude paths (relative to the base directory) are kept.
+type Janitor struct {
+	Interval time.Duration
+	MinAge   time.Duration
+	Exclude  []string
+}
+
+// dirRemover is implemented by storage backends able to remove a directory only if it's empty.
+// The janitor relies on it, so files created while it's running are never removed.
+type dirRemover interface {
+	Remove(name string) error
+}
+
+// Remove removes a file or an empty directory with os.Remove.
+func (osStorage) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// keepDir reports whether the directory at the path relative to the base directory has to be kept even if empty:
+// excluded ones, the directories of users and staged uploads and the ones of append-only trees.
+func (cfg *Config) keepDir(name, rel string) bool {
+	for _, exclude := range cfg.Janitor.Exclude {
+		if hasFilePathPrefix(rel, path.Clean("/"+exclude)) {
+			return true
+		}
+	}
+	for username, user := range cfg.Users {
+		if subdir, _ := cfg.subdirOf(username, user); subdir != "" && foldPath(rel) == foldPath(path.Clean("/"+filepath.ToSlash(subdir))) {
+			return true
+		}
+	}
+	if cfg.Staging != nil && cfg.Staging.Dir != "" && filepath.Clean(cfg.Staging.Dir) == name {
+		return true
+	}
+	return cfg.inAppendOnly(name, true)
+}
+
+// sweepEmptyDirs removes the empty directories below the base directory which are older than the minimum age
+// and returns their number. Directories only holding empty directories are removed along with them.
+func (cfg *Config) sweepEmptyDirs(now time.Time) int {
+	storage := Dir{Config: cfg}.storage()
+	remover, ok := storage.(dirRemover)
+	if !ok {
+		log.Warn("Storage doesn't support the removal of empty directories")
+		return 0
+	}
+	removed := 0
+	// sweep removes the empty directories below name and reports whether it's empty afterwards
+	var sweep func(name string) bool
+	sweep = func(name string) bool {
+		f, err := storage.OpenFile(name, os.O_RDONLY, 0)
+		if err != nil {
+			return false
+		}
+		infos, err := f.Readdir(-1)
+		f.Close()
+		if err != nil {
+			return false
+		}
+		empty := true
+		for _, info := range infos {
+			child := filepath.Join(name, info.Name())
+			// The age of the directory is taken before its empty children are removed
+			if !info.IsDir() || !sweep(child) || now.Sub(info.ModTime()) < cfg.Janitor.MinAge {
+				empty = false
+				continue
+			}
+			if rel, ok := cfg.relPath(child); !ok || cfg.keepDir(child, rel) {
+				empty = false
+				continue
+			}
+			if err := remover.Remove(child); err != nil {
+				empty = false
+				continue
+			}
+			log.WithField("path", child).Debug("Removed empty directory")
+			removed++
+		}
+		return empty
+	}
+	sweep(filepath.Clean(cfg.Dir))
+	return removed
+}
+
+// startJanitor periodically removes the empty directories of the main configuration and the tenants.
+func (cfg *Config) startJanitor() {
+	interval := cfg.Janitor.Interval
+	if interval <= 0 {
+		interval = defaultJanitorInterval
+	}
+	go func() {
+		for now := range time.Tick(interval) {
+			configs := []*Config{cfg}
+			for _, tenant := range cfg.tenants {
+				configs = append(configs, tenant)
+			}
+			for _, c := range configs {
+				if c.Janitor == nil {
+					continue
+				}
+				if removed := c.sweepEmptyDirs(now); removed != 0 {
+					log.WithFields(log.Fields{"path": c.Dir, "removed": removed}).Info("Removed empty directories")
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSweepEmptyDirs(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"hollow/a/b", "recent", "keep/empty", "alice", "data/file", "backups/empty", "staging"} {
+		os.MkdirAll(filepath.Join(dir, name), 0700)
+	}
+	os.WriteFile(filepath.Join(dir, "data", "file", "content.txt"), []byte("content"), 0600)
+	for _, name := range []string{"hollow/a/b", "hollow/a", "hollow", "keep/empty", "keep", "alice", "data/file", "data", "backups/empty", "backups", "staging"} {
+		os.Chtimes(filepath.Join(dir, name), old, old)
+	}
+	alice := "/alice"
+	cfg := &Config{
+		Dir:        dir,
+		Janitor:    &Janitor{MinAge: 24 * time.Hour, Exclude: []string{"keep"}},
+		Users:      map[string]*UserInfo{"alice": {Subdir: &alice}},
+		AppendOnly: []string{"/backups"},
+		Staging:    &Staging{Dir: filepath.Join(dir, "staging")},
+	}
+
+	if removed := cfg.sweepEmptyDirs(time.Now()); removed != 3 {
+		t.Errorf("sweepEmptyDirs() = %d, want 3", removed)
+	}
+	tests := []struct {
+		name   string
+		exists bool
+	}{
+		{"hollow", false},
+		{"recent", true},
+		{"keep/empty", true},
+		{"alice", true},
+		{"data/file", true},
+		{"backups/empty", true},
+		{"staging", true},
+	}
+	for _, tt := range tests {
+		if _, err := os.Stat(filepath.Join(dir, tt.name)); (err == nil) != tt.exists {
+			t.Errorf("%s exists = %v, want %v", tt.name, err == nil, tt.exists)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// JWT configures the bearer tokens of automation clients, signed with HS256 and the shared Secret.
+type JWT struct {
+	Secret string
+	// MaxTTL limits the lifetime of the tokens, later expiries are refused. Zero allows any.
+	MaxTTL time.Duration
+}
+
+// jwtClaims are the claims of a token: the username in sub, the permissions and the path the token is limited
+// to, below the URL prefix of the user. The expiry is required.
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Crud  string `json:"crud,omitempty"`
+	Scope string `json:"scope,omitempty"`
+}
+
+// IssueJWT signs a token for the user, limited to the permissions crud (the ones of the user if empty) and the
+// path scope (anything if empty), which expires after ttl.
+func IssueJWT(cfg *Config, username, crud, scope string, ttl time.Duration) (string, error) {
+	if cfg.JWT == nil || cfg.JWT.Secret == "" {
+		return "", errors.New("jwt is not configured")
+	}
+	if ttl <= 0 {
+		return "", errors.New("tokens have to expire")
+	}
+	if scope != "" {
+		scope = path.Clean("/" + scope)
+	}
+	now := time.Now()
+	claims := jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   username,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+		Crud:  crud,
+		Scope: scope,
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.JWT.Secret))
+}
+
+// bearerToken returns the token of the Authorization header, empty if it isn't a bearer token.
+func bearerToken(req *http.Request) string {
+	scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticateJWT verifies the bearer token of the request. It returns nil if there's no bearer token, so other
+// methods of authentication apply, and an unauthenticated AuthInfo if the token is invalid.
+func authenticateJWT(cfg *Config, req *http.Request) *AuthInfo {
+	if cfg.JWT == nil || cfg.JWT.Secret == "" {
+		return nil
+	}
+	token := bearerToken(req)
+	if token == "" {
+		return nil
+	}
+	denied := &AuthInfo{Authenticated: false, CrudType: &testCrudType}
+	var claims jwtClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		// Only the shared secret is accepted, a token mustn't choose how it's verified
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method " + t.Method.Alg())
+		}
+		return []byte(cfg.JWT.Secret), nil
+	})
+	switch {
+	case err != nil:
+		log.WithError(err).WithField("address", clientAddress(req)).Warn("Invalid bearer token")
+		return denied
+	case claims.ExpiresAt == nil || claims.Subject == "":
+		log.WithField("address", clientAddress(req)).Warn("Bearer token without expiry or subject")
+		return denied
+	case cfg.JWT.MaxTTL > 0 && time.Until(claims.ExpiresAt.Time) > cfg.JWT.MaxTTL:
+		log.WithFields(log.Fields{"user": claims.Subject, "address": clientAddress(req)}).Warn("Bearer token expires beyond the maximum lifetime")
+		return denied
+	}
+
+	username := claims.Subject
+	user := cfg.storedUser(username)
+	if user == nil || user.Crud == nil {
+		// Tokens only stand for configured users, they can't bring their own
+		log.WithFields(log.Fields{"user": username, "address": clientAddress(req)}).Warn("Bearer token of unknown user")
+		return denied
+	}
+	// The permissions of the token narrow the ones of the user, they never widen them
+	crud := user.Crud
+	if claims.Crud != "" {
+		crud = intersectCrud(user.Crud, newCrudType(claims.Crud))
+	}
+	log.WithFields(log.Fields{"user": username, "crud": crud, "scope": claims.Scope}).Debug("User was authenticated by bearer token")
+	return &AuthInfo{Username: username, Authenticated: true, CrudType: crud, Scope: claims.Scope}
+}
+
+// inScope reports whether the url path lies in the scope of the token, which all paths do without one.
+func (cfg *Config) inScope(authInfo *AuthInfo, urlPath string) bool {
+	if authInfo.Scope == "" {
+		return true
+	}
+	return hasPathPrefix(path.Clean("/"+strings.TrimPrefix(urlPath, cfg.prefixOf(authInfo.Username))), authInfo.Scope)
+}
+
+// rejectOutOfScope answers requests of a token limited to a path, which address other paths, with 403 Forbidden.
+// The destinations of copies and moves have to be in scope as well. It returns false if the request can be served.
+func rejectOutOfScope(cfg *Config, w http.ResponseWriter, req *http.Request, authInfo *AuthInfo) bool {
+	if authInfo.Scope == "" {
+		return false
+	}
+	names := []string{req.URL.Path}
+	if req.Method == Copy || req.Method == Move {
+		u, err := url.Parse(req.Header.Get("Destination"))
+		if err != nil {
+			writeDAVError(w, http.StatusBadRequest, conditionOutOfScope)
+			return true
+		}
+		names = append(names, u.Path)
+	}
+	for _, name := range names {
+		if !cfg.inScope(authInfo, name) {
+			log.WithFields(log.Fields{"user": authInfo.Username, "method": req.Method, "path": name, "scope": authInfo.Scope}).Warn("Refused request outside the scope of the token")
+			writeDAVError(w, http.StatusForbidden, conditionOutOfScope, name)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/net/webdav"
+)
+
+func TestAuthenticateJWT(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "artifacts"), 0700)
+	cfg := &Config{
+		Dir:     dir,
+		Log:     Logging{Create: true},
+		JWT:     &JWT{Secret: "secret", MaxTTL: 48 * time.Hour},
+		Presign: &Presign{Secret: "s3cr3t"},
+		Users: map[string]*UserInfo{
+			"alice": {Password: GenHash([]byte("password")), Crud: newCrudType("r")},
+			"ci":    {Crud: newCrudType("crud")},
+		},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+
+	sign := func(claims jwtClaims, method jwt.SigningMethod, key interface{}) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid, _ := IssueJWT(cfg, "ci", "cr", "/artifacts", time.Hour)
+	readOnly, _ := IssueJWT(cfg, "alice", "", "", time.Hour)
+	widened, _ := IssueJWT(cfg, "alice", "cr", "", time.Hour)
+	narrowed, _ := IssueJWT(cfg, "ci", "r", "", time.Hour)
+	unknown, _ := IssueJWT(cfg, "mallory", "crud", "", time.Hour)
+	expired := sign(jwtClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "ci", ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))}, Crud: "cr"}, jwt.SigningMethodHS256, []byte("secret"))
+	forged := sign(jwtClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "ci", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}, Crud: "cr"}, jwt.SigningMethodHS256, []byte("other"))
+	unsigned := sign(jwtClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "ci", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}, Crud: "cr"}, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType)
+	eternal := sign(jwtClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "ci"}, Crud: "cr"}, jwt.SigningMethodHS256, []byte("secret"))
+	tooLong, _ := IssueJWT(cfg, "ci", "cr", "", 72*time.Hour)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"upload in scope", http.MethodPut, "/artifacts/build.zip", valid, http.StatusCreated},
+		{"upload out of scope", http.MethodPut, "/build.zip", valid, http.StatusForbidden},
+		{"listing in scope", "PROPFIND", "/artifacts", valid, http.StatusMultiStatus},
+		{"endpoint out of scope", http.MethodGet, "/_presign?path=/file.txt", valid, http.StatusForbidden},
+		{"usage out of scope", http.MethodGet, "/_usage", valid, http.StatusForbidden},
+		{"permissions of the user", http.MethodPut, "/file.txt", readOnly, http.StatusForbidden},
+		{"claim beyond the permissions of the user", http.MethodPut, "/file.txt", widened, http.StatusForbidden},
+		{"claim narrowing the permissions of the user", http.MethodPut, "/file.txt", narrowed, http.StatusForbidden},
+		{"unknown subject", "PROPFIND", "/artifacts", unknown, http.StatusUnauthorized},
+		{"expired", "PROPFIND", "/artifacts", expired, http.StatusUnauthorized},
+		{"forged", "PROPFIND", "/artifacts", forged, http.StatusUnauthorized},
+		{"unsigned", "PROPFIND", "/artifacts", unsigned, http.StatusUnauthorized},
+		{"without expiry", "PROPFIND", "/artifacts", eternal, http.StatusUnauthorized},
+		{"beyond the maximum lifetime", "PROPFIND", "/artifacts", tooLong, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := ""
+			if tt.method == http.MethodPut {
+				body = "content"
+			}
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(body))
+			r.Header.Set("Depth", "0")
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, r, a)
+			if w.Code != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejectOutOfScope(t *testing.T) {
+	cfg := &Config{Prefix: "/dav"}
+	authInfo := &AuthInfo{Username: "ci", Authenticated: true, Scope: "/artifacts"}
+	for destination, want := range map[string]bool{"/dav/artifacts/b.zip": false, "/dav/b.zip": true, "/dav/artifacts-old/b.zip": true} {
+		r := httptest.NewRequest(Move, "/dav/artifacts/a.zip", nil)
+		r.Header.Set("Destination", "http://example.com"+destination)
+		w := httptest.NewRecorder()
+		if got := rejectOutOfScope(cfg, w, r, authInfo); got != want {
+			t.Errorf("rejectOutOfScope() of a move to %s = %v, want %v", destination, got, want)
+		}
+	}
+}
+
+func TestJWTRequiresAuthentication(t *testing.T) {
+	cfg := &Config{Dir: t.TempDir(), JWT: &JWT{Secret: "secret"}}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	r := httptest.NewRequest("PROPFIND", "/", nil)
+	r.Header.Set("Depth", "0")
+	w := httptest.NewRecorder()
+	handle(context.Background(), w, r, a)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("PROPFIND without token = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
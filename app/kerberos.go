@@ -0,0 +1,104 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jcmturner/goidentity/v6"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	log "github.com/sirupsen/logrus"
+)
+
+// negotiateScheme is the HTTP authentication scheme of SPNEGO (RFC 4559).
+const negotiateScheme = "Negotiate"
+
+// Kerberos authenticates the tickets of domain members, sent with the Negotiate scheme, with the service key
+// of Keytab, so Windows clients log in with single sign-on. Principal selects the key of the keytab (the one of
+// the ticket if empty). Principals map principals like alice@EXAMPLE.COM to users, regardless of their case.
+// With StripRealm, unmapped principals are the users named like them without the realm. Principals of
+// unknown users are denied.
+type Kerberos struct {
+	Keytab     string
+	Principal  string
+	Principals map[string]string
+	StripRealm bool `mapstructure:"strip_realm"`
+}
+
+// loadKeytab reads the keytab of the service.
+func loadKeytab(k *Kerberos) (*keytab.Keytab, error) {
+	if k.Keytab == "" {
+		return nil, errors.New("kerberos needs a keytab")
+	}
+	return keytab.Load(k.Keytab)
+}
+
+// userOf returns the user a principal maps to, empty if it maps to none.
+func (k *Kerberos) userOf(principal string) string {
+	for name, username := range k.Principals {
+		if strings.EqualFold(name, principal) {
+			return username
+		}
+	}
+	if k.StripRealm {
+		username, _, _ := strings.Cut(principal, "@")
+		return strings.ToLower(username)
+	}
+	return ""
+}
+
+// headerWriter keeps the headers SPNEGO sets and drops its responses, david answers on its own.
+type headerWriter struct {
+	header http.Header
+}
+
+func (w *headerWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *headerWriter) WriteHeader(int) {}
+
+// authenticateNegotiate verifies the Kerberos ticket of a Negotiate header. It returns nil if there's no
+// Negotiate header, so other methods of authentication apply, and an unauthenticated AuthInfo if the ticket is
+// invalid or its principal isn't a user.
+func authenticateNegotiate(cfg *Config, w http.ResponseWriter, req *http.Request) *AuthInfo {
+	if cfg.Kerberos == nil || cfg.keytab == nil {
+		return nil
+	}
+	scheme, _, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, negotiateScheme) {
+		return nil
+	}
+	denied := &AuthInfo{Authenticated: false, CrudType: &testCrudType}
+	var settings []func(*service.Settings)
+	if cfg.Kerberos.Principal != "" {
+		settings = append(settings, service.KeytabPrincipal(cfg.Kerberos.Principal))
+	}
+	var identity goidentity.Identity
+	spnegoWriter := &headerWriter{header: http.Header{}}
+	spnego.SPNEGOKRB5Authenticate(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		identity = goidentity.FromHTTPRequestContext(r)
+	}), cfg.keytab, settings...).ServeHTTP(spnegoWriter, req)
+	if identity == nil || !identity.Authenticated() {
+		log.WithField("address", clientAddress(req)).Warn("Invalid kerberos ticket")
+		return denied
+	}
+
+	principal := identity.UserName() + "@" + identity.Domain()
+	username := cfg.Kerberos.userOf(principal)
+	user := cfg.user(username)
+	if username == "" || user == nil {
+		log.WithFields(log.Fields{"principal": principal, "address": clientAddress(req)}).Warn("Kerberos principal isn't mapped to a user")
+		return denied
+	}
+	// Mutual authentication: the client learns the server accepted its ticket
+	w.Header().Set("WWW-Authenticate", spnegoWriter.header.Get("WWW-Authenticate"))
+	log.WithFields(log.Fields{"user": username, "principal": principal}).Debug("User was authenticated by kerberos")
+	return &AuthInfo{Username: username, Authenticated: true, CrudType: user.Crud}
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// negotiateHeader returns the Negotiate header of a ticket of the principal for the service of the keytab.
+func negotiateHeader(t *testing.T, kt *keytab.Keytab, username string) string {
+	cl := client.NewWithPassword(username, "EXAMPLE.COM", "unused", config.New())
+	sname := types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"HTTP", "dav.example.com"}}
+	now := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), "EXAMPLE.COM", sname, "EXAMPLE.COM",
+		types.NewKrbFlags(), kt, etypeID.AES256_CTS_HMAC_SHA1_96, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	init, err := spnego.NewNegTokenInitKRB5(cl, tkt, sessionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := (&spnego.SPNEGOToken{Init: true, NegTokenInit: init}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Negotiate " + base64.StdEncoding.EncodeToString(token)
+}
+
+func TestAuthenticateNegotiate(t *testing.T) {
+	kt := keytab.New()
+	if err := kt.AddEntry("HTTP/dav.example.com", "EXAMPLE.COM", "service secret", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatal(err)
+	}
+	other := keytab.New()
+	other.AddEntry("HTTP/dav.example.com", "EXAMPLE.COM", "other secret", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+
+	cfg := createTestConfig(t.TempDir())
+	cfg.Kerberos = &Kerberos{Principals: map[string]string{"Alice@example.com": "user1"}, StripRealm: true}
+	cfg.keytab = kt
+	a := &App{Config: cfg}
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{"mapped principal", negotiateHeader(t, kt, "alice"), http.StatusOK},
+		{"principal without realm", negotiateHeader(t, kt, "user2"), http.StatusOK},
+		{"unknown user", negotiateHeader(t, kt, "mallory"), http.StatusUnauthorized},
+		{"ticket of another key", negotiateHeader(t, other, "alice"), http.StatusUnauthorized},
+		{"malformed ticket", "Negotiate " + base64.StdEncoding.EncodeToString([]byte("garbage")), http.StatusUnauthorized},
+		{"no credentials", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodOptions, "/", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			handle(context.Background(), w, r, a)
+			if w.Code != tt.wantStatus {
+				t.Errorf("handle() = %d, want %d", w.Code, tt.wantStatus)
+			}
+			challenges := strings.Join(w.Result().Header.Values("WWW-Authenticate"), ", ")
+			if tt.wantStatus == http.StatusUnauthorized && (!strings.HasPrefix(challenges, "Negotiate") || !strings.Contains(challenges, "Basic")) {
+				t.Errorf("WWW-Authenticate = %s, want Negotiate and Basic", challenges)
+			}
+		})
+	}
+}
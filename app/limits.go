@@ -0,0 +1,218 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errUploadTooLarge aborts reading a request body which exceeds the upload limit.
+var errUploadTooLarge = errors.New("upload exceeds the size limit")
+
+// uploadLimit returns the maximum size of an upload of the user in bytes, 0 means unlimited.
+func (cfg *Config) uploadLimit(username string) int64 {
+	if user := cfg.user(username); user != nil && user.MaxUploadSize > 0 {
+		return user.MaxUploadSize
+	}
+	return cfg.MaxUploadSize
+}
+
+// limitedBody fails reading a request body as soon as it exceeds the limit, nothing beyond is buffered.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+// Read passes data up to the limit and reports errUploadTooLarge once a byte beyond it arrives.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, errUploadTooLarge
+	}
+	// Read one byte more than allowed to tell an exact fit from an excess
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) <= b.remaining {
+		b.remaining -= int64(n)
+		return n, err
+	}
+	n, b.remaining, b.exceeded = int(b.remaining), 0, true
+	return n, errUploadTooLarge
+}
+
+// rejectTooLarge answers with 413 and closes the connection, so the rest of the body isn't read.
+func rejectTooLarge(w http.ResponseWriter) {
+	w.Header().Set("Connection", "close")
+	http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+}
+
+// uploadLimitWriter answers an upload aborted by its limit with 413 instead of the status of the webdav handler.
+type uploadLimitWriter struct {
+	http.ResponseWriter
+	body     *limitedBody
+	replaced bool
+}
+
+// WriteHeader rejects the upload if its body exceeded the limit and passes all other statuses.
+func (w *uploadLimitWriter) WriteHeader(status int) {
+	if !w.body.exceeded || w.replaced {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	rejectTooLarge(w.ResponseWriter)
+	w.replaced = true
+}
+
+// Write discards the original body after it has been replaced.
+func (w *uploadLimitWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// limitUpload enforces the upload limit of the user on a PUT. Uploads announcing an excessive Content-Length
+// are rejected right away, others are cut off while streaming. It returns the writer to serve the upload with,
+// and a cleanup function removing the partial file of an aborted upload, or a nil writer if it was rejected.
+func limitUpload(a *App, ctx context.Context, w http.ResponseWriter, req *http.Request, username string) (http.ResponseWriter, func()) {
+	limit := a.Config.uploadLimit(username)
+	if req.Method != http.MethodPut || limit <= 0 {
+		return w, func() {}
+	}
+	if req.ContentLength > limit {
+		log.WithFields(log.Fields{"user": username, "path": req.URL.Path, "size": req.ContentLength, "limit": limit}).Warn("Rejected upload exceeding the size limit")
+		rejectTooLarge(w)
+		return nil, nil
+	}
+
+	body := &limitedBody{ReadCloser: req.Body, remaining: limit}
+	req.Body = body
+	name := strings.TrimPrefix(req.URL.Path, a.Config.prefixOf(username))
+	_, err := a.Handler.FileSystem.Stat(ctx, name)
+	existed := !errors.Is(err, os.ErrNotExist)
+	return &uploadLimitWriter{ResponseWriter: w, body: body}, func() {
+		if !body.exceeded {
+			return
+		}
+		log.WithFields(log.Fields{"user": username, "path": req.URL.Path, "limit": limit}).Warn("Aborted upload exceeding the size limit")
+		// Only files created by the upload are removed, overwritten files are staged and kept as they were
+		if !existed {
+			if err := a.Handler.FileSystem.RemoveAll(ctx, name); err != nil {
+				log.WithError(err).WithField("path", req.URL.Path).Error("Error removing partial upload")
+			}
+		}
+	}
+}
+
+// pathLimitExceeded returns the condition of the limit the path below the prefix exceeds, false if it doesn't.
+// The length is counted in characters, the depth in path elements.
+func (cfg *Config) pathLimitExceeded(name string) (davCondition, bool) {
+	name = path.Clean("/" + name)
+	if cfg.MaxPathLength > 0 && utf8.RuneCountInString(name) > cfg.MaxPathLength {
+		return conditionPathTooLong, true
+	}
+	if cfg.MaxPathDepth > 0 && name != "/" && strings.Count(name, "/") > cfg.MaxPathDepth {
+		return conditionPathTooDeep, true
+	}
+	return davCondition{}, false
+}
+
+// rejectPathLimits answers requests creating a path beyond the limits of length and depth with 400 Bad Request.
+// Existing paths can still be read and deleted. It returns false if the request can be served.
+func rejectPathLimits(cfg *Config, w http.ResponseWriter, req *http.Request, username string) bool {
+	if cfg.MaxPathLength <= 0 && cfg.MaxPathDepth <= 0 {
+		return false
+	}
+	var name string
+	switch req.Method {
+	case http.MethodPut, "MKCOL", Lock:
+		name = req.URL.Path
+	case Copy, Move:
+		u, err := url.Parse(req.Header.Get("Destination"))
+		if err != nil {
+			return false
+		}
+		name = u.Path
+	default:
+		return false
+	}
+	condition, exceeded := cfg.pathLimitExceeded(strings.TrimPrefix(name, cfg.prefixOf(username)))
+	if !exceeded {
+		return false
+	}
+	log.WithFields(log.Fields{"user": username, "method": req.Method, "path": name, "limit": condition.name}).Warn("Refused path beyond the limits")
+	writeDAVError(w, http.StatusBadRequest, condition, name)
+	return true
+}
+
+// writeRetryAfter is the time clients are asked to wait before retrying a write refused by the concurrency limit.
+const writeRetryAfter = 5 * time.Second
+
+// limitedWriteMethods are the methods counted by the limit of concurrent writes.
+var limitedWriteMethods = map[string]bool{http.MethodPut: true, "MKCOL": true, Copy: true, Move: true}
+
+// writeTracker counts the writes in progress of each user.
+type writeTracker struct {
+	mu     sync.Mutex
+	active map[string]int
+}
+
+// activeWrites tracks the writes in progress of all users.
+var activeWrites = &writeTracker{active: map[string]int{}}
+
+// acquire counts a write of the user unless the limit is reached already.
+func (t *writeTracker) acquire(username string, limit int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.active[username] >= limit {
+		return false
+	}
+	t.active[username]++
+	return true
+}
+
+// release forgets a finished write of the user.
+func (t *writeTracker) release(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.active[username]--; t.active[username] <= 0 {
+		delete(t.active, username)
+	}
+}
+
+// writeLimit returns the maximum number of concurrent writes of the user, 0 means unlimited.
+func (cfg *Config) writeLimit(username string) int {
+	if user := cfg.user(username); user != nil && user.MaxWrites > 0 {
+		return user.MaxWrites
+	}
+	return cfg.MaxWrites
+}
+
+// acquireWrite counts a write of the user until the returned release is called. Writes beyond the limit are
+// answered with 503 Service Unavailable and Retry-After, which reports false.
+func acquireWrite(cfg *Config, w http.ResponseWriter, req *http.Request, username string) (func(), bool) {
+	limit := cfg.writeLimit(username)
+	if limit <= 0 || !limitedWriteMethods[req.Method] {
+		return func() {}, true
+	}
+	if !activeWrites.acquire(username, limit) {
+		log.WithFields(log.Fields{"user": username, "method": req.Method, "path": req.URL.Path, "limit": limit}).Warn("Refused write beyond the concurrency limit")
+		w.Header().Set("Retry-After", strconv.Itoa(int(writeRetryAfter/time.Second)))
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return func() { activeWrites.release(username) }, true
+}
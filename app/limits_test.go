@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestServeWebdavUploadLimit(t *testing.T) {
+	fs := webdav.NewMemFS()
+	a := &App{
+		Config: &Config{
+			MaxUploadSize: 5,
+			Users:         map[string]*UserInfo{"big": {MaxUploadSize: 10}},
+		},
+		Handler: &webdav.Handler{FileSystem: fs, LockSystem: webdav.NewMemLS()},
+	}
+	tests := []struct {
+		name     string
+		user     string
+		body     string
+		streamed bool
+		want     int
+	}{
+		{"within limit", "", "12345", false, http.StatusCreated},
+		{"announced excess", "", "123456", false, http.StatusRequestEntityTooLarge},
+		{"streamed excess", "", "123456", true, http.StatusRequestEntityTooLarge},
+		{"user limit", "big", "1234567890", true, http.StatusCreated},
+		{"user excess", "big", "12345678901", true, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs.RemoveAll(context.Background(), "/file.txt")
+			r := httptest.NewRequest(http.MethodPut, "/file.txt", strings.NewReader(tt.body))
+			if tt.streamed {
+				// Chunked uploads don't announce their size
+				r.Body, r.ContentLength = io.NopCloser(r.Body), -1
+			}
+			w := httptest.NewRecorder()
+			serveWebdav(a, context.Background(), w, r, tt.user)
+			if w.Code != tt.want {
+				t.Fatalf("PUT = %d, want %d", w.Code, tt.want)
+			}
+			_, err := fs.Stat(context.Background(), "/file.txt")
+			if tt.want == http.StatusRequestEntityTooLarge {
+				if w.Header().Get("Connection") != "close" {
+					t.Errorf("PUT without Connection: close")
+				}
+				if err == nil {
+					t.Errorf("partial upload was kept")
+				}
+			} else if err != nil {
+				t.Errorf("upload missing: %v", err)
+			}
+		})
+	}
+}
+
+func TestServeWebdavUploadLimitOverwrite(t *testing.T) {
+	cfg := &Config{
+		Dir:           t.TempDir(),
+		MaxUploadSize: 5,
+		Users:         map[string]*UserInfo{"alice": {Crud: newCrudType("crud")}},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	name := filepath.Join(cfg.Dir, "file.txt")
+	os.WriteFile(name, []byte("12345"), 0600)
+	ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "alice", Authenticated: true, CrudType: cfg.Users["alice"].Crud})
+
+	// An overwrite aborted by the limit keeps the original, as it's only replaced once complete
+	r := httptest.NewRequest(http.MethodPut, "/file.txt", strings.NewReader("abcdefgh"))
+	r.Body, r.ContentLength = io.NopCloser(r.Body), -1
+	w := httptest.NewRecorder()
+	serveWebdav(a, ctx, w, r, "alice")
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("PUT = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+	if content, _ := os.ReadFile(name); string(content) != "12345" {
+		t.Errorf("content = %q, want the original 12345", content)
+	}
+	if entries, _ := os.ReadDir(cfg.Dir); len(entries) != 1 {
+		t.Errorf("entries = %v, want only the original", entries)
+	}
+
+	r = httptest.NewRequest(http.MethodPut, "/file.txt", strings.NewReader("abc"))
+	r.Body, r.ContentLength = io.NopCloser(r.Body), -1
+	serveWebdav(a, ctx, httptest.NewRecorder(), r, "alice")
+	if content, _ := os.ReadFile(name); string(content) != "abc" {
+		t.Errorf("content = %q, want abc", content)
+	}
+}
+
+func TestServeWebdavPathLimits(t *testing.T) {
+	fs := webdav.NewMemFS()
+	fs.Mkdir(context.Background(), "/a", 0700)
+	a := &App{
+		Config:  &Config{MaxPathLength: 12, MaxPathDepth: 2},
+		Handler: &webdav.Handler{FileSystem: fs, LockSystem: webdav.NewMemLS()},
+	}
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		destination string
+		want        int
+	}{
+		{"within limits", http.MethodPut, "/a/file.txt", "", http.StatusCreated},
+		{"too long", http.MethodPut, "/a/long-file.txt", "", http.StatusBadRequest},
+		{"too deep", "MKCOL", "/a/b/c", "", http.StatusBadRequest},
+		{"moved too deep", "MOVE", "/a/file.txt", "/a/b/c", http.StatusBadRequest},
+		{"counted in characters", "MKCOL", "/a/äääääääää", "", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := ""
+			if tt.method == http.MethodPut {
+				body = "content"
+			}
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(body))
+			if tt.destination != "" {
+				r.Header.Set("Destination", "http://example.com"+tt.destination)
+			}
+			w := httptest.NewRecorder()
+			serveWebdav(a, context.Background(), w, r, "")
+			if w.Code != tt.want {
+				t.Fatalf("%s = %d, want %d", tt.method, w.Code, tt.want)
+			}
+			if tt.want == http.StatusBadRequest && !strings.Contains(w.Body.String(), "path-too-") {
+				t.Errorf("body = %q, want the exceeded limit", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServeWebdavWriteLimit(t *testing.T) {
+	fs := webdav.NewMemFS()
+	a := &App{
+		Config:  &Config{MaxWrites: 1, Users: map[string]*UserInfo{"sync": {MaxWrites: 2}}},
+		Handler: &webdav.Handler{FileSystem: fs, LockSystem: webdav.NewMemLS()},
+	}
+	put := func(user, name string, body io.Reader) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, name, body)
+		r.ContentLength = -1
+		w := httptest.NewRecorder()
+		serveWebdav(a, context.Background(), w, r, user)
+		return w
+	}
+
+	// An upload blocked in its body keeps the only write of the user busy
+	pr, pw := io.Pipe()
+	done := make(chan int)
+	go func() { done <- put("", "/slow.txt", pr).Code }()
+	pw.Write([]byte("first"))
+	if w := put("", "/other.txt", strings.NewReader("content")); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("PUT = %d with Retry-After %q, want %d", w.Code, w.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+	if w := put("sync", "/sync.txt", strings.NewReader("content")); w.Code != http.StatusCreated {
+		t.Errorf("PUT of another user = %d, want %d", w.Code, http.StatusCreated)
+	}
+	pw.Close()
+	if code := <-done; code != http.StatusCreated {
+		t.Errorf("slow PUT = %d, want %d", code, http.StatusCreated)
+	}
+	if w := put("", "/other.txt", strings.NewReader("content")); w.Code != http.StatusCreated {
+		t.Errorf("PUT after the slow one = %d, want %d", w.Code, http.StatusCreated)
+	}
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"fmt"
+	"slices"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Formats of the general log.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// fieldsFormatter passes only the selected fields of the entries to the formatter, the time, level and message
+// are always kept.
+type fieldsFormatter struct {
+	log.Formatter
+	fields []string
+}
+
+// Format formats a copy of the entry holding only the selected fields.
+func (f *fieldsFormatter) Format(entry *log.Entry) ([]byte, error) {
+	selected := *entry
+	selected.Data = log.Fields{}
+	for key, value := range entry.Data {
+		if slices.Contains(f.fields, key) {
+			selected.Data[key] = value
+		}
+	}
+	return f.Formatter.Format(&selected)
+}
+
+// logLevel returns the configured level of the log. Without level it's debug in debug mode and info otherwise.
+func (l *Logging) logLevel() (log.Level, error) {
+	if l.Level != "" {
+		return log.ParseLevel(l.Level)
+	}
+	if l.Debug {
+		return log.DebugLevel, nil
+	}
+	return log.InfoLevel, nil
+}
+
+// logFormatter returns the configured formatter of the log. Without format it's JSON in production mode and
+// text otherwise.
+func (l *Logging) logFormatter() (log.Formatter, error) {
+	format := l.Format
+	if format == "" {
+		format = logFormatText
+		if l.Production {
+			format = logFormatJSON
+		}
+	}
+	var formatter log.Formatter
+	switch format {
+	case logFormatText:
+		formatter = &log.TextFormatter{ForceColors: l.Colors, FullTimestamp: l.TimestampFormat != "", TimestampFormat: l.TimestampFormat}
+	case logFormatJSON:
+		formatter = &log.JSONFormatter{TimestampFormat: l.TimestampFormat}
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", format)
+	}
+	if len(l.Fields) != 0 {
+		formatter = &fieldsFormatter{Formatter: formatter, fields: l.Fields}
+	}
+	return formatter, nil
+}
+
+// ApplyLog sets the level and the formatter of the general log.
+func (cfg *Config) ApplyLog() error {
+	level, err := cfg.Log.logLevel()
+	if err != nil {
+		return err
+	}
+	formatter, err := cfg.Log.logFormatter()
+	if err != nil {
+		return err
+	}
+	log.SetLevel(level)
+	log.SetFormatter(formatter)
+	return nil
+}
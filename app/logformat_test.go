@@ -0,0 +1,72 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestLogLevel(t *testing.T) {
+	tests := []struct {
+		log     Logging
+		want    log.Level
+		wantErr bool
+	}{
+		{Logging{}, log.InfoLevel, false},
+		{Logging{Debug: true}, log.DebugLevel, false},
+		{Logging{Debug: true, Level: "warn"}, log.WarnLevel, false},
+		{Logging{Level: "trace"}, log.TraceLevel, false},
+		{Logging{Level: "loud"}, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := tt.log.logLevel()
+		if (err != nil) != tt.wantErr || err == nil && got != tt.want {
+			t.Errorf("logLevel() of %+v = %v, %v, want %v", tt.log, got, err, tt.want)
+		}
+	}
+}
+
+func TestLogFormatter(t *testing.T) {
+	entry := &log.Entry{
+		Logger:  log.New(),
+		Time:    time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		Level:   log.InfoLevel,
+		Message: "Created file",
+		Data:    log.Fields{"user": "alice", "path": "/a.txt", "crud": "crud"},
+	}
+	tests := []struct {
+		log  Logging
+		want []string
+		gone []string
+	}{
+		{Logging{}, []string{`msg="Created file"`, "user=alice"}, nil},
+		{Logging{Production: true}, []string{`"msg":"Created file"`, `"user":"alice"`}, nil},
+		{Logging{Format: logFormatText, Production: true, TimestampFormat: "2006-01-02"}, []string{"time=2024-05-01", "path=/a.txt"}, nil},
+		{Logging{Format: logFormatJSON, Fields: []string{"user"}}, []string{`"user":"alice"`, `"level":"info"`}, []string{"path", "crud"}},
+	}
+	for _, tt := range tests {
+		formatter, err := tt.log.logFormatter()
+		if err != nil {
+			t.Fatalf("logFormatter() error = %v", err)
+		}
+		b, err := formatter.Format(entry)
+		if err != nil {
+			t.Fatalf("Format() error = %v", err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(string(b), want) {
+				t.Errorf("Format() with %+v = %q, want %s", tt.log, b, want)
+			}
+		}
+		for _, gone := range tt.gone {
+			if strings.Contains(string(b), gone) {
+				t.Errorf("Format() with %+v = %q, contains %s", tt.log, b, gone)
+			}
+		}
+	}
+	if _, err := (&Logging{Format: "xml"}).logFormatter(); err == nil {
+		t.Error("logFormatter() of an unknown format succeeded")
+	}
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Modes of a maintenance window.
+const (
+	MaintenanceReadOnly = "read-only"
+	MaintenancePause    = "pause"
+)
+
+// MaintenanceWindow is a recurring period during which the server is read-only or paused, e.g. for nightly
+// snapshots. It starts at Start (local time, "15:04") on the given days (every day if empty) and lasts for Duration.
+type MaintenanceWindow struct {
+	Days     []string
+	Start    string
+	Duration time.Duration
+	Mode     string
+}
+
+// weekdays maps the abbreviated names of the days to their weekday.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// validate checks the start, days and mode of the window.
+func (m *MaintenanceWindow) validate() error {
+	if _, err := time.Parse("15:04", m.Start); err != nil {
+		return errors.New("invalid start " + m.Start + " of maintenance window")
+	}
+	if m.Duration <= 0 {
+		return errors.New("maintenance window without duration")
+	}
+	for _, day := range m.Days {
+		if _, ok := weekdays[strings.ToLower(day)[:min(3, len(day))]]; !ok {
+			return errors.New("invalid day " + day + " of maintenance window")
+		}
+	}
+	if m.Mode != "" && m.Mode != MaintenanceReadOnly && m.Mode != MaintenancePause {
+		return errors.New("invalid mode " + m.Mode + " of maintenance window")
+	}
+	return nil
+}
+
+// on returns whether the window starts on the weekday.
+func (m *MaintenanceWindow) on(day time.Weekday) bool {
+	if len(m.Days) == 0 {
+		return true
+	}
+	for _, d := range m.Days {
+		if weekdays[strings.ToLower(d)[:min(3, len(d))]] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// end returns the end of the window active at the given time, or the zero time if it isn't active.
+// Windows lasting past midnight are found by their start on one of the previous days.
+func (m *MaintenanceWindow) end(now time.Time) time.Time {
+	start, err := time.Parse("15:04", m.Start)
+	if err != nil {
+		return time.Time{}
+	}
+	for days := 0; days <= int(m.Duration/(24*time.Hour))+1; days++ {
+		day := now.AddDate(0, 0, -days)
+		begin := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, now.Location())
+		if m.on(begin.Weekday()) && !now.Before(begin) && now.Before(begin.Add(m.Duration)) {
+			return begin.Add(m.Duration)
+		}
+	}
+	return time.Time{}
+}
+
+// pauses returns whether all requests are refused, not only writes.
+func (m *MaintenanceWindow) pauses() bool {
+	return m.Mode == MaintenancePause
+}
+
+// maintenanceAt returns the active window restricting the method which ends last and its end, or nil if none is active.
+func (cfg *Config) maintenanceAt(now time.Time, method string) (*MaintenanceWindow, time.Time) {
+	var active *MaintenanceWindow
+	var end time.Time
+	for _, m := range cfg.Maintenance {
+		e := m.end(now)
+		if e.IsZero() || !m.pauses() && !writeMethods[method] {
+			continue
+		}
+		if active == nil || e.After(end) {
+			active, end = m, e
+		}
+	}
+	return active, end
+}
+
+// rejectDuringMaintenance answers requests during a maintenance window with 503 Service Unavailable and
+// the time until its end in Retry-After. It returns false if the request can be served.
+func rejectDuringMaintenance(cfg *Config, w http.ResponseWriter, req *http.Request) bool {
+	now := time.Now()
+	window, end := cfg.maintenanceAt(now, req.Method)
+	if window == nil {
+		return false
+	}
+	seconds := int((end.Sub(now) + time.Second - 1) / time.Second)
+	log.WithFields(log.Fields{"method": req.Method, "path": req.URL.Path, "mode": window.Mode, "retryAfter": seconds}).Debug("Refused request during maintenance")
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeDAVError(w, http.StatusServiceUnavailable, conditionMaintenance)
+	return true
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestMaintenanceWindowEnd(t *testing.T) {
+	// 2024-01-01 is a Monday
+	at := func(day, hour, minute int) time.Time { return time.Date(2024, 1, day, hour, minute, 0, 0, time.Local) }
+	tests := []struct {
+		name   string
+		window MaintenanceWindow
+		now    time.Time
+		want   time.Time
+	}{
+		{"inside", MaintenanceWindow{Start: "02:00", Duration: time.Hour}, at(1, 2, 30), at(1, 3, 0)},
+		{"before", MaintenanceWindow{Start: "02:00", Duration: time.Hour}, at(1, 1, 59), time.Time{}},
+		{"at the end", MaintenanceWindow{Start: "02:00", Duration: time.Hour}, at(1, 3, 0), time.Time{}},
+		{"past midnight", MaintenanceWindow{Start: "23:00", Duration: 2 * time.Hour}, at(2, 0, 30), at(2, 1, 0)},
+		{"on the day", MaintenanceWindow{Days: []string{"Monday"}, Start: "02:00", Duration: time.Hour}, at(1, 2, 30), at(1, 3, 0)},
+		{"on another day", MaintenanceWindow{Days: []string{"tue", "sun"}, Start: "02:00", Duration: time.Hour}, at(1, 2, 30), time.Time{}},
+		{"started on the day before", MaintenanceWindow{Days: []string{"sun"}, Start: "23:00", Duration: 2 * time.Hour}, at(1, 0, 30), at(1, 1, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.window.validate(); err != nil {
+				t.Fatalf("validate() error = %v", err)
+			}
+			if got := tt.window.end(tt.now); !got.Equal(tt.want) {
+				t.Errorf("end() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	for _, window := range []MaintenanceWindow{
+		{Start: "25:00", Duration: time.Hour},
+		{Start: "02:00"},
+		{Start: "02:00", Duration: time.Hour, Days: []string{"someday"}},
+		{Start: "02:00", Duration: time.Hour, Mode: "drain"},
+	} {
+		if err := window.validate(); err == nil {
+			t.Errorf("validate() of %+v error = nil, want error", window)
+		}
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	// A window which started a minute ago
+	start := time.Now().Add(-time.Minute).Format("15:04")
+	tests := []struct {
+		name   string
+		mode   string
+		method string
+		want   int
+	}{
+		{"read during read-only", MaintenanceReadOnly, "PROPFIND", http.StatusMultiStatus},
+		{"write during read-only", MaintenanceReadOnly, http.MethodPut, http.StatusServiceUnavailable},
+		{"read during pause", MaintenancePause, "PROPFIND", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{
+				Config: &Config{
+					Maintenance: []*MaintenanceWindow{{Start: start, Duration: time.Hour, Mode: tt.mode}},
+				},
+				Handler: &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()},
+			}
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, httptest.NewRequest(tt.method, "/", nil), a)
+			if w.Code != tt.want {
+				t.Errorf("%s = %d, want %d", tt.method, w.Code, tt.want)
+			}
+			if tt.want == http.StatusServiceUnavailable {
+				if retry := w.Header().Get("Retry-After"); retry == "" || retry == "0" {
+					t.Errorf("Retry-After = %q, want the time until the end of the window", retry)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// metricFamily holds all series of a metric together with its help text and type.
+type metricFamily struct {
+	help   string
+	kind   string
+	values map[string]float64
+}
+
+// metricsRegistry is a minimal registry of counters and gauges rendered in the Prometheus text format.
+type metricsRegistry struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+// metrics is the registry all components of the server report to.
+var metrics = &metricsRegistry{families: map[string]*metricFamily{}}
+
+// labelSet renders label pairs (name, value, name, value, ...) as {name="value",...}.
+func labelSet(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+replacer.Replace(labels[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// family returns the family with the given name, creating it if necessary.
+func (r *metricsRegistry) family(name, help, kind string) *metricFamily {
+	f, ok := r.families[name]
+	if !ok {
+		f = &metricFamily{help: help, kind: kind, values: map[string]float64{}}
+		r.families[name] = f
+	}
+	return f
+}
+
+// Add increases the counter name with the given labels by value.
+func (r *metricsRegistry) Add(name, help string, value float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.family(name, help, "counter").values[labelSet(labels)] += value
+}
+
+// Set sets the gauge name with the given labels to value.
+func (r *metricsRegistry) Set(name, help string, value float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.family(name, help, "gauge").values[labelSet(labels)] = value
+}
+
+// write renders all metrics in the Prometheus text exposition format.
+func (r *metricsRegistry) write(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.kind)
+		series := make([]string, 0, len(f.values))
+		for labels := range f.values {
+			series = append(series, labels)
+		}
+		sort.Strings(series)
+		for _, labels := range series {
+			fmt.Fprintf(w, "%s%s %v\n", name, labels, f.values[labels])
+		}
+	}
+}
+
+// Usage holds the transfer accounting of a single user.
+type Usage struct {
+	BytesUploaded   int64            `json:"bytesUploaded"`
+	BytesDownloaded int64            `json:"bytesDownloaded"`
+	Operations      map[string]int64 `json:"operations"`
+}
+
+// usageTracker accounts transferred bytes and operations per user.
+// Besides the totals since the start it keeps the usage not yet flushed to the accounting file.
+type usageTracker struct {
+	mu      sync.Mutex
+	users   map[string]*Usage
+	pending map[string]*Usage
+}
+
+// usage is the accounting of all users since the server was started.
+var usage = &usageTracker{users: map[string]*Usage{}, pending: map[string]*Usage{}}
+
+// addUsage adds the transfer and the operation to the usage of username in entries.
+func addUsage(entries map[string]*Usage, username, method string, uploaded, downloaded int64) {
+	entry, ok := entries[username]
+	if !ok {
+		entry = &Usage{Operations: map[string]int64{}}
+		entries[username] = entry
+	}
+	entry.BytesUploaded += uploaded
+	entry.BytesDownloaded += downloaded
+	entry.Operations[method]++
+}
+
+// record adds a finished request of username to the accounting and the metrics.
+func (u *usageTracker) record(username, method string, uploaded, downloaded int64) {
+	u.mu.Lock()
+	addUsage(u.users, username, method, uploaded, downloaded)
+	addUsage(u.pending, username, method, uploaded, downloaded)
+	u.mu.Unlock()
+
+	metrics.Add("david_user_bytes_uploaded_total", "Bytes uploaded per user.", float64(uploaded), "user", username)
+	metrics.Add("david_user_bytes_downloaded_total", "Bytes downloaded per user.", float64(downloaded), "user", username)
+	metrics.Add("david_user_operations_total", "Requests per user and method.", 1, "user", username, "method", method)
+}
+
+// get returns a copy of the accounting of username.
+func (u *usageTracker) get(username string) Usage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	result := Usage{Operations: map[string]int64{}}
+	if entry, ok := u.users[username]; ok {
+		result.BytesUploaded = entry.BytesUploaded
+		result.BytesDownloaded = entry.BytesDownloaded
+		for method, count := range entry.Operations {
+			result.Operations[method] = count
+		}
+	}
+	return result
+}
+
+// all returns a copy of the accounting of all users.
+func (u *usageTracker) all() map[string]Usage {
+	u.mu.Lock()
+	names := make([]string, 0, len(u.users))
+	for name := range u.users {
+		names = append(names, name)
+	}
+	u.mu.Unlock()
+	result := map[string]Usage{}
+	for _, name := range names {
+		result[name] = u.get(name)
+	}
+	return result
+}
+
+// countingReader counts the bytes read from the wrapped request body.
+type countingReader struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+// Read counts the bytes read.
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// writeJSON sends v as JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Error("Error sending JSON response")
+	}
+}
+
+// handleUsageRequest returns the accounting of the authenticated user.
+func handleUsageRequest(w http.ResponseWriter, authInfo *AuthInfo) {
+	writeJSON(w, usage.get(authInfo.Username))
+}
+
+// NewMetricsHandler returns the handler of the metrics listener.
+// It serves the Prometheus metrics at /metrics and the accounting of all users at /usage.
+func NewMetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics.write(w)
+	})
+	mux.HandleFunc("/usage", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, usage.all())
+	})
+	return mux
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestMetricsRegistryWrite(t *testing.T) {
+	r := &metricsRegistry{families: map[string]*metricFamily{}}
+	r.Add("requests_total", "Requests.", 2, "user", `a"b`)
+	r.Add("requests_total", "Requests.", 1, "user", `a"b`)
+	r.Set("open_files", "Open files.", 7)
+
+	var buf bytes.Buffer
+	r.write(&buf)
+	want := `# HELP open_files Open files.
+# TYPE open_files gauge
+open_files 7
+# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{user="a\"b"} 3
+`
+	if buf.String() != want {
+		t.Errorf("metricsRegistry.write() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestServeWebdavAccounting(t *testing.T) {
+	a := &App{
+		Config: &Config{},
+		Handler: &webdav.Handler{
+			FileSystem: webdav.NewMemFS(),
+			LockSystem: webdav.NewMemLS(),
+		},
+	}
+	before := usage.get("accounting-user")
+
+	// Upload five bytes and read them back
+	serveWebdav(a, context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("hello")), "accounting-user")
+	serveWebdav(a, context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a.txt", nil), "accounting-user")
+
+	got := usage.get("accounting-user")
+	if got.BytesUploaded-before.BytesUploaded != 5 || got.BytesDownloaded-before.BytesDownloaded != 5 {
+		t.Errorf("usage.get() = %+v, want 5 bytes uploaded and downloaded", got)
+	}
+	if got.Operations[http.MethodPut]-before.Operations[http.MethodPut] != 1 {
+		t.Errorf("usage.get() operations = %v, want one PUT", got.Operations)
+	}
+}
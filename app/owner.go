@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"encoding/xml"
+	"os"
+	"path"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// Dead properties holding the users who created and last modified a file, which can't be set by PROPPATCH.
+var (
+	ownerProperty    = xml.Name{Space: davidNamespace, Local: "owner"}
+	modifierProperty = xml.Name{Space: davidNamespace, Local: "modifiedby"}
+)
+
+// tracksOwners reports whether the users creating and modifying files are recorded, which owner-only
+// directories rely on.
+func (cfg *Config) tracksOwners() bool {
+	return (cfg.TrackOwners || len(cfg.OwnerOnly) != 0) && cfg.propertyStore() != nil
+}
+
+// inOwnerOnly reports whether the physical path lies below an owner-only directory. The directories
+// themselves are shared, only their contents are private to their owners.
+func (cfg *Config) inOwnerOnly(name string) bool {
+	rel, ok := cfg.relPath(name)
+	if !ok {
+		return false
+	}
+	for _, dir := range cfg.OwnerOnly {
+		dir = path.Clean("/" + dir)
+		if hasFilePathPrefix(rel, dir) && !hasFilePathPrefix(dir, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// ownerOf returns the user who created the file at the physical path, empty if it isn't known.
+func (cfg *Config) ownerOf(ctx context.Context, name string) string {
+	props, err := cfg.propertyStore().props(ctx, name)
+	if err != nil {
+		log.WithError(err).WithField("path", name).Error("Error reading owner of file")
+		return ""
+	}
+	if p, ok := props[ownerProperty]; ok {
+		return propertyText(p)
+	}
+	return ""
+}
+
+// recordWrite remembers the user writing the file at the physical path as the one who last modified it and,
+// if the file was created, as its owner, so it stays visible to them in owner-only directories, also after
+// it was moved into one. The write is recorded in the audit log as well.
+func (d Dir) recordWrite(ctx context.Context, name string, created bool) {
+	if !d.Config.tracksOwners() {
+		return
+	}
+	username := d.resolveUser(ctx)
+	patch := webdav.Proppatch{Props: []webdav.Property{textProperty(modifierProperty, username)}}
+	action := "modify"
+	if created {
+		patch.Props = append(patch.Props, textProperty(ownerProperty, username))
+		action = "create"
+	}
+	if err := d.Config.propertyStore().patch(ctx, name, []webdav.Proppatch{patch}); err != nil {
+		log.WithError(err).WithFields(log.Fields{"user": username, "path": name}).Error("Error recording owner of file")
+	}
+	if rel, ok := d.Config.relPath(name); ok {
+		writeAudit(d.Config, AuditEntry{User: username, Action: action, Path: rel})
+	}
+}
+
+// hiddenFromUser reports whether the file at the physical path, or an existing directory it's in, lies in
+// an owner-only directory and wasn't created by the user. Files of unknown owners are hidden as well, admins
+// see everything.
+func (d Dir) hiddenFromUser(ctx context.Context, name string) bool {
+	if len(d.Config.OwnerOnly) == 0 || d.Config.propertyStore() == nil {
+		return false
+	}
+	username := d.resolveUser(ctx)
+	if user := d.Config.user(username); user != nil && user.Admin {
+		return false
+	}
+	for p := name; d.Config.inOwnerOnly(p); p = filepath.Dir(p) {
+		if _, err := d.storage().Stat(p); err != nil {
+			continue
+		}
+		if username == "" || d.Config.ownerOf(ctx, p) != username {
+			return true
+		}
+	}
+	return false
+}
+
+// ownedDir lists only the entries of a directory which aren't hidden from the user.
+type ownedDir struct {
+	webdav.File
+	ctx  context.Context
+	dir  Dir
+	name string
+}
+
+// Readdir returns the entries of the directory visible to the user.
+func (d *ownedDir) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := d.File.Readdir(count)
+	visible := infos[:0]
+	for _, info := range infos {
+		if !d.dir.hiddenFromUser(d.ctx, filepath.Join(d.name, info.Name())) {
+			visible = append(visible, info)
+		}
+	}
+	return visible, err
+}
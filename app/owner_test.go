@@ -0,0 +1,208 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestOwnerOnly(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "uploads"), 0700)
+	os.WriteFile(filepath.Join(dir, "uploads", "unknown.txt"), []byte("unknown"), 0600)
+	store, err := openPropertyStore(&Properties{File: filepath.Join(t.TempDir(), "properties.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		Dir:        dir,
+		Log:        Logging{Create: true},
+		OwnerOnly:  []string{"/uploads"},
+		properties: store,
+		Users: map[string]*UserInfo{
+			"alice": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")},
+			"bob":   {Password: GenHash([]byte("password")), Crud: newCrudType("crud")},
+			"admin": {Password: GenHash([]byte("password")), Crud: newCrudType("crud"), Admin: true},
+		},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	do := func(user, method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.SetBasicAuth(user, "password")
+		r.Header.Set("Depth", "1")
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		return w
+	}
+
+	for user, name := range map[string]string{"alice": "/uploads/a.txt", "bob": "/uploads/b.txt"} {
+		if w := do(user, http.MethodPut, name, "content"); w.Code != http.StatusCreated {
+			t.Fatalf("PUT %s of %s = %d, want %d", name, user, w.Code, http.StatusCreated)
+		}
+	}
+	if w := do("alice", "MKCOL", "/uploads/private", ""); w.Code != http.StatusCreated {
+		t.Fatalf("MKCOL of alice = %d, want %d", w.Code, http.StatusCreated)
+	}
+
+	listing := do("bob", "PROPFIND", "/uploads", "").Body.String()
+	if !strings.Contains(listing, "b.txt") || strings.Contains(listing, "a.txt") || strings.Contains(listing, "private") || strings.Contains(listing, "unknown.txt") {
+		t.Errorf("listing of bob = %s, want only his own file", listing)
+	}
+	listing = do("admin", "PROPFIND", "/uploads", "").Body.String()
+	if !strings.Contains(listing, "a.txt") || !strings.Contains(listing, "b.txt") || !strings.Contains(listing, "unknown.txt") {
+		t.Errorf("listing of admin = %s, want all files", listing)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{"PROPFIND", "/uploads/a.txt", http.StatusNotFound},
+		{http.MethodPut, "/uploads/a.txt", http.StatusNotFound},
+		{http.MethodDelete, "/uploads/a.txt", http.StatusNotFound},
+		{http.MethodPut, "/uploads/private/b.txt", http.StatusNotFound},
+		{"PROPFIND", "/uploads/b.txt", http.StatusMultiStatus},
+	}
+	for _, tt := range tests {
+		if w := do("bob", tt.method, tt.path, ""); w.Code != tt.want {
+			t.Errorf("%s %s of bob = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+		}
+	}
+
+	// The owner can't be changed by PROPPATCH
+	patch := `<?xml version="1.0" encoding="utf-8"?><D:propertyupdate xmlns:D="DAV:" xmlns:d="https://github.com/audstanley/david"><D:set><D:prop><d:owner>alice</d:owner></D:prop></D:set></D:propertyupdate>`
+	if w := do("bob", "PROPPATCH", "/uploads/b.txt", patch); !strings.Contains(w.Body.String(), "403") {
+		t.Errorf("PROPPATCH of the owner = %s, want 403", w.Body.String())
+	}
+	if owner := cfg.ownerOf(context.Background(), filepath.Join(dir, "uploads", "b.txt")); owner != "bob" {
+		t.Errorf("owner after PROPPATCH = %s, want bob", owner)
+	}
+}
+
+func TestTrackOwners(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openPropertyStore(&Properties{File: filepath.Join(t.TempDir(), "properties.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		Dir:         dir,
+		Log:         Logging{Create: true},
+		TrackOwners: true,
+		Audit:       &Audit{File: filepath.Join(t.TempDir(), "audit.log")},
+		properties:  store,
+		Users: map[string]*UserInfo{
+			"alice": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")},
+			"bob":   {Password: GenHash([]byte("password")), Crud: newCrudType("crud")},
+		},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	do := func(user, method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.SetBasicAuth(user, "password")
+		r.Header.Set("Depth", "0")
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		return w
+	}
+
+	if w := do("alice", http.MethodPut, "/a.txt", "first"); w.Code != http.StatusCreated {
+		t.Fatalf("PUT of alice = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if w := do("bob", http.MethodPut, "/a.txt", "second"); w.Code != http.StatusCreated {
+		t.Fatalf("PUT of bob = %d, want %d", w.Code, http.StatusCreated)
+	}
+	props := do("alice", "PROPFIND", "/a.txt", "").Body.String()
+	for _, want := range []string{">alice</owner>", ">bob</modifiedby>"} {
+		if !strings.Contains(props, want) {
+			t.Errorf("properties = %s, want %s", props, want)
+		}
+	}
+
+	// The modifier can't be changed by PROPPATCH
+	patch := `<?xml version="1.0" encoding="utf-8"?><D:propertyupdate xmlns:D="DAV:" xmlns:d="https://github.com/audstanley/david"><D:set><D:prop><d:modifiedby>alice</d:modifiedby></D:prop></D:set></D:propertyupdate>`
+	if w := do("alice", "PROPPATCH", "/a.txt", patch); !strings.Contains(w.Body.String(), "403") {
+		t.Errorf("PROPPATCH of the modifier = %s, want 403", w.Body.String())
+	}
+
+	content, _ := os.ReadFile(cfg.Audit.File)
+	for _, want := range []string{`"user":"alice","action":"create","path":"/a.txt"`, `"user":"bob","action":"modify","path":"/a.txt"`} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("audit log = %s, want %s", content, want)
+		}
+	}
+}
+
+func TestOwnerOnlyLinks(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "uploads"), 0700)
+	store, err := openPropertyStore(&Properties{File: filepath.Join(t.TempDir(), "properties.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		Dir:        dir,
+		Log:        Logging{Create: true},
+		OwnerOnly:  []string{"/uploads"},
+		Presign:    &Presign{Secret: "s3cr3t"},
+		Shares:     &Shares{File: filepath.Join(t.TempDir(), "shares.db")},
+		properties: store,
+		Users: map[string]*UserInfo{
+			"alice": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")},
+			"bob":   {Password: GenHash([]byte("password")), Crud: newCrudType("crud")},
+		},
+	}
+	if cfg.shares, err = openShareStore(cfg.Shares); err != nil {
+		t.Fatal(err)
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	do := func(user, method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if user != "" {
+			r.SetBasicAuth(user, "password")
+		}
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		return w
+	}
+	for user, name := range map[string]string{"alice": "/uploads/a.txt", "bob": "/uploads/b.txt"} {
+		if w := do(user, http.MethodPut, name, "content"); w.Code != http.StatusCreated {
+			t.Fatalf("PUT %s of %s = %d, want %d", name, user, w.Code, http.StatusCreated)
+		}
+	}
+
+	// Files of others can neither be pre-signed nor shared
+	if w := do("bob", http.MethodGet, "/_presign?path=/uploads/a.txt", ""); w.Code != http.StatusNotFound {
+		t.Errorf("pre-signing file of alice = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := do("bob", http.MethodPost, "/_shares", `{"path": "/uploads/a.txt"}`); w.Code != http.StatusNotFound {
+		t.Errorf("sharing file of alice = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	// Nor served by links signed before
+	if w := do("", http.MethodGet, PresignURL(cfg, "bob", "/uploads/a.txt", time.Now().Add(time.Hour)), ""); w.Code != http.StatusNotFound {
+		t.Errorf("pre-signed url of file of alice = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// Shares of the owner-only directory only reach the files of the sharing user
+	w := do("bob", http.MethodPost, "/_shares", `{"path": "/uploads"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("sharing owner-only directory = %d, want %d", w.Code, http.StatusCreated)
+	}
+	var sh share
+	json.NewDecoder(w.Body).Decode(&sh)
+	if listing := do("", http.MethodGet, "/s/"+sh.Token, "").Body.String(); !strings.Contains(listing, "b.txt") || strings.Contains(listing, "a.txt") {
+		t.Errorf("listing of share = %s, want only the file of bob", listing)
+	}
+	if w := do("", http.MethodGet, "/s/"+sh.Token+"/a.txt", ""); w.Code != http.StatusNotFound {
+		t.Errorf("file of alice through share = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
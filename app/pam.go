@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os/user"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PAM authenticates system accounts unknown to the configuration with the PAM Service (david if empty). Their
+// permissions are the ones of the first of Groups they're a member of, accounts in none of them are denied.
+// With Home they're jailed in their home directory, which has to be below the base directory.
+type PAM struct {
+	Service string
+	Groups  []*PAMGroup
+	Home    bool
+}
+
+// PAMGroup maps the members of a system group to permissions.
+type PAMGroup struct {
+	Group       string
+	Permissions string
+}
+
+// errPAMUnsupported is returned by builds without PAM, which requires cgo and the pam build tag on Linux.
+var errPAMUnsupported = errors.New("david was built without pam support, build it on linux with -tags pam")
+
+// Hooks of the PAM authentication, replaced by tests.
+var (
+	pamVerify     = pamAuthenticate
+	lookupAccount = systemAccount
+)
+
+// systemAccount returns the home directory and the names of the groups of a system account.
+func systemAccount(username string) (string, []string, error) {
+	account, err := user.Lookup(username)
+	if err != nil {
+		return "", nil, err
+	}
+	ids, err := account.GroupIds()
+	if err != nil {
+		return "", nil, err
+	}
+	groups := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if group, err := user.LookupGroupId(id); err == nil {
+			groups = append(groups, group.Name)
+		}
+	}
+	return account.HomeDir, groups, nil
+}
+
+// authenticateWithPAM verifies the password of a system account with PAM and maps its groups to permissions.
+func authenticateWithPAM(cfg *Config, username, password string) (*AuthInfo, error) {
+	service := cfg.PAM.Service
+	if service == "" {
+		service = "david"
+	}
+	if err := pamVerify(service, username, password); err != nil {
+		return nil, err
+	}
+	home, groups, err := lookupAccount(username)
+	if err != nil {
+		return nil, err
+	}
+	var permissions string
+	for _, mapping := range cfg.PAM.Groups {
+		for _, group := range groups {
+			if group == mapping.Group && permissions == "" {
+				permissions = mapping.Permissions
+			}
+		}
+	}
+	if permissions == "" {
+		return nil, errors.New("account is in none of the pam groups")
+	}
+
+	user := &UserInfo{Permissions: permissions, Crud: &CrudType{Crud: permissions}}
+	if cfg.PAM.Home {
+		rel, err := filepath.Rel(cfg.Dir, home)
+		if err != nil || !withinDir(cfg.Dir, home) {
+			return nil, errors.New("home directory " + home + " is outside of the base directory")
+		}
+		subdir := "/" + filepath.ToSlash(rel)
+		user.Subdir = &subdir
+	}
+	cfg.externalUsers.Store(username, user)
+	if err := FormatCrud(context.Background(), username, cfg); err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{"user": username, "crud": user.Crud}).Debug("User was authenticated by pam")
+	return &AuthInfo{Username: username, Authenticated: true, CrudType: user.Crud}, nil
+}
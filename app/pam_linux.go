@@ -0,0 +1,77 @@
+//go:build linux && cgo && pam
+
+package app
+
+/*
+#cgo LDFLAGS: -lpam
+#include <security/pam_appl.h>
+#include <stdlib.h>
+#include <string.h>
+
+// conversation answers the prompts for the password with the one passed as appdata_ptr.
+static int conversation(int num_msg, const struct pam_message **msg, struct pam_response **resp, void *appdata_ptr) {
+	struct pam_response *replies = calloc(num_msg, sizeof(struct pam_response));
+	if (replies == NULL) {
+		return PAM_BUF_ERR;
+	}
+	for (int i = 0; i < num_msg; i++) {
+		switch (msg[i]->msg_style) {
+		case PAM_PROMPT_ECHO_OFF:
+			replies[i].resp = strdup((const char *)appdata_ptr);
+			if (replies[i].resp != NULL) {
+				break;
+			}
+			// fall through
+		case PAM_PROMPT_ECHO_ON:
+			for (int j = 0; j < i; j++) {
+				free(replies[j].resp);
+			}
+			free(replies);
+			return PAM_CONV_ERR;
+		}
+	}
+	*resp = replies;
+	return PAM_SUCCESS;
+}
+
+// authenticate checks the password and the validity of the account.
+static int authenticate(const char *service, const char *user, char *password) {
+	struct pam_conv conv = {conversation, password};
+	pam_handle_t *handle = NULL;
+	int status = pam_start(service, user, &conv, &handle);
+	if (status != PAM_SUCCESS) {
+		return status;
+	}
+	status = pam_authenticate(handle, PAM_SILENT | PAM_DISALLOW_NULL_AUTHTOK);
+	if (status == PAM_SUCCESS) {
+		status = pam_acct_mgmt(handle, PAM_SILENT | PAM_DISALLOW_NULL_AUTHTOK);
+	}
+	pam_end(handle, status);
+	return status;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// pamSupported reports whether the build can authenticate with PAM.
+const pamSupported = true
+
+// pamAuthenticate checks the password of the account with the PAM service.
+func pamAuthenticate(service, username, password string) error {
+	cService, cUser, cPassword := C.CString(service), C.CString(username), C.CString(password)
+	defer C.free(unsafe.Pointer(cService))
+	defer C.free(unsafe.Pointer(cUser))
+	defer func() {
+		// Don't leave the password in the freed memory
+		C.memset(unsafe.Pointer(cPassword), 0, C.size_t(len(password)))
+		C.free(unsafe.Pointer(cPassword))
+	}()
+	if status := C.authenticate(cService, cUser, cPassword); status != C.PAM_SUCCESS {
+		return errors.New("pam: " + C.GoString(C.pam_strerror(nil, status)))
+	}
+	return nil
+}
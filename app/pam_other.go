@@ -0,0 +1,11 @@
+//go:build !(linux && cgo && pam)
+
+package app
+
+// pamSupported reports whether the build can authenticate with PAM.
+const pamSupported = false
+
+// pamAuthenticate fails, the build has no PAM support.
+func pamAuthenticate(service, username, password string) error {
+	return errPAMUnsupported
+}
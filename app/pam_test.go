@@ -0,0 +1,70 @@
+package app
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuthenticateWithPAM(t *testing.T) {
+	dir := t.TempDir()
+	accounts := map[string]struct {
+		password string
+		home     string
+		groups   []string
+	}{
+		"alice": {"secret", filepath.Join(dir, "alice"), []string{"users", "staff"}},
+		"bob":   {"secret", filepath.Join(dir, "bob"), []string{"users"}},
+		"carol": {"secret", "/home/carol", []string{"staff"}},
+		"dave":  {"secret", filepath.Join(dir, "dave"), []string{"other"}},
+	}
+	defer func(verify func(string, string, string) error, lookup func(string) (string, []string, error)) {
+		pamVerify, lookupAccount = verify, lookup
+	}(pamVerify, lookupAccount)
+	pamVerify = func(service, username, password string) error {
+		if service != "david" || accounts[username].password != password {
+			return errors.New("pam: authentication failure")
+		}
+		return nil
+	}
+	lookupAccount = func(username string) (string, []string, error) {
+		return accounts[username].home, accounts[username].groups, nil
+	}
+
+	cfg := &Config{Dir: dir, PAM: &PAM{Home: true, Groups: []*PAMGroup{
+		{Group: "staff", Permissions: "crud"},
+		{Group: "users", Permissions: "r"},
+	}}}
+	a := &App{Config: cfg}
+	tests := []struct {
+		username   string
+		password   string
+		wantCrud   string
+		wantSubdir string
+	}{
+		{"alice", "secret", "crud", "/alice"},
+		{"bob", "secret", "r", "/bob"},
+		{"bob", "wrong", "", ""},
+		{"carol", "secret", "", ""},
+		{"dave", "secret", "", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("PROPFIND", "/", nil)
+		req.SetBasicAuth(tt.username, tt.password)
+		authInfo := authenticateBasic(a, req)
+		if tt.wantCrud == "" {
+			if authInfo != nil && authInfo.Authenticated {
+				t.Errorf("%s/%s was authenticated", tt.username, tt.password)
+			}
+			continue
+		}
+		if authInfo == nil || !authInfo.Authenticated || authInfo.CrudType.Crud != tt.wantCrud {
+			t.Errorf("authenticateBasic(%s) = %v, want crud %s", tt.username, authInfo, tt.wantCrud)
+			continue
+		}
+		if user := cfg.user(tt.username); user == nil || user.Subdir == nil || *user.Subdir != tt.wantSubdir {
+			t.Errorf("user(%s) = %v, want subdir %s", tt.username, user, tt.wantSubdir)
+		}
+	}
+}
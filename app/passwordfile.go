@@ -0,0 +1,102 @@
+package app
+
+import (
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// passwordFileUsers returns the users of the server and its tenants whose passwords are read from files.
+func (cfg *Config) passwordFileUsers() map[string][]*UserInfo {
+	users := map[string][]*UserInfo{}
+	lists := []map[string]*UserInfo{cfg.Users}
+	for _, tenant := range cfg.TenantConfigs() {
+		lists = append(lists, tenant.Users)
+	}
+	for _, list := range lists {
+		for username, user := range list {
+			if user.PasswordFile != "" {
+				users[username] = append(users[username], user)
+			}
+		}
+	}
+	return users
+}
+
+// reloadPasswordFiles re-reads the password files of the users and replaces the passwords which changed.
+// Plaintext passwords are hashed as the ones of the configuration, a file which can't be read or is empty
+// keeps the previous password.
+func (cfg *Config) reloadPasswordFiles() {
+	for username, users := range cfg.passwordFileUsers() {
+		for _, user := range users {
+			secret, err := resolveSecret(secretFile + user.PasswordFile)
+			if err != nil {
+				log.WithError(err).WithFields(log.Fields{"user": username, "path": user.PasswordFile}).Error("Error reading password file of user")
+				continue
+			}
+			if secret == "" {
+				// The file is being replaced, the next event brings the new password
+				continue
+			}
+			password := secret
+			if !isPasswordHash(secret) {
+				var ok bool
+				if password, ok = cfg.hashPlaintext(username, secret, user.Password); !ok {
+					continue
+				}
+			}
+			if password != user.Password {
+				log.WithFields(log.Fields{"user": username, "path": user.PasswordFile}).Info("Updated password of user from password file")
+				user.Password = password
+			}
+		}
+	}
+}
+
+// watchPasswordFiles reloads the password files of the users whenever they change. The directories are
+// watched, as mounted secrets are rotated by replacing a symlink next to the files instead of writing them,
+// and any change in one reloads all the files. Called again after a reload, it adds the new directories.
+func (cfg *Config) watchPasswordFiles() error {
+	dirs := map[string]bool{}
+	for _, users := range cfg.passwordFileUsers() {
+		for _, user := range users {
+			dirs[filepath.Dir(filepath.Clean(user.PasswordFile))] = true
+		}
+	}
+	if len(dirs) == 0 {
+		return nil
+	}
+	if cfg.passwordFiles == nil {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		cfg.passwordFiles = watcher
+		go func() {
+			for {
+				select {
+				case event, ok := <-watcher.Events:
+					if !ok {
+						return
+					}
+					if event.Op == fsnotify.Chmod {
+						continue
+					}
+					cfg.reloadPasswordFiles()
+				case err, ok := <-watcher.Errors:
+					if !ok {
+						return
+					}
+					log.WithError(err).Error("Error watching password files")
+				}
+			}
+		}()
+	}
+	for dir := range dirs {
+		if err := cfg.passwordFiles.Add(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
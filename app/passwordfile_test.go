@@ -0,0 +1,46 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchPasswordFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alice")
+	os.WriteFile(path, []byte(GenHash([]byte("password"))+"\n"), 0o600)
+	cfg := &Config{
+		Users:              map[string]*UserInfo{"alice": {PasswordFile: path, Crud: newCrudType("r")}},
+		PlaintextPasswords: plaintextHash,
+	}
+	if err := cfg.resolveSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := authenticate(cfg, "alice", "password"); err != nil {
+		t.Errorf("authenticate() with the password of the file = %v", err)
+	}
+	if err := cfg.watchPasswordFiles(); err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.passwordFiles.Close()
+
+	// A rotated secret in plaintext is hashed
+	os.WriteFile(path, []byte("rotated\n"), 0o600)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := authenticate(cfg, "alice", "rotated"); err == nil {
+			if !isPasswordHash(cfg.Users["alice"].Password) {
+				t.Errorf("rotated plaintext password wasn't hashed")
+			}
+			return
+		}
+	}
+	t.Errorf("rotated password file wasn't reloaded")
+}
+
+func TestPasswordFileWithPassword(t *testing.T) {
+	cfg := &Config{Users: map[string]*UserInfo{"alice": {Password: GenHash([]byte("password")), PasswordFile: "/run/secrets/alice"}}}
+	if err := cfg.resolveSecrets(); err == nil {
+		t.Errorf("resolveSecrets() of a user with both a password and a password file succeeded")
+	}
+}
@@ -0,0 +1,232 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Algorithms of the password hashes GenHashWith emits.
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+	HashScrypt   = "scrypt"
+)
+
+// Prefixes of the hashes in the PHC string format, other hashes are taken for bcrypt.
+const (
+	argon2idPrefix = "$argon2id$"
+	scryptPrefix   = "$scrypt$"
+)
+
+// defaultBcryptCost is the cost of new bcrypt hashes if no other cost is configured.
+const defaultBcryptCost = 10
+
+// Parameters of new Argon2id hashes, the ones recommended by OWASP. Hashes keep their own parameters.
+const (
+	argon2idMemory  = 19 * 1024
+	argon2idTime    = 2
+	argon2idThreads = 1
+	argon2idSaltLen = 16
+	argon2idKeyLen  = 32
+)
+
+// Parameters of new scrypt hashes: N = 2^15, which takes 32 MiB of memory.
+const (
+	scryptLogN    = 15
+	scryptR       = 8
+	scryptP       = 1
+	scryptSaltLen = 16
+	scryptKeyLen  = 32
+)
+
+// errPasswordMismatch is returned if the password doesn't match the hash.
+var errPasswordMismatch = errors.New("password doesn't match")
+
+// isPasswordHash reports whether the password of a user is a hash david can verify.
+func isPasswordHash(password string) bool {
+	switch {
+	case strings.HasPrefix(password, argon2idPrefix):
+		_, _, _, err := parseArgon2id(password)
+		return err == nil
+	case strings.HasPrefix(password, scryptPrefix):
+		_, _, _, err := parseScrypt(password)
+		return err == nil
+	}
+	_, err := bcrypt.Cost([]byte(password))
+	return err == nil
+}
+
+// verifyPassword checks the password against the hash, dispatching on the algorithm detected from the prefix
+// of the hash, so users can be migrated from one algorithm to another one by one.
+func verifyPassword(hash, password string) error {
+	switch {
+	case strings.HasPrefix(hash, argon2idPrefix):
+		return verifyArgon2id(hash, password)
+	case strings.HasPrefix(hash, scryptPrefix):
+		return verifyScrypt(hash, password)
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
+
+// GenHashWith generates a hashed password string with the given algorithm.
+func GenHashWith(algorithm string, password []byte) (string, error) {
+	return GenHashWithCost(algorithm, 0, password)
+}
+
+// GenHashWithCost generates a hashed password string with the given algorithm, bcrypt hashes of the given
+// cost (the default one if zero).
+func GenHashWithCost(algorithm string, cost int, password []byte) (string, error) {
+	if cost == 0 {
+		cost = defaultBcryptCost
+	}
+	switch algorithm {
+	case "", HashBcrypt:
+		hash, err := bcrypt.GenerateFromPassword(password, cost)
+		return string(hash), err
+	case HashArgon2id:
+		salt := make([]byte, argon2idSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey(password, salt, argon2idTime, argon2idMemory, argon2idThreads, argon2idKeyLen)
+		return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, argon2idMemory, argon2idTime, argon2idThreads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	case HashScrypt:
+		salt := make([]byte, scryptSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key, err := scrypt.Key(password, salt, 1<<scryptLogN, scryptR, scryptP, scryptKeyLen)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%sln=%d,r=%d,p=%d$%s$%s", scryptPrefix, scryptLogN, scryptR, scryptP,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+	return "", fmt.Errorf("unknown hash algorithm: %s", algorithm)
+}
+
+// needsRehash reports whether a hash is of another algorithm than the given one (bcrypt if empty) or weaker
+// than the hashes it generates, bcrypt hashes with the given cost (the default one if zero).
+func needsRehash(hash, algorithm string, cost int) bool {
+	if cost == 0 {
+		cost = defaultBcryptCost
+	}
+	if algorithm == "" {
+		algorithm = HashBcrypt
+	}
+	switch {
+	case strings.HasPrefix(hash, argon2idPrefix):
+		params, _, _, err := parseArgon2id(hash)
+		return algorithm != HashArgon2id || err == nil && (params.memory < argon2idMemory || params.time < argon2idTime)
+	case strings.HasPrefix(hash, scryptPrefix):
+		params, _, _, err := parseScrypt(hash)
+		return algorithm != HashScrypt || err == nil && params.logN < scryptLogN
+	}
+	current, err := bcrypt.Cost([]byte(hash))
+	return algorithm != HashBcrypt || err == nil && current < cost
+}
+
+// argon2idParams are the parameters of an Argon2id hash.
+type argon2idParams struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+// parseArgon2id splits an Argon2id hash of the form $argon2id$v=19$m=...,t=...,p=...$salt$key.
+func parseArgon2id(hash string) (argon2idParams, []byte, []byte, error) {
+	var params argon2idParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errors.New("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version: %s", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, fmt.Errorf("malformed argon2id parameters: %s", parts[3])
+	}
+	if params.memory == 0 || params.time == 0 || params.threads == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %s", parts[3])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("malformed argon2id key")
+	}
+	return params, salt, key, nil
+}
+
+// verifyArgon2id checks the password against an Argon2id hash in constant time.
+func verifyArgon2id(hash, password string) error {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	derived := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(derived, key) != 1 {
+		return errPasswordMismatch
+	}
+	return nil
+}
+
+// scryptParams are the parameters of a scrypt hash, logN is the binary logarithm of the cost N.
+type scryptParams struct {
+	logN int
+	r    int
+	p    int
+}
+
+// parseScrypt splits a scrypt hash of the form $scrypt$ln=...,r=...,p=...$salt$key.
+func parseScrypt(hash string) (scryptParams, []byte, []byte, error) {
+	var params scryptParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 {
+		return params, nil, nil, errors.New("malformed scrypt hash")
+	}
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &params.logN, &params.r, &params.p); err != nil {
+		return params, nil, nil, fmt.Errorf("malformed scrypt parameters: %s", parts[2])
+	}
+	// Larger costs would take minutes or the whole memory for each request
+	if params.logN < 1 || params.logN > 24 || params.r < 1 || params.p < 1 || params.r*params.p >= 1<<30 {
+		return params, nil, nil, fmt.Errorf("invalid scrypt parameters: %s", parts[2])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("malformed scrypt salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("malformed scrypt key")
+	}
+	return params, salt, key, nil
+}
+
+// verifyScrypt checks the password against a scrypt hash in constant time.
+func verifyScrypt(hash, password string) error {
+	params, salt, key, err := parseScrypt(hash)
+	if err != nil {
+		return err
+	}
+	derived, err := scrypt.Key([]byte(password), salt, 1<<params.logN, params.r, params.p, len(key))
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(derived, key) != 1 {
+		return errPasswordMismatch
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package app
+
+import "testing"
+
+func TestVerifyPassword(t *testing.T) {
+	for _, algorithm := range []string{HashBcrypt, HashArgon2id, HashScrypt} {
+		hash, err := GenHashWith(algorithm, []byte("secret"))
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if !isPasswordHash(hash) {
+			t.Errorf("%s: isPasswordHash(%q) = false", algorithm, hash)
+		}
+		if err := verifyPassword(hash, "secret"); err != nil {
+			t.Errorf("%s: verifyPassword() of the password = %v", algorithm, err)
+		}
+		if err := verifyPassword(hash, "wrong"); err == nil {
+			t.Errorf("%s: verifyPassword() of a wrong password succeeded", algorithm)
+		}
+	}
+
+	// A hash of the reference implementation with other parameters than the ones of new hashes
+	const reference = "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"
+	if err := verifyPassword(reference, "password"); err != nil {
+		t.Errorf("verifyPassword() of the reference hash = %v", err)
+	}
+	if _, err := GenHashWith("md5", []byte("secret")); err == nil {
+		t.Errorf("GenHashWith() of an unknown algorithm succeeded")
+	}
+	for _, malformed := range []string{"$scrypt$ln=15,r=8$c29tZXNhbHQ$CTFh", "$scrypt$ln=40,r=8,p=1$c29tZXNhbHQ$CTFh", "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ", "$argon2id$v=16$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "$argon2id$v=19$m=0,t=2,p=1$c29tZXNhbHQ$CTFh"} {
+		if isPasswordHash(malformed) {
+			t.Errorf("isPasswordHash(%q) = true", malformed)
+		}
+	}
+}
+
+func TestAuthenticateHashes(t *testing.T) {
+	// Users with hashes of different algorithms side by side, as during a migration
+	users := map[string]*UserInfo{}
+	for _, algorithm := range []string{HashBcrypt, HashArgon2id, HashScrypt} {
+		hash, _ := GenHashWith(algorithm, []byte("secret"))
+		users[algorithm] = &UserInfo{Password: hash, Crud: newCrudType("r")}
+	}
+	cfg := &Config{Users: users}
+	for username := range users {
+		if info, err := authenticate(cfg, username, "secret"); err != nil || !info.Authenticated {
+			t.Errorf("authenticate(%s) = %v, %v", username, info, err)
+		}
+		if _, err := authenticate(cfg, username, "wrong"); err == nil {
+			t.Errorf("authenticate(%s) with a wrong password succeeded", username)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+)
+
+// pepperEnv is the environment variable holding the pepper if no pepper file is configured.
+const pepperEnv = "DAVID_PEPPER"
+
+// LoadPepper returns the server-side secret passwords are combined with before they're hashed, read from the file
+// at path or else from $DAVID_PEPPER. There's no pepper if neither is set.
+func LoadPepper(path string) (string, error) {
+	if path == "" {
+		return os.Getenv(pepperEnv), nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	pepper := strings.TrimRight(string(content), "\r\n")
+	if pepper == "" {
+		return "", errors.New("pepper file is empty")
+	}
+	return pepper, nil
+}
+
+// PepperPassword returns what is hashed for a password: the base64 encoded HMAC-SHA256 of the password keyed
+// with the pepper. Appending the pepper instead would exceed the 72 bytes bcrypt hashes with longer passwords,
+// which cuts off the pepper. Without a pepper the password is hashed as it is.
+func PepperPassword(password, pepper string) string {
+	if pepper == "" {
+		return password
+	}
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(password))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// peppered combines the password of a user with the pepper. Users of the htpasswd file are left alone, their
+// hashes are generated by other tools.
+func (cfg *Config) peppered(username, password string) string {
+	if cfg.fileUsers[username] {
+		return password
+	}
+	return PepperPassword(password, cfg.pepper)
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPepper(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pepper")
+	os.WriteFile(path, []byte("s3cr3t-pepper\n"), 0o600)
+	pepper, err := LoadPepper(path)
+	if err != nil || pepper != "s3cr3t-pepper" {
+		t.Fatalf("LoadPepper() = %q, %v", pepper, err)
+	}
+	t.Setenv(pepperEnv, "from-env")
+	if pepper, _ := LoadPepper(""); pepper != "from-env" {
+		t.Errorf("LoadPepper() without file = %q, want the environment variable", pepper)
+	}
+
+	cfg := &Config{pepper: "s3cr3t-pepper", Users: map[string]*UserInfo{}}
+	hash, _ := cfg.genHash([]byte("password"))
+	cfg.Users["alice"] = &UserInfo{Password: hash, Crud: newCrudType("r")}
+	// A user of the htpasswd file, whose hash doesn't know the pepper
+	cfg.Users["bob"] = &UserInfo{Password: GenHash([]byte("password")), Crud: newCrudType("r")}
+	cfg.fileUsers = map[string]bool{"bob": true}
+
+	for _, username := range []string{"alice", "bob"} {
+		if info, err := authenticate(cfg, username, "password"); err != nil || !info.Authenticated {
+			t.Errorf("authenticate(%s) = %v, %v", username, info, err)
+		}
+	}
+	if verifyPassword(hash, "password") == nil {
+		t.Errorf("hash matches the password without the pepper")
+	}
+	cfg.pepper = "other"
+	if _, err := authenticate(cfg, "alice", "password"); err == nil {
+		t.Errorf("authenticate() with another pepper succeeded")
+	}
+}
+
+func TestPepperLongPassword(t *testing.T) {
+	cfg := &Config{pepper: strings.Repeat("p", 32), Users: map[string]*UserInfo{}}
+	// Appended to the password, the pepper would be cut off by the 72 bytes bcrypt hashes
+	password := strings.Repeat("x", 60)
+	hash, err := cfg.genHash([]byte(password))
+	if err != nil {
+		t.Fatalf("genHash() error = %v", err)
+	}
+	cfg.Users["alice"] = &UserInfo{Password: hash, Crud: newCrudType("r")}
+	if info, err := authenticate(cfg, "alice", password); err != nil || !info.Authenticated {
+		t.Errorf("authenticate() = %v, %v", info, err)
+	}
+	cfg.pepper = strings.Repeat("p", 31) + "q"
+	if _, err := authenticate(cfg, "alice", password); err == nil {
+		t.Errorf("authenticate() with another end of the pepper succeeded")
+	}
+	// Passwords longer than bcrypt hashes can still be hashed
+	if _, err := cfg.genHash([]byte(strings.Repeat("x", 100))); err != nil {
+		t.Errorf("genHash() of a long password error = %v", err)
+	}
+}
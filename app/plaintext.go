@@ -0,0 +1,165 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Handling of plaintext passwords in the configuration, set by plaintextPasswords.
+const (
+	// plaintextHash hashes them when the configuration is loaded.
+	plaintextHash = "hash"
+	// plaintextRewrite hashes them and replaces them in the configuration file by their hashes.
+	plaintextRewrite = "rewrite"
+)
+
+// passwordLine matches the password of a user in a yaml file: the key with the indentation, the value and the
+// comment.
+var passwordLine = regexp.MustCompile(`^(\s*(?i:password)\s*:\s*)("[^"]*"|'[^']*'|[^#\s]+)(\s*(?:#.*)?)$`)
+
+// hashPlaintextPasswords hashes the passwords of the users which aren't hashes, as they'd never authenticate,
+// if the configuration allows it, and warns about them otherwise. The hashes of the current users are kept if
+// they match, so a reload doesn't change them. With plaintextRewrite the passwords in the configuration file
+// at path are replaced by their hashes.
+func (cfg *Config) hashPlaintextPasswords(path string, current map[string]*UserInfo) {
+	hashes := map[string]string{}
+	for username, user := range cfg.Users {
+		if user.Password == "" || isPasswordHash(user.Password) {
+			continue
+		}
+		var previous string
+		if user := current[username]; user != nil {
+			previous = user.Password
+		}
+		hash, ok := cfg.hashPlaintext(username, user.Password, previous)
+		if !ok {
+			continue
+		}
+		user.Password = hash
+		// Secrets referenced by the configuration stay where they are
+		if user.passwordRef == "" {
+			hashes[username] = user.Password
+		}
+		if cfg.PlaintextPasswords == plaintextHash {
+			log.WithField("user", username).Warn("Password of user is in plaintext in the configuration, it was hashed for now")
+		}
+	}
+	if cfg.PlaintextPasswords != plaintextRewrite || len(hashes) == 0 {
+		return
+	}
+	if err := rewritePasswords(path, hashes); err != nil {
+		log.WithError(err).WithField("path", path).Error("Error replacing plaintext passwords in the configuration file, they were hashed for now")
+		return
+	}
+	log.WithField("path", path).Warn("Replaced plaintext passwords in the configuration file by their hashes")
+}
+
+// hashPlaintext returns the hash of the plaintext password of a user, the previous hash if it matches. It
+// returns false, after logging why, if plaintext passwords aren't allowed or hashing failed.
+func (cfg *Config) hashPlaintext(username, plain, previous string) (string, bool) {
+	if cfg.PlaintextPasswords != plaintextHash && cfg.PlaintextPasswords != plaintextRewrite {
+		log.WithField("user", username).Error("Password of user is not a hash and never matches, hash it with bcpt or set plaintextPasswords")
+		return "", false
+	}
+	if previous != "" && verifyPassword(previous, PepperPassword(plain, cfg.pepper)) == nil {
+		return previous, true
+	}
+	hash, err := cfg.genHash([]byte(plain))
+	if err != nil {
+		log.WithError(err).WithField("user", username).Error("Error hashing plaintext password of user")
+		return "", false
+	}
+	return hash, true
+}
+
+// rewritePasswords replaces the passwords of the users in the yaml file at path by their hashes, which are
+// keyed by username. The rest of the file, including comments, is kept as it is.
+func rewritePasswords(path string, hashes map[string]string) error {
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".yaml" && ext != ".yml" {
+		return fmt.Errorf("only yaml files can be rewritten")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return err
+	}
+	lines := strings.Split(string(content), "\n")
+	replaced := 0
+	for username, value := range passwordNodes(&root) {
+		hash, ok := hashes[username]
+		if !ok || value.Line < 1 || value.Line > len(lines) {
+			continue
+		}
+		match := passwordLine.FindStringSubmatch(lines[value.Line-1])
+		if match == nil {
+			continue
+		}
+		lines[value.Line-1] = match[1] + `"` + hash + `"` + match[3]
+		replaced++
+	}
+	if replaced != len(hashes) {
+		return fmt.Errorf("%d of %d passwords not found", len(hashes)-replaced, len(hashes))
+	}
+	// Replace the file at once, a reload mustn't see it half written
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".david-config-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(strings.Join(lines, "\n")); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// passwordNodes returns the value nodes of the passwords of the users in a yaml document, keyed by username.
+// Keys match regardless of their case, as they do in the configuration.
+func passwordNodes(root *yaml.Node) map[string]*yaml.Node {
+	nodes := map[string]*yaml.Node{}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nodes
+	}
+	users := mappingValue(root.Content[0], "users")
+	if users == nil || users.Kind != yaml.MappingNode {
+		return nodes
+	}
+	for i := 0; i+1 < len(users.Content); i += 2 {
+		if password := mappingValue(users.Content[i+1], "password"); password != nil && password.Kind == yaml.ScalarNode {
+			nodes[strings.ToLower(users.Content[i].Value)] = password
+		}
+	}
+	return nodes
+}
+
+// mappingValue returns the value of key in a yaml mapping, nil if it isn't a mapping or doesn't have the key.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, key) {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPlaintextPasswords(t *testing.T) {
+	hash := GenHash([]byte("secret"))
+	for _, mode := range []string{"", plaintextHash} {
+		cfg := &Config{PlaintextPasswords: mode, Users: map[string]*UserInfo{
+			"alice": {Password: "secret"},
+			"bob":   {Password: hash},
+		}}
+		cfg.hashPlaintextPasswords("", nil)
+		if cfg.Users["bob"].Password != hash {
+			t.Errorf("%q: hash of bob was changed", mode)
+		}
+		hashed := bcrypt.CompareHashAndPassword([]byte(cfg.Users["alice"].Password), []byte("secret")) == nil
+		if hashed != (mode == plaintextHash) {
+			t.Errorf("%q: password of alice hashed = %v", mode, hashed)
+		}
+	}
+
+	// A reload keeps the hash of the current configuration
+	cfg := &Config{PlaintextPasswords: plaintextHash, Users: map[string]*UserInfo{"alice": {Password: "secret"}}}
+	cfg.hashPlaintextPasswords("", map[string]*UserInfo{"alice": {Password: hash}})
+	if cfg.Users["alice"].Password != hash {
+		t.Errorf("reload changed the hash of alice")
+	}
+}
+
+func TestRewritePasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `dir: /tmp
+users:
+  alice:
+    password: secret    # pasted by the admin
+    permissions: crud
+  Bob:
+    password: 'other'
+redis:
+  password: secret
+`
+	os.WriteFile(path, []byte(content), 0640)
+	cfg := &Config{PlaintextPasswords: plaintextRewrite, Users: map[string]*UserInfo{
+		"alice": {Password: "secret"},
+		"bob":   {Password: "other"},
+	}}
+	cfg.hashPlaintextPasswords(path, nil)
+
+	rewritten, _ := os.ReadFile(path)
+	lines := strings.Split(string(rewritten), "\n")
+	if want := `    password: "` + cfg.Users["alice"].Password + `"    # pasted by the admin`; lines[3] != want {
+		t.Errorf("line of alice = %q, want %q", lines[3], want)
+	}
+	if want := `    password: "` + cfg.Users["bob"].Password + `"`; lines[6] != want {
+		t.Errorf("line of bob = %q, want %q", lines[6], want)
+	}
+	if lines[8] != "  password: secret" {
+		t.Errorf("password outside of the users was replaced: %q", lines[8])
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0640 {
+		t.Errorf("mode of the configuration = %v, want 0640", info.Mode().Perm())
+	}
+}
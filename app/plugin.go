@@ -0,0 +1,259 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/audstanley/david/plugin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// pluginClient is a running plugin process and the RPC client connected to it.
+type pluginClient struct {
+	name   string
+	cmd    *exec.Cmd
+	client *rpc.Client
+}
+
+// pipe combines the standard output and input of a plugin process.
+type pipe struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+// Close closes both directions of the pipe.
+func (p pipe) Close() error {
+	p.WriteCloser.Close()
+	return p.ReadCloser.Close()
+}
+
+// startPlugin launches the plugin command and connects a JSON-RPC client to its standard input and output.
+func startPlugin(name string, p *Plugin) (*pluginClient, error) {
+	fields := strings.Fields(p.Command)
+	if len(fields) == 0 {
+		return nil, errors.New("empty plugin command")
+	}
+	cmd := exec.Command(fields[0], fields[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{"plugin": name, "pid": cmd.Process.Pid}).Info("Started plugin")
+	client := rpc.NewClientWithCodec(jsonrpc.NewClientCodec(pipe{stdout, stdin}))
+	return &pluginClient{name: name, cmd: cmd, client: client}, nil
+}
+
+// call invokes an RPC method of the plugin and maps transported error messages back to os errors.
+func (p *pluginClient) call(method string, args interface{}, reply interface{}) error {
+	err := p.client.Call(method, args, reply)
+	if err == nil {
+		return nil
+	}
+	if err == rpc.ErrShutdown {
+		log.WithField("plugin", p.name).Error("Plugin is no longer running")
+	}
+	switch err.Error() {
+	case plugin.ErrNotExist:
+		return os.ErrNotExist
+	case plugin.ErrExist:
+		return os.ErrExist
+	case plugin.ErrInvalid:
+		return os.ErrInvalid
+	}
+	return err
+}
+
+// startPlugins launches all configured plugins and wires them into the configuration.
+func (cfg *Config) startPlugins() error {
+	for name, p := range cfg.Plugins {
+		client, err := startPlugin(name, p)
+		if err != nil {
+			return errors.New("plugin " + name + ": " + err.Error())
+		}
+		if p.Auth {
+			cfg.authPlugins = append(cfg.authPlugins, client)
+		}
+		if p.Events {
+			cfg.eventPlugins = append(cfg.eventPlugins, client)
+		}
+		if p.Storage {
+			if cfg.storage != nil {
+				return errors.New("plugin " + name + ": only one storage plugin can be configured")
+			}
+			cfg.storage = &pluginStorage{client}
+		}
+	}
+	return nil
+}
+
+// authenticateWithPlugins asks the auth plugins to verify the credentials of a user unknown to the config file.
+// Authenticated users are remembered with the returned permissions and subdir.
+func authenticateWithPlugins(cfg *Config, username, password, address string) (*AuthInfo, error) {
+	for _, p := range cfg.authPlugins {
+		var reply plugin.AuthReply
+		if err := p.call("Auth.Authenticate", plugin.AuthArgs{Username: username, Password: password, Address: address}, &reply); err != nil {
+			log.WithFields(log.Fields{"plugin": p.name, "user": username}).WithError(err).Error("Error authenticating with plugin")
+			continue
+		}
+		if !reply.Authenticated {
+			continue
+		}
+
+		user := &UserInfo{Permissions: reply.Permissions, Crud: &CrudType{Crud: reply.Permissions}}
+		if reply.Subdir != "" {
+			user.Subdir = &reply.Subdir
+		}
+		cfg.externalUsers.Store(username, user)
+		if err := FormatCrud(context.Background(), username, cfg); err != nil {
+			return nil, err
+		}
+		log.WithFields(log.Fields{"plugin": p.name, "user": username, "crud": user.Crud}).Debug("User was authenticated by plugin")
+		return &AuthInfo{Username: username, Authenticated: true, CrudType: user.Crud}, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+// publishEvent sends the event to all event plugins in the background, and to the thumbnail workers.
+func publishEvent(cfg *Config, event *Event) {
+	if cfg.thumbnailer != nil {
+		cfg.thumbnailer.publish(cfg, event)
+	}
+	for _, p := range cfg.eventPlugins {
+		go func(p *pluginClient) {
+			if err := p.call("Events.Publish", plugin.Event(*event), &plugin.Empty{}); err != nil {
+				log.WithField("plugin", p.name).WithError(err).Error("Error publishing event to plugin")
+			}
+		}(p)
+	}
+}
+
+// pluginStorage is a storage backend served by a plugin.
+type pluginStorage struct {
+	p *pluginClient
+}
+
+// Mkdir creates a directory via Storage.Mkdir.
+func (s *pluginStorage) Mkdir(name string, perm os.FileMode) error {
+	return s.p.call("Storage.Mkdir", plugin.MkdirArgs{Name: name, Perm: perm}, &plugin.Empty{})
+}
+
+// OpenFile opens a file via Storage.Open and returns a handle based webdav.File.
+func (s *pluginStorage) OpenFile(name string, flag int, perm os.FileMode) (webdav.File, error) {
+	var handle plugin.Handle
+	if err := s.p.call("Storage.Open", plugin.OpenArgs{Name: name, Flag: flag, Perm: perm}, &handle); err != nil {
+		return nil, err
+	}
+	return &pluginFile{p: s.p, handle: handle.Handle}, nil
+}
+
+// RemoveAll removes a file or directory via Storage.RemoveAll.
+func (s *pluginStorage) RemoveAll(name string) error {
+	return s.p.call("Storage.RemoveAll", plugin.PathArgs{Name: name}, &plugin.Empty{})
+}
+
+// Rename renames a file or directory via Storage.Rename.
+func (s *pluginStorage) Rename(oldName, newName string) error {
+	return s.p.call("Storage.Rename", plugin.RenameArgs{OldName: oldName, NewName: newName}, &plugin.Empty{})
+}
+
+// Stat returns file information via Storage.Stat.
+func (s *pluginStorage) Stat(name string) (os.FileInfo, error) {
+	var info plugin.FileInfo
+	if err := s.p.call("Storage.Stat", plugin.PathArgs{Name: name}, &info); err != nil {
+		return nil, err
+	}
+	return pluginFileInfo{info}, nil
+}
+
+// pluginFile is a file opened by a storage plugin.
+type pluginFile struct {
+	p      *pluginClient
+	handle uint64
+}
+
+// Read reads from the file via Storage.Read.
+func (f *pluginFile) Read(b []byte) (int, error) {
+	var reply plugin.ReadReply
+	if err := f.p.call("Storage.Read", plugin.ReadArgs{Handle: f.handle, Size: len(b)}, &reply); err != nil {
+		return 0, err
+	}
+	n := copy(b, reply.Data)
+	if reply.EOF && n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// Write writes to the file via Storage.Write.
+func (f *pluginFile) Write(b []byte) (int, error) {
+	var reply plugin.WriteReply
+	if err := f.p.call("Storage.Write", plugin.WriteArgs{Handle: f.handle, Data: b}, &reply); err != nil {
+		return reply.N, err
+	}
+	return reply.N, nil
+}
+
+// Seek moves the offset of the file via Storage.Seek.
+func (f *pluginFile) Seek(offset int64, whence int) (int64, error) {
+	var reply plugin.SeekReply
+	err := f.p.call("Storage.Seek", plugin.SeekArgs{Handle: f.handle, Offset: offset, Whence: whence}, &reply)
+	return reply.Offset, err
+}
+
+// Readdir lists directory entries via Storage.Readdir.
+func (f *pluginFile) Readdir(count int) ([]os.FileInfo, error) {
+	var reply plugin.ReaddirReply
+	if err := f.p.call("Storage.Readdir", plugin.ReaddirArgs{Handle: f.handle, Count: count}, &reply); err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, len(reply.Infos))
+	for i, info := range reply.Infos {
+		infos[i] = pluginFileInfo{info}
+	}
+	if count > 0 && len(infos) == 0 {
+		return nil, io.EOF
+	}
+	return infos, nil
+}
+
+// Stat returns information about the open file via Storage.FStat.
+func (f *pluginFile) Stat() (os.FileInfo, error) {
+	var info plugin.FileInfo
+	if err := f.p.call("Storage.FStat", plugin.Handle{Handle: f.handle}, &info); err != nil {
+		return nil, err
+	}
+	return pluginFileInfo{info}, nil
+}
+
+// Close releases the handle via Storage.Close.
+func (f *pluginFile) Close() error {
+	return f.p.call("Storage.Close", plugin.Handle{Handle: f.handle}, &plugin.Empty{})
+}
+
+// pluginFileInfo implements os.FileInfo for file information sent by a plugin.
+type pluginFileInfo struct {
+	info plugin.FileInfo
+}
+
+func (fi pluginFileInfo) Name() string       { return fi.info.Name }
+func (fi pluginFileInfo) Size() int64        { return fi.info.Size }
+func (fi pluginFileInfo) Mode() os.FileMode  { return fi.info.Mode }
+func (fi pluginFileInfo) ModTime() time.Time { return fi.info.ModTime }
+func (fi pluginFileInfo) IsDir() bool        { return fi.info.IsDir }
+func (fi pluginFileInfo) Sys() interface{}   { return nil }
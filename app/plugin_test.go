@@ -0,0 +1,71 @@
+package app
+
+import (
+	"os"
+	"testing"
+
+	"github.com/audstanley/david/plugin"
+)
+
+// helperAuth is the auth service of the helper plugin, it knows a single user.
+type helperAuth struct{}
+
+func (helperAuth) Authenticate(args plugin.AuthArgs, reply *plugin.AuthReply) error {
+	if args.Username == "plugin-user" && args.Password == "secret" {
+		*reply = plugin.AuthReply{Authenticated: true, Permissions: "r", Subdir: "/plugin"}
+	}
+	return nil
+}
+
+// TestHelperPlugin isn't a real test, it's the plugin process started by TestAuthenticateWithPlugins.
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv("DAVID_HELPER_PLUGIN") != "1" {
+		return
+	}
+	plugin.Serve(map[string]interface{}{"Auth": helperAuth{}})
+	os.Exit(0)
+}
+
+func TestAuthenticateWithPlugins(t *testing.T) {
+	// Start the test binary itself as plugin
+	t.Setenv("DAVID_HELPER_PLUGIN", "1")
+	cfg := &Config{Plugins: map[string]*Plugin{
+		"helper": {Command: os.Args[0] + " -test.run=^TestHelperPlugin$", Auth: true},
+	}}
+	if err := cfg.startPlugins(); err != nil {
+		t.Fatalf("startPlugins() error = %v", err)
+	}
+	defer cfg.authPlugins[0].cmd.Process.Kill()
+
+	if !cfg.AuthenticationNeeded() {
+		t.Errorf("AuthenticationNeeded() = false, want true with an auth plugin")
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  bool
+	}{
+		{"wrong password", "plugin-user", "wrong", true},
+		{"unknown user", "nobody", "secret", true},
+		{"all fine", "plugin-user", "secret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := authenticateWithPlugins(cfg, tt.username, tt.password, "127.0.0.1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("authenticateWithPlugins() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && (!got.Authenticated || !got.CrudType.Read || got.CrudType.Create) {
+				t.Errorf("authenticateWithPlugins() = %v, want read only user", got)
+			}
+		})
+	}
+
+	// The authenticated user is known with its subdir from now on
+	if user := cfg.user("plugin-user"); user == nil || user.Subdir == nil || *user.Subdir != "/plugin" {
+		t.Errorf("user() = %v, want user with subdir /plugin", user)
+	}
+}
@@ -0,0 +1,182 @@
+package app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// presignEndpoint is the path (relative to the configured prefix) authenticated users call to generate links.
+const presignEndpoint = "/_presign"
+
+// defaultPresignExpiry is used when neither the request nor the configuration limit the lifetime of a link.
+const defaultPresignExpiry = 24 * time.Hour
+
+// Query parameters carried by a pre-signed url.
+const (
+	presignUserParam      = "user"
+	presignExpiresParam   = "expires"
+	presignSignatureParam = "signature"
+)
+
+// presignResponse is the JSON body returned to a user who requested a pre-signed url.
+type presignResponse struct {
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// presignSignature calculates the hex encoded HMAC-SHA256 over the user, the cleaned path and the expiry.
+func presignSignature(secret, username, name string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(username + "\n" + name + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// PresignURL returns the path and query (including the configured prefix) granting username read access to name until expires.
+func PresignURL(cfg *Config, username, name string, expires time.Time) string {
+	name = path.Clean("/" + name)
+	query := url.Values{}
+	query.Set(presignUserParam, username)
+	query.Set(presignExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+	query.Set(presignSignatureParam, presignSignature(cfg.Presign.Secret, username, name, expires.Unix()))
+	return (&url.URL{Path: cfg.prefixOf(username) + name, RawQuery: query.Encode()}).String()
+}
+
+// isPresignedRequest reports whether the request carries a pre-signed url signature.
+func isPresignedRequest(req *http.Request) bool {
+	return (req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+		req.URL.Query().Get(presignSignatureParam) != ""
+}
+
+// verifyPresigned validates the signature and expiry of a pre-signed request and returns the user and cleaned path.
+func verifyPresigned(cfg *Config, req *http.Request) (string, string, error) {
+	query := req.URL.Query()
+	username := query.Get(presignUserParam)
+	expires, err := strconv.ParseInt(query.Get(presignExpiresParam), 10, 64)
+	if err != nil {
+		return "", "", errors.New("invalid expiry of pre-signed url")
+	}
+	if !hasPathPrefix(req.URL.Path, cfg.prefixOf(username)) {
+		return "", "", errors.New("pre-signed url outside of the prefix of the user")
+	}
+	name := path.Clean("/" + strings.TrimPrefix(req.URL.Path, cfg.prefixOf(username)))
+
+	// Compare in constant time so the signature can't be guessed byte by byte
+	want := presignSignature(cfg.Presign.Secret, username, name, expires)
+	if !hmac.Equal([]byte(want), []byte(query.Get(presignSignatureParam))) {
+		return "", "", errors.New("signature of pre-signed url doesn't match")
+	}
+	if time.Now().Unix() > expires {
+		return "", "", errors.New("pre-signed url has expired")
+	}
+	return username, name, nil
+}
+
+// servePresigned serves a single file for a valid pre-signed url without requiring Basic auth.
+func servePresigned(a *App, w http.ResponseWriter, req *http.Request) {
+	username, name, err := verifyPresigned(a.Config, req)
+	if err != nil {
+		log.WithFields(log.Fields{"path": req.URL.Path, "user": username}).WithError(err).Warn("Rejected pre-signed url")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	// The signing user must still exist, still be allowed to read and neither be disabled nor expired since
+	user := a.Config.user(username)
+	if user == nil || user.Crud == nil || !user.Crud.Read || user.Disabled || user.expired(time.Now()) {
+		log.WithFields(log.Fields{"path": name, "user": username}).Warn("Pre-signed url of a user without read permission, disabled or expired")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	// The files of encrypted users are only served with their key, which is only at hand with a key file
+	fs, err := a.Config.userFileSystem(username)
+	if err != nil {
+		log.WithFields(log.Fields{"path": name, "user": username}).WithError(err).Warn("Pre-signed url of an encrypted user")
+		writeDAVError(w, http.StatusForbidden, conditionOperationDenied)
+		return
+	}
+
+	// Open the file within the jail of the signing user, like any request of the user would
+	ctx := context.WithValue(req.Context(), authInfoKey, &AuthInfo{Username: username, Authenticated: true, CrudType: user.Crud})
+	f, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		// Only single files can be shared
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if a.Config.Log.Read {
+		log.WithFields(log.Fields{"path": name, "user": username}).Info("Served pre-signed url")
+	}
+	sw := &statusWriter{ResponseWriter: w}
+	http.ServeContent(sw, req, info.Name(), info.ModTime(), f)
+	usage.record(username, req.Method, 0, sw.written.Load())
+}
+
+// handlePresignRequest generates a pre-signed url for the authenticated user.
+// The file is given with the query parameter "path" and the lifetime with "expires" (e.g. "1h").
+func handlePresignRequest(a *App, ctx context.Context, w http.ResponseWriter, req *http.Request, authInfo *AuthInfo) {
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		handleMethodNotAllowed(ctx, w, req, http.MethodGet, http.MethodPost)
+		return
+	}
+	name := req.URL.Query().Get("path")
+	if name == "" {
+		http.Error(w, "missing path", http.StatusBadRequest)
+		return
+	}
+
+	// Determine the lifetime of the link, bounded by the configured maximum
+	expiry := defaultPresignExpiry
+	if a.Config.Presign.MaxExpiry > 0 {
+		expiry = a.Config.Presign.MaxExpiry
+	}
+	if requested := req.URL.Query().Get("expires"); requested != "" {
+		d, err := time.ParseDuration(requested)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid expires", http.StatusBadRequest)
+			return
+		}
+		if d < expiry {
+			expiry = d
+		}
+	}
+
+	// Only existing files the user can read may be shared, not the ones of others in owner-only directories or
+	// the ones the ACL of the user denies
+	dir := Dir{a.Config}
+	filePath := Resolve(ctx, name, dir)
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() || dir.hiddenFromUser(ctx, filePath) || !dir.crudAt(ctx, filePath).Read {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+
+	expires := time.Now().Add(expiry)
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	link := scheme + "://" + req.Host + PresignURL(a.Config, authInfo.Username, name, expires)
+	log.WithFields(log.Fields{"user": authInfo.Username, "path": name, "expires": expires}).Info("Generated pre-signed url")
+
+	writeJSON(w, presignResponse{URL: link, Expires: expires.UTC()})
+}
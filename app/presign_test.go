@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServePresigned(t *testing.T) {
+	// Create a temporary directory with a file inside the jail of user1
+	tmpDir := filepath.Join(os.TempDir(), "david__"+strconv.FormatInt(time.Now().UnixNano(), 10))
+	os.MkdirAll(filepath.Join(tmpDir, "subdir1"), 0700)
+	defer os.RemoveAll(tmpDir)
+	os.WriteFile(filepath.Join(tmpDir, "subdir1", "report.txt"), []byte("content"), 0600)
+
+	configTmp := createTestConfig(tmpDir)
+	configTmp.Presign = &Presign{Secret: "s3cr3t"}
+	a := &App{Config: configTmp}
+	// Users disabled or expired after signing a link
+	disabled, expiredUser := *configTmp.Users["user1"], *configTmp.Users["user1"]
+	disabled.Disabled, expiredUser.ExpiresAt = true, time.Now().Add(-time.Minute)
+	configTmp.Users["disabled"], configTmp.Users["expired"] = &disabled, &expiredUser
+
+	valid := PresignURL(configTmp, "user1", "/report.txt", time.Now().Add(time.Hour))
+	expired := PresignURL(configTmp, "user1", "/report.txt", time.Now().Add(-time.Hour))
+
+	tests := []struct {
+		name       string
+		url        string
+		statusCode int
+	}{
+		{"valid", valid, http.StatusOK},
+		{"expired", expired, http.StatusForbidden},
+		{"tampered user", strings.Replace(valid, "user=user1", "user=admin", 1), http.StatusForbidden},
+		{"tampered path", "/other.txt?" + valid[len("/report.txt?"):], http.StatusForbidden},
+		{"missing file", PresignURL(configTmp, "user1", "/nope.txt", time.Now().Add(time.Hour)), http.StatusNotFound},
+		{"unknown user", PresignURL(configTmp, "ghost", "/report.txt", time.Now().Add(time.Hour)), http.StatusForbidden},
+		{"disabled user", PresignURL(configTmp, "disabled", "/report.txt", time.Now().Add(time.Hour)), http.StatusForbidden},
+		{"expired user", PresignURL(configTmp, "expired", "/report.txt", time.Now().Add(time.Hour)), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, httptest.NewRequest(http.MethodGet, tt.url, nil), a)
+
+			if resp := w.Result(); resp.StatusCode != tt.statusCode {
+				t.Errorf("handle() presigned = %v, want %v", resp.StatusCode, tt.statusCode)
+			}
+		})
+	}
+}
+
+func TestHandlePresignRequest(t *testing.T) {
+	// Create a temporary directory with a file to share
+	tmpDir := filepath.Join(os.TempDir(), "david__"+strconv.FormatInt(time.Now().UnixNano(), 10))
+	os.Mkdir(tmpDir, 0700)
+	defer os.RemoveAll(tmpDir)
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0600)
+
+	configTmp := createTestConfig(tmpDir)
+	configTmp.Presign = &Presign{Secret: "s3cr3t", MaxExpiry: time.Hour}
+	configTmp.Users["admin"].Password = GenHash([]byte("password"))
+	a := &App{Config: configTmp}
+
+	tests := []struct {
+		name       string
+		url        string
+		statusCode int
+	}{
+		{"ok", "/_presign?path=/a.txt&expires=10m", http.StatusOK},
+		{"missing path", "/_presign", http.StatusBadRequest},
+		{"invalid expiry", "/_presign?path=/a.txt&expires=soon", http.StatusBadRequest},
+		{"missing file", "/_presign?path=/b.txt", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, tt.url, nil)
+			r.SetBasicAuth("admin", "password")
+			handle(context.Background(), w, r, a)
+
+			if resp := w.Result(); resp.StatusCode != tt.statusCode {
+				t.Errorf("handlePresignRequest() = %v, want %v", resp.StatusCode, tt.statusCode)
+			}
+		})
+	}
+}
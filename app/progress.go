@@ -0,0 +1,84 @@
+package app
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultProgressInterval is used when no interval of the progress reports is configured.
+const defaultProgressInterval = 30 * time.Second
+
+// Progress configures periodic reports of transfers larger than MinSize bytes (announced or transferred so far)
+// while they are in progress, logged and exported as metrics every Interval.
+type Progress struct {
+	MinSize  int64
+	Interval time.Duration
+}
+
+// progressReporter remembers the bytes of the transfers at the last report, for their current rate.
+type progressReporter struct {
+	progress *Progress
+	last     map[*transfer]int64
+	users    map[string]bool
+}
+
+// report logs the large transfers in progress and sets the gauges of their number and bytes per user.
+func (r *progressReporter) report(now time.Time, interval time.Duration) {
+	stats.mu.Lock()
+	transfers := make([]*transfer, 0, len(stats.transfers))
+	for t := range stats.transfers {
+		transfers = append(transfers, t)
+	}
+	stats.mu.Unlock()
+
+	last := map[*transfer]int64{}
+	bytes := map[string]int64{}
+	for _, t := range transfers {
+		transferred := t.Bytes()
+		if transferred < r.progress.MinSize && t.Size < r.progress.MinSize {
+			continue
+		}
+		// Transfers reported for the first time are rated since their start
+		elapsed := now.Sub(t.Started)
+		var rate float64
+		if span := min(interval, elapsed); span > 0 {
+			rate = float64(transferred-r.last[t]) / span.Seconds()
+		}
+		fields := log.Fields{"user": t.User, "method": t.Method, "path": t.Path, "bytes": transferred,
+			"rate": int64(rate), "elapsed": elapsed.Round(time.Second).String()}
+		if t.Size > 0 {
+			fields["size"] = t.Size
+		}
+		log.WithFields(fields).Info("Transfer in progress")
+		last[t] = transferred
+		bytes[t.User] += transferred
+	}
+	r.last = last
+
+	metrics.Set("david_large_transfers", "Number of transfers in progress above the size threshold", float64(len(last)))
+	for user := range r.users {
+		if _, ok := bytes[user]; !ok {
+			metrics.Set("david_large_transfer_bytes", "Bytes transferred so far by the large transfers in progress", 0, "user", user)
+		}
+	}
+	r.users = map[string]bool{}
+	for user, n := range bytes {
+		metrics.Set("david_large_transfer_bytes", "Bytes transferred so far by the large transfers in progress", float64(n), "user", user)
+		r.users[user] = true
+	}
+}
+
+// startProgress periodically reports the large transfers in progress.
+func (cfg *Config) startProgress() {
+	interval := cfg.Progress.Interval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	r := &progressReporter{progress: cfg.Progress, last: map[*transfer]int64{}, users: map[string]bool{}}
+	go func() {
+		for now := range time.Tick(interval) {
+			r.report(now, interval)
+		}
+	}()
+}
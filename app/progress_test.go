@@ -0,0 +1,43 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressReport(t *testing.T) {
+	now := time.Now()
+	small := &transfer{User: "alice", Method: "PUT", Path: "/small.txt", Started: now.Add(-time.Minute), Size: 10, body: &countingReader{}, writer: &statusWriter{}}
+	announced := &transfer{User: "bob", Method: "PUT", Path: "/disk.img", Started: now.Add(-time.Minute), Size: 1 << 30, body: &countingReader{}, writer: &statusWriter{}}
+	download := &transfer{User: "bob", Method: "GET", Path: "/video.mp4", Started: now.Add(-time.Minute), Size: -1, body: &countingReader{}, writer: &statusWriter{}}
+	small.body.n.Store(10)
+	announced.body.n.Store(300)
+	download.writer.written.Store(2000)
+	for _, tr := range []*transfer{small, announced, download} {
+		stats.begin(tr)
+		defer stats.end(tr)
+	}
+
+	r := &progressReporter{progress: &Progress{MinSize: 1000}, last: map[*transfer]int64{}, users: map[string]bool{}}
+	r.report(now, 30*time.Second)
+	if len(r.last) != 2 || r.last[announced] != 300 || r.last[download] != 2000 {
+		t.Errorf("reported transfers = %v, want the announced upload and the download", r.last)
+	}
+	var buf bytes.Buffer
+	metrics.write(&buf)
+	if !strings.Contains(buf.String(), `david_large_transfer_bytes{user="bob"} 2300`) {
+		t.Errorf("metrics = %q, want the bytes of bob", buf.String())
+	}
+
+	// Finished transfers are reset in the gauges
+	stats.end(announced)
+	stats.end(download)
+	r.report(now.Add(30*time.Second), 30*time.Second)
+	buf.Reset()
+	metrics.write(&buf)
+	if !strings.Contains(buf.String(), `david_large_transfer_bytes{user="bob"} 0`) || !strings.Contains(buf.String(), "david_large_transfers 0") {
+		t.Errorf("metrics = %q, want no large transfers", buf.String())
+	}
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/webdav"
+)
+
+// Properties configures the SQLite database File keeping the dead properties set by PROPPATCH,
+// like tags and metadata. In high availability mode they are kept in redis instead.
+type Properties struct {
+	File string
+}
+
+// propertiesSchema creates the table of the properties, values hold the inner XML of the properties.
+var propertiesSchema = []string{
+	`CREATE TABLE IF NOT EXISTS david_properties (
+		path TEXT NOT NULL,
+		space TEXT NOT NULL,
+		local TEXT NOT NULL,
+		lang TEXT NOT NULL DEFAULT '',
+		value BLOB NOT NULL,
+		PRIMARY KEY (path, space, local)
+	)`,
+}
+
+// sqlitePropertyStore keeps the properties in a SQLite database.
+type sqlitePropertyStore struct {
+	db *sql.DB
+}
+
+// openPropertyStore opens the database of the properties and creates its table if necessary.
+func openPropertyStore(cfg *Properties) (*sqlitePropertyStore, error) {
+	db, err := sql.Open("sqlite", cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite doesn't allow concurrent writers, a single connection serializes them
+	db.SetMaxOpenConns(1)
+	for _, statement := range propertiesSchema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &sqlitePropertyStore{db: db}, nil
+}
+
+func (s *sqlitePropertyStore) props(ctx context.Context, name string) (map[xml.Name]webdav.Property, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT space, local, lang, value FROM david_properties WHERE path = ?`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	props := map[xml.Name]webdav.Property{}
+	for rows.Next() {
+		var p webdav.Property
+		if err := rows.Scan(&p.XMLName.Space, &p.XMLName.Local, &p.Lang, &p.InnerXML); err != nil {
+			return nil, err
+		}
+		props[p.XMLName] = p
+	}
+	return props, rows.Err()
+}
+
+func (s *sqlitePropertyStore) patch(ctx context.Context, name string, patches []webdav.Proppatch) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			if patch.Remove {
+				_, err = tx.Exec(`DELETE FROM david_properties WHERE path = ? AND space = ? AND local = ?`, name, p.XMLName.Space, p.XMLName.Local)
+			} else {
+				_, err = tx.Exec(`INSERT INTO david_properties (path, space, local, lang, value) VALUES (?, ?, ?, ?, ?)
+					ON CONFLICT (path, space, local) DO UPDATE SET lang = excluded.lang, value = excluded.value`,
+					name, p.XMLName.Space, p.XMLName.Local, p.Lang, p.InnerXML)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// below returns the prefix of the paths below name. The paths below it are matched by range, from the prefix
+// up to the prefix followed by the byte 0xff, which no UTF-8 text contains: substr and length count characters,
+// not bytes.
+func below(name string) string {
+	return strings.TrimSuffix(name, string(filepath.Separator)) + string(filepath.Separator)
+}
+
+func (s *sqlitePropertyStore) remove(ctx context.Context, name string) error {
+	prefix := below(name)
+	_, err := s.db.ExecContext(ctx, `DELETE FROM david_properties WHERE path = ? OR path >= ? AND path < ? || x'ff'`, name, prefix, prefix)
+	return err
+}
+
+func (s *sqlitePropertyStore) move(ctx context.Context, oldName, newName string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Properties of a replaced destination are dropped
+	if _, err := tx.Exec(`DELETE FROM david_properties WHERE path = ? OR path >= ? AND path < ? || x'ff'`, newName, below(newName), below(newName)); err != nil {
+		return err
+	}
+	prefix := below(oldName)
+	if _, err := tx.Exec(`UPDATE david_properties SET path = ? || substr(path, length(?) + 1) WHERE path = ? OR path >= ? AND path < ? || x'ff'`,
+		newName, oldName, oldName, prefix, prefix); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultProxyAuthHeader is the header of the username if the proxy authentication doesn't set one.
+const defaultProxyAuthHeader = "X-Remote-User"
+
+// ProxyAuth accepts the username a trusted proxy like Authelia or oauth2-proxy authenticated in Header. The
+// permissions and subdir of the user apply as configured.
+type ProxyAuth struct {
+	Header string
+}
+
+// fromTrustedProxy reports whether the request was sent directly by one of the trusted proxies.
+func (cfg *Config) fromTrustedProxy(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	proxies, _ := parsePrefixes(cfg.TrustedProxies)
+	return containsAddr(proxies, addr)
+}
+
+// authenticateProxyHeader authenticates the user named in the header of the proxy authentication. It returns
+// nil if the request doesn't have the header, so other methods of authentication apply, and an unauthenticated
+// AuthInfo if anyone but a trusted proxy sent it or the user is unknown.
+func authenticateProxyHeader(cfg *Config, req *http.Request) *AuthInfo {
+	if cfg.ProxyAuth == nil {
+		return nil
+	}
+	header := cfg.ProxyAuth.Header
+	if header == "" {
+		header = defaultProxyAuthHeader
+	}
+	username := strings.TrimSpace(req.Header.Get(header))
+	if username == "" {
+		return nil
+	}
+	denied := &AuthInfo{Authenticated: false, CrudType: &testCrudType}
+	if !cfg.fromTrustedProxy(req) {
+		log.WithFields(log.Fields{"user": username, "address": req.RemoteAddr}).Warn("Refused proxy authentication header of untrusted address")
+		return denied
+	}
+	user := cfg.user(username)
+	if user == nil {
+		log.WithField("user", username).Warn("Proxy authenticated unknown user")
+		return denied
+	}
+	log.WithFields(log.Fields{"user": username, "crud": user.Crud}).Debug("User was authenticated by proxy header")
+	return &AuthInfo{Username: username, Authenticated: true, CrudType: user.Crud}
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestProxyAuth(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "alice"), 0o755)
+	subdir := "alice"
+	cfg := &Config{
+		Dir:            dir,
+		TrustedProxies: []string{"10.0.0.1"},
+		ProxyAuth:      &ProxyAuth{Header: "Remote-User"},
+		Log:            Logging{Create: true},
+		Users: map[string]*UserInfo{
+			"alice": {Password: GenHash([]byte("password")), Subdir: &subdir, Crud: newCrudType("r")},
+		},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	tests := []struct {
+		name   string
+		method string
+		remote string
+		user   string
+		want   int
+	}{
+		{"trusted proxy", "PROPFIND", "10.0.0.1:1234", "alice", http.StatusMultiStatus},
+		{"permissions apply", http.MethodPut, "10.0.0.1:1234", "alice", http.StatusForbidden},
+		{"untrusted address", "PROPFIND", "192.0.2.1:1234", "alice", http.StatusUnauthorized},
+		{"unknown user", "PROPFIND", "10.0.0.1:1234", "mallory", http.StatusUnauthorized},
+		{"without header", "PROPFIND", "10.0.0.1:1234", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/file.txt", nil)
+		if tt.method == "PROPFIND" {
+			r = httptest.NewRequest(tt.method, "/", nil)
+			r.Header.Set("Depth", "0")
+		}
+		r.RemoteAddr = tt.remote
+		if tt.user != "" {
+			r.Header.Set("Remote-User", tt.user)
+		}
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "file.txt")); err == nil {
+		t.Errorf("read-only user wrote outside its subdir")
+	}
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/webdav"
+)
+
+// byteRange is a satisfiable range of a file, end is exclusive.
+type byteRange struct {
+	start, end int64
+}
+
+// parseRanges resolves the ranges of a Range header against a file of size bytes.
+// Unsatisfiable ranges are dropped, ok is false if the header can't be parsed.
+func parseRanges(header string, size int64) (ranges []byteRange, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found {
+		return nil, false
+	}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		first, last, found := strings.Cut(part, "-")
+		if !found {
+			return nil, false
+		}
+		var r byteRange
+		if first == "" {
+			// A suffix range covers the last bytes of the file
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, false
+			}
+			r = byteRange{start: max(size-n, 0), end: size}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, false
+			}
+			r = byteRange{start: start, end: size}
+			if last != "" {
+				end, err := strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, false
+				}
+				r.end = min(end+1, size)
+			}
+		}
+		if r.start < r.end {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges, true
+}
+
+// coalesceRanges merges the overlapping and adjacent ranges of a Range header (RFC 7233, section 4.1).
+// Overlapping ranges would otherwise make http.ServeContent answer with the full content instead of
+// multipart/byteranges. Headers which can't be parsed or satisfied are returned unchanged.
+func coalesceRanges(header string, size int64) string {
+	ranges, ok := parseRanges(header, size)
+	if !ok || len(ranges) == 0 {
+		return header
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		if last := &merged[len(merged)-1]; r.start <= last.end {
+			last.end = max(last.end, r.end)
+		} else {
+			merged = append(merged, r)
+		}
+	}
+	parts := make([]string, len(merged))
+	for i, r := range merged {
+		parts[i] = strconv.FormatInt(r.start, 10) + "-" + strconv.FormatInt(r.end-1, 10)
+	}
+	return "bytes=" + strings.Join(parts, ",")
+}
+
+// coalesceRequestRanges rewrites the Range header of a multi-range GET of name to non overlapping ranges.
+func coalesceRequestRanges(ctx context.Context, fs webdav.FileSystem, req *http.Request, name string) {
+	header := req.Header.Get("Range")
+	if req.Method != http.MethodGet || !strings.Contains(header, ",") {
+		return
+	}
+	info, err := fs.Stat(ctx, name)
+	if err != nil || info == nil || info.IsDir() {
+		return
+	}
+	req.Header.Set("Range", coalesceRanges(header, info.Size()))
+}
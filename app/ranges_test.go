@@ -0,0 +1,74 @@
+package app
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestCoalesceRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"disjoint", "bytes=0-1,4-5", "bytes=0-1,4-5"},
+		{"overlapping", "bytes=0-5,3-8", "bytes=0-8"},
+		{"adjacent", "bytes=0-1,2-3", "bytes=0-3"},
+		{"unsorted", "bytes=6-7, 0-1", "bytes=0-1,6-7"},
+		{"suffix and open", "bytes=-2,5-", "bytes=5-9"},
+		{"unsatisfiable dropped", "bytes=0-1,20-30", "bytes=0-1"},
+		{"unsatisfiable", "bytes=20-30", "bytes=20-30"},
+		{"malformed", "bytes=a-b,1-2", "bytes=a-b,1-2"},
+		{"other unit", "items=0-1,2-3", "items=0-1,2-3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coalesceRanges(tt.header, 10); got != tt.want {
+				t.Errorf("coalesceRanges(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeWebdavMultiRange(t *testing.T) {
+	cfg := &Config{
+		Dir: t.TempDir(),
+		Users: map[string]*UserInfo{
+			"alice": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")},
+		},
+	}
+	handler := NewBasicAuthWebdavHandler(&App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}})
+	os.WriteFile(filepath.Join(cfg.Dir, "a.txt"), []byte("0123456789"), 0600)
+
+	r := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+	r.SetBasicAuth("alice", "password")
+	r.Header.Set("Range", "bytes=0-1,1-2,6-7")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	mediaType, params, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if w.Code != http.StatusPartialContent || mediaType != "multipart/byteranges" {
+		t.Fatalf("GET = %d %s, want %d multipart/byteranges", w.Code, mediaType, http.StatusPartialContent)
+	}
+	var parts []string
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		b, _ := io.ReadAll(part)
+		parts = append(parts, part.Header.Get("Content-Range")+" "+string(b))
+	}
+	if got := strings.Join(parts, ", "); got != "bytes 0-2/10 012, bytes 6-7/10 67" {
+		t.Errorf("parts = %s, want the overlapping ranges merged", got)
+	}
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// requestIDHeader carries the ID of a request, which is taken from a proxy if it sets one.
+const requestIDHeader = "X-Request-Id"
+
+// requestID returns the ID of the request given by a proxy, or a random one.
+func requestID(req *http.Request) string {
+	if id := req.Header.Get(requestIDHeader); id != "" {
+		return id
+	}
+	random := make([]byte, 8)
+	rand.Read(random)
+	return hex.EncodeToString(random)
+}
+
+// NewRecoveryHandler returns a handler which recovers from the panics of the handler. They're logged with their
+// stack trace and counted, and answered with 500 Internal Server Error and the ID of the request, so a client
+// can report it and the log entry be found.
+func NewRecoveryHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// The server aborts the response on its own
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			id := requestID(r)
+			metrics.Add("david_panics_total", "Panics recovered while handling requests.", 1)
+			log.WithFields(log.Fields{
+				"requestId": id,
+				"method":    r.Method,
+				"path":      r.URL.Path,
+				"address":   clientAddress(r),
+				"panic":     fmt.Sprint(err),
+				"stack":     string(debug.Stack()),
+			}).Error("Panic handling request")
+			// A response already started can't be replaced, it's cut short by the server
+			if sw.status != 0 {
+				return
+			}
+			w.Header().Set(requestIDHeader, id)
+			http.Error(w, "internal server error, request "+id, http.StatusInternalServerError)
+		}()
+		handler.ServeHTTP(sw, r)
+	})
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		id      string
+		want    int
+		body    string
+	}{
+		{"no panic", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }, "", http.StatusOK, "ok"},
+		{"panic", func(w http.ResponseWriter, r *http.Request) { panic("boom") }, "", http.StatusInternalServerError, "internal server error, request "},
+		{"panic with request id of proxy", func(w http.ResponseWriter, r *http.Request) { panic(http.ErrBodyNotAllowed) }, "abc123", http.StatusInternalServerError, "internal server error, request abc123"},
+		{"panic after response started", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			panic("boom")
+		}, "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.id != "" {
+				r.Header.Set(requestIDHeader, tt.id)
+			}
+			w := httptest.NewRecorder()
+			NewRecoveryHandler(tt.handler).ServeHTTP(w, r)
+			if w.Code != tt.want || !strings.HasPrefix(w.Body.String(), tt.body) {
+				t.Errorf("response = %d %q, want %d %q", w.Code, w.Body.String(), tt.want, tt.body)
+			}
+			if id := w.Header().Get(requestIDHeader); tt.want == http.StatusInternalServerError && (id == "" || !strings.Contains(w.Body.String(), id)) {
+				t.Errorf("%s = %q, want the ID of the body", requestIDHeader, id)
+			}
+		})
+	}
+	var buf bytes.Buffer
+	metrics.write(&buf)
+	if !strings.Contains(buf.String(), "david_panics_total") {
+		t.Error("panics aren't counted")
+	}
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Modes of the redaction of personal data in the log.
+const (
+	redactHash     = "hash"
+	redactTruncate = "truncate"
+)
+
+// Fields of log entries holding personal data, by the kind of data.
+var (
+	redactedUserFields    = []string{"user", "username", "identity", "cn"}
+	redactedAddressFields = []string{"address"}
+	redactedPathFields    = []string{"path", "oldPath", "newPath", "destination", "name"}
+)
+
+// redactHook redacts the personal data of the entries of the general log according to the configured mode.
+// The audit log and the security log are written separately and keep them.
+type redactHook struct {
+	cfg *Config
+	key []byte
+}
+
+// redaction is the hook installed on the general log, it's installed once and follows the live config.
+var redaction struct {
+	once sync.Once
+	hook *redactHook
+}
+
+// installRedaction installs the redaction of the general log for the configuration. The key of the hashes is
+// random unless configured, so hashes only correlate entries within a run.
+func installRedaction(cfg *Config) {
+	redaction.once.Do(func() {
+		redaction.hook = &redactHook{cfg: cfg}
+		log.AddHook(redaction.hook)
+	})
+	key := []byte(cfg.Log.RedactKey)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	redaction.hook.cfg, redaction.hook.key = cfg, key
+}
+
+// Levels applies the hook to all levels.
+func (h *redactHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire redacts the fields of the entry holding personal data.
+func (h *redactHook) Fire(entry *log.Entry) error {
+	mode := h.cfg.Log.Redact
+	if mode == "" {
+		return nil
+	}
+	redact := func(fields []string, truncate func(string) string) {
+		for _, field := range fields {
+			value, ok := entry.Data[field]
+			if !ok {
+				continue
+			}
+			s := fmt.Sprint(value)
+			if s == "" {
+				continue
+			}
+			if mode == redactTruncate {
+				entry.Data[field] = truncate(s)
+			} else {
+				entry.Data[field] = h.hash(s)
+			}
+		}
+	}
+	redact(redactedUserFields, truncateUser)
+	redact(redactedAddressFields, truncateAddress)
+	redact(redactedPathFields, truncatePath)
+	return nil
+}
+
+// hash returns a short keyed hash of the value, equal values get equal hashes.
+func (h *redactHook) hash(value string) string {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// truncateUser keeps the first character of a username.
+func truncateUser(username string) string {
+	for _, r := range username {
+		return string(r) + "…"
+	}
+	return ""
+}
+
+// truncateAddress keeps the network of an IP address, /24 of IPv4 and /48 of IPv6 addresses.
+func truncateAddress(address string) string {
+	host := address
+	if h, _, err := net.SplitHostPort(address); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(strings.TrimSpace(host))
+	switch {
+	case ip == nil:
+		return "…"
+	case ip.To4() != nil:
+		return ip.Mask(net.CIDRMask(24, 32)).String()
+	default:
+		return ip.Mask(net.CIDRMask(48, 128)).String()
+	}
+}
+
+// truncatePath keeps the first element of a path.
+func truncatePath(name string) string {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	first, rest, _ := strings.Cut(strings.TrimPrefix(slashed, "/"), "/")
+	if rest == "" {
+		return path.Clean("/" + first)
+	}
+	if strings.HasPrefix(slashed, "/") {
+		return "/" + first + "/…"
+	}
+	return first + "/…"
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestRedactHook(t *testing.T) {
+	fields := log.Fields{"user": "alice", "address": "192.168.1.23:51234", "path": "/srv/webdav/alice/taxes/2024.pdf", "method": "PUT"}
+	tests := []struct {
+		mode string
+		want []string
+		gone []string
+	}{
+		{"", []string{"user=alice", "address=\"192.168.1.23:51234\"", "path=/srv/webdav/alice/taxes/2024.pdf"}, nil},
+		{redactTruncate, []string{"user=\"a…\"", "address=192.168.1.0", "path=\"/srv/…\"", "method=PUT"}, []string{"alice", "taxes", ".23"}},
+		{redactHash, []string{"method=PUT"}, []string{"alice", "taxes", "192.168"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := log.New()
+			logger.Out = &buf
+			logger.Formatter = &log.TextFormatter{DisableTimestamp: true}
+			logger.AddHook(&redactHook{cfg: &Config{Log: Logging{Redact: tt.mode}}, key: []byte("key")})
+			logger.WithFields(fields).Info("Created file")
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("log = %q, want %s", buf.String(), want)
+				}
+			}
+			for _, gone := range tt.gone {
+				if strings.Contains(buf.String(), gone) {
+					t.Errorf("log = %q, contains %s", buf.String(), gone)
+				}
+			}
+		})
+	}
+}
+
+func TestTruncateAddress(t *testing.T) {
+	tests := map[string]string{
+		"10.1.2.3":                   "10.1.2.0",
+		"[2001:db8:1:2::1]:443":      "2001:db8:1::",
+		"2001:db8:1:2:3:4:5:6":       "2001:db8:1::",
+		"not an address":             "…",
+		"203.0.113.9, 198.51.100.17": "…",
+	}
+	for address, want := range tests {
+		if got := truncateAddress(address); got != want {
+			t.Errorf("truncateAddress(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
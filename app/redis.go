@@ -0,0 +1,260 @@
+package app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultRedisPrefix is used when no prefix of the keys is configured.
+const defaultRedisPrefix = "david:"
+
+// Redis configures the server holding the state shared by several instances of david: the failed logins,
+// the verified credentials (for CredentialTTL, if set along with a pepper) and the SAML sessions.
+type Redis struct {
+	Address       string
+	Password      string
+	DB            int
+	Prefix        string
+	CredentialTTL time.Duration
+}
+
+// redisState is the state shared through Redis.
+type redisState struct {
+	client        *redis.Client
+	prefix        string
+	credentialTTL time.Duration
+}
+
+// openRedis connects to the configured server.
+func openRedis(cfg *Redis) (*redisState, error) {
+	client := redis.NewClient(&redis.Options{Addr: cfg.Address, Password: cfg.Password, DB: cfg.DB})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+	return &redisState{client: client, prefix: prefix, credentialTTL: cfg.CredentialTTL}, nil
+}
+
+// authFailureCounter counts the consecutive failed logins, in memory or shared by several instances.
+type authFailureCounter interface {
+	fail(key string, now time.Time, window time.Duration) int
+	count(key string, now time.Time, window time.Duration) (int, time.Duration)
+	reset(key string)
+}
+
+// authFailureCounter returns the counter shared through Redis, or else the one of this instance.
+func (cfg *Config) authFailureCounter() authFailureCounter {
+	if cfg.redis != nil {
+		return cfg.redis
+	}
+	return authFailures
+}
+
+// fail records a failed login, which expires after the window like the ones before.
+// If Redis isn't available the failures are counted by this instance.
+func (s *redisState) fail(key string, now time.Time, window time.Duration) int {
+	ctx := context.Background()
+	pipe := s.client.TxPipeline()
+	count := pipe.Incr(ctx, s.prefix+"authfail:"+key)
+	pipe.PExpire(ctx, s.prefix+"authfail:"+key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.WithError(err).Error("Error counting failed login in redis")
+		return authFailures.fail(key, now, window)
+	}
+	return int(count.Val())
+}
+
+// count returns the number of consecutive failures and the time until they expire.
+// If Redis isn't available the failures counted by this instance are returned.
+func (s *redisState) count(key string, now time.Time, window time.Duration) (int, time.Duration) {
+	ctx := context.Background()
+	pipe := s.client.Pipeline()
+	count := pipe.Get(ctx, s.prefix+"authfail:"+key)
+	ttl := pipe.PTTL(ctx, s.prefix+"authfail:"+key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, 0
+		}
+		log.WithError(err).Error("Error reading failed logins from redis")
+		return authFailures.count(key, now, window)
+	}
+	n, _ := count.Int()
+	return n, ttl.Val()
+}
+
+// reset forgets the failures after a successful login.
+func (s *redisState) reset(key string) {
+	if err := s.client.Del(context.Background(), s.prefix+"authfail:"+key).Err(); err != nil {
+		log.WithError(err).Error("Error resetting failed logins in redis")
+	}
+	authFailures.reset(key)
+}
+
+// credentialKey identifies a successful verification of a password. The password hash is part of it,
+// so changing the password invalidates the entry. It's an HMAC keyed with the pepper, a plain hash would
+// let anyone reading Redis guess the password without the cost of the password hash.
+func (s *redisState) credentialKey(pepper, username, hash, password string) string {
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(username + "\x00" + hash + "\x00" + password))
+	return s.prefix + "cred:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verified returns whether the credentials were verified recently by any instance, false if they weren't or
+// caching them isn't enabled, which requires a pepper.
+func (s *redisState) verified(pepper, username, hash, password string) bool {
+	if s == nil || s.credentialTTL <= 0 || pepper == "" {
+		return false
+	}
+	n, err := s.client.Exists(context.Background(), s.credentialKey(pepper, username, hash, password)).Result()
+	if err != nil {
+		log.WithError(err).Error("Error looking up credentials in redis")
+	}
+	cacheLookup("credentials", n == 1)
+	return n == 1
+}
+
+// remember caches the successful verification of the credentials.
+func (s *redisState) remember(pepper, username, hash, password string) {
+	if s == nil || s.credentialTTL <= 0 || pepper == "" {
+		return
+	}
+	if err := s.client.Set(context.Background(), s.credentialKey(pepper, username, hash, password), "1", s.credentialTTL).Err(); err != nil {
+		log.WithError(err).Error("Error caching credentials in redis")
+	}
+}
+
+// externalGrant is what a user of an external source, PAM, the forward-auth endpoint or a plugin, was granted
+// at login.
+type externalGrant struct {
+	Permissions string  `json:"permissions"`
+	Subdir      *string `json:"subdir,omitempty"`
+}
+
+// externalCredentialKey identifies a successful login of a user of an external source. There's no hash to
+// bind it to, so it's an HMAC keyed with the pepper, and Redis alone doesn't allow guessing the password.
+func (s *redisState) externalCredentialKey(pepper, username, password string) string {
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(username + "\x00" + password))
+	return s.prefix + "extcred:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifiedExternal returns the authentication of a user of an external source whose credentials were verified
+// recently by any instance, nil if they weren't or caching them isn't enabled, which requires a pepper.
+func (cfg *Config) verifiedExternal(username, password string) *AuthInfo {
+	if cfg.redis == nil || cfg.redis.credentialTTL <= 0 || cfg.pepper == "" {
+		return nil
+	}
+	value, err := cfg.redis.client.Get(context.Background(), cfg.redis.externalCredentialKey(cfg.pepper, username, password)).Bytes()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		log.WithError(err).Error("Error looking up credentials in redis")
+	}
+	cacheLookup("credentials", err == nil)
+	var grant externalGrant
+	if err != nil || json.Unmarshal(value, &grant) != nil {
+		return nil
+	}
+	user := &UserInfo{Permissions: grant.Permissions, Crud: &CrudType{Crud: grant.Permissions}, Subdir: grant.Subdir}
+	cfg.externalUsers.Store(username, user)
+	if err := FormatCrud(context.Background(), username, cfg); err != nil {
+		return nil
+	}
+	log.WithFields(log.Fields{"user": username, "crud": user.Crud}).Debug("User was authenticated by cached credentials")
+	return &AuthInfo{Username: username, Authenticated: true, CrudType: user.Crud}
+}
+
+// rememberExternal caches the successful login of a user of an external source with what it was granted.
+func (cfg *Config) rememberExternal(username, password string) {
+	if cfg.redis == nil || cfg.redis.credentialTTL <= 0 || cfg.pepper == "" {
+		return
+	}
+	user := cfg.user(username)
+	if user == nil {
+		return
+	}
+	value, _ := json.Marshal(externalGrant{Permissions: user.Permissions, Subdir: user.Subdir})
+	if err := cfg.redis.client.Set(context.Background(), cfg.redis.externalCredentialKey(cfg.pepper, username, password), value, cfg.redis.credentialTTL).Err(); err != nil {
+		log.WithError(err).Error("Error caching credentials in redis")
+	}
+}
+
+// redisSessionProvider keeps the SAML sessions in Redis, the cookie only holds a random ID.
+// A logout is effective on all instances and sessions can't outlive their entry.
+type redisSessionProvider struct {
+	samlsp.CookieSessionProvider
+	state *redisState
+}
+
+// CreateSession stores the session of the assertion and sets the cookie with its ID.
+func (p redisSessionProvider) CreateSession(w http.ResponseWriter, r *http.Request, assertion *saml.Assertion) error {
+	session, err := p.Codec.New(assertion)
+	if err != nil {
+		return err
+	}
+	value, err := p.Codec.Encode(session)
+	if err != nil {
+		return err
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	id := hex.EncodeToString(random)
+	if err := p.state.client.Set(r.Context(), p.state.prefix+"session:"+id, value, p.MaxAge).Err(); err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     p.Name,
+		Value:    id,
+		MaxAge:   int(p.MaxAge.Seconds()),
+		HttpOnly: p.HTTPOnly,
+		Secure:   p.Secure || r.URL.Scheme == "https",
+		SameSite: p.SameSite,
+		Path:     "/",
+	})
+	return nil
+}
+
+// DeleteSession removes the session and its cookie.
+func (p redisSessionProvider) DeleteSession(w http.ResponseWriter, r *http.Request) error {
+	if cookie, err := r.Cookie(p.Name); err == nil {
+		if err := p.state.client.Del(r.Context(), p.state.prefix+"session:"+cookie.Value).Err(); err != nil {
+			return err
+		}
+	}
+	return p.CookieSessionProvider.DeleteSession(w, r)
+}
+
+// GetSession returns the session the cookie refers to.
+func (p redisSessionProvider) GetSession(r *http.Request) (samlsp.Session, error) {
+	cookie, err := r.Cookie(p.Name)
+	if err != nil {
+		return nil, samlsp.ErrNoSession
+	}
+	value, err := p.state.client.Get(r.Context(), p.state.prefix+"session:"+cookie.Value).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, samlsp.ErrNoSession
+	} else if err != nil {
+		return nil, err
+	}
+	session, err := p.Codec.Decode(value)
+	if err != nil {
+		return nil, samlsp.ErrNoSession
+	}
+	return session, nil
+}
@@ -0,0 +1,176 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/crewjam/saml"
+	"golang.org/x/net/webdav"
+)
+
+// openTestRedis returns two instances sharing an in-memory redis server.
+func openTestRedis(t *testing.T) (*miniredis.Miniredis, *redisState, *redisState) {
+	server := miniredis.RunT(t)
+	cfg := &Redis{Address: server.Addr(), CredentialTTL: time.Minute}
+	first, err := openRedis(cfg)
+	if err != nil {
+		t.Fatalf("openRedis() error = %v", err)
+	}
+	second, err := openRedis(cfg)
+	if err != nil {
+		t.Fatalf("openRedis() error = %v", err)
+	}
+	return server, first, second
+}
+
+func TestRedisAuthFailures(t *testing.T) {
+	server, first, second := openTestRedis(t)
+	key := authFailureKey("198.51.100.7", "redis")
+	now := time.Now()
+
+	// Failures are counted across instances and forgotten after the window
+	for i, state := range []*redisState{first, second, first} {
+		if got := state.fail(key, now, time.Minute); got != i+1 {
+			t.Errorf("fail() = %d, want %d", got, i+1)
+		}
+	}
+	server.FastForward(2 * time.Minute)
+	if got := second.fail(key, now, time.Minute); got != 1 {
+		t.Errorf("fail() after window = %d, want 1", got)
+	}
+	first.reset(key)
+	if got := second.fail(key, now, time.Minute); got != 1 {
+		t.Errorf("fail() after reset = %d, want 1", got)
+	}
+	if count, remaining := first.count(key, now, time.Minute); count != 1 || remaining <= 0 || remaining > time.Minute {
+		t.Errorf("count() = %d, %v, want 1 within the window", count, remaining)
+	}
+	if count, _ := first.count(authFailureKey("198.51.100.7", "other"), now, time.Minute); count != 0 {
+		t.Errorf("count() of another user = %d, want 0", count)
+	}
+}
+
+func TestRedisCredentials(t *testing.T) {
+	_, first, second := openTestRedis(t)
+	hash := GenHash([]byte("password"))
+	cfg := &Config{Users: map[string]*UserInfo{"alice": {Password: hash, Crud: newCrudType("r")}}, redis: first}
+
+	// Without a pepper the credentials aren't cached at all
+	if info, err := authenticate(cfg, "alice", "password"); err != nil || !info.Authenticated {
+		t.Fatalf("authenticate() = %v %v, want authenticated", info, err)
+	}
+	if second.verified("", "alice", hash, "password") {
+		t.Errorf("verified() without pepper = true, want false")
+	}
+
+	hash = GenHash([]byte(PepperPassword("password", "pepper")))
+	cfg.Users["alice"].Password = hash
+	cfg.pepper = "pepper"
+	if _, err := authenticate(cfg, "alice", "wrong"); err == nil {
+		t.Errorf("authenticate() with wrong password error = nil")
+	}
+	if second.verified("pepper", "alice", hash, "wrong") {
+		t.Errorf("verified() of failed login = true, want false")
+	}
+	if info, err := authenticate(cfg, "alice", "password"); err != nil || !info.Authenticated {
+		t.Fatalf("authenticate() = %v %v, want authenticated", info, err)
+	}
+	if !second.verified("pepper", "alice", hash, "password") {
+		t.Errorf("verified() on other instance = false, want true")
+	}
+	if second.verified("pepper", "alice", GenHash([]byte(PepperPassword("password", "pepper"))), "password") {
+		t.Errorf("verified() after password change = true, want false")
+	}
+	if second.verified("other", "alice", hash, "password") {
+		t.Errorf("verified() with another pepper = true, want false")
+	}
+}
+
+func TestRedisExternalCredentials(t *testing.T) {
+	_, first, second := openTestRedis(t)
+	calls := 0
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var credentials forwardAuthRequest
+		json.NewDecoder(r.Body).Decode(&credentials)
+		if credentials.Password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(forwardAuthResponse{Crud: "cr"})
+	}))
+	defer endpoint.Close()
+
+	login := func(state *redisState, pepper, password string) int {
+		cfg := &Config{Dir: t.TempDir(), ForwardAuth: &ForwardAuth{URL: endpoint.URL}, redis: state, pepper: pepper}
+		a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+		r := httptest.NewRequest("PROPFIND", "/", nil)
+		r.Header.Set("Depth", "0")
+		r.SetBasicAuth("alice", password)
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		return w.Code
+	}
+
+	// Without a pepper the credentials of external users aren't cached
+	login(first, "", "secret")
+	login(second, "", "secret")
+	if calls != 2 {
+		t.Errorf("endpoint called %d times without pepper, want 2", calls)
+	}
+
+	calls = 0
+	if code := login(first, "pepper", "secret"); code != http.StatusMultiStatus {
+		t.Fatalf("login = %d, want %d", code, http.StatusMultiStatus)
+	}
+	if code := login(second, "pepper", "secret"); code != http.StatusMultiStatus || calls != 1 {
+		t.Errorf("login on other instance = %d with %d calls, want %d with 1 call", code, calls, http.StatusMultiStatus)
+	}
+	if code := login(second, "pepper", "wrong"); code != http.StatusUnauthorized || calls != 2 {
+		t.Errorf("login with wrong password = %d with %d calls, want %d with 2 calls", code, calls, http.StatusUnauthorized)
+	}
+}
+
+func TestRedisSessions(t *testing.T) {
+	_, first, second := openTestRedis(t)
+	cfg := &Config{Prefix: "/dav", SAML: writeSAMLFiles(t, t.TempDir()), redis: first}
+	sp, err := loadSAML(cfg)
+	if err != nil {
+		t.Fatalf("loadSAML() error = %v", err)
+	}
+	provider, ok := sp.Session.(redisSessionProvider)
+	if !ok {
+		t.Fatalf("session provider = %T, want redisSessionProvider", sp.Session)
+	}
+
+	w := httptest.NewRecorder()
+	assertion := &saml.Assertion{Subject: &saml.Subject{NameID: &saml.NameID{Value: "alice"}}}
+	if err := provider.CreateSession(w, httptest.NewRequest("GET", "/dav/", nil), assertion); err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	cookie := w.Result().Cookies()[0]
+	req := httptest.NewRequest("GET", "/dav/", nil)
+	req.AddCookie(cookie)
+
+	// Another instance finds the session, until it's deleted
+	other := redisSessionProvider{CookieSessionProvider: provider.CookieSessionProvider, state: second}
+	if _, err := other.GetSession(req); err != nil {
+		t.Errorf("GetSession() on other instance error = %v", err)
+	}
+	if err := provider.DeleteSession(httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("DeleteSession() error = %v", err)
+	}
+	if _, err := other.GetSession(req); err == nil {
+		t.Errorf("GetSession() after logout error = nil")
+	}
+	forged := httptest.NewRequest("GET", "/dav/", nil)
+	forged.AddCookie(&http.Cookie{Name: samlCookieName, Value: "unknown"})
+	if _, err := other.GetSession(forged); err == nil {
+		t.Errorf("GetSession() with unknown ID error = nil")
+	}
+}
@@ -0,0 +1,213 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/net/webdav"
+)
+
+// lockHoldTimeout bounds how long a lock stays held by a request, so the locks held by a crashed instance
+// become usable again.
+const lockHoldTimeout = time.Hour
+
+// lockUpdateRetries is how often an update of the locks is retried after a concurrent change.
+const lockUpdateRetries = 100
+
+// redisLock is a lock as stored in redis. A zero expiry means the lock is infinite.
+type redisLock struct {
+	Root      string        `json:"root"`
+	Duration  time.Duration `json:"duration"`
+	OwnerXML  string        `json:"owner"`
+	ZeroDepth bool          `json:"zeroDepth"`
+	Expiry    time.Time     `json:"expiry"`
+	HeldUntil time.Time     `json:"heldUntil"`
+}
+
+// held returns whether the lock is held by a request.
+func (l *redisLock) held(now time.Time) bool {
+	return now.Before(l.HeldUntil)
+}
+
+// expired returns whether the lock timed out, held locks don't expire.
+func (l *redisLock) expired(now time.Time) bool {
+	return !l.held(now) && !l.Expiry.IsZero() && !now.Before(l.Expiry)
+}
+
+// covers returns whether the lock applies to the named resource.
+func (l *redisLock) covers(name string) bool {
+	if name == l.Root {
+		return true
+	}
+	return !l.ZeroDepth && (l.Root == "/" || strings.HasPrefix(name, l.Root+"/"))
+}
+
+// redisLockSystem is a webdav.LockSystem shared by all instances through redis, with the same semantics as
+// the in-memory one of x/net/webdav. The locks of a directory tree are kept in a single hash, which is
+// updated in optimistic transactions.
+type redisLockSystem struct {
+	state *redisState
+	key   string
+}
+
+// newRedisLockSystem returns the lock system of the tree in the given directory.
+func newRedisLockSystem(state *redisState, dir string) *redisLockSystem {
+	return &redisLockSystem{state: state, key: state.prefix + "locks:" + dir}
+}
+
+// update applies fn to the current locks without the expired ones and writes the changes back atomically.
+func (ls *redisLockSystem) update(now time.Time, fn func(locks map[string]*redisLock) error) error {
+	ctx := context.Background()
+	for i := 0; i < lockUpdateRetries; i++ {
+		err := ls.state.client.Watch(ctx, func(tx *redis.Tx) error {
+			stored, err := tx.HGetAll(ctx, ls.key).Result()
+			if err != nil {
+				return err
+			}
+			locks := map[string]*redisLock{}
+			for token, value := range stored {
+				var lock redisLock
+				if err := json.Unmarshal([]byte(value), &lock); err == nil && !lock.expired(now) {
+					locks[token] = &lock
+				}
+			}
+			if err := fn(locks); err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				for token, value := range stored {
+					if locks[token] == nil {
+						pipe.HDel(ctx, ls.key, token)
+					} else if updated, _ := json.Marshal(locks[token]); string(updated) != value {
+						pipe.HSet(ctx, ls.key, token, updated)
+					}
+				}
+				for token, lock := range locks {
+					if _, ok := stored[token]; !ok {
+						value, _ := json.Marshal(lock)
+						pipe.HSet(ctx, ls.key, token, value)
+					}
+				}
+				return nil
+			})
+			return err
+		}, ls.key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return errors.New("webdav: too many concurrent lock updates")
+}
+
+// lookupLock returns the token of a lock matching the conditions which covers the named resource and isn't held.
+func lookupLock(locks map[string]*redisLock, now time.Time, name string, conditions ...webdav.Condition) string {
+	for _, c := range conditions {
+		if lock := locks[c.Token]; lock != nil && !lock.held(now) && lock.covers(name) {
+			return c.Token
+		}
+	}
+	return ""
+}
+
+// Confirm holds the locks of the conditions covering the named resources.
+func (ls *redisLockSystem) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (func(), error) {
+	var tokens []string
+	err := ls.update(now, func(locks map[string]*redisLock) error {
+		tokens = nil
+		for _, name := range []string{name0, name1} {
+			if name == "" {
+				continue
+			}
+			token := lookupLock(locks, now, path.Clean("/"+name), conditions...)
+			if token == "" {
+				return webdav.ErrConfirmationFailed
+			}
+			// Don't hold the same lock twice
+			if len(tokens) == 0 || tokens[0] != token {
+				tokens = append(tokens, token)
+			}
+		}
+		for _, token := range tokens {
+			locks[token].HeldUntil = now.Add(lockHoldTimeout)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		ls.update(time.Now(), func(locks map[string]*redisLock) error {
+			for _, token := range tokens {
+				if lock := locks[token]; lock != nil {
+					lock.HeldUntil = time.Time{}
+				}
+			}
+			return nil
+		})
+	}, nil
+}
+
+// Create creates a lock unless the resource, one of its descendants (for infinite locks) or one of its
+// ancestors (with an infinite lock) is locked already.
+func (ls *redisLockSystem) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	root := path.Clean("/" + details.Root)
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := "opaquelocktoken:" + hex.EncodeToString(random)
+	err := ls.update(now, func(locks map[string]*redisLock) error {
+		for _, lock := range locks {
+			if lock.covers(root) || !details.ZeroDepth && (root == "/" || strings.HasPrefix(lock.Root, root+"/")) {
+				return webdav.ErrLocked
+			}
+		}
+		locks[token] = &redisLock{Root: root, Duration: details.Duration, OwnerXML: details.OwnerXML, ZeroDepth: details.ZeroDepth,
+			Expiry: lockExpiry(now, details.Duration)}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Refresh extends the lock by the duration.
+func (ls *redisLockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	var details webdav.LockDetails
+	err := ls.update(now, func(locks map[string]*redisLock) error {
+		lock := locks[token]
+		if lock == nil {
+			return webdav.ErrNoSuchLock
+		}
+		if lock.held(now) {
+			return webdav.ErrLocked
+		}
+		lock.Duration, lock.Expiry = duration, lockExpiry(now, duration)
+		details = webdav.LockDetails{Root: lock.Root, Duration: lock.Duration, OwnerXML: lock.OwnerXML, ZeroDepth: lock.ZeroDepth}
+		return nil
+	})
+	return details, err
+}
+
+// Unlock removes the lock unless it's held.
+func (ls *redisLockSystem) Unlock(now time.Time, token string) error {
+	return ls.update(now, func(locks map[string]*redisLock) error {
+		lock := locks[token]
+		if lock == nil {
+			return webdav.ErrNoSuchLock
+		}
+		if lock.held(now) {
+			return webdav.ErrLocked
+		}
+		delete(locks, token)
+		return nil
+	})
+}
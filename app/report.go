@@ -0,0 +1,111 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ReportRow holds the storage and transfer usage of a user within the period of a report.
+type ReportRow struct {
+	User            string `json:"user"`
+	StorageBytes    int64  `json:"storageBytes"`
+	BytesUploaded   int64  `json:"bytesUploaded"`
+	BytesDownloaded int64  `json:"bytesDownloaded"`
+	Operations      int64  `json:"operations"`
+}
+
+// directorySize sums up the size of all files below root.
+func directorySize(root string) int64 {
+	var size int64
+	filepath.WalkDir(root, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable parts of the tree are skipped
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// userRoot returns the directory a user is jailed in, which is the base directory for users without subdir.
+func userRoot(cfg *Config, username string) string {
+	if user := cfg.user(username); user != nil {
+		if subdir, _ := cfg.subdirOf(username, user); subdir != "" {
+			return filepath.Join(cfg.Dir, subdir)
+		}
+	}
+	return cfg.Dir
+}
+
+// GenerateReport builds the usage report of all users between from and to (inclusive) from the accounting file.
+// The storage is the current size of each user's directory.
+func GenerateReport(cfg *Config, from, to time.Time) ([]ReportRow, error) {
+	if cfg.Accounting == nil {
+		return nil, errors.New("accounting is not configured")
+	}
+	records, err := ReadAccounting(cfg.Accounting.File, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sum up the transfer of each user, including users no longer in the config file
+	rows := map[string]*ReportRow{}
+	for username := range cfg.Users {
+		rows[username] = &ReportRow{User: username}
+	}
+	for _, record := range records {
+		row, ok := rows[record.User]
+		if !ok {
+			row = &ReportRow{User: record.User}
+			rows[record.User] = row
+		}
+		row.BytesUploaded += record.BytesUploaded
+		row.BytesDownloaded += record.BytesDownloaded
+		for _, count := range record.Operations {
+			row.Operations += count
+		}
+	}
+
+	result := make([]ReportRow, 0, len(rows))
+	for username, row := range rows {
+		row.StorageBytes = directorySize(userRoot(cfg, username))
+		result = append(result, *row)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].User < result[j].User })
+	return result, nil
+}
+
+// WriteReport writes the report rows in the given format, which is either "csv" or "json".
+func WriteReport(w io.Writer, rows []ReportRow, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"user", "storage_bytes", "bytes_uploaded", "bytes_downloaded", "operations"})
+		for _, row := range rows {
+			writer.Write([]string{
+				row.User,
+				strconv.FormatInt(row.StorageBytes, 10),
+				strconv.FormatInt(row.BytesUploaded, 10),
+				strconv.FormatInt(row.BytesDownloaded, 10),
+				strconv.FormatInt(row.Operations, 10),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return errors.New("unknown report format: " + format)
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFlushAccounting(t *testing.T) {
+	cfg := &Config{Accounting: &Accounting{File: filepath.Join(t.TempDir(), "usage.ndjson"), Interval: time.Hour}}
+	usage.takePending()
+	usage.record("user1", "PUT", 100, 0)
+
+	// The pending usage is written without waiting for the interval
+	cfg.FlushAccounting()
+	records, err := ReadAccounting(cfg.Accounting.File, time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 1))
+	if err != nil || len(records) != 1 || records[0].User != "user1" || records[0].BytesUploaded != 100 {
+		t.Errorf("ReadAccounting() = %+v, %v, want the pending usage of user1", records, err)
+	}
+	// Without accounting nothing is written
+	(&Config{}).FlushAccounting()
+}
+
+func TestGenerateReport(t *testing.T) {
+	// Create a base dir with a file of ten bytes in the jail of user1
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "subdir1"), 0700)
+	os.WriteFile(filepath.Join(tmpDir, "subdir1", "a"), []byte("0123456789"), 0600)
+
+	configTmp := createTestConfig(tmpDir)
+	configTmp.Accounting = &Accounting{File: filepath.Join(tmpDir, "usage.ndjson")}
+
+	// Record usage on two days, the second one outside of the reported period.
+	// Usage recorded by other tests is discarded first.
+	usage.takePending()
+	usage.record("user1", "PUT", 100, 0)
+	usage.record("user1", "GET", 0, 50)
+	if err := flushAccounting(configTmp.Accounting.File, time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("flushAccounting() error = %v", err)
+	}
+	usage.record("user1", "PUT", 1000, 0)
+	if err := flushAccounting(configTmp.Accounting.File, time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("flushAccounting() error = %v", err)
+	}
+
+	rows, err := GenerateReport(configTmp, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("GenerateReport() error = %v", err)
+	}
+	var got *ReportRow
+	for i := range rows {
+		if rows[i].User == "user1" {
+			got = &rows[i]
+		}
+	}
+	want := ReportRow{User: "user1", StorageBytes: 10, BytesUploaded: 100, BytesDownloaded: 50, Operations: 2}
+	if got == nil || *got != want {
+		t.Errorf("GenerateReport() user1 = %+v, want %+v", got, want)
+	}
+
+	// Both formats must be writable, unknown formats are rejected
+	for _, format := range []string{"csv", "json"} {
+		if err := WriteReport(&bytes.Buffer{}, rows, format); err != nil {
+			t.Errorf("WriteReport() format = %v, error = %v", format, err)
+		}
+	}
+	if err := WriteReport(&bytes.Buffer{}, rows, "xml"); err == nil {
+		t.Errorf("WriteReport() format = xml, want error")
+	}
+}
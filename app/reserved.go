@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// windowsDeviceNames are the names Windows reserves for devices, with any extension. Files named like them
+// can't be opened or deleted by clients on Windows.
+var windowsDeviceNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// reservedName reports why the base name of the physical path is reserved, empty if it isn't. Windows reserves
+// the names of devices and drops trailing dots and spaces, the temp files of staged uploads are removed by david.
+func (cfg *Config) reservedName(name string) string {
+	base := filepath.Base(name)
+	device, _, _ := strings.Cut(base, ".")
+	if windowsDeviceNames[strings.ToUpper(strings.TrimRight(device, " "))] {
+		return "device name"
+	}
+	if strings.HasSuffix(base, ".") || strings.HasSuffix(base, " ") {
+		return "trailing dot or space"
+	}
+	if cfg.Staging != nil && strings.HasSuffix(base, cfg.Staging.suffix()) {
+		return "staged upload"
+	}
+	return ""
+}
+
+// internalDir returns the directory of david the physical path lies in, empty if none. The directories of the
+// trash, the versions and the like are kept outside of the served tree, but nothing enforces it.
+func (cfg *Config) internalDir(name string) string {
+	var dirs []string
+	if cfg.Trash != nil {
+		dirs = append(dirs, cfg.Trash.Dir)
+	}
+	if cfg.Versions != nil {
+		dirs = append(dirs, cfg.Versions.Dir)
+	}
+	if cfg.Staging != nil {
+		dirs = append(dirs, cfg.Staging.Dir)
+	}
+	if cfg.Tiering != nil {
+		dirs = append(dirs, cfg.Tiering.Dir)
+	}
+	if cfg.Thumbnails != nil {
+		dirs = append(dirs, cfg.Thumbnails.Dir)
+	}
+	for _, dir := range dirs {
+		if dir != "" && withinDir(filepath.Clean(dir), name) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// denyReservedName refuses creating the physical path if its name is reserved or it lies in a directory of
+// david. The refusal is answered with 403 Forbidden.
+func (d Dir) denyReservedName(ctx context.Context, name string) error {
+	reason := d.Config.reservedName(name)
+	if reason == "" && d.Config.internalDir(name) != "" {
+		reason = "internal directory"
+	}
+	if reason == "" {
+		return nil
+	}
+	log.WithFields(log.Fields{"user": d.resolveUser(ctx), "path": name, "reason": reason}).Warn("Denied creation of reserved name")
+	recordFailure(ctx, http.StatusForbidden, conditionReservedName, "reserved-name")
+	return os.ErrPermission
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReservedName(t *testing.T) {
+	cfg := &Config{Staging: &Staging{}}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"report.txt", false},
+		{"console.txt", false},
+		{"CON", true},
+		{"nul.txt", true},
+		{"Com1.tar.gz", true},
+		{"LPT9 .log", true},
+		{"COM10", false},
+		{"name.", true},
+		{"name ", true},
+		{".report.txt.0123456789abcdef.david-upload", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.reservedName(filepath.Join("data", tt.name)); (got != "") != tt.want {
+				t.Errorf("reservedName() = %q, want reserved %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenyReservedName(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{Dir: dir, Log: Logging{Create: true}, Trash: &Trash{Dir: filepath.Join(dir, ".trash")}, Users: map[string]*UserInfo{"alice": {Crud: newCrudType("crud")}}}
+	os.Mkdir(cfg.Trash.Dir, 0700)
+	ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "alice", Authenticated: true, CrudType: newCrudType("crud")})
+	d := Dir{Config: cfg}
+
+	if _, err := d.OpenFile(ctx, "/nul.txt", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600); err == nil {
+		t.Error("OpenFile() of a device name succeeded")
+	}
+	if _, err := d.OpenFile(ctx, "/.trash/file.txt", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600); err == nil {
+		t.Error("OpenFile() in the trash succeeded")
+	}
+	if err := d.Mkdir(ctx, "/aux", 0700); err == nil {
+		t.Error("Mkdir() of a device name succeeded")
+	}
+	f, err := d.OpenFile(ctx, "/file.txt", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	f.Close()
+	if err := d.Rename(ctx, "/file.txt", "/CON"); err == nil {
+		t.Error("Rename() to a device name succeeded")
+	}
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// retentionOverrideHeader carries the reason of an admin overriding a retention period.
+const retentionOverrideHeader = "X-Retention-Override"
+
+// retentionOverrideKey holds the override reason of a request in its context.
+var retentionOverrideKey contextKey = 4
+
+// RetentionRule keeps the files below Path from being deleted, renamed or overwritten until they are MinAge old.
+type RetentionRule struct {
+	Path   string
+	MinAge time.Duration
+}
+
+// relPath returns the physical path relative to the base directory as a slash separated path,
+// ok is false for paths outside of it.
+func (cfg *Config) relPath(name string) (string, bool) {
+	rel, err := filepath.Rel(filepath.Clean(cfg.Dir), name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return path.Clean("/" + filepath.ToSlash(rel)), true
+}
+
+// retentionOf returns the longest retention period of the rules covering rel.
+func (cfg *Config) retentionOf(rel string) time.Duration {
+	var retention time.Duration
+	for _, rule := range cfg.Retention {
+		if hasFilePathPrefix(rel, path.Clean("/"+rule.Path)) && rule.MinAge > retention {
+			retention = rule.MinAge
+		}
+	}
+	return retention
+}
+
+// retentionAffects reports whether a rule covers rel or a path below it.
+func (cfg *Config) retentionAffects(rel string) bool {
+	for _, rule := range cfg.Retention {
+		if dir := path.Clean("/" + rule.Path); hasFilePathPrefix(rel, dir) || hasFilePathPrefix(dir, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// retained returns the first file at or below the physical path which is younger than its retention period.
+func (d Dir) retained(name string, now time.Time) (string, bool) {
+	rel, ok := d.Config.relPath(name)
+	if !ok || !d.Config.retentionAffects(rel) {
+		return "", false
+	}
+	info, err := d.storage().Stat(name)
+	if err != nil {
+		return "", false
+	}
+	if !info.IsDir() {
+		return rel, now.Sub(info.ModTime()) < d.Config.retentionOf(rel)
+	}
+	f, err := d.storage().OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return "", false
+	}
+	children, err := f.Readdir(0)
+	f.Close()
+	if err != nil {
+		// A directory which can't be listed is kept, it may contain retained files
+		return rel, true
+	}
+	for _, child := range children {
+		if file, ok := d.retained(filepath.Join(name, child.Name()), now); ok {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+// denyRetained refuses the modification of the physical path while it contains files younger than their
+// retention period, regardless of the permissions of the user. Admins can override it with a reason in the
+// X-Retention-Override header, which is recorded in the audit log. The refusal is answered with 403 Forbidden.
+func (d Dir) denyRetained(ctx context.Context, name string) error {
+	if len(d.Config.Retention) == 0 {
+		return nil
+	}
+	file, ok := d.retained(name, time.Now())
+	if !ok {
+		return nil
+	}
+	username := d.resolveUser(ctx)
+	if reason, _ := ctx.Value(retentionOverrideKey).(string); reason != "" {
+		if user := d.Config.user(username); user != nil && user.Admin {
+			writeAudit(d.Config, AuditEntry{User: username, Action: "retention-override", Path: file, Detail: reason})
+			return nil
+		}
+	}
+	log.WithFields(log.Fields{"user": username, "path": file}).Warn("Denied modification of retained file")
+	recordFailure(ctx, http.StatusForbidden, conditionRetention, "retention")
+	return os.ErrPermission
+}
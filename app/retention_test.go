@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestRetention(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		method   string
+		path     string
+		override string
+		want     int
+	}{
+		{"delete expired", "foo", http.MethodDelete, "/archive/old.txt", "", http.StatusNoContent},
+		{"delete retained", "foo", http.MethodDelete, "/archive/new.txt", "", http.StatusForbidden},
+		{"delete directory with retained file", "foo", http.MethodDelete, "/archive", "", http.StatusForbidden},
+		{"overwrite retained", "foo", http.MethodPut, "/archive/new.txt", "", http.StatusForbidden},
+		{"rename retained", "foo", Move, "/archive/new.txt", "", http.StatusForbidden},
+		{"delete unprotected", "foo", http.MethodDelete, "/new.txt", "", http.StatusNoContent},
+		{"override by user", "foo", http.MethodDelete, "/archive/new.txt", "legal hold lifted", http.StatusForbidden},
+		{"admin without override", "admin", http.MethodDelete, "/archive/new.txt", "", http.StatusForbidden},
+		{"admin override", "admin", http.MethodDelete, "/archive/new.txt", "legal hold lifted", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			auditFile := filepath.Join(t.TempDir(), "audit.log")
+			os.MkdirAll(filepath.Join(dir, "archive"), 0700)
+			for _, name := range []string{"archive/old.txt", "archive/new.txt", "new.txt"} {
+				os.WriteFile(filepath.Join(dir, name), []byte("content"), 0600)
+			}
+			old := time.Now().Add(-48 * time.Hour)
+			os.Chtimes(filepath.Join(dir, "archive", "old.txt"), old, old)
+			cfg := &Config{
+				Dir:       dir,
+				Log:       Logging{Create: true},
+				Retention: []*RetentionRule{{Path: "/archive", MinAge: 24 * time.Hour}},
+				Audit:     &Audit{File: auditFile},
+				Users: map[string]*UserInfo{
+					"foo":   {Crud: newCrudType("crud")},
+					"admin": {Crud: newCrudType("crud"), Admin: true},
+				},
+			}
+			a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+			ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: tt.user, Authenticated: true})
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader("new"))
+			r.Header.Set("Destination", "http://example.com/renamed.txt")
+			if tt.override != "" {
+				r.Header.Set(retentionOverrideHeader, tt.override)
+			}
+			w := httptest.NewRecorder()
+			serveWebdav(a, ctx, w, r, tt.user)
+
+			if w.Code != tt.want {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body.String(), tt.want)
+			}
+			if tt.want == http.StatusForbidden && !strings.Contains(w.Body.String(), "retention-period") {
+				t.Errorf("%s %s without retention-period condition: %s", tt.method, tt.path, w.Body.String())
+			}
+
+			// Only overrides are audited
+			var entry AuditEntry
+			content, _ := os.ReadFile(auditFile)
+			if tt.name == "admin override" {
+				if err := json.Unmarshal(content, &entry); err != nil || entry.User != "admin" || entry.Action != "retention-override" ||
+					entry.Path != "/archive/new.txt" || entry.Detail != tt.override {
+					t.Errorf("audit entry = %s, want override of admin", content)
+				}
+			} else if len(content) != 0 {
+				t.Errorf("unexpected audit entry %s", content)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/crewjam/saml/samlsp"
+	log "github.com/sirupsen/logrus"
+)
+
+// samlEndpoint is the path (relative to the configured prefix) of the SAML service provider endpoints.
+const samlEndpoint = "/_saml"
+
+// samlCookieName is the name of the cookie holding the session of a SAML login.
+const samlCookieName = "david_session"
+
+// loadSAML creates the SAML service provider from the configured key pair and IdP metadata.
+func loadSAML(cfg *Config) (*samlsp.Middleware, error) {
+	root, err := url.Parse(cfg.SAML.URL)
+	if err != nil {
+		return nil, err
+	}
+	keyPair, err := tls.LoadX509KeyPair(cfg.SAML.CertFile, cfg.SAML.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("SAML key has to be an RSA key")
+	}
+	certificate, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(cfg.SAML.IDPMetadataFile)
+	if err != nil {
+		return nil, err
+	}
+	idpMetadata, err := samlsp.ParseMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sp, err := samlsp.New(samlsp.Options{
+		URL:                *root,
+		Key:                key,
+		Certificate:        certificate,
+		IDPMetadata:        idpMetadata,
+		CookieName:         samlCookieName,
+		DefaultRedirectURI: cfg.Prefix + "/",
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Move the endpoints below the prefix, next to the other internal endpoints of david
+	base := strings.TrimSuffix(root.Path, "/") + cfg.Prefix + samlEndpoint
+	sp.ServiceProvider.MetadataURL.Path = base + "/metadata"
+	sp.ServiceProvider.AcsURL.Path = base + "/acs"
+	sp.ServiceProvider.SloURL.Path = base + "/slo"
+	// Sessions shared by several instances are kept in redis
+	if cfg.redis != nil {
+		sp.Session = redisSessionProvider{CookieSessionProvider: sp.Session.(samlsp.CookieSessionProvider), state: cfg.redis}
+	}
+	return sp, nil
+}
+
+// isSAMLRequest returns whether the request targets an endpoint of the SAML service provider.
+func isSAMLRequest(cfg *Config, req *http.Request) bool {
+	return cfg.saml != nil && strings.HasPrefix(req.URL.Path, path.Dir(cfg.saml.ServiceProvider.MetadataURL.Path)+"/")
+}
+
+// isBrowserRequest returns whether the request was made by a browser which can follow the SAML login flow.
+func isBrowserRequest(req *http.Request) bool {
+	return req.Method == http.MethodGet && req.Header.Get("Authorization") == "" && acceptsHTML(req)
+}
+
+// authenticateSAMLSession maps the session cookie of a SAML login to a configured user.
+// It returns nil if there's no valid session, so other methods of authentication apply.
+func authenticateSAMLSession(cfg *Config, req *http.Request) *AuthInfo {
+	if cfg.saml == nil {
+		return nil
+	}
+	session, err := cfg.saml.Session.GetSession(req)
+	if err != nil {
+		return nil
+	}
+	claims, ok := session.(samlsp.JWTSessionClaims)
+	if !ok {
+		return nil
+	}
+
+	// Use the configured attribute or else the NameID, optionally translated by the users mapping
+	identity := claims.Subject
+	if cfg.SAML.Attribute != "" {
+		identity = claims.Attributes.Get(cfg.SAML.Attribute)
+	}
+	username := identity
+	for _, mapping := range cfg.SAML.Users {
+		if strings.EqualFold(mapping.Identity, identity) {
+			username = mapping.User
+			break
+		}
+	}
+	user := cfg.user(username)
+	if identity == "" || user == nil {
+		log.WithFields(log.Fields{"identity": identity, "user": username}).Warn("SAML login maps to unknown user")
+		return nil
+	}
+	log.WithFields(log.Fields{"user": username, "identity": identity}).Debug("User was authenticated by SAML session")
+	return &AuthInfo{Username: username, Authenticated: true, CrudType: user.Crud}
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+)
+
+const testIDPMetadata = `<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://idp.example.com/">
+  <IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso"/>
+  </IDPSSODescriptor>
+</EntityDescriptor>`
+
+// writeSAMLFiles writes a self signed key pair and the IdP metadata to dir.
+func writeSAMLFiles(t *testing.T, dir string) *SAML {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "david"}, NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &SAML{
+		URL:             "https://dav.example.com",
+		IDPMetadataFile: filepath.Join(dir, "idp.xml"),
+		CertFile:        filepath.Join(dir, "sp.crt"),
+		KeyFile:         filepath.Join(dir, "sp.key"),
+		Users:           []SAMLUser{{Identity: "alice@example.com", User: "alice"}},
+	}
+	os.WriteFile(cfg.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(cfg.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+	os.WriteFile(cfg.IDPMetadataFile, []byte(testIDPMetadata), 0600)
+	return cfg
+}
+
+func TestSAML(t *testing.T) {
+	cfg := &Config{
+		Prefix: "/dav",
+		Dir:    t.TempDir(),
+		Users:  map[string]*UserInfo{"alice": {Crud: newCrudType("crud")}},
+		SAML:   writeSAMLFiles(t, t.TempDir()),
+	}
+	sp, err := loadSAML(cfg)
+	if err != nil {
+		t.Fatalf("loadSAML() error = %v", err)
+	}
+	cfg.saml = sp
+	a := &App{Config: cfg}
+
+	// The metadata is served below the prefix
+	w := httptest.NewRecorder()
+	handle(context.Background(), w, httptest.NewRequest("GET", "/dav/_saml/metadata", nil), a)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "https://dav.example.com/dav/_saml/acs") {
+		t.Errorf("metadata = %d %s, want the ACS url", w.Code, w.Body.String())
+	}
+
+	// Browsers without a session are sent to the identity provider, other clients get a Basic auth challenge
+	browser := httptest.NewRequest("GET", "/dav/", nil)
+	browser.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	handle(context.Background(), w, browser, a)
+	if w.Code != http.StatusFound || !strings.HasPrefix(w.Header().Get("Location"), "https://idp.example.com/sso") {
+		t.Errorf("browser request = %d %s, want redirect to the IdP", w.Code, w.Header().Get("Location"))
+	}
+	w = httptest.NewRecorder()
+	handle(context.Background(), w, httptest.NewRequest("PROPFIND", "/dav/", nil), a)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("client request = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	tests := []struct {
+		name   string
+		nameID string
+		want   string
+	}{
+		{"mapped identity", "Alice@example.com", "alice"},
+		{"username as identity", "alice", "alice"},
+		{"unknown user", "mallory", ""},
+	}
+	codec := sp.Session.(samlsp.CookieSessionProvider).Codec
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, err := codec.New(&saml.Assertion{Subject: &saml.Subject{NameID: &saml.NameID{Value: tt.nameID}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := codec.Encode(session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("PROPFIND", "/dav/", nil)
+			req.AddCookie(&http.Cookie{Name: samlCookieName, Value: token})
+			got := authenticateSAMLSession(cfg, req)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("authenticateSAMLSession() = %v, want nil", got)
+				}
+			} else if got == nil || got.Username != tt.want {
+				t.Errorf("authenticateSAMLSession() = %v, want user %s", got, tt.want)
+			}
+		})
+	}
+}
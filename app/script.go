@@ -0,0 +1,127 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.starlark.net/starlark"
+)
+
+// scriptTimeout bounds the runtime of a single policy function call.
+const scriptTimeout = time.Second
+
+// Names of the functions a policy script may define.
+const (
+	scriptAuthFunction      = "auth"
+	scriptOperationFunction = "operation"
+)
+
+// policyScript holds the globals of an executed starlark policy script.
+type policyScript struct {
+	file    string
+	globals starlark.StringDict
+}
+
+// scriptDecision is the result of a policy function call.
+type scriptDecision struct {
+	Allow bool
+	Path  string // non empty if the path was rewritten
+}
+
+// loadScript reads and executes the starlark policy script at file.
+func loadScript(file string) (*policyScript, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	thread := &starlark.Thread{Name: "load", Print: scriptPrint}
+	globals, err := starlark.ExecFile(thread, file, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Freezing makes the globals safe for concurrent calls
+	globals.Freeze()
+	return &policyScript{file: file, globals: globals}, nil
+}
+
+// scriptPrint forwards print() calls of a policy script to the log.
+func scriptPrint(thread *starlark.Thread, msg string) {
+	log.WithField("thread", thread.Name).Debug(msg)
+}
+
+// call invokes the policy function name with the request information.
+// A missing function, None or True allow the request, False denies it and a string rewrites the path.
+func (s *policyScript) call(name, username string, req *http.Request, prefix string) (scriptDecision, error) {
+	fn, ok := s.globals[name]
+	if !ok {
+		return scriptDecision{Allow: true}, nil
+	}
+
+	// Build the request dictionary passed to the policy function
+	request := starlark.NewDict(5)
+	request.SetKey(starlark.String("user"), starlark.String(username))
+	request.SetKey(starlark.String("method"), starlark.String(req.Method))
+	request.SetKey(starlark.String("path"), starlark.String(path.Clean("/"+strings.TrimPrefix(req.URL.Path, prefix))))
+	request.SetKey(starlark.String("size"), starlark.MakeInt64(req.ContentLength))
+	request.SetKey(starlark.String("address"), starlark.String(clientAddress(req)))
+
+	// Cancel scripts which don't finish in time
+	thread := &starlark.Thread{Name: name, Print: scriptPrint}
+	timer := time.AfterFunc(scriptTimeout, func() { thread.Cancel("timeout") })
+	defer timer.Stop()
+
+	result, err := starlark.Call(thread, fn, starlark.Tuple{request}, nil)
+	if err != nil {
+		return scriptDecision{}, err
+	}
+	switch v := result.(type) {
+	case starlark.NoneType:
+		return scriptDecision{Allow: true}, nil
+	case starlark.Bool:
+		return scriptDecision{Allow: bool(v)}, nil
+	case starlark.String:
+		return scriptDecision{Allow: true, Path: path.Clean("/" + string(v))}, nil
+	}
+	return scriptDecision{}, fmt.Errorf("unexpected return type %s of %s()", result.Type(), name)
+}
+
+// scriptAllowsAuth evaluates the auth function of the configured policy script.
+func scriptAllowsAuth(a *App, username string, req *http.Request) bool {
+	if a.Config.script == nil {
+		return true
+	}
+	decision, err := a.Config.script.call(scriptAuthFunction, username, req, a.Config.prefixOf(username))
+	if err != nil {
+		log.WithFields(log.Fields{"user": username, "file": a.Config.script.file}).WithError(err).Error("Error evaluating policy script")
+		return false
+	}
+	return decision.Allow
+}
+
+// applyScriptToOperation evaluates the operation function of the configured policy script.
+// A rewritten path replaces the path of the request, a denied operation returns an error.
+func applyScriptToOperation(a *App, username string, req *http.Request) error {
+	if a.Config.script == nil {
+		return nil
+	}
+	decision, err := a.Config.script.call(scriptOperationFunction, username, req, a.Config.prefixOf(username))
+	if err != nil {
+		log.WithFields(log.Fields{"user": username, "file": a.Config.script.file}).WithError(err).Error("Error evaluating policy script")
+		return err
+	}
+	if !decision.Allow {
+		return errors.New("operation denied by policy script")
+	}
+	if decision.Path != "" {
+		log.WithFields(log.Fields{"user": username, "path": req.URL.Path, "rewrite": decision.Path}).Debug("Policy script rewrote path")
+		req.URL.Path = a.Config.prefixOf(username) + decision.Path
+		req.URL.RawPath = ""
+	}
+	return nil
+}
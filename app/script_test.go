@@ -0,0 +1,61 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyScriptToOperation(t *testing.T) {
+	// Write a policy script denying deletes, rewriting /inbox and keeping everything else
+	file := filepath.Join(t.TempDir(), "policy.star")
+	os.WriteFile(file, []byte(`
+def auth(request):
+    return request["user"] != "blocked"
+
+def operation(request):
+    if request["method"] == "DELETE":
+        return False
+    if request["path"] == "/inbox":
+        return "/users/" + request["user"] + "/inbox"
+    return None
+`), 0600)
+	script, err := loadScript(file)
+	if err != nil {
+		t.Fatalf("loadScript() error = %v", err)
+	}
+	a := &App{Config: &Config{Prefix: "/dav", script: script}}
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		wantErr  bool
+		wantPath string
+	}{
+		{"allowed", "PROPFIND", "/dav/a", false, "/dav/a"},
+		{"denied", http.MethodDelete, "/dav/a", true, "/dav/a"},
+		{"rewritten", http.MethodPut, "/dav/inbox", false, "/dav/users/foo/inbox"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.url, nil)
+			if err := applyScriptToOperation(a, "foo", r); (err != nil) != tt.wantErr {
+				t.Errorf("applyScriptToOperation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if r.URL.Path != tt.wantPath {
+				t.Errorf("applyScriptToOperation() path = %v, want %v", r.URL.Path, tt.wantPath)
+			}
+		})
+	}
+
+	// The auth function decides on the user only
+	if !scriptAllowsAuth(a, "foo", httptest.NewRequest("PROPFIND", "/dav", nil)) {
+		t.Errorf("scriptAllowsAuth() = false, want true")
+	}
+	if scriptAllowsAuth(a, "blocked", httptest.NewRequest("PROPFIND", "/dav", nil)) {
+		t.Errorf("scriptAllowsAuth() = true, want false")
+	}
+}
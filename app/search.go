@@ -0,0 +1,344 @@
+package app
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// searchEndpoint is the path (relative to the configured prefix) searching the index below the tree of the user.
+const searchEndpoint = "/_search"
+
+// Limits of the number of search results.
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+)
+
+// Methods searching the index, SEARCH with a DAV:basicsearch (RFC 5323) and REPORT with a david:search body.
+const (
+	Search = "SEARCH"
+	Report = "REPORT"
+)
+
+// SearchResult is a file or directory matching a search, its path is relative to the tree of the user.
+type SearchResult struct {
+	Path     string    `json:"path"`
+	Href     string    `json:"href"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Dir      bool      `json:"dir"`
+	Snippet  string    `json:"snippet,omitempty"`
+}
+
+// matchQuery turns the words of a user query into an FTS5 query matching all of them, the last one as prefix.
+// Quoting keeps the query syntax of FTS5 out of reach of users.
+func matchQuery(query string) string {
+	words := strings.Fields(query)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	if len(words) == 0 {
+		return ""
+	}
+	words[len(words)-1] += "*"
+	return strings.Join(words, " ")
+}
+
+// searchQuery holds the conditions a search result has to match: the words of text in its name or content,
+// all tags, all metadata and the where condition of a basicsearch.
+type searchQuery struct {
+	text     string
+	tags     []string
+	metadata map[string]string
+	where    *searchCondition
+}
+
+// empty reports whether the query has no condition.
+func (q searchQuery) empty() bool {
+	return matchQuery(q.text) == "" && len(q.tags) == 0 && len(q.metadata) == 0 && q.where == nil
+}
+
+// search returns the files and directories below the physical path root matching the query, best matches first.
+// Without text the results are ordered by path.
+func (ix *indexer) search(root string, q searchQuery, limit int) ([]SearchResult, error) {
+	if q.empty() {
+		return nil, nil
+	}
+	prefix := below(root)
+	query := `SELECT f.path, f.size, f.modified, f.dir, '' FROM david_index_files f WHERE (f.path = ? OR f.path >= ? AND f.path < ? || x'ff')`
+	args := []interface{}{root, prefix, prefix}
+	order := ` ORDER BY f.path`
+	if match := matchQuery(q.text); match != "" {
+		query = `SELECT f.path, f.size, f.modified, f.dir, snippet(david_index_text, 1, '**', '**', '…', 12)
+			FROM david_index_text t JOIN david_index_files f ON f.id = t.rowid
+			WHERE david_index_text MATCH ? AND (f.path = ? OR f.path >= ? AND f.path < ? || x'ff')`
+		args = append([]interface{}{match}, args...)
+		order = ` ORDER BY rank`
+	}
+	for _, tag := range q.tags {
+		query += ` AND EXISTS (SELECT 1 FROM david_index_meta m WHERE m.file_id = f.id AND m.name = '' AND m.value = ?)`
+		args = append(args, strings.ToLower(tag))
+	}
+	for key, value := range q.metadata {
+		query += ` AND EXISTS (SELECT 1 FROM david_index_meta m WHERE m.file_id = f.id AND m.name = ? AND m.value = ?)`
+		args = append(args, propertyField(xml.Name{Space: metadataNamespace, Local: key}), value)
+	}
+	if q.where != nil {
+		query += ` AND ` + q.where.sql
+		args = append(args, q.where.args...)
+	}
+	rows, err := ix.db.Query(query+order+` LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		var modified int64
+		if err := rows.Scan(&r.Path, &r.Size, &modified, &r.Dir, &r.Snippet); err != nil {
+			return nil, err
+		}
+		r.Modified = time.Unix(0, modified).UTC()
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// userResults makes the physical paths of the results relative to the tree of the user and adds their hrefs.
+func userResults(results []SearchResult, root, prefix string) []SearchResult {
+	for i := range results {
+		rel, err := filepath.Rel(root, results[i].Path)
+		if err != nil {
+			rel = "."
+		}
+		results[i].Path = path.Clean("/" + filepath.ToSlash(rel))
+		href := path.Join(prefix, results[i].Path)
+		if results[i].Dir && href != "/" {
+			href += "/"
+		}
+		results[i].Href = (&url.URL{Path: href}).EscapedPath()
+	}
+	return results
+}
+
+// visibleResults drops the results of other users in owner-only directories and the ones the ACL of the user
+// denies.
+func visibleResults(ctx context.Context, d Dir, results []SearchResult) []SearchResult {
+	visible := results[:0]
+	for _, r := range results {
+		if !d.hiddenFromUser(ctx, r.Path) && d.crudAt(ctx, r.Path).Read {
+			visible = append(visible, r)
+		}
+	}
+	return visible
+}
+
+// searchScope returns the physical path of a path of the tree of the user.
+func searchScope(a *App, ctx context.Context, name string) string {
+	return Resolve(ctx, path.Clean("/"+name), Dir{Config: a.Config})
+}
+
+// searchQueryOf returns the query of the parameters of a search request: the text q, the tags of the tag
+// parameters and the metadata of the meta parameters given as key:value.
+func searchQueryOf(params url.Values) (searchQuery, bool) {
+	q := searchQuery{text: params.Get("q"), tags: params["tag"], metadata: map[string]string{}}
+	for _, meta := range params["meta"] {
+		key, value, ok := strings.Cut(meta, ":")
+		if !ok {
+			return q, false
+		}
+		q.metadata[key] = value
+	}
+	return q, true
+}
+
+// handleSearchRequest answers the query (optionally below path, at most limit results) with the matching
+// files of the tree of the user as JSON.
+func handleSearchRequest(a *App, ctx context.Context, w http.ResponseWriter, req *http.Request, authInfo *AuthInfo) {
+	// Searches list files, which requires the permission to do so
+	if !a.Config.mayList(authInfo.CrudType) {
+		writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges)
+		return
+	}
+	if req.Method != http.MethodGet {
+		handleMethodNotAllowed(ctx, w, req, http.MethodGet)
+		return
+	}
+	query := req.URL.Query()
+	q, ok := searchQueryOf(query)
+	if !ok {
+		http.Error(w, "invalid meta, expected key:value", http.StatusBadRequest)
+		return
+	}
+	if q.empty() {
+		http.Error(w, "missing query", http.StatusBadRequest)
+		return
+	}
+	limit := defaultSearchLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+	root := searchScope(a, ctx, "/")
+	scope := searchScope(a, ctx, query.Get("path"))
+	if root == "" || scope == "" {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	results, err := a.Config.indexer.search(scope, q, limit)
+	if err != nil {
+		log.WithError(err).WithField("user", authInfo.Username).Error("Error searching index")
+		http.Error(w, "search failed", http.StatusInternalServerError)
+		return
+	}
+	if results == nil {
+		results = []SearchResult{}
+	}
+	writeJSON(w, userResults(visibleResults(ctx, Dir{a.Config}, results), root, a.Config.prefixOf(authInfo.Username)))
+}
+
+// basicSearch is the subset of a DAV:searchrequest (RFC 5323) supported: a scope, a where clause and a limit.
+type basicSearch struct {
+	Scope []string `xml:"basicsearch>from>scope>href"`
+	Where xmlNode  `xml:"basicsearch>where"`
+	Limit int      `xml:"basicsearch>limit>nresults"`
+}
+
+// searchReport is the body of a REPORT searching the index below the request path.
+type searchReport struct {
+	XMLName xml.Name `xml:"https://github.com/audstanley/david search"`
+	Query   string   `xml:"query"`
+	Limit   int      `xml:"limit"`
+}
+
+// handleSearchMethod answers SEARCH and REPORT requests with a multistatus of the matching files.
+func handleSearchMethod(a *App, ctx context.Context, w http.ResponseWriter, req *http.Request, authInfo *AuthInfo) {
+	// Users may be limited to other methods
+	if user := a.Config.user(authInfo.Username); user != nil && !user.methodAllowed(req.Method) {
+		handleMethodNotAllowed(ctx, w, req, a.Config.methodsOf(user)...)
+		return
+	}
+	// Searches list files, which requires the permission to do so
+	if !a.Config.mayList(authInfo.CrudType) {
+		writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges)
+		return
+	}
+	prefix := a.Config.prefixOf(authInfo.Username)
+	var q searchQuery
+	var scope string
+	var limit int
+	switch req.Method {
+	case Search:
+		var body basicSearch
+		if err := xml.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid searchrequest", http.StatusBadRequest)
+			return
+		}
+		limit, scope = body.Limit, req.URL.Path
+		if len(body.Where.Nodes) != 1 {
+			http.Error(w, "where needs exactly one condition", http.StatusBadRequest)
+			return
+		}
+		// A plain contains is searched as text, so the results have snippets
+		if condition := body.Where.Nodes[0]; condition.XMLName.Local == "contains" {
+			q.text = condition.Content
+		} else {
+			where, err := compileWhere(condition)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			q.where = where
+		}
+		if len(body.Scope) > 0 {
+			u, err := url.Parse(body.Scope[0])
+			if err != nil {
+				http.Error(w, "invalid scope", http.StatusBadRequest)
+				return
+			}
+			scope = u.Path
+		}
+	case Report:
+		var body searchReport
+		if err := xml.NewDecoder(req.Body).Decode(&body); err != nil {
+			// Other reports aren't supported
+			writeDAVError(w, http.StatusForbidden, conditionSupportedReport)
+			return
+		}
+		q.text, limit, scope = body.Query, body.Limit, req.URL.Path
+	}
+	if !hasPathPrefix(scope, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	// The scope of the search can't leave the one of the token
+	if !a.Config.inScope(authInfo, scope) {
+		writeDAVError(w, http.StatusForbidden, conditionOutOfScope, scope)
+		return
+	}
+	if q.empty() {
+		http.Error(w, "missing query", http.StatusBadRequest)
+		return
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	root := searchScope(a, ctx, "/")
+	physical := searchScope(a, ctx, strings.TrimPrefix(scope, prefix))
+	results, err := a.Config.indexer.search(physical, q, min(limit, maxSearchLimit))
+	if err != nil {
+		log.WithError(err).WithField("user", authInfo.Username).Error("Error searching index")
+		http.Error(w, "search failed", http.StatusInternalServerError)
+		return
+	}
+	writeSearchMultistatus(w, userResults(visibleResults(ctx, Dir{a.Config}, results), root, prefix))
+}
+
+// writeSearchMultistatus renders the results as a DAV:multistatus with their basic properties and snippets.
+func writeSearchMultistatus(w http.ResponseWriter, results []SearchResult) {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<D:multistatus xmlns:D="DAV:" xmlns:david="` + davidNamespace + `">`)
+	for _, r := range results {
+		resourceType := ""
+		if r.Dir {
+			resourceType = "<D:collection/>"
+		}
+		fmt.Fprintf(&b, `<D:response><D:href>%s</D:href><D:propstat><D:prop>`, escapeXML(r.Href))
+		fmt.Fprintf(&b, `<D:displayname>%s</D:displayname><D:resourcetype>%s</D:resourcetype>`, escapeXML(path.Base(r.Path)), resourceType)
+		if !r.Dir {
+			fmt.Fprintf(&b, `<D:getcontentlength>%d</D:getcontentlength>`, r.Size)
+		}
+		fmt.Fprintf(&b, `<D:getlastmodified>%s</D:getlastmodified>`, r.Modified.Format(http.TimeFormat))
+		if r.Snippet != "" {
+			fmt.Fprintf(&b, `<david:snippet>%s</david:snippet>`, escapeXML(r.Snippet))
+		}
+		b.WriteString(`</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`)
+	}
+	b.WriteString(`</D:multistatus>`)
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write([]byte(b.String()))
+}
+
+// escapeXML escapes the text for an XML element.
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
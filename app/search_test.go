@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"alice/docs/fox.txt":    "the quick brown fox",
+		"alice/docs/dog.txt":    "the lazy dog",
+		"alice/other/fox 2.txt": "another fox",
+		"bob/fox.txt":           "bob's fox",
+		"alice/Übersicht/f.txt": "a fox in a directory with a multibyte name",
+		"jörg/fox.txt":          "jörg's fox",
+	} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0700)
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+	}
+	ix, err := openIndexer(&Index{File: filepath.Join(t.TempDir(), "index.db"), Content: true})
+	if err != nil {
+		t.Fatalf("openIndexer() error = %v", err)
+	}
+	alice, joerg := "/alice", "/jörg"
+	cfg := &Config{
+		Dir: dir,
+		Users: map[string]*UserInfo{
+			"alice": {Password: GenHash([]byte("password")), Subdir: &alice, Crud: newCrudType("r")},
+			"joerg": {Password: GenHash([]byte("password")), Subdir: &joerg, Crud: newCrudType("r")},
+		},
+		indexer: ix,
+	}
+	if err := ix.reconcile(cfg); err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+
+	const basicSearch = `<?xml version="1.0"?><D:searchrequest xmlns:D="DAV:"><D:basicsearch>
+		<D:from><D:scope><D:href>/docs</D:href><D:depth>infinity</D:depth></D:scope></D:from>
+		<D:where><D:contains>fox</D:contains></D:where></D:basicsearch></D:searchrequest>`
+	const report = `<?xml version="1.0"?><david:search xmlns:david="https://github.com/audstanley/david"><david:query>fox</david:query></david:search>`
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		want     int
+		contains []string
+		excludes []string
+	}{
+		{"visible subtree only", http.MethodGet, "/_search?q=fox", "", http.StatusOK, []string{`"path":"/docs/fox.txt"`, `"href":"/other/fox%202.txt"`, `"snippet":"the quick brown **fox**"`}, []string{"bob", "dog"}},
+		{"below path", http.MethodGet, "/_search?q=fox&path=/other", "", http.StatusOK, []string{"/other/fox 2.txt"}, []string{"/docs"}},
+		{"below multibyte path", http.MethodGet, "/_search?q=fox&path=/%C3%9Cbersicht", "", http.StatusOK, []string{"/Übersicht/f.txt"}, []string{"/docs"}},
+		{"prefix of last word", http.MethodGet, "/_search?q=la", "", http.StatusOK, []string{"/docs/dog.txt"}, nil},
+		{"query syntax is quoted", http.MethodGet, "/_search?q=fox+OR+NEAR(", "", http.StatusOK, nil, nil},
+		{"missing query", http.MethodGet, "/_search", "", http.StatusBadRequest, nil, nil},
+		{"SEARCH", Search, "/", basicSearch, http.StatusMultiStatus, []string{"<D:href>/docs/fox.txt</D:href>", "<D:getcontentlength>19</D:getcontentlength>"}, []string{"/other"}},
+		{"REPORT", Report, "/other", report, http.StatusMultiStatus, []string{"<D:href>/other/fox%202.txt</D:href>"}, []string{"/docs"}},
+		{"unsupported REPORT", Report, "/", `<D:version-tree xmlns:D="DAV:"/>`, http.StatusForbidden, []string{"supported-report"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.SetBasicAuth("alice", "password")
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, r, a)
+			if w.Code != tt.want {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body.String(), tt.want)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("body = %s, want %s", w.Body.String(), s)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(w.Body.String(), s) {
+					t.Errorf("body = %s, doesn't want %s", w.Body.String(), s)
+				}
+			}
+		})
+	}
+
+	// Users whose root has a multibyte name find their files as well
+	r := httptest.NewRequest(http.MethodGet, "/_search?q=fox", nil)
+	r.SetBasicAuth("joerg", "password")
+	w := httptest.NewRecorder()
+	handle(context.Background(), w, r, a)
+	if !strings.Contains(w.Body.String(), `"path":"/fox.txt"`) || strings.Contains(w.Body.String(), "bob") {
+		t.Errorf("search of joerg = %s, want only their fox.txt", w.Body.String())
+	}
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xmlNode is a generic XML element, used for the where clause of a basicsearch.
+type xmlNode struct {
+	XMLName xml.Name
+	Content string    `xml:",chardata"`
+	Nodes   []xmlNode `xml:",any"`
+}
+
+// searchCondition is a where clause compiled to an SQL condition on the index files f.
+type searchCondition struct {
+	sql  string
+	args []interface{}
+}
+
+// Live properties of the index which can be compared.
+var (
+	propLastModified  = xml.Name{Space: "DAV:", Local: "getlastmodified"}
+	propContentLength = xml.Name{Space: "DAV:", Local: "getcontentlength"}
+	propDisplayName   = xml.Name{Space: "DAV:", Local: "displayname"}
+)
+
+// comparisons maps the comparison operators of RFC 5323 to SQL.
+var comparisons = map[string]string{"eq": "=", "lt": "<", "lte": "<=", "gt": ">", "gte": ">="}
+
+// parseSearchTime parses a date literal, in the format of getlastmodified or as RFC 3339.
+func parseSearchTime(s string) (time.Time, error) {
+	if t, err := http.ParseTime(s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// operand returns the property and the literal of a comparison.
+func (n xmlNode) operand() (xml.Name, string, error) {
+	var prop xml.Name
+	var literal *string
+	for _, child := range n.Nodes {
+		switch child.XMLName.Local {
+		case "prop":
+			if len(child.Nodes) != 1 {
+				return prop, "", errors.New(n.XMLName.Local + " needs exactly one property")
+			}
+			prop = child.Nodes[0].XMLName
+		case "literal", "typed-literal":
+			text := strings.TrimSpace(child.Content)
+			literal = &text
+		}
+	}
+	if prop.Local == "" || literal == nil && n.XMLName.Local != "is-defined" {
+		return prop, "", errors.New(n.XMLName.Local + " needs a property and a literal")
+	}
+	if literal == nil {
+		return prop, "", nil
+	}
+	return prop, *literal, nil
+}
+
+// compileWhere compiles a where clause of a basicsearch (RFC 5323, section 5.5): and, or, not, the comparisons,
+// like, contains, is-collection and is-defined. The dates and sizes of files are compared as such, tags match if
+// the file has the tag, dead properties are compared by their text.
+func compileWhere(n xmlNode) (*searchCondition, error) {
+	switch op := n.XMLName.Local; op {
+	case "and", "or":
+		if len(n.Nodes) == 0 {
+			return nil, errors.New(op + " without operands")
+		}
+		var parts []string
+		var args []interface{}
+		for _, child := range n.Nodes {
+			c, err := compileWhere(child)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, c.sql)
+			args = append(args, c.args...)
+		}
+		return &searchCondition{"(" + strings.Join(parts, " "+strings.ToUpper(op)+" ") + ")", args}, nil
+	case "not":
+		if len(n.Nodes) != 1 {
+			return nil, errors.New("not needs exactly one operand")
+		}
+		c, err := compileWhere(n.Nodes[0])
+		if err != nil {
+			return nil, err
+		}
+		return &searchCondition{"NOT " + c.sql, c.args}, nil
+	case "contains":
+		match := matchQuery(n.Content)
+		if match == "" {
+			return nil, errors.New("empty contains")
+		}
+		return &searchCondition{"f.id IN (SELECT rowid FROM david_index_text WHERE david_index_text MATCH ?)", []interface{}{match}}, nil
+	case "is-collection":
+		return &searchCondition{"f.dir", nil}, nil
+	case "is-defined":
+		prop, _, err := n.operand()
+		if err != nil {
+			return nil, err
+		}
+		switch prop {
+		case propLastModified, propContentLength, propDisplayName:
+			return &searchCondition{"1", nil}, nil
+		}
+		return &searchCondition{"EXISTS (SELECT 1 FROM david_index_meta m WHERE m.file_id = f.id AND m.name = ?)", []interface{}{propertyField(prop)}}, nil
+	case "like", "eq", "lt", "lte", "gt", "gte":
+		prop, literal, err := n.operand()
+		if err != nil {
+			return nil, err
+		}
+		operator, ok := comparisons[op]
+		if op == "like" {
+			operator = "LIKE"
+		}
+		switch {
+		case prop == propLastModified && ok:
+			t, err := parseSearchTime(literal)
+			if err != nil {
+				return nil, errors.New("invalid date " + literal)
+			}
+			return &searchCondition{"f.modified " + operator + " ?", []interface{}{t.UnixNano()}}, nil
+		case prop == propContentLength && ok:
+			size, err := strconv.ParseInt(literal, 10, 64)
+			if err != nil {
+				return nil, errors.New("invalid size " + literal)
+			}
+			return &searchCondition{"NOT f.dir AND f.size " + operator + " ?", []interface{}{size}}, nil
+		case prop == propDisplayName:
+			return &searchCondition{"f.id IN (SELECT rowid FROM david_index_text WHERE name " + operator + " ?)", []interface{}{literal}}, nil
+		case prop == tagsProperty && op == "eq":
+			return &searchCondition{"EXISTS (SELECT 1 FROM david_index_meta m WHERE m.file_id = f.id AND m.name = '' AND m.value = ?)", []interface{}{strings.ToLower(literal)}}, nil
+		case prop == propLastModified || prop == propContentLength || prop == tagsProperty:
+			return nil, errors.New(op + " isn't supported for " + prop.Local)
+		}
+		return &searchCondition{"EXISTS (SELECT 1 FROM david_index_meta m WHERE m.file_id = f.id AND m.name = ? AND m.value " + operator + " ?)", []interface{}{propertyField(prop), literal}}, nil
+	}
+	return nil, errors.New("unsupported operator " + n.XMLName.Local)
+}
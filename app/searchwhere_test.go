@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestSearchWhere(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().AddDate(0, 0, -30)
+	files := map[string]struct {
+		modified time.Time
+		size     int
+		tags     string
+		project  string
+	}{
+		"recent-alpha.txt": {time.Now(), 10, "draft", "alpha"},
+		"old-alpha.txt":    {old, 2000, "final", "alpha"},
+		"recent-beta.txt":  {time.Now(), 10, "draft, final", "beta"},
+		"untagged.txt":     {time.Now(), 10, "", ""},
+	}
+	store, err := openPropertyStore(&Properties{File: filepath.Join(t.TempDir(), "props.db")})
+	if err != nil {
+		t.Fatalf("openPropertyStore() error = %v", err)
+	}
+	for name, f := range files {
+		p := filepath.Join(dir, name)
+		os.WriteFile(p, []byte(strings.Repeat("x", f.size)), 0600)
+		os.Chtimes(p, f.modified, f.modified)
+		var props []webdav.Property
+		if f.tags != "" {
+			props = append(props, textProperty(tagsProperty, f.tags))
+		}
+		if f.project != "" {
+			props = append(props, textProperty(xml.Name{Space: metadataNamespace, Local: "project"}, f.project))
+		}
+		store.patch(context.Background(), p, []webdav.Proppatch{{Props: props}})
+	}
+	ix, err := openIndexer(&Index{File: filepath.Join(t.TempDir(), "index.db")})
+	if err != nil {
+		t.Fatalf("openIndexer() error = %v", err)
+	}
+	cfg := &Config{
+		Dir:        dir,
+		Users:      map[string]*UserInfo{"foo": {Password: GenHash([]byte("password")), Crud: newCrudType("r")}},
+		properties: store,
+		indexer:    ix,
+	}
+	ix.props = cfg.propertyStore()
+	if err := ix.reconcile(cfg); err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+
+	week := time.Now().AddDate(0, 0, -7).UTC().Format(http.TimeFormat)
+	project := func(op, value string) string {
+		return `<D:` + op + `><D:prop><m:project/></D:prop><D:literal>` + value + `</D:literal></D:` + op + `>`
+	}
+	tagged := func(tag string) string {
+		return `<D:eq><D:prop><david:tags/></D:prop><D:literal>` + tag + `</D:literal></D:eq>`
+	}
+	modifiedAfter := `<D:gt><D:prop><D:getlastmodified/></D:prop><D:literal>` + week + `</D:literal></D:gt>`
+	tests := []struct {
+		name  string
+		where string
+		want  int
+		files []string
+	}{
+		{"project modified this week", `<D:and>` + project("eq", "alpha") + modifiedAfter + `</D:and>`, http.StatusMultiStatus, []string{"recent-alpha.txt"}},
+		{"tag", tagged("FINAL"), http.StatusMultiStatus, []string{"old-alpha.txt", "recent-beta.txt"}},
+		{"or", `<D:or>` + project("eq", "beta") + `<D:gt><D:prop><D:getcontentlength/></D:prop><D:literal>1000</D:literal></D:gt></D:or>`, http.StatusMultiStatus, []string{"old-alpha.txt", "recent-beta.txt"}},
+		{"not defined", `<D:and><D:not><D:is-defined><D:prop><m:project/></D:prop></D:is-defined></D:not><D:not><D:is-collection/></D:not></D:and>`, http.StatusMultiStatus, []string{"untagged.txt"}},
+		{"like", `<D:like><D:prop><D:displayname/></D:prop><D:literal>recent-%</D:literal></D:like>`, http.StatusMultiStatus, []string{"recent-alpha.txt", "recent-beta.txt"}},
+		{"invalid date", `<D:gt><D:prop><D:getlastmodified/></D:prop><D:literal>last week</D:literal></D:gt>`, http.StatusBadRequest, nil},
+		{"unsupported operator", `<D:within/>`, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `<?xml version="1.0"?><D:searchrequest xmlns:D="DAV:" xmlns:david="https://github.com/audstanley/david" xmlns:m="https://github.com/audstanley/david/metadata">
+				<D:basicsearch><D:where>` + tt.where + `</D:where></D:basicsearch></D:searchrequest>`
+			r := httptest.NewRequest(Search, "/", strings.NewReader(body))
+			r.SetBasicAuth("foo", "password")
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, r, a)
+			if w.Code != tt.want {
+				t.Fatalf("SEARCH = %d %s, want %d", w.Code, w.Body.String(), tt.want)
+			}
+			if got := strings.Count(w.Body.String(), "<D:response>"); got != len(tt.files) {
+				t.Errorf("SEARCH = %s, want %v", w.Body.String(), tt.files)
+			}
+			for _, name := range tt.files {
+				if !strings.Contains(w.Body.String(), "<D:href>/"+name+"</D:href>") {
+					t.Errorf("SEARCH = %s, want %s", w.Body.String(), name)
+				}
+			}
+		})
+	}
+}
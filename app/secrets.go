@@ -0,0 +1,161 @@
+package app
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Prefixes of the references to secrets kept outside of the configuration.
+const (
+	secretEnv   = "env:"
+	secretFile  = "file:"
+	secretVault = "vault:"
+)
+
+// vaultTimeout bounds the requests to Vault.
+const vaultTimeout = 10 * time.Second
+
+// isSecretRef reports whether a value of the configuration refers to a secret instead of holding it.
+func isSecretRef(value string) bool {
+	return strings.HasPrefix(value, secretEnv) || strings.HasPrefix(value, secretFile) || strings.HasPrefix(value, secretVault)
+}
+
+// resolveSecret returns the secret a reference refers to: env:NAME is the environment variable, file:/path the
+// content of the file without the trailing newline and vault:path#key the key of the secret at path in Vault,
+// at $VAULT_ADDR with $VAULT_TOKEN. Other values are returned as they are.
+func resolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, secretEnv):
+		name := strings.TrimPrefix(ref, secretEnv)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s isn't set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(ref, secretFile):
+		content, err := os.ReadFile(strings.TrimPrefix(ref, secretFile))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	case strings.HasPrefix(ref, secretVault):
+		return readVaultSecret(strings.TrimPrefix(ref, secretVault))
+	}
+	return ref, nil
+}
+
+// readVaultSecret reads the key of a secret in Vault, given as path#key. Secrets of both versions of the
+// key/value engine are supported, version 2 nests the data in another data object.
+func readVaultSecret(ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("vault reference %q isn't of the form path#key", ref)
+	}
+	address := os.Getenv("VAULT_ADDR")
+	if address == "" {
+		return "", errors.New("VAULT_ADDR isn't set")
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(address, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	res, err := (&http.Client{Timeout: vaultTimeout}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault answered %s for %s", res.Status, path)
+	}
+	var secret struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&secret); err != nil {
+		return "", err
+	}
+	data := secret.Data
+	if nested, ok := data["data"]; ok {
+		if err := json.Unmarshal(nested, &data); err != nil {
+			return "", err
+		}
+	}
+	var value string
+	if err := json.Unmarshal(data[key], &value); err != nil {
+		return "", fmt.Errorf("vault secret %s has no key %s", path, key)
+	}
+	return value, nil
+}
+
+// resolveSecrets replaces the references of the passwords of the users by the secrets and reads the referenced
+// certificates and keys of the server and the tenants, so the configuration itself holds no secrets.
+func (cfg *Config) resolveSecrets() error {
+	users := []map[string]*UserInfo{cfg.Users}
+	certificates := []*TLS{cfg.TLS}
+	for _, t := range cfg.Tenants {
+		users = append(users, t.Users)
+		certificates = append(certificates, t.TLS)
+	}
+	for _, list := range users {
+		for username, user := range list {
+			ref := user.Password
+			if user.PasswordFile != "" {
+				if user.Password != "" {
+					return fmt.Errorf("user %s has both a password and a password_file", username)
+				}
+				ref = secretFile + user.PasswordFile
+			}
+			if !isSecretRef(ref) {
+				continue
+			}
+			password, err := resolveSecret(ref)
+			if err != nil {
+				return fmt.Errorf("password of user %s: %s", username, err)
+			}
+			user.passwordRef, user.Password = ref, password
+		}
+	}
+	for _, t := range certificates {
+		if t == nil {
+			continue
+		}
+		if isSecretRef(t.CertFile) {
+			cert, err := resolveSecret(t.CertFile)
+			if err != nil {
+				return fmt.Errorf("tls certificate: %s", err)
+			}
+			t.certPEM = []byte(cert)
+		}
+		if isSecretRef(t.KeyFile) {
+			key, err := resolveSecret(t.KeyFile)
+			if err != nil {
+				return fmt.Errorf("tls key: %s", err)
+			}
+			t.keyPEM = []byte(key)
+		}
+	}
+	return nil
+}
+
+// keyPair returns the certificate and key, read from the secrets they refer to or else from their files.
+func (t *TLS) keyPair() (tls.Certificate, error) {
+	cert, key := t.certPEM, t.keyPEM
+	var err error
+	if cert == nil {
+		if cert, err = os.ReadFile(t.CertFile); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	if key == nil {
+		if key, err = os.ReadFile(t.KeyFile); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	return tls.X509KeyPair(cert, key)
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/david":
+			w.Write([]byte(`{"data": {"data": {"alice": "from-vault-v2"}, "metadata": {}}}`))
+		case "/v1/kv/david":
+			w.Write([]byte(`{"data": {"alice": "from-vault-v1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "token")
+	t.Setenv("DAVID_TEST_SECRET", "from-env")
+	file := filepath.Join(t.TempDir(), "secret")
+	os.WriteFile(file, []byte("from-file\n"), 0o600)
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{"$2a$10$plain", "$2a$10$plain", false},
+		{"env:DAVID_TEST_SECRET", "from-env", false},
+		{"env:DAVID_TEST_MISSING", "", true},
+		{"file:" + file, "from-file", false},
+		{"file:" + file + ".missing", "", true},
+		{"vault:secret/data/david#alice", "from-vault-v2", false},
+		{"vault:kv/david#alice", "from-vault-v1", false},
+		{"vault:kv/david#bob", "", true},
+		{"vault:kv/missing#alice", "", true},
+		{"vault:kv/david", "", true},
+	}
+	for _, tt := range tests {
+		got, err := resolveSecret(tt.ref)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolveSecret(%s) = %q, %v, want %q", tt.ref, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	saml := writeSAMLFiles(t, dir)
+	key, _ := os.ReadFile(saml.KeyFile)
+	t.Setenv("DAVID_TEST_KEY", string(key))
+	hash := GenHash([]byte("password"))
+	t.Setenv("DAVID_TEST_HASH", hash)
+
+	cfg := &Config{
+		Users: map[string]*UserInfo{"alice": {Password: "env:DAVID_TEST_HASH", Crud: newCrudType("r")}},
+		TLS:   &TLS{CertFile: saml.CertFile, KeyFile: "env:DAVID_TEST_KEY"},
+	}
+	if err := cfg.resolveSecrets(); err != nil {
+		t.Fatalf("resolveSecrets() error = %v", err)
+	}
+	if info, err := authenticate(cfg, "alice", "password"); err != nil || !info.Authenticated {
+		t.Errorf("authenticate() with referenced hash = %v, %v", info, err)
+	}
+	pair, err := cfg.TLS.keyPair()
+	if err != nil || len(pair.Certificate) == 0 {
+		t.Errorf("keyPair() with referenced key = %v", err)
+	}
+}
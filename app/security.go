@@ -6,14 +6,14 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var authInfoKey contextKey
@@ -23,6 +23,7 @@ type AuthInfo struct {
 	Username      string
 	Authenticated bool
 	CrudType      *CrudType
+	Scope         string // path below the URL prefix of the user the requests are limited to, empty for all
 }
 
 // authWebdavHandlerFunc is a type definition which holds a context and application reference to
@@ -44,7 +45,7 @@ func NewBasicAuthWebdavHandler(a *App) http.Handler {
 	})
 }
 
-var testCrudType = CrudType{"", false, false, false, false}
+var testCrudType = CrudType{"", false, false, false, false, false, false}
 
 // authenticate validates the provided username and password against the configured users and returns an AuthInfo object.
 func authenticate(cfg *Config, username, password string) (*AuthInfo, error) {
@@ -59,21 +60,44 @@ func authenticate(cfg *Config, username, password string) (*AuthInfo, error) {
 		return &AuthInfo{Authenticated: false, CrudType: &testCrudType}, errors.New("username not found or password empty")
 	}
 
-	// Retrieve user information from configuration
-	user := cfg.Users[username]
+	// Retrieve user information from configuration or the user store
+	user := cfg.storedUser(username)
 
 	if user == nil {
 		return nil, errors.New("user not found")
 	}
 
+	// Suspended accounts keep their settings, but can't log in
+	if user.Disabled {
+		log.WithField("user", username).Warn("Refused login of disabled user")
+		return &AuthInfo{Username: username, Authenticated: false, CrudType: &testCrudType}, errors.New("account disabled")
+	}
+
+	// Guest accounts can't log in once they expired
+	if user.expired(time.Now()) {
+		return &AuthInfo{Username: username, Authenticated: false, CrudType: &testCrudType}, errors.New("account expired")
+	}
+
 	// Retrieve user CRUD permissions from configuration
-	crud := cfg.Users[username].Crud
+	crud := user.Crud
 
-	// Verify provided password against stored hash
-	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err != nil {
-		return &AuthInfo{Username: username, Authenticated: false, CrudType: &testCrudType}, errors.New("Password doesn't match")
+	// Verify provided password against stored hash, unless another instance did so recently
+	if !cfg.redis.verified(cfg.pepper, username, user.Password, password) {
+		err := verifyPassword(user.Password, cfg.peppered(username, password))
+		if err != nil {
+			return &AuthInfo{Username: username, Authenticated: false, CrudType: &testCrudType}, errors.New("Password doesn't match")
+		}
+		cfg.redis.remember(cfg.pepper, username, user.Password, password)
+	}
+	// Passwords older than the maximum age have to be rotated
+	if cfg.passwordExpired(user, time.Now()) {
+		if !cfg.Security.PasswordAgeWarnOnly {
+			return &AuthInfo{Username: username, Authenticated: false, CrudType: &testCrudType}, errors.New("password expired")
+		}
+		log.WithField("user", username).WithField("set", user.PasswordSetAt).Warn("Password of user expired, rotate it")
 	}
+	// Weaker hashes are replaced now that the password is known
+	cfg.upgradeHash(username, user, password)
 
 	log.WithFields(log.Fields{"user": username, "crud": crud}).Debug("User was authenticated")
 	// Return successful authentication information
@@ -94,6 +118,19 @@ func AuthFromContext(ctx context.Context) *AuthInfo {
 
 func handle(ctx context.Context, w http.ResponseWriter, req *http.Request, a *App) {
 
+	// Answered requests are logged if enabled
+	var access *accessWriter
+	if a.Config.Log.Access {
+		access = &accessWriter{statusWriter: statusWriter{ResponseWriter: w}, started: time.Now()}
+		w = access
+		defer access.log(a.Config, req)
+	}
+
+	// Browsers get the custom pages of error responses
+	if len(a.Config.errorPages) != 0 && acceptsHTML(req) {
+		w = &errorPageWriter{ResponseWriter: w, req: req, realm: a.Config.Realm, pages: a.Config.errorPages}
+	}
+
 	// CORS preflight request handling
 	if req.Method == "OPTIONS" {
 		// Allow preflight requests from configured origins and with valid headers
@@ -105,47 +142,170 @@ func handle(ctx context.Context, w http.ResponseWriter, req *http.Request, a *Ap
 		}
 	}
 
+	// Write operations over the HTTP listener may require TLS
+	if isCleartext(a.Config, req) && a.Config.HTTP.RequireTLSForWrite && writeMethods[req.Method] {
+		writeDAVError(w, http.StatusForbidden, conditionTLSRequired)
+		return
+	}
+
+	// Writes, or all requests, are refused during maintenance windows
+	if rejectDuringMaintenance(a.Config, w, req) {
+		return
+	}
+
+	// Paths ignoring their case can't be moved onto themselves in another casing
+	if rejectCaseOnlyMove(a.Config, w, req) {
+		return
+	}
+
+	// Pre-signed download links are served without Basic auth
+	if a.Config.Presign != nil && a.Config.AuthenticationNeeded() && isPresignedRequest(req) {
+		servePresigned(a, w, req)
+		return
+	}
+
+	// Share links are served to anyone holding their token
+	if isShareRequest(a.Config, req) {
+		serveShare(a, w, req)
+		return
+	}
+
+	// The SAML endpoints receive the login of the identity provider
+	if isSAMLRequest(a.Config, req) {
+		a.Config.saml.ServeHTTP(w, req)
+		return
+	}
+
 	// Authentication bypass for systems without users
 	if !a.Config.AuthenticationNeeded() {
-		a.Handler.ServeHTTP(w, req.WithContext(ctx))
+		if err := applyScriptToOperation(a, "", req); err != nil {
+			writeDAVError(w, http.StatusForbidden, conditionOperationDenied)
+			return
+		}
+		serveWebdav(a, ctx, w, req, "")
 		return
 	}
 
-	// Extract username and password from HTTP Basic Auth header
-	username, password, ok := httpAuth(req, a.Config)
-	if !ok {
-		// Respond with Unauthorized status and optional realm
-		SayUnauthorized(w, a.Config.Realm)
+	// Credentials must not be sent in cleartext unless allowed
+	if isCleartext(a.Config, req) && !a.Config.HTTP.AllowAuth {
+		writeDAVError(w, http.StatusForbidden, conditionTLSRequired)
 		return
 	}
 
-	// Authenticate user credentials
-	authInfo, err := authenticate(a.Config, username, password)
-	// Log failed login attempt with user and IP address
-	if err != nil {
-		ipAddr := req.Header.Get("X-Forwarded-For")
-		if len(ipAddr) == 0 {
-			remoteAddr := req.RemoteAddr
-			lastIndex := strings.LastIndex(remoteAddr, ":")
-			if lastIndex != -1 {
-				ipAddr = remoteAddr[:lastIndex]
-			} else {
-				ipAddr = remoteAddr
-			}
+	// Clients which failed to log in too often are locked out for a while
+	if rejectLockedOut(a.Config, w, req) {
+		return
+	}
+
+	// Authenticate with a bearer token, a Kerberos ticket, a verified client certificate, the header of a trusted
+	// proxy, a SAML session or else with the HTTP Basic Auth header
+	authInfo := authenticateJWT(a.Config, req)
+	if authInfo == nil {
+		authInfo = authenticateNegotiate(a.Config, w, req)
+	}
+	if authInfo == nil {
+		authInfo = authenticateClientCertificate(a.Config, req)
+	}
+	if authInfo == nil {
+		authInfo = authenticateProxyHeader(a.Config, req)
+	}
+	if authInfo == nil {
+		authInfo = authenticateSAMLSession(a.Config, req)
+	}
+	if authInfo == nil {
+		// Browsers without a session log in at the identity provider instead of a Basic auth dialog
+		if a.Config.saml != nil && isBrowserRequest(req) {
+			a.Config.saml.HandleStartAuthFlow(w, req)
+			return
 		}
-		log.WithField("user", username).WithField("address", ipAddr).WithError(err).Warn("User failed to login")
+		authInfo = authenticateBasic(a, req)
 	}
 	// Check if user is authenticated and authorized
-	if !authInfo.Authenticated || !authInfo.CrudType.Read {
-		// Respond with Unauthorized status and optional realm
+	if authInfo == nil || !authInfo.Authenticated || authInfo.CrudType == nil || !authInfo.CrudType.Read {
+		// Slow down repeated guessing before responding with Unauthorized status and optional realm
+		tarpitFailedLogin(a.Config, req)
+		if a.Config.Kerberos != nil {
+			// Domain members log in with their ticket, others fall back to Basic auth
+			w.Header().Set("WWW-Authenticate", negotiateScheme)
+		}
+		SayUnauthorized(w, a.Config.Realm)
+		return
+	}
+	// Disabled and expired accounts are refused, whichever way they authenticated
+	if user := a.Config.user(authInfo.Username); user != nil && user.Disabled {
+		log.WithField("user", authInfo.Username).WithField("address", clientAddress(req)).Warn("Refused login of disabled user")
+		securityEvent(a.Config, log.WarnLevel, "Login of disabled user", log.Fields{"user": authInfo.Username, "address": a.Config.sourceAddressString(req)})
 		SayUnauthorized(w, a.Config.Realm)
 		return
+	} else if user != nil && user.expired(time.Now()) {
+		log.WithField("user", authInfo.Username).WithField("address", clientAddress(req)).Warn("Refused login of expired user")
+		SayUnauthorized(w, a.Config.Realm)
+		return
+	}
+	// Users limited to address ranges can't log in from elsewhere
+	if rejectDisallowedAddress(a.Config, w, req, authInfo.Username) {
+		return
+	}
+	if username, _, ok := req.BasicAuth(); ok {
+		a.Config.authFailureCounter().reset(authFailureKey(a.Config.failureAddress(req), a.Config.normalizeUsername(username)))
+	}
+	// Denied requests of authenticated users are security events
+	w, logDenial := securityDenials(a.Config, w, req, authInfo.Username)
+	defer logDenial()
+	// Evaluate the auth function of the policy script
+	if !scriptAllowsAuth(a, authInfo.Username, req) {
+		log.WithField("user", authInfo.Username).WithField("address", clientAddress(req)).Warn("Policy script denied login")
+		securityEvent(a.Config, log.WarnLevel, "Login denied by policy script", log.Fields{"user": authInfo.Username, "address": a.Config.sourceAddressString(req)})
+		SayUnauthorized(w, a.Config.Realm)
+		return
+	}
+	// The files of encrypted users are only served with their key
+	if a.Config.encrypts(authInfo.Username) {
+		_, password, _ := httpAuth(req, a.Config)
+		key, err := a.Config.userKey(authInfo.Username, password)
+		if err != nil {
+			log.WithField("user", authInfo.Username).WithError(err).Error("Error unlocking encryption key")
+			writeDAVError(w, http.StatusForbidden, conditionOperationDenied)
+			return
+		}
+		ctx = context.WithValue(ctx, encryptionKeyKey, key)
 	}
 	// Add authentication information to context
 	ctx = context.WithValue(ctx, authInfoKey, authInfo)
+	if access != nil {
+		access.user = authInfo.Username
+	}
+	a.Config.createAssignedSubdir(authInfo.Username)
+
+	// Tokens limited to a path can't address others, nor the internal endpoints outside of it
+	if rejectOutOfScope(a.Config, w, req, authInfo) {
+		return
+	}
+
+	// Serve the internal endpoints of david for the authenticated user
+	if serveInternalEndpoint(a, ctx, w, req, authInfo) {
+		return
+	}
+
+	// With per-user prefixes only the tree below the prefix of the user is served
+	if !hasPathPrefix(req.URL.Path, a.Config.prefixOf(authInfo.Username)) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Evaluate the operation function of the policy script, which may rewrite the path
+	if err := applyScriptToOperation(a, authInfo.Username, req); err != nil {
+		writeDAVError(w, http.StatusForbidden, conditionOperationDenied)
+		return
+	}
+
+	// Permissions may vary by path inside the tree of the user
+	if applyACL(a.Config, w, req, authInfo) {
+		return
+	}
 
 	// Handle HTTP authorization from method headers
-	err, ok = handleHeadersForAuthorization(a, ctx, w, req, authInfo)
+	err, ok := handleHeadersForAuthorization(a, ctx, w, req, authInfo)
 	if err == nil && !ok {
 		return
 	} else if err != nil {
@@ -157,13 +317,72 @@ func handle(ctx context.Context, w http.ResponseWriter, req *http.Request, a *Ap
 	// =================================================================================================================
 
 	// Serve request with authenticated user context
-	a.Handler.ServeHTTP(w, req.WithContext(ctx))
+	serveWebdav(a, ctx, w, req, authInfo.Username)
 }
 
-// Resolve returns the physical path for the given name.
+// authenticateBasic validates the credentials of the HTTP Basic Auth header against the config file and the auth plugins.
+func authenticateBasic(a *App, req *http.Request) *AuthInfo {
+	// Extract username and password from HTTP Basic Auth header
+	username, password, ok := httpAuth(req, a.Config)
+	if !ok {
+		return nil
+	}
+
+	// Authenticate user credentials
+	authInfo, err := authenticate(a.Config, username, password)
+	if authInfo == nil {
+		// Users of external sources verified recently by any instance don't have to be verified again
+		if authInfo = a.Config.verifiedExternal(username, password); authInfo != nil {
+			err = nil
+		}
+	}
+	external := authInfo == nil
+	if authInfo == nil && a.Config.PAM != nil {
+		// Users unknown to the config file may be system accounts
+		authInfo, err = authenticateWithPAM(a.Config, username, password)
+	}
+	if authInfo == nil && a.Config.Unix != nil {
+		// Users unknown to the config file may be system accounts of the shadow file
+		authInfo, err = authenticateWithUnix(a.Config, username, password)
+	}
+	if authInfo == nil && a.Config.ForwardAuth != nil {
+		// Users unknown to the config file may be known to another service
+		authInfo, err = authenticateWithForwardAuth(a.Config, req, username, password)
+	}
+	if authInfo == nil && len(a.Config.authPlugins) > 0 {
+		// Users unknown to the config file may be known to an auth plugin
+		authInfo, err = authenticateWithPlugins(a.Config, username, password, clientAddress(req))
+	}
+	if external && authInfo != nil && authInfo.Authenticated {
+		a.Config.rememberExternal(username, password)
+	}
+	// Log failed login attempt with user and IP address
+	if err != nil {
+		log.WithField("user", username).WithField("address", clientAddress(req)).WithError(err).Warn("User failed to login")
+		siemLoginFailure(a.Config, username, a.Config.sourceAddressString(req), err)
+		logFailedLogin(a.Config, req, username)
+		securityEvent(a.Config, log.WarnLevel, "Login failed", log.Fields{"user": username, "address": a.Config.sourceAddressString(req), "error": err.Error()})
+	}
+	return authInfo
+}
+
+// hasPathPrefix reports whether urlPath is prefix itself or below it.
+func hasPathPrefix(urlPath, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/")
+}
+
+// hasFilePathPrefix reports whether the slash separated path of a file is prefix itself or below it, ignoring
+// the case where the file system does.
+func hasFilePathPrefix(rel, prefix string) bool {
+	return hasPathPrefix(foldPath(rel), foldPath(prefix))
+}
+
+// Resolve returns the physical path for the given name, or an empty path if it's invalid or leads out of the
+// directory of the user.
 func Resolve(ctx context.Context, name string, d Dir) string {
 	// Validate the name for any invalid characters or separators.
-	if filepath.Separator != '/' && strings.ContainsRune(name, filepath.Separator) ||
+	if invalidName(name) ||
 		strings.Contains(name, "\x00") { // Null bytes are illegal in file names because they can be used to terminate strings prematurely and cause unexpected behavior.
 		return ""
 	}
@@ -173,31 +392,84 @@ func Resolve(ctx context.Context, name string, d Dir) string {
 	if dir == "" {
 		dir = "."
 	}
+	root := dir
 	// Obtain authentication information from the context.
 	authInfo := AuthFromContext(ctx)
 	// Check if user is authenticated and has configured subdirectory.
 	if authInfo != nil && authInfo.Authenticated {
 		// Get user information from the configuration.
-		userInfo := d.Config.Users[authInfo.Username]
-		// If user has a configured subdirectory, append it to the path.
-		if userInfo != nil && userInfo.Subdir != nil {
-			return filepath.Join(dir, *userInfo.Subdir, filepath.FromSlash(path.Clean("/"+name)))
+		userInfo := d.Config.user(authInfo.Username)
+		// If user has a subdirectory, configured or assigned by the policy, the user is jailed in it.
+		if userInfo != nil {
+			subdir, ok := d.Config.subdirOf(authInfo.Username, userInfo)
+			if !ok {
+				return ""
+			}
+			root = filepath.Join(dir, subdir)
+			if !withinDir(dir, root) {
+				return ""
+			}
+		}
+	}
+	// Build the final physical path by combining the root and the provided name, which has to stay below the root.
+	physical := filepath.Join(root, filepath.FromSlash(path.Clean("/"+name)))
+	// Paths ignoring their case take the casing of the existing files.
+	if d.Config.CaseInsensitive && localStorage(d.storage()) {
+		var ok bool
+		if physical, ok = matchCase(root, physical); !ok {
+			return ""
 		}
 	}
-	// Build the final physical path by combining base directory and the provided name.
-	return filepath.Join(dir, filepath.FromSlash(path.Clean("/"+name)))
+	return d.confine(root, physical)
 }
 
 // Define allowed methods for your WebDAV resource
 var allowedMethods = []string{
-	"GET", "HEAD", "PUT", "POST", "DELETE",
+	"OPTIONS", "GET", "HEAD", "PUT", "POST", "DELETE",
 	"PROPFIND", "PROPPATCH", "COPY", "MOVE", "LOCK",
-	"UNLOCK", "MKCOL", "DELETE",
+	"UNLOCK", "MKCOL",
+}
+
+// methodsAllowed returns the methods of the webdav tree, including the search of the index if configured.
+func (cfg *Config) methodsAllowed() []string {
+	if cfg.indexer != nil {
+		// Advertise the search of the index (RFC 5323)
+		return append(allowedMethods[:len(allowedMethods):len(allowedMethods)], Search, Report)
+	}
+	return allowedMethods
+}
+
+// validateMethods checks that the methods a user is limited to are known.
+func validateMethods(methods []string) error {
+	known := append(allowedMethods[:len(allowedMethods):len(allowedMethods)], Search, Report)
+	for _, method := range methods {
+		if !slices.ContainsFunc(known, func(m string) bool { return strings.EqualFold(m, method) }) {
+			return fmt.Errorf("unknown method %s", method)
+		}
+	}
+	return nil
+}
+
+// methodAllowed reports whether the user may send requests of the method. Users without a list of methods
+// may send all of them, OPTIONS is always allowed so clients can discover the others.
+func (user *UserInfo) methodAllowed(method string) bool {
+	return len(user.Methods) == 0 || method == http.MethodOptions ||
+		slices.ContainsFunc(user.Methods, func(m string) bool { return strings.EqualFold(m, method) })
+}
+
+// methodsOf returns the methods of the webdav tree the user may send, all of them for unknown users.
+func (cfg *Config) methodsOf(user *UserInfo) []string {
+	if user == nil {
+		return cfg.methodsAllowed()
+	}
+	return slices.DeleteFunc(slices.Clone(cfg.methodsAllowed()), func(method string) bool {
+		return !user.methodAllowed(method)
+	})
 }
 
 const (
 	Propfind string = "PROPFIND"
-	Mkol     string = "MKOL"
+	Mkol     string = "MKCOL"
 	Move     string = "MOVE"
 	Lock     string = "LOCK"
 	Unlock   string = "UNLOCK"
@@ -208,17 +480,27 @@ const (
 func handleHeadersForAuthorization(a *App, ctx context.Context, w http.ResponseWriter, req *http.Request, authInfo *AuthInfo) (error, bool) {
 	// Initialize authorization status as True (assuming allowed)
 	ok := true
-	switch req.Method {
-	case http.MethodGet:
-		// GET not allowed, return Method Not Allowed (405)
-		handleMethodNotAllowed(ctx, w, req)
+	// Users may be limited to some methods, whatever their permissions are
+	user := a.Config.user(authInfo.Username)
+	if user != nil && !user.methodAllowed(req.Method) {
+		handleMethodNotAllowed(ctx, w, req, a.Config.methodsOf(user)...)
 		return nil, !ok
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		// Check user's "Read" permission for GET and HEAD requests, ranges and conditions are left to the handler
+		log.WithField("method", req.Method).Debug("Method received")
+		if !authInfo.CrudType.Read {
+			writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges, req.URL.Path)
+			return nil, !ok
+		}
+		return nil, ok
 	case http.MethodPut:
 		// Check user's "Create" permission for PUT requests
 		log.WithField("method", req.Method).Debug("Method received")
 		// Unauthorized due to missing permission
-		if !a.Config.Users[authInfo.Username].Crud.Create {
-			w.WriteHeader(http.StatusForbidden)
+		if !authInfo.CrudType.Create {
+			writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges, req.URL.Path)
 			return nil, !ok
 		} else {
 			// Authorized!
@@ -230,23 +512,23 @@ func handleHeadersForAuthorization(a *App, ctx context.Context, w http.ResponseW
 	case http.MethodDelete:
 		// Check user's "Delete" permission for DELETE requests
 		log.WithField("method", req.Method).Debug("Method received")
-		if !a.Config.Users[authInfo.Username].Crud.Delete {
+		if !authInfo.CrudType.Delete {
 			// Unauthorized due to missing permission
-			w.WriteHeader(http.StatusForbidden)
+			writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges, req.URL.Path)
 			return nil, !ok
 		} else {
 			// Authorized!
 			return nil, ok
 		}
-	case http.MethodHead:
-		// Log the received HEAD request but don't handle authorization here
-		log.WithField("method", req.Method).Debug("Method received")
 	case http.MethodOptions:
 		// Handle OPTIONS request by setting allowed methods and WebDAV headers
 		log.WithField("method", req.Method).Debug("Method received")
 		// Respond to OPTIONS request
-		w.Header().Set("Allow", strings.Join(allowedMethods, ", "))
+		w.Header().Set("Allow", strings.Join(a.Config.methodsOf(user), ", "))
 		w.Header().Set("DAV", "1, 2, source") // Indicate supported WebDAV versions and extensions
+		if a.Config.indexer != nil {
+			w.Header().Set("DASL", "<DAV:basicsearch>")
+		}
 		w.WriteHeader(http.StatusOK)
 		return nil, !ok // Not authorized in the strict sense, but OPTIONS doesn't require file access
 	case Propfind:
@@ -255,48 +537,28 @@ func handleHeadersForAuthorization(a *App, ctx context.Context, w http.ResponseW
 			"method": req.Method,
 			"crud":   authInfo.CrudType.Crud},
 		).Debug("Method received")
-		if !a.Config.Users[authInfo.Username].Crud.Read {
+		if !authInfo.CrudType.Read {
 			// Check user's "Read" permission
-			w.WriteHeader(http.StatusUnauthorized) // 401 Unauthorized
+			writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges, req.URL.Path)
 			return nil, !ok
-		} else {
-			// User can read existing files, but additional check for non-existent files requested with Create/Update permissions
-			if !a.Config.Users[authInfo.Username].Crud.Create || !a.Config.Users[authInfo.Username].Crud.Update {
-				// Get the requested file path
-				filePath := Resolve(ctx, req.URL.Path, Dir{a.Config})
-				log.WithFields(log.Fields{"user": authInfo.Username, "Path": filePath}).Debug("Header received")
-
-				// Check if the file exists (if not, user might be trying to open a non-existent file they shouldn't have access to)
-				// **Important note:** The previous code relied on `os.Stat` which can panic during custom WebDAV filesystem implementations. This revised approach avoids the panic potential.
-				_, err := os.Stat(filePath)
-				if err != nil {
-					if errors.Is(err, os.ErrNotExist) {
-						// File doesn't exist, and user lacks Create/Update permissions
-						if a.Config.Log.Create {
-							log.WithFields(log.Fields{
-								"path":       filePath,
-								"user":       authInfo.Username,
-								"User-Agent": req.Header.Get("User-Agent"),
-							}).Debug("User does not have the permission to open a non existant file that their operating system is attempting to find")
-							// Not authorized due to attempting to open a non-existent file with insufficient permissions
-							return nil, !ok
-						} else {
-							// For some other reason, the file doesn't exist, but the user has Create/Update permissions
-							return nil, !ok
-						}
-					}
-				}
-				return nil, ok
+		}
+		// Collections are only listed with the "List" permission, their own properties are readable anyway
+		if req.Header.Get("Depth") != "0" && !a.Config.mayList(authInfo.CrudType) {
+			name := path.Clean("/" + strings.TrimPrefix(req.URL.Path, a.Config.prefixOf(authInfo.Username)))
+			dir := Dir{a.Config}
+			if info, err := dir.storage().Stat(Resolve(ctx, name, dir)); err == nil && info.IsDir() {
+				writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges, req.URL.Path)
+				return nil, !ok
 			}
-
-			return nil, ok
 		}
+		// Missing resources are answered with 404 by the webdav handler, also to users who can't create them
+		return nil, ok
 	case Mkol:
 		// Check user's "Create" permission for MKCOL
 		log.WithField("method", Mkol).Debug("Method received")
-		if !a.Config.Users[authInfo.Username].Crud.Create {
+		if !authInfo.CrudType.Create {
 			// Unauthorized due to missing permission
-			w.WriteHeader(http.StatusUnauthorized)
+			writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges, req.URL.Path)
 			return nil, !ok
 		} else {
 			// Authorized!
@@ -305,21 +567,30 @@ func handleHeadersForAuthorization(a *App, ctx context.Context, w http.ResponseW
 	case Move:
 		// Check user's "Update" permission for MOVE
 		log.WithField("method", Move).Debug("Method received")
-		if !a.Config.Users[authInfo.Username].Crud.Update {
+		if !authInfo.CrudType.Update {
 			// Unauthorized due to missing permission
 			filePath := Resolve(ctx, req.URL.Path, Dir{a.Config})
 			log.WithFields(log.Fields{"user": authInfo.Username, "method": Move, "crud": authInfo.CrudType.Crud, "path": filePath}).Debug("User does not have the permission to move the file")
-			w.WriteHeader(http.StatusUnauthorized)
+			writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges, req.URL.Path)
 			return nil, !ok
 		} else {
 			// Authorized!
 			return nil, ok
 		}
+	case Copy:
+		// COPY reads the source and creates the destination
+		log.WithField("method", Copy).Debug("Method received")
+		if !authInfo.CrudType.Read || !authInfo.CrudType.Create {
+			writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges, req.URL.Path)
+			return nil, !ok
+		} else {
+			return nil, ok
+		}
 	case Lock:
 		// LOCK requires "Create" permission
 		log.WithField("method", Lock).Debug("Method received")
-		if !a.Config.Users[authInfo.Username].Crud.Create {
-			w.WriteHeader(http.StatusUnauthorized)
+		if !authInfo.CrudType.Create {
+			writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges, req.URL.Path)
 			return nil, !ok
 		} else {
 			return nil, ok
@@ -327,8 +598,8 @@ func handleHeadersForAuthorization(a *App, ctx context.Context, w http.ResponseW
 	case Unlock:
 		// UNLOCK requires "Create" permission
 		log.WithField("method", Unlock).Debug("Method received")
-		if !a.Config.Users[authInfo.Username].Crud.Create {
-			w.WriteHeader(http.StatusUnauthorized)
+		if !authInfo.CrudType.Create {
+			writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges, req.URL.Path)
 			return nil, !ok
 		} else {
 			return nil, ok
@@ -345,24 +616,51 @@ func handleHeadersForAuthorization(a *App, ctx context.Context, w http.ResponseW
 	return errors.New("no single method was received"), !ok
 }
 
-// handle methods not allowed
-func handleMethodNotAllowed(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+// handleMethodNotAllowed answers a method the resource doesn't support with 405 and the allowed methods,
+// which have to be set before the status is written.
+func handleMethodNotAllowed(ctx context.Context, w http.ResponseWriter, req *http.Request, allowed ...string) {
 	log.WithField("method", req.Method).Debug("Method received")
-	w.Write([]byte("Method not allowed"))
-	w.WriteHeader(http.StatusMethodNotAllowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeDAVError(w, http.StatusMethodNotAllowed, conditionMethodNotAllowed)
+}
+
+// writeMethods are the methods modifying the webdav tree.
+var writeMethods = map[string]bool{
+	http.MethodPut: true, http.MethodPost: true, http.MethodDelete: true,
+	"MKCOL": true, Copy: true, Move: true, Propatch: true, Lock: true, Unlock: true,
+}
+
+// isCleartext reports whether the request was received by the additional HTTP listener.
+func isCleartext(cfg *Config, req *http.Request) bool {
+	return cfg.HTTP != nil && req.TLS == nil
+}
+
+// clientAddress returns the address of the client, preferring the X-Forwarded-For header of a proxy.
+func clientAddress(req *http.Request) string {
+	ipAddr := req.Header.Get("X-Forwarded-For")
+	if len(ipAddr) == 0 {
+		remoteAddr := req.RemoteAddr
+		lastIndex := strings.LastIndex(remoteAddr, ":")
+		if lastIndex != -1 {
+			ipAddr = remoteAddr[:lastIndex]
+		} else {
+			ipAddr = remoteAddr
+		}
+	}
+	return ipAddr
 }
 
 func httpAuth(r *http.Request, config *Config) (string, string, bool) {
 	if config.AuthenticationNeeded() {
 		username, password, ok := r.BasicAuth()
-		return username, password, ok
+		return config.normalizeUsername(username), password, ok
 	}
 
 	return "", "", true
 }
 
 func SayUnauthorized(w http.ResponseWriter, realm string) {
-	w.Header().Set("WWW-Authenticate", "Basic realm="+realm)
+	w.Header().Add("WWW-Authenticate", "Basic realm="+realm)
 	w.WriteHeader(http.StatusUnauthorized)
 	_, err := w.Write([]byte(fmt.Sprintf("%d %s", http.StatusUnauthorized, "Unauthorized")))
 
@@ -373,10 +671,10 @@ func SayUnauthorized(w http.ResponseWriter, realm string) {
 
 // GenHash generates a bcrypt hashed password string
 func GenHash(password []byte) string {
-	pw, err := bcrypt.GenerateFromPassword(password, 10)
+	pw, err := GenHashWith(HashBcrypt, password)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	return string(pw)
+	return pw
 }
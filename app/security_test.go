@@ -2,10 +2,15 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
@@ -224,14 +229,14 @@ func TestAuthFromContext(t *testing.T) {
 		{
 			"success",
 			args{
-				ctx: context.WithValue(baseCtx, authInfoKey, &AuthInfo{"username", true, &CrudType{"crud", true, true, true, true}}),
+				ctx: context.WithValue(baseCtx, authInfoKey, &AuthInfo{"username", true, &CrudType{"crud", true, true, true, true, false, false}, ""}),
 			},
-			&AuthInfo{"username", true, &CrudType{"crud", true, true, true, true}},
+			&AuthInfo{"username", true, &CrudType{"crud", true, true, true, true, false, false}, ""},
 		},
 		{
 			"failure",
 			args{
-				ctx: context.WithValue(baseCtx, fakeKeyValue, &AuthInfo{"username", true, &CrudType{"crud", true, true, true, true}}),
+				ctx: context.WithValue(baseCtx, fakeKeyValue, &AuthInfo{"username", true, &CrudType{"crud", true, true, true, true, false, false}, ""}),
 			},
 			nil,
 		},
@@ -302,7 +307,9 @@ func TestHandle(t *testing.T) {
 				&App{
 					Config: &Config{Users: map[string]*UserInfo{
 						"foo": {
-							Password: GenHash([]byte("password")),
+							Password:    GenHash([]byte("password")),
+							Permissions: "crud",
+							Crud:        &CrudType{Crud: "crud", Create: true, Read: true, Update: true, Delete: true},
 						},
 					}},
 					Handler: &webdav.Handler{
@@ -329,3 +336,297 @@ func TestHandle(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleUserPrefix(t *testing.T) {
+	a := &App{
+		Config: &Config{
+			Prefix:     "/dav",
+			UserPrefix: true,
+			Users: map[string]*UserInfo{
+				"alice": {Password: GenHash([]byte("password")), Permissions: "crud", Crud: newCrudType("crud")},
+			},
+		},
+		Handler: &webdav.Handler{
+			Prefix:     "/dav",
+			FileSystem: webdav.NewMemFS(),
+			LockSystem: webdav.NewMemLS(),
+		},
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+	}{
+		{"own prefix", "/dav/alice/", 207},
+		{"prefix of another user", "/dav/bob/", 404},
+		{"prefix without user", "/dav/", 404},
+		{"username as part of a name", "/dav/alice2/", 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PROPFIND", tt.path, nil)
+			r.SetBasicAuth("alice", "password")
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, r, a)
+			if w.Code != tt.statusCode {
+				t.Errorf("handle() = %v, want %v", w.Code, tt.statusCode)
+			}
+			// The hrefs contain the prefix of the user
+			if w.Code == 207 && !strings.Contains(w.Body.String(), "<D:href>/dav/alice/</D:href>") {
+				t.Errorf("handle() body = %s, want href /dav/alice/", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleCleartext(t *testing.T) {
+	newApp := func(listener *HTTP) *App {
+		return &App{
+			Config: &Config{
+				TLS:  &TLS{},
+				HTTP: listener,
+				Users: map[string]*UserInfo{
+					"foo": {Password: GenHash([]byte("password")), Permissions: "crud", Crud: newCrudType("crud")},
+				},
+			},
+			Handler: &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		listener   *HTTP
+		method     string
+		path       string
+		tls        bool
+		statusCode int
+	}{
+		{"auth over cleartext denied", &HTTP{}, "PROPFIND", "/", false, 403},
+		{"auth over cleartext allowed", &HTTP{AllowAuth: true}, "PROPFIND", "/", false, 207},
+		{"write requires tls", &HTTP{AllowAuth: true, RequireTLSForWrite: true}, "MKCOL", "/dir", false, 403},
+		{"read with write requiring tls", &HTTP{AllowAuth: true, RequireTLSForWrite: true}, "PROPFIND", "/", false, 207},
+		{"write over tls", &HTTP{RequireTLSForWrite: true}, "MKCOL", "/dir", true, 201},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			r.SetBasicAuth("foo", "password")
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, r, newApp(tt.listener))
+			if w.Code != tt.statusCode {
+				t.Errorf("handle() = %v, want %v", w.Code, tt.statusCode)
+			}
+		})
+	}
+}
+
+func TestHandleMethodNotAllowed(t *testing.T) {
+	a := &App{
+		Config: &Config{
+			Presign: &Presign{Secret: "secret"},
+			Users: map[string]*UserInfo{
+				"foo":    {Password: GenHash([]byte("password")), Permissions: "crud", Crud: newCrudType("crud")},
+				"lister": {Password: GenHash([]byte("password")), Permissions: "crud", Crud: newCrudType("crud"), Methods: []string{"PROPFIND"}},
+			},
+		},
+		Handler: &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()},
+	}
+
+	tests := []struct {
+		name    string
+		user    string
+		method  string
+		path    string
+		allowed string
+	}{
+		{"get of a user limited to methods", "lister", http.MethodGet, "/file.txt", "OPTIONS, PROPFIND"},
+		{"delete of endpoint", "foo", http.MethodDelete, presignEndpoint, "GET, POST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.SetBasicAuth(tt.user, "password")
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, r, a)
+			// The result has the headers as they were when the status was written
+			result := w.Result()
+			if result.StatusCode != http.StatusMethodNotAllowed {
+				t.Errorf("status = %d, want %d", result.StatusCode, http.StatusMethodNotAllowed)
+			}
+			if allow := result.Header.Get("Allow"); allow != tt.allowed {
+				t.Errorf("Allow = %q, want %q", allow, tt.allowed)
+			}
+			if !strings.Contains(w.Body.String(), "<D:error") {
+				t.Errorf("body = %q, want a DAV:error", w.Body.String())
+			}
+		})
+	}
+	if len(allowedMethods) != 13 || allowedMethods[1] != http.MethodGet {
+		t.Errorf("allowedMethods = %v, was modified", allowedMethods)
+	}
+}
+
+func TestHandleDisabledUser(t *testing.T) {
+	cfg := &Config{
+		Dir: t.TempDir(),
+		Users: map[string]*UserInfo{
+			"alice": {Password: GenHash([]byte("password")), Crud: newCrudType("crud"), Disabled: true},
+		},
+		JWT: &JWT{Secret: "secret"},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	token, _ := IssueJWT(cfg, "alice", "", "", time.Hour)
+	for name, authorize := range map[string]func(*http.Request){
+		"password": func(r *http.Request) { r.SetBasicAuth("alice", "password") },
+		"token":    func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) },
+	} {
+		r := httptest.NewRequest("PROPFIND", "/", nil)
+		r.Header.Set("Depth", "0")
+		authorize(r)
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status of disabled user = %d, want %d", name, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// Enabling the account again on reload keeps its settings
+	updated := &Config{Users: map[string]*UserInfo{"alice": {Password: cfg.Users["alice"].Password, Crud: cfg.Users["alice"].Crud}}}
+	updateConfig(cfg, updated)
+	r := httptest.NewRequest("PROPFIND", "/", nil)
+	r.Header.Set("Depth", "0")
+	r.SetBasicAuth("alice", "password")
+	w := httptest.NewRecorder()
+	handle(context.Background(), w, r, a)
+	if w.Code != http.StatusMultiStatus {
+		t.Errorf("status of enabled user = %d, want %d", w.Code, http.StatusMultiStatus)
+	}
+}
+
+func TestListPermission(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "docs"), 0700)
+	os.WriteFile(filepath.Join(dir, "docs", "known.txt"), []byte("known"), 0600)
+	cfg := &Config{
+		Dir:            dir,
+		ListPermission: true,
+		Users: map[string]*UserInfo{
+			"alice": {Password: GenHash([]byte("password")), Crud: newCrudType("r")},
+			"bob":   {Password: GenHash([]byte("password")), Crud: newCrudType("rl")},
+		},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	tests := []struct {
+		user   string
+		method string
+		path   string
+		depth  string
+		want   int
+	}{
+		{"alice", "PROPFIND", "/docs/known.txt", "1", http.StatusMultiStatus},
+		{"alice", "PROPFIND", "/docs", "0", http.StatusMultiStatus},
+		{"alice", "PROPFIND", "/docs", "1", http.StatusForbidden},
+		{"alice", "PROPFIND", "/", "", http.StatusForbidden},
+		{"bob", "PROPFIND", "/docs", "1", http.StatusMultiStatus},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.depth != "" {
+			r.Header.Set("Depth", tt.depth)
+		}
+		r.SetBasicAuth(tt.user, "password")
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		if w.Code != tt.want {
+			t.Errorf("%s %s of %s with depth %q = %d, want %d", tt.method, tt.path, tt.user, tt.depth, w.Code, tt.want)
+		}
+	}
+
+	// Without ListPermission reading includes listing
+	cfg.ListPermission = false
+	r := httptest.NewRequest("PROPFIND", "/docs", nil)
+	r.Header.Set("Depth", "1")
+	r.SetBasicAuth("alice", "password")
+	w := httptest.NewRecorder()
+	handle(context.Background(), w, r, a)
+	if w.Code != http.StatusMultiStatus {
+		t.Errorf("listing of reader without ListPermission = %d, want %d", w.Code, http.StatusMultiStatus)
+	}
+}
+
+func TestUserMethods(t *testing.T) {
+	a := &App{
+		Config: &Config{
+			Users: map[string]*UserInfo{
+				"sync": {Password: GenHash([]byte("password")), Crud: newCrudType("crud"), Methods: []string{"propfind", "PUT", "DELETE"}},
+			},
+		},
+		Handler: &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()},
+	}
+	tests := []struct {
+		method string
+		want   int
+	}{
+		{http.MethodPut, http.StatusCreated},
+		{"PROPFIND", http.StatusMultiStatus},
+		{"MOVE", http.StatusMethodNotAllowed},
+		{"COPY", http.StatusMethodNotAllowed},
+		{http.MethodOptions, http.StatusOK},
+		{http.MethodDelete, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/file.txt", nil)
+		r.Header.Set("Destination", "/other.txt")
+		r.SetBasicAuth("sync", "password")
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		result := w.Result()
+		if result.StatusCode != tt.want {
+			t.Errorf("%s = %d, want %d", tt.method, result.StatusCode, tt.want)
+		}
+		// Refused requests and OPTIONS only advertise the methods of the user
+		if allow := result.Header.Get("Allow"); (tt.want == http.StatusMethodNotAllowed || tt.want == http.StatusOK) && allow != "OPTIONS, PUT, DELETE, PROPFIND" {
+			t.Errorf("Allow of %s = %q, want the methods of the user", tt.method, allow)
+		}
+	}
+	if err := validateMethods([]string{"PUT", "FETCH"}); err == nil {
+		t.Error("validateMethods() of an unknown method = nil, want an error")
+	}
+}
+
+func TestHandleGet(t *testing.T) {
+	cfg := &Config{
+		Dir: t.TempDir(),
+		Users: map[string]*UserInfo{
+			"reader": {Password: GenHash([]byte("password")), Crud: newCrudType("r")},
+			"lister": {Password: GenHash([]byte("password")), Crud: newCrudType("r"), ACL: map[string]string{"/a.txt": "l"}},
+		},
+	}
+	os.WriteFile(filepath.Join(cfg.Dir, "a.txt"), []byte("content"), 0600)
+	handler := NewBasicAuthWebdavHandler(&App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}})
+	tests := []struct {
+		user       string
+		method     string
+		statusCode int
+	}{
+		{"reader", http.MethodGet, http.StatusOK},
+		{"reader", http.MethodHead, http.StatusOK},
+		{"lister", http.MethodGet, http.StatusForbidden},
+		{"lister", http.MethodHead, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user+" "+tt.method, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/a.txt", nil)
+			r.SetBasicAuth(tt.user, "password")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.statusCode {
+				t.Errorf("%s = %d, want %d", tt.method, w.Code, tt.statusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// securityLogDay is the layout of the day appended to the names of rotated security log files.
+const securityLogDay = "2006-01-02"
+
+// SecurityLog configures the log of security events: failed logins, delayed logins, denied requests and the
+// actions of admins. They're logged as JSON lines to File, which is rotated daily and whose rotated files are
+// removed after MaxAge (kept forever if zero), and to Syslog if set: local for the local daemon or an address
+// like udp://host:514, with Facility (auth by default). Level (info by default) applies only to this log, which
+// is independent of the CRUD flags of the log.
+type SecurityLog struct {
+	File     string
+	MaxAge   time.Duration
+	Syslog   string
+	Facility string
+	Level    string
+}
+
+// securityLogger writes the security events, tenants share it.
+type securityLogger struct {
+	*log.Logger
+	file *dailyFile
+}
+
+// newSecurityLogger opens the file and connects to syslog.
+func newSecurityLogger(cfg *SecurityLog) (*securityLogger, error) {
+	if cfg.File == "" && cfg.Syslog == "" {
+		return nil, errors.New("security log without file or syslog")
+	}
+	level := log.InfoLevel
+	if cfg.Level != "" {
+		var err error
+		if level, err = log.ParseLevel(cfg.Level); err != nil {
+			return nil, err
+		}
+	}
+	l := &securityLogger{Logger: log.New()}
+	l.Formatter = &log.JSONFormatter{}
+	l.Level = level
+	l.Out = io.Discard
+	if cfg.File != "" {
+		if err := os.MkdirAll(filepath.Dir(cfg.File), 0700); err != nil {
+			return nil, err
+		}
+		l.file = &dailyFile{path: cfg.File, maxAge: cfg.MaxAge}
+		if err := l.file.open(time.Now()); err != nil {
+			return nil, err
+		}
+		l.Out = l.file
+	}
+	if cfg.Syslog != "" {
+		hook, err := newSyslogHook(cfg.Syslog, cfg.Facility)
+		if err != nil {
+			return nil, err
+		}
+		l.AddHook(hook)
+	}
+	return l, nil
+}
+
+// securityEvent logs an event to the security log if configured, regardless of the flags of the log.
+func securityEvent(cfg *Config, level log.Level, msg string, fields log.Fields) {
+	if cfg.securityLog == nil {
+		return
+	}
+	cfg.securityLog.WithFields(fields).Log(level, msg)
+}
+
+// securityDenials records the denied requests of an authenticated user as security events.
+func securityDenials(cfg *Config, w http.ResponseWriter, req *http.Request, username string) (http.ResponseWriter, func()) {
+	if cfg.securityLog == nil {
+		return w, func() {}
+	}
+	sw := &statusWriter{ResponseWriter: w}
+	return sw, func() {
+		if sw.status == http.StatusForbidden {
+			securityEvent(cfg, log.WarnLevel, "Request denied", log.Fields{"user": username, "address": cfg.sourceAddressString(req), "method": req.Method, "path": req.URL.Path})
+		}
+	}
+}
+
+// dailyFile is a log file which is rotated at midnight by renaming it after its day. Rotated files older
+// than maxAge are removed.
+type dailyFile struct {
+	mu     sync.Mutex
+	path   string
+	maxAge time.Duration
+	day    string
+	f      *os.File
+}
+
+// open opens the file, rotating it first if it was last written on an earlier day.
+func (d *dailyFile) open(now time.Time) error {
+	today := now.Format(securityLogDay)
+	if info, err := os.Stat(d.path); err == nil {
+		if day := info.ModTime().Format(securityLogDay); day != today {
+			if err := os.Rename(d.path, d.path+"."+day); err != nil {
+				return err
+			}
+		}
+	}
+	f, err := os.OpenFile(d.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	d.f, d.day = f, today
+	d.prune(now)
+	return nil
+}
+
+// prune removes the rotated files older than the maximum age.
+func (d *dailyFile) prune(now time.Time) {
+	if d.maxAge <= 0 {
+		return
+	}
+	rotated, _ := filepath.Glob(d.path + ".*")
+	for _, name := range rotated {
+		day, err := time.ParseInLocation(securityLogDay, strings.TrimPrefix(name, d.path+"."), now.Location())
+		// The day of a file ends a day after its date
+		if err == nil && now.Sub(day.AddDate(0, 0, 1)) > d.maxAge {
+			if err := os.Remove(name); err != nil {
+				log.WithError(err).WithField("path", name).Warn("Error removing rotated security log")
+			}
+		}
+	}
+}
+
+// Write appends to the file of the day.
+func (d *dailyFile) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if now.Format(securityLogDay) != d.day {
+		d.f.Close()
+		if err := d.open(now); err != nil {
+			return 0, err
+		}
+	}
+	return d.f.Write(p)
+}
@@ -0,0 +1,81 @@
+//go:build !windows
+
+package app
+
+import (
+	"fmt"
+	"log/syslog"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// syslogFacilities are the facilities security events can be logged with.
+var syslogFacilities = map[string]syslog.Priority{
+	"auth":     syslog.LOG_AUTH,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"daemon":   syslog.LOG_DAEMON,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// syslogHook sends the entries of a logger to syslog.
+type syslogHook struct {
+	writer *syslog.Writer
+}
+
+// newSyslogHook connects to the local syslog daemon (local) or the one at the address (like udp://host:514).
+func newSyslogHook(address, facility string) (*syslogHook, error) {
+	priority := syslog.LOG_AUTH
+	if facility != "" {
+		p, ok := syslogFacilities[strings.ToLower(facility)]
+		if !ok {
+			return nil, fmt.Errorf("unknown syslog facility %s", facility)
+		}
+		priority = p
+	}
+	network, raddr := "", ""
+	if address != "local" {
+		u, err := url.Parse(address)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid syslog address %s", address)
+		}
+		network, raddr = u.Scheme, u.Host
+	}
+	writer, err := syslog.Dial(network, raddr, priority|syslog.LOG_INFO, "david")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogHook{writer: writer}, nil
+}
+
+// Levels returns all levels, the level of the logger filters the entries.
+func (h *syslogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire sends the entry with the severity of its level.
+func (h *syslogHook) Fire(entry *log.Entry) error {
+	line, err := entry.String()
+	if err != nil {
+		return err
+	}
+	switch entry.Level {
+	case log.PanicLevel, log.FatalLevel:
+		return h.writer.Crit(line)
+	case log.ErrorLevel:
+		return h.writer.Err(line)
+	case log.WarnLevel:
+		return h.writer.Warning(line)
+	case log.InfoLevel:
+		return h.writer.Info(line)
+	}
+	return h.writer.Debug(line)
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestSecurityLog(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "security.log")
+	logger, err := newSecurityLogger(&SecurityLog{File: file})
+	if err != nil {
+		t.Fatalf("newSecurityLogger() error = %v", err)
+	}
+	cfg := &Config{
+		Dir: t.TempDir(),
+		Users: map[string]*UserInfo{
+			"foo": {Password: GenHash([]byte("password")), Crud: newCrudType("r")},
+		},
+		Security:    &Security{AuthDelays: []time.Duration{time.Millisecond}},
+		securityLog: logger,
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+
+	tests := []struct {
+		name     string
+		method   string
+		password string
+		want     int
+		logged   []string
+	}{
+		{"failed login", http.MethodPut, "wrong", http.StatusUnauthorized, []string{`"msg":"Login failed"`, `"msg":"Delaying response to failed login"`}},
+		{"denied request", http.MethodPut, "password", http.StatusForbidden, []string{`"method":"PUT","msg":"Request denied","path":"/file.txt"`}},
+		{"allowed request", "PROPFIND", "password", http.StatusMultiStatus, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, _ := os.ReadFile(file)
+			r := httptest.NewRequest(tt.method, "/file.txt", strings.NewReader("content"))
+			if tt.method == "PROPFIND" {
+				r = httptest.NewRequest(tt.method, "/", nil)
+			}
+			r.SetBasicAuth("foo", tt.password)
+			// The header of a client which isn't a trusted proxy doesn't change the logged address
+			r.Header.Set("X-Forwarded-For", "198.51.100.7")
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, r, a)
+			if w.Code != tt.want {
+				t.Fatalf("%s = %d, want %d", tt.method, w.Code, tt.want)
+			}
+			content, _ := os.ReadFile(file)
+			added := strings.Split(strings.TrimSpace(string(content[len(before):])), "\n")
+			if len(tt.logged) == 0 && strings.TrimSpace(string(content[len(before):])) != "" {
+				t.Errorf("logged %s, want nothing", content[len(before):])
+			}
+			if len(tt.logged) != 0 && len(added) != len(tt.logged) {
+				t.Fatalf("logged %q, want %q", added, tt.logged)
+			}
+			for i, want := range tt.logged {
+				if !strings.Contains(added[i], want) || !strings.Contains(added[i], `"user":"foo"`) {
+					t.Errorf("logged %s, want %s of foo", added[i], want)
+				}
+				if !strings.Contains(added[i], `"address":"192.0.2.1"`) {
+					t.Errorf("logged %s, want address of client", added[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDailyFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "security.log")
+	now := time.Now()
+	old := now.AddDate(0, 0, -40).Format(securityLogDay)
+	recent := now.AddDate(0, 0, -2).Format(securityLogDay)
+	os.WriteFile(name+"."+old, []byte("old\n"), 0600)
+	os.WriteFile(name+"."+recent, []byte("recent\n"), 0600)
+	// The current file was last written yesterday, so it's rotated when opened
+	os.WriteFile(name, []byte("yesterday\n"), 0600)
+	yesterday := now.AddDate(0, 0, -1)
+	os.Chtimes(name, yesterday, yesterday)
+
+	d := &dailyFile{path: name, maxAge: 30 * 24 * time.Hour}
+	if err := d.open(now); err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+	d.Write([]byte("today\n"))
+	d.f.Close()
+
+	for file, want := range map[string]string{
+		name + "." + old:    "",
+		name + "." + recent: "recent\n",
+		name + "." + yesterday.Format(securityLogDay): "yesterday\n",
+		name: "today\n",
+	} {
+		content, err := os.ReadFile(file)
+		if want == "" && !os.IsNotExist(err) || want != "" && string(content) != want {
+			t.Errorf("%s = %q, %v, want %q", filepath.Base(file), content, err, want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package app
+
+import (
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// newSyslogHook fails, there is no syslog on Windows.
+func newSyslogHook(address, facility string) (log.Hook, error) {
+	return nil, errors.New("syslog isn't supported on windows")
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// Rounds of SHA-crypt, as defined by its specification.
+const (
+	shaCryptDefaultRounds = 5000
+	shaCryptMinRounds     = 1000
+	shaCryptMaxRounds     = 999999999
+)
+
+// shaCryptAlphabet is the alphabet of the base64 encoding of crypt(3).
+const shaCryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// shaCryptOrder is the order the bytes of the SHA-256 and SHA-512 digests are encoded in, in groups of three.
+var shaCryptOrder = map[int][]int{
+	sha256.Size: {0, 10, 20, 21, 1, 11, 12, 22, 2, 3, 13, 23, 24, 4, 14, 15, 25, 5, 6, 16, 26, 27, 7, 17, 18, 28, 8, 9, 19, 29},
+	sha512.Size: {0, 21, 42, 22, 43, 1, 44, 2, 23, 3, 24, 45, 25, 46, 4, 47, 5, 26, 6, 27, 48, 28, 49, 7, 50, 8, 29, 9, 30, 51,
+		31, 52, 10, 53, 11, 32, 12, 33, 54, 34, 55, 13, 56, 14, 35, 15, 36, 57, 37, 58, 16, 59, 17, 38, 18, 39, 60, 40, 61, 19,
+		62, 20, 41},
+}
+
+// errUnsupportedCrypt is returned for crypt(3) hashes other than SHA-crypt and bcrypt, like yescrypt.
+var errUnsupportedCrypt = errors.New("unsupported crypt hash, use sha512crypt or bcrypt")
+
+// isShaCrypt reports whether a hash of crypt(3) is a SHA-256 ($5$) or SHA-512 ($6$) one.
+func isShaCrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$5$") || strings.HasPrefix(hash, "$6$")
+}
+
+// verifyShaCrypt compares a SHA-crypt hash with a password in constant time.
+func verifyShaCrypt(hash, password string) error {
+	parts := strings.Split(hash, "$")
+	if len(parts) < 4 || len(parts) > 5 {
+		return errors.New("malformed sha-crypt hash")
+	}
+	newHash := sha512.New
+	if parts[1] == "5" {
+		newHash = sha256.New
+	}
+	rounds, custom := shaCryptDefaultRounds, false
+	salt := parts[2]
+	if len(parts) == 5 {
+		value, ok := strings.CutPrefix(parts[2], "rounds=")
+		n, err := strconv.Atoi(value)
+		if !ok || err != nil {
+			return errors.New("malformed rounds of sha-crypt hash")
+		}
+		rounds, custom, salt = min(max(n, shaCryptMinRounds), shaCryptMaxRounds), true, parts[3]
+	}
+	computed := shaCrypt(newHash, parts[1], []byte(password), []byte(salt), rounds, custom)
+	if subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) != 1 {
+		return errors.New("password doesn't match")
+	}
+	return nil
+}
+
+// shaCrypt computes the SHA-crypt hash of a password, following the specification of Ulrich Drepper. The salt
+// is truncated to 16 bytes, the rounds are only part of the hash if they were given explicitly.
+func shaCrypt(newHash func() hash.Hash, id string, password, salt []byte, rounds int, custom bool) string {
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+	h := newHash()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(password)
+	b := h.Sum(nil)
+
+	a := newHash()
+	a.Write(password)
+	a.Write(salt)
+	for n := len(password); n > 0; n -= len(b) {
+		a.Write(b[:min(n, len(b))])
+	}
+	for n := len(password); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(b)
+		} else {
+			a.Write(password)
+		}
+	}
+	digest := a.Sum(nil)
+
+	h.Reset()
+	for range password {
+		h.Write(password)
+	}
+	p := repeatBytes(h.Sum(nil), len(password))
+	h.Reset()
+	for i := 0; i < 16+int(digest[0]); i++ {
+		h.Write(salt)
+	}
+	s := repeatBytes(h.Sum(nil), len(salt))
+
+	for i := 0; i < rounds; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(digest)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(digest)
+		} else {
+			h.Write(p)
+		}
+		digest = h.Sum(digest[:0])
+	}
+
+	var out strings.Builder
+	out.WriteString("$" + id + "$")
+	if custom {
+		out.WriteString("rounds=" + strconv.Itoa(rounds) + "$")
+	}
+	out.Write(salt)
+	out.WriteByte('$')
+	order := shaCryptOrder[len(digest)]
+	for i := 0; i+2 < len(order); i += 3 {
+		encodeCrypt64(&out, uint(digest[order[i]])<<16|uint(digest[order[i+1]])<<8|uint(digest[order[i+2]]), 4)
+	}
+	if len(digest) == sha512.Size {
+		encodeCrypt64(&out, uint(digest[63]), 2)
+	} else {
+		encodeCrypt64(&out, uint(digest[31])<<8|uint(digest[30]), 3)
+	}
+	return out.String()
+}
+
+// repeatBytes returns b repeated to the length n.
+func repeatBytes(b []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, b[:min(len(b), n-len(out))]...)
+	}
+	return out
+}
+
+// encodeCrypt64 writes the lowest 6*n bits of w in the base64 encoding of crypt(3), least significant first.
+func encodeCrypt64(out *strings.Builder, w uint, n int) {
+	for ; n > 0; n-- {
+		out.WriteByte(shaCryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+}
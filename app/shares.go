@@ -0,0 +1,525 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// Endpoints of the share links, relative to the configured prefix: authenticated users manage their links at
+// sharesEndpoint, anyone holding a token uses the link below shareEndpoint.
+const (
+	sharesEndpoint = "/_shares"
+	shareEndpoint  = "/s"
+)
+
+// Permissions of a share link: uploads add files to the shared directory itself, drop-boxes files and
+// directories anywhere below it. Neither can read anything.
+const (
+	shareRead    = "read"
+	shareUpload  = "upload"
+	shareDropbox = "dropbox"
+)
+
+// shareReadMethods are refused with 403 Forbidden by drop-box links, which mustn't reveal their contents.
+var shareReadMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, Propfind: true, Search: true, Report: true,
+}
+
+// shareRealm is the realm of the Basic auth asking for the password of a share link.
+const shareRealm = "share"
+
+// Shares configures the SQLite database File keeping the share links, which grant access to a path of a user
+// to anyone holding their token. MaxExpiry limits their lifetime, zero allows links which don't expire.
+type Shares struct {
+	File      string
+	MaxExpiry time.Duration
+}
+
+// share is a link to a file or directory of a user. Expires is zero for links which don't expire, Password
+// is the hash of the optional password.
+type share struct {
+	Token      string    `json:"token"`
+	User       string    `json:"user"`
+	Path       string    `json:"path"`
+	Permission string    `json:"permission"`
+	Password   string    `json:"-"`
+	Protected  bool      `json:"protected"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires,omitempty"`
+	URL        string    `json:"url,omitempty"`
+}
+
+// shareRequest is the JSON body creating a share link, Expires is a duration like "24h".
+type shareRequest struct {
+	Path       string `json:"path"`
+	Permission string `json:"permission"`
+	Password   string `json:"password"`
+	Expires    string `json:"expires"`
+}
+
+// sharesSchema creates the table of the share links, times are unix seconds with zero for no expiry.
+var sharesSchema = []string{
+	`CREATE TABLE IF NOT EXISTS david_shares (
+		token TEXT PRIMARY KEY,
+		username TEXT NOT NULL,
+		path TEXT NOT NULL,
+		permission TEXT NOT NULL,
+		password TEXT NOT NULL DEFAULT '',
+		created INTEGER NOT NULL,
+		expires INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS david_shares_username ON david_shares (username)`,
+}
+
+// shareStore keeps the share links in a SQLite database.
+type shareStore struct {
+	db *sql.DB
+}
+
+// openShareStore opens the database of the share links and creates its table if necessary.
+func openShareStore(cfg *Shares) (*shareStore, error) {
+	db, err := sql.Open("sqlite", cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite doesn't allow concurrent writers, a single connection serializes them
+	db.SetMaxOpenConns(1)
+	for _, statement := range sharesSchema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &shareStore{db: db}, nil
+}
+
+// unixOrZero returns the unix seconds of t, zero for the zero time.
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// timeOrZero returns the time of unix seconds, the zero time for zero.
+func timeOrZero(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0).UTC()
+}
+
+// put stores a new share link.
+func (s *shareStore) put(sh *share) error {
+	_, err := s.db.Exec(`INSERT INTO david_shares (token, username, path, permission, password, created, expires) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		sh.Token, sh.User, sh.Path, sh.Permission, sh.Password, sh.Created.Unix(), unixOrZero(sh.Expires))
+	return err
+}
+
+// scanShare reads the share link of a row.
+func scanShare(row interface{ Scan(...any) error }) (*share, error) {
+	var sh share
+	var created, expires int64
+	if err := row.Scan(&sh.Token, &sh.User, &sh.Path, &sh.Permission, &sh.Password, &created, &expires); err != nil {
+		return nil, err
+	}
+	sh.Created, sh.Expires, sh.Protected = timeOrZero(created), timeOrZero(expires), sh.Password != ""
+	return &sh, nil
+}
+
+// get returns the share link of a token, nil if there's none.
+func (s *shareStore) get(token string) (*share, error) {
+	sh, err := scanShare(s.db.QueryRow(`SELECT token, username, path, permission, password, created, expires FROM david_shares WHERE token = ?`, token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return sh, err
+}
+
+// list returns the share links of a user, the ones of all users for an empty username.
+func (s *shareStore) list(username string) ([]*share, error) {
+	rows, err := s.db.Query(`SELECT token, username, path, permission, password, created, expires FROM david_shares WHERE ? = '' OR username = ? ORDER BY created`, username, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	shares := []*share{}
+	for rows.Next() {
+		sh, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, sh)
+	}
+	return shares, rows.Err()
+}
+
+// delete removes a share link, it reports whether it existed.
+func (s *shareStore) delete(token string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM david_shares WHERE token = ?`, token)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// allowedBy reports whether the permissions of a user allow what the share link grants.
+func (sh *share) allowedBy(crud *CrudType) bool {
+	if crud == nil {
+		return false
+	}
+	if sh.Permission == shareRead {
+		return crud.Read
+	}
+	return crud.Create
+}
+
+// expired reports whether the share link expired at now.
+func (sh *share) expired(now time.Time) bool {
+	return !sh.Expires.IsZero() && !now.Before(sh.Expires)
+}
+
+// newShareToken returns a random token of 128 bits.
+func newShareToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// shareURL returns the link of a token on the host of the request.
+func shareURL(cfg *Config, req *http.Request, token string) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host + cfg.Prefix + shareEndpoint + "/" + token
+}
+
+// isShareRequest reports whether the request uses a share link.
+func isShareRequest(cfg *Config, req *http.Request) bool {
+	return cfg.shares != nil && hasPathPrefix(strings.TrimPrefix(req.URL.Path, cfg.Prefix), shareEndpoint)
+}
+
+// handleSharesRequest lists the links of the authenticated user at the endpoint itself (those of all users
+// for admins), creates one with POST and revokes one below it with DELETE. Users can only share what they
+// may access themselves: reading needs the read permission, uploads the create permission.
+func handleSharesRequest(a *App, ctx context.Context, w http.ResponseWriter, req *http.Request, authInfo *AuthInfo) {
+	store := a.Config.shares
+	user := a.Config.user(authInfo.Username)
+	admin := user != nil && user.Admin
+	token := strings.Trim(strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, a.Config.Prefix), sharesEndpoint), "/")
+
+	if token != "" {
+		if req.Method != http.MethodDelete {
+			handleMethodNotAllowed(ctx, w, req, http.MethodDelete)
+			return
+		}
+		sh, err := store.get(token)
+		if err != nil {
+			log.WithError(err).Error("Error reading share link")
+			http.Error(w, "error reading share link", http.StatusInternalServerError)
+			return
+		}
+		// Links of others are hidden, their tokens mustn't be probed
+		if sh == nil || sh.User != authInfo.Username && !admin {
+			http.Error(w, "share link not found", http.StatusNotFound)
+			return
+		}
+		if _, err := store.delete(token); err != nil {
+			log.WithError(err).Error("Error deleting share link")
+			http.Error(w, "error deleting share link", http.StatusInternalServerError)
+			return
+		}
+		writeAudit(a.Config, AuditEntry{User: authInfo.Username, Action: "share-revoke", Path: sh.Path, Detail: "link of " + sh.User + " for " + sh.Permission})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		username := authInfo.Username
+		if admin {
+			username = ""
+		}
+		shares, err := store.list(username)
+		if err != nil {
+			log.WithError(err).Error("Error listing share links")
+			http.Error(w, "error listing share links", http.StatusInternalServerError)
+			return
+		}
+		for _, sh := range shares {
+			sh.URL = shareURL(a.Config, req, sh.Token)
+		}
+		writeJSON(w, shares)
+	case http.MethodPost:
+		var body shareRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Path == "" {
+			http.Error(w, "invalid share link", http.StatusBadRequest)
+			return
+		}
+		sh := &share{User: authInfo.Username, Path: path.Clean("/" + body.Path), Permission: body.Permission, Created: time.Now().UTC()}
+		if sh.Permission == "" {
+			sh.Permission = shareRead
+		}
+		// The ACL of the user may grant other permissions at the path
+		dir := Dir{a.Config}
+		filePath := Resolve(ctx, sh.Path, dir)
+		switch {
+		case sh.Permission != shareRead && sh.Permission != shareUpload && sh.Permission != shareDropbox:
+			http.Error(w, "permission has to be read, upload or dropbox", http.StatusBadRequest)
+			return
+		case !sh.allowedBy(dir.crudAt(ctx, filePath)):
+			writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges)
+			return
+		}
+		info, err := os.Stat(filePath)
+		if err != nil || sh.Permission != shareRead && !info.IsDir() || dir.hiddenFromUser(ctx, filePath) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+
+		// Determine the lifetime of the link, bounded by the configured maximum
+		expiry := a.Config.Shares.MaxExpiry
+		if body.Expires != "" {
+			d, err := time.ParseDuration(body.Expires)
+			if err != nil || d <= 0 {
+				http.Error(w, "invalid expires", http.StatusBadRequest)
+				return
+			}
+			if expiry == 0 || d < expiry {
+				expiry = d
+			}
+		}
+		if expiry > 0 {
+			sh.Expires = sh.Created.Add(expiry)
+		}
+		if body.Password != "" {
+			if sh.Password, err = a.Config.genHash([]byte(body.Password)); err != nil {
+				http.Error(w, "invalid password", http.StatusBadRequest)
+				return
+			}
+			sh.Protected = true
+		}
+		if sh.Token, err = newShareToken(); err == nil {
+			err = store.put(sh)
+		}
+		if err != nil {
+			log.WithError(err).Error("Error creating share link")
+			http.Error(w, "error creating share link", http.StatusInternalServerError)
+			return
+		}
+		writeAudit(a.Config, AuditEntry{User: authInfo.Username, Action: "share-create", Path: sh.Path, Detail: "link for " + sh.Permission})
+		sh.URL = shareURL(a.Config, req, sh.Token)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(sh)
+	default:
+		handleMethodNotAllowed(ctx, w, req, http.MethodGet, http.MethodPost)
+	}
+}
+
+// serveShare serves a request of a share link without Basic auth of a user: files are downloaded and
+// directories listed below links for reading, files are created in the directory of links for uploads. The
+// accesses are recorded in the audit log.
+func serveShare(a *App, w http.ResponseWriter, req *http.Request) {
+	token, rel, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, a.Config.Prefix), shareEndpoint+"/"), "/")
+	sh, err := a.Config.shares.get(token)
+	if err != nil {
+		log.WithError(err).Error("Error reading share link")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if sh == nil || sh.expired(time.Now()) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if sh.Password != "" {
+		// Guessing the password of a link is slowed down and locked out like the one of a user. The link is
+		// counted by the start of its token, which is a secret itself.
+		link := "link " + token[:min(8, len(token))]
+		if rejectLockedOutAccount(a.Config, w, req, link) {
+			return
+		}
+		_, password, ok := req.BasicAuth()
+		if !ok || verifyPassword(sh.Password, PepperPassword(password, a.Config.pepper)) != nil {
+			if ok {
+				address := a.Config.failureAddress(req)
+				log.WithFields(log.Fields{"link": link, "user": sh.User, "address": address}).Warn("Wrong password of share link")
+				logFailedLogin(a.Config, req, link)
+				securityEvent(a.Config, log.WarnLevel, "Wrong password of share link", log.Fields{"link": link, "user": sh.User, "address": address})
+				tarpitFailure(a.Config, req, link)
+			}
+			SayUnauthorized(w, shareRealm)
+			return
+		}
+		a.Config.authFailureCounter().reset(authFailureKey(a.Config.failureAddress(req), link))
+	}
+
+	// The sharing user must still exist and still be allowed to do what the link grants
+	user := a.Config.user(sh.User)
+	if user == nil || user.Disabled || user.expired(time.Now()) || !sh.allowedBy(user.Crud) {
+		log.WithFields(log.Fields{"path": sh.Path, "user": sh.User}).Warn("Share link of a user without the permission")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	// The files of encrypted users are only served with their key, which is only at hand with a key file
+	fs, err := a.Config.userFileSystem(sh.User)
+	if err != nil {
+		log.WithFields(log.Fields{"path": sh.Path, "user": sh.User}).WithError(err).Warn("Share link of an encrypted user")
+		writeDAVError(w, http.StatusForbidden, conditionOperationDenied)
+		return
+	}
+	ctx := context.WithValue(req.Context(), authInfoKey, &AuthInfo{Username: sh.User, Authenticated: true, CrudType: user.Crud})
+	name := path.Join(sh.Path, path.Clean("/"+rel))
+	dir := Dir{a.Config}
+	filePath := Resolve(ctx, name, dir)
+	// Files of others in owner-only directories don't exist for the sharing user, nor below its link
+	if filePath == "" || dir.hiddenFromUser(ctx, filePath) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	// Neither do paths the ACL of the user doesn't allow what the link grants
+	if !sh.allowedBy(dir.crudAt(ctx, filePath)) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	address, _ := a.Config.sourceAddress(req)
+	detail := "link " + token[:min(8, len(token))] + " from " + address.String()
+
+	switch {
+	case sh.Permission == shareRead && (req.Method == http.MethodGet || req.Method == http.MethodHead):
+		// Files are read like by any request of the user, decrypted and without the ones hidden from them
+		f, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// Directories are only listed if the sharing user may list them
+		if info.IsDir() && !a.Config.mayList(dir.crudAt(ctx, filePath)) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		writeAudit(a.Config, AuditEntry{User: sh.User, Action: "share-read", Path: name, Detail: detail})
+		if info.IsDir() {
+			serveShareListing(w, f)
+			return
+		}
+		sw := &statusWriter{ResponseWriter: w}
+		http.ServeContent(sw, req, info.Name(), info.ModTime(), f)
+		usage.record(sh.User, req.Method, 0, sw.written.Load())
+	case sh.Permission == shareUpload && req.Method == http.MethodPut:
+		// Uploads only add files directly in the shared directory
+		if rel == "" || strings.Contains(rel, "/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		receiveShareUpload(ctx, a, w, req, fs, sh, name, detail)
+	case sh.Permission == shareDropbox && shareReadMethods[req.Method]:
+		log.WithFields(log.Fields{"path": name, "user": sh.User, "method": req.Method}).Debug("Refused reading drop-box link")
+		writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges)
+	case sh.Permission == shareDropbox && rel != "" && req.Method == http.MethodPut:
+		receiveShareUpload(ctx, a, w, req, fs, sh, name, detail)
+	case sh.Permission == shareDropbox && rel != "" && req.Method == "MKCOL":
+		if err := fs.Mkdir(ctx, name, 0700); errors.Is(err, os.ErrExist) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		writeAudit(a.Config, AuditEntry{User: sh.User, Action: "share-mkcol", Path: name, Detail: detail})
+		w.WriteHeader(http.StatusCreated)
+	default:
+		allowed := []string{http.MethodGet, http.MethodHead}
+		switch sh.Permission {
+		case shareUpload:
+			allowed = []string{http.MethodPut}
+		case shareDropbox:
+			allowed = []string{http.MethodPut, "MKCOL"}
+		}
+		handleMethodNotAllowed(req.Context(), w, req, allowed...)
+	}
+}
+
+// receiveShareUpload writes the body of an upload to a share link to a new file, existing files are never
+// replaced. It's written like by any request of the user, encrypted and with the checks of the file system.
+func receiveShareUpload(ctx context.Context, a *App, w http.ResponseWriter, req *http.Request, fs webdav.FileSystem, sh *share, name, detail string) {
+	if _, err := fs.Stat(ctx, name); !errors.Is(err, os.ErrNotExist) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	f, err := fs.OpenFile(ctx, name, os.O_RDWR|os.O_CREATE|os.O_EXCL|os.O_TRUNC, 0600)
+	if err != nil {
+		// The file exists already, its parent collection doesn't (RFC 4918, section 9.7.1) or it can't be written
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	body := io.Reader(req.Body)
+	if limit := a.Config.uploadLimit(sh.User); limit > 0 {
+		body = http.MaxBytesReader(w, req.Body, limit)
+	}
+	written, err := io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if filePath := Resolve(ctx, name, Dir{a.Config}); filePath != "" {
+			Dir{a.Config}.storage().RemoveAll(filePath)
+		}
+		log.WithError(err).WithFields(log.Fields{"path": name, "user": sh.User}).Warn("Error uploading to share link")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	writeAudit(a.Config, AuditEntry{User: sh.User, Action: "share-upload", Path: name, Detail: detail})
+	usage.record(sh.User, req.Method, written, 0)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// shareEntry is an entry of the listing of a shared directory.
+type shareEntry struct {
+	Name     string    `json:"name"`
+	Dir      bool      `json:"dir"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// serveShareListing answers with the entries of a shared directory as JSON, hidden files are left out. The
+// directory was opened by the Dir of the user, which leaves out the files hidden from them.
+func serveShareListing(w http.ResponseWriter, dir webdav.File) {
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	entries := []shareEntry{}
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		entries = append(entries, shareEntry{Name: filepath.Base(info.Name()), Dir: info.IsDir(), Size: info.Size(), Modified: info.ModTime().UTC()})
+	}
+	writeJSON(w, entries)
+}
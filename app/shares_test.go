@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShares(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "subdir1", "inbox"), 0700)
+	os.WriteFile(filepath.Join(dir, "subdir1", "report.txt"), []byte("content"), 0600)
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	cfg := createTestConfig(dir)
+	cfg.Users["user1"].Password = GenHash([]byte("password"))
+	cfg.Users["user2"].Password = GenHash([]byte("password"))
+	cfg.Shares = &Shares{File: filepath.Join(t.TempDir(), "shares.db"), MaxExpiry: time.Hour}
+	cfg.Audit = &Audit{File: auditFile}
+	store, err := openShareStore(cfg.Shares)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.shares = store
+	a := &App{Config: cfg}
+
+	request := func(method, url, username, password, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		if username != "" || password != "" {
+			r.SetBasicAuth(username, password)
+		}
+		handle(context.Background(), w, r, a)
+		return w
+	}
+	create := func(body string) *share {
+		w := request(http.MethodPost, "/_shares", "user1", "password", body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("creating share link %s = %d", body, w.Code)
+		}
+		var sh share
+		json.NewDecoder(w.Body).Decode(&sh)
+		return &sh
+	}
+
+	read := create(`{"path": "/report.txt", "expires": "10m"}`)
+	if read.Permission != shareRead || read.Expires.IsZero() || !strings.HasSuffix(read.URL, "/s/"+read.Token) {
+		t.Errorf("created share link = %+v", read)
+	}
+	if w := request(http.MethodGet, "/s/"+read.Token, "", "", ""); w.Code != http.StatusOK || w.Body.String() != "content" {
+		t.Errorf("GET of read link = %d %q", w.Code, w.Body.String())
+	}
+	if w := request(http.MethodPut, "/s/"+read.Token, "", "", "x"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT to read link = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if w := request(http.MethodGet, "/s/unknown", "", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET of unknown link = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	protected := create(`{"path": "/", "password": "letmein"}`)
+	if w := request(http.MethodGet, "/s/"+protected.Token+"/report.txt", "", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET of protected link without password = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := request(http.MethodGet, "/s/"+protected.Token+"/report.txt", "", "letmein", ""); w.Code != http.StatusOK {
+		t.Errorf("GET of protected link with password = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := request(http.MethodGet, "/s/"+protected.Token+"/../subdir2", "", "letmein", ""); w.Code == http.StatusOK && strings.Contains(w.Body.String(), "subdir") {
+		t.Errorf("link escaped the shared directory: %s", w.Body.String())
+	}
+	// Directories are only listed if the sharing user may list them
+	if w := request(http.MethodGet, "/s/"+protected.Token, "", "letmein", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "report.txt") {
+		t.Errorf("GET of protected directory = %d %s, want the listing", w.Code, w.Body.String())
+	}
+	cfg.ListPermission = true
+	if w := request(http.MethodGet, "/s/"+protected.Token, "", "letmein", ""); w.Code != http.StatusForbidden {
+		t.Errorf("GET of directory without list permission = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	cfg.ListPermission = false
+	// Guessing the password is locked out like logins, even the right one is refused then
+	cfg.Security = &Security{LockoutThreshold: 2}
+	for i := 0; i < 2; i++ {
+		if w := request(http.MethodGet, "/s/"+protected.Token+"/report.txt", "", "guess", ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("GET of protected link with wrong password = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	}
+	if w := request(http.MethodGet, "/s/"+protected.Token+"/report.txt", "", "letmein", ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("GET of protected link after guessing = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	cfg.Security = nil
+
+	upload := create(`{"path": "/inbox", "permission": "upload"}`)
+	if w := request(http.MethodPut, "/s/"+upload.Token+"/photo.jpg", "", "", "photo"); w.Code != http.StatusCreated {
+		t.Errorf("PUT to upload link = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "subdir1", "inbox", "photo.jpg")); string(content) != "photo" {
+		t.Errorf("uploaded content = %q", content)
+	}
+	if w := request(http.MethodPut, "/s/"+upload.Token+"/photo.jpg", "", "", "other"); w.Code != http.StatusConflict {
+		t.Errorf("PUT replacing a file = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := request(http.MethodGet, "/s/"+upload.Token+"/photo.jpg", "", "", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET of upload link = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	dropbox := create(`{"path": "/inbox", "permission": "dropbox"}`)
+	for _, step := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"MKCOL", "/batch", "", http.StatusCreated},
+		{http.MethodPut, "/batch/large.bin", "large", http.StatusCreated},
+		{http.MethodPut, "/missing/large.bin", "large", http.StatusConflict},
+		{http.MethodGet, "/batch/large.bin", "", http.StatusForbidden},
+		{http.MethodHead, "/photo.jpg", "", http.StatusForbidden},
+		{"PROPFIND", "/", "", http.StatusForbidden},
+		{http.MethodDelete, "/batch/large.bin", "", http.StatusMethodNotAllowed},
+	} {
+		if w := request(step.method, "/s/"+dropbox.Token+step.path, "", "", step.body); w.Code != step.want {
+			t.Errorf("%s %s of drop-box link = %d, want %d", step.method, step.path, w.Code, step.want)
+		}
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "subdir1", "inbox", "batch", "large.bin")); string(content) != "large" {
+		t.Errorf("content dropped = %q", content)
+	}
+
+	// Links are listed and revoked by their owner only
+	if w := request(http.MethodDelete, "/_shares/"+read.Token, "user2", "password", ""); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE of the link of another user = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	w := request(http.MethodGet, "/_shares", "user1", "password", "")
+	var listed []share
+	if json.NewDecoder(w.Body).Decode(&listed); len(listed) != 4 {
+		t.Errorf("listed %d share links, want 4", len(listed))
+	}
+	if w := request(http.MethodDelete, "/_shares/"+read.Token, "user1", "password", ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE of own link = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if w := request(http.MethodGet, "/s/"+read.Token, "", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET of revoked link = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	if w := request(http.MethodPost, "/_shares", "user1", "password", `{"path": "/report.txt", "permission": "upload"}`); w.Code != http.StatusNotFound {
+		t.Errorf("upload link to a file = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	entries, _ := readAuditEntries(auditFile)
+	actions := map[string]int{}
+	for _, entry := range entries {
+		actions[entry.Action]++
+	}
+	if actions["share-create"] != 4 || actions["share-read"] != 3 || actions["share-upload"] != 2 || actions["share-revoke"] != 1 {
+		t.Errorf("audited actions = %v", actions)
+	}
+}
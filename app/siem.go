@@ -0,0 +1,253 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Formats of the events exported to a SIEM.
+const (
+	siemFormatCEF  = "cef"
+	siemFormatLEEF = "leef"
+)
+
+// Identification of the device in the exported events.
+const (
+	siemVendor  = "audstanley"
+	siemProduct = "david"
+	siemVersion = "1.0.0"
+)
+
+// siemQueueSize bounds the events waiting to be sent, further ones are dropped while the SIEM is unreachable.
+const siemQueueSize = 1000
+
+// siemRetryInterval is the time between the attempts to reconnect to the SIEM.
+const siemRetryInterval = 10 * time.Second
+
+// SIEM configures the export of the audit entries, file operations and failed logins to a SIEM at Address
+// (host:port). Network is udp (default) or tcp, Format is cef (ArcSight Common Event Format, default) or leef
+// (QRadar Log Event Extended Format). Syslog prefixes the events with a syslog header, as most collectors expect.
+type SIEM struct {
+	Address string
+	Network string
+	Format  string
+	Syslog  bool
+}
+
+// siemEvent is an event in the terms of a SIEM, mapped to the standard fields of the formats.
+type siemEvent struct {
+	Time        time.Time
+	ID          string
+	Name        string
+	Severity    int
+	User        string
+	Address     string
+	Path        string
+	Destination string
+	Outcome     string
+	Detail      string
+}
+
+// siemSink sends the events to the SIEM in the background, tenants share it.
+type siemSink struct {
+	config   *SIEM
+	hostname string
+	events   chan siemEvent
+}
+
+// newSIEMSink validates the configuration and creates the sink, its sender is started by start.
+func newSIEMSink(cfg *SIEM) (*siemSink, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("siem without address")
+	}
+	switch cfg.Network {
+	case "":
+		cfg.Network = "udp"
+	case "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("unsupported siem network %s", cfg.Network)
+	}
+	switch cfg.Format = strings.ToLower(cfg.Format); cfg.Format {
+	case "":
+		cfg.Format = siemFormatCEF
+	case siemFormatCEF, siemFormatLEEF:
+	default:
+		return nil, fmt.Errorf("unsupported siem format %s", cfg.Format)
+	}
+	hostname, _ := os.Hostname()
+	return &siemSink{config: cfg, hostname: hostname, events: make(chan siemEvent, siemQueueSize)}, nil
+}
+
+// send queues the event, it's dropped if the queue is full.
+func (s *siemSink) send(event siemEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	select {
+	case s.events <- event:
+	default:
+		metrics.Add("david_siem_dropped_total", "Events dropped because the SIEM was unreachable.", 1)
+	}
+}
+
+// start starts sending the queued events. The connection is reestablished when writing fails, the event
+// is sent again on the new connection.
+func (s *siemSink) start() {
+	go func() {
+		var conn net.Conn
+		for event := range s.events {
+			line := s.format(event)
+			for {
+				if conn == nil {
+					c, err := net.DialTimeout(s.config.Network, s.config.Address, siemRetryInterval)
+					if err != nil {
+						log.WithError(err).WithField("address", s.config.Address).Warn("Error connecting to SIEM")
+						time.Sleep(siemRetryInterval)
+						continue
+					}
+					conn = c
+				}
+				conn.SetWriteDeadline(time.Now().Add(siemRetryInterval))
+				if _, err := conn.Write(line); err != nil {
+					log.WithError(err).WithField("address", s.config.Address).Warn("Error sending event to SIEM")
+					conn.Close()
+					conn = nil
+					continue
+				}
+				break
+			}
+		}
+	}()
+}
+
+// format returns the event in the configured format, framed for the network: datagrams carry one event each,
+// streams separate them by newlines.
+func (s *siemSink) format(event siemEvent) []byte {
+	var line string
+	if s.config.Format == siemFormatLEEF {
+		line = formatLEEF(event)
+	} else {
+		line = formatCEF(event)
+	}
+	if s.config.Syslog {
+		// Facility security/authorization (10), the severities of the SIEM formats don't map to syslog
+		line = fmt.Sprintf("<%d>%s %s %s: %s", 10*8+siemSyslogSeverity(event.Severity), event.Time.Format(time.RFC3339), s.hostname, siemProduct, line)
+	}
+	if s.config.Network == "tcp" {
+		line += "\n"
+	}
+	return []byte(line)
+}
+
+// siemSyslogSeverity maps the severity of an event (0 to 10) to a syslog severity.
+func siemSyslogSeverity(severity int) int {
+	switch {
+	case severity >= 7:
+		return 4 // warning
+	case severity >= 4:
+		return 5 // notice
+	}
+	return 6 // informational
+}
+
+// cefHeaderEscaper escapes the fields of the header of CEF events.
+var cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r", " ", "\n", " ")
+
+// cefValueEscaper escapes the values of the extension of CEF events.
+var cefValueEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r", `\r`, "\n", `\n`)
+
+// formatCEF formats the event in the Common Event Format.
+func formatCEF(event siemEvent) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|", siemVendor, siemProduct, siemVersion,
+		cefHeaderEscaper.Replace(event.ID), cefHeaderEscaper.Replace(event.Name), event.Severity)
+	fields := []string{"rt", strconv.FormatInt(event.Time.UnixMilli(), 10)}
+	add := func(key, value string) {
+		if value != "" {
+			fields = append(fields, key, value)
+		}
+	}
+	add("suser", event.User)
+	add("src", event.Address)
+	add("act", event.Name)
+	add("outcome", event.Outcome)
+	add("filePath", event.Path)
+	if event.Destination != "" {
+		add("cs1Label", "destination")
+		add("cs1", event.Destination)
+	}
+	add("msg", event.Detail)
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(fields[i] + "=" + cefValueEscaper.Replace(fields[i+1]))
+	}
+	return b.String()
+}
+
+// leefValueEscaper replaces the delimiters of the attributes of LEEF events.
+var leefValueEscaper = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+
+// formatLEEF formats the event in the Log Event Extended Format, with tab delimited attributes.
+func formatLEEF(event siemEvent) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "LEEF:1.0|%s|%s|%s|%s|", siemVendor, siemProduct, siemVersion, strings.ReplaceAll(event.ID, "|", " "))
+	fields := []string{"devTime", event.Time.Format("Jan 02 2006 15:04:05.000 MST"), "devTimeFormat", "MMM dd yyyy HH:mm:ss.SSS z",
+		"cat", event.Name, "sev", strconv.Itoa(event.Severity)}
+	add := func(key, value string) {
+		if value != "" {
+			fields = append(fields, key, value)
+		}
+	}
+	add("usrName", event.User)
+	add("src", event.Address)
+	add("outcome", event.Outcome)
+	add("resource", event.Path)
+	add("destination", event.Destination)
+	add("msg", event.Detail)
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			b.WriteByte('\t')
+		}
+		b.WriteString(fields[i] + "=" + leefValueEscaper.Replace(fields[i+1]))
+	}
+	return b.String()
+}
+
+// siemOperation exports a file operation with the address of the client.
+func siemOperation(cfg *Config, event *Event, address string) {
+	if cfg.siem == nil {
+		return
+	}
+	severity := 3
+	if event.Result != "success" {
+		severity = 5
+	}
+	cfg.siem.send(siemEvent{ID: "file-" + event.Operation, Name: event.Operation, Severity: severity, User: event.User,
+		Address: address, Path: event.Path, Destination: event.Destination, Outcome: event.Result})
+}
+
+// siemAudit exports an audit entry, which records an accountable action.
+func siemAudit(cfg *Config, entry AuditEntry) {
+	if cfg.siem == nil {
+		return
+	}
+	cfg.siem.send(siemEvent{Time: entry.Time, ID: "audit-" + entry.Action, Name: entry.Action, Severity: 6, User: entry.User,
+		Path: entry.Path, Outcome: "success", Detail: entry.Detail})
+}
+
+// siemLoginFailure exports a failed login of the user from the address.
+func siemLoginFailure(cfg *Config, username, address string, err error) {
+	if cfg.siem == nil {
+		return
+	}
+	cfg.siem.send(siemEvent{ID: "login-failure", Name: "login", Severity: 7, User: username, Address: address,
+		Outcome: "failure", Detail: err.Error()})
+}
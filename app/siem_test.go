@@ -0,0 +1,127 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestFormatSIEMEvent(t *testing.T) {
+	event := siemEvent{
+		Time:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		ID:          "file-move",
+		Name:        "move",
+		Severity:    3,
+		User:        "alice",
+		Address:     "192.0.2.1",
+		Path:        "/a=b.txt",
+		Destination: "/c|d\ne.txt",
+		Outcome:     "success",
+	}
+	tests := []struct {
+		name   string
+		format func(siemEvent) string
+		want   string
+	}{
+		{"cef", formatCEF, `CEF:0|audstanley|david|1.0.0|file-move|move|3|rt=1704164645000 suser=alice src=192.0.2.1 act=move outcome=success filePath=/a\=b.txt cs1Label=destination cs1=/c|d\ne.txt`},
+		{"leef", formatLEEF, "LEEF:1.0|audstanley|david|1.0.0|file-move|devTime=Jan 02 2024 03:04:05.000 UTC\tdevTimeFormat=MMM dd yyyy HH:mm:ss.SSS z\tcat=move\tsev=3\tusrName=alice\tsrc=192.0.2.1\toutcome=success\tresource=/a=b.txt\tdestination=/c|d e.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.format(event); got != tt.want {
+				t.Errorf("format() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSIEMSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	sink, err := newSIEMSink(&SIEM{Address: listener.Addr().String(), Network: "tcp", Syslog: true})
+	if err != nil {
+		t.Fatalf("newSIEMSink() error = %v", err)
+	}
+	sink.start()
+
+	cfg := &Config{
+		Dir:   t.TempDir(),
+		Log:   Logging{Create: true},
+		Users: map[string]*UserInfo{"foo": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")}},
+		siem:  sink,
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	serve := func(password string) {
+		r := httptest.NewRequest(http.MethodPut, "/file.txt", strings.NewReader("content"))
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("X-Forwarded-For", "198.51.100.7")
+		r.SetBasicAuth("foo", password)
+		handle(context.Background(), httptest.NewRecorder(), r, a)
+	}
+	serve("wrong")
+	serve("password")
+	writeAudit(cfg, AuditEntry{User: "foo", Action: "retention-override", Path: "/file.txt"})
+
+	for _, want := range []string{
+		"|login-failure|login|7|",
+		"|file-upload|upload|3|",
+		"|audit-retention-override|retention-override|6|",
+	} {
+		select {
+		case line := <-lines:
+			if !strings.HasPrefix(line, "<8") || !strings.Contains(line, want) || !strings.Contains(line, "suser=foo") {
+				t.Errorf("event = %s, want %s of foo with syslog header", line, want)
+			}
+			// The X-Forwarded-For header of a client which isn't a trusted proxy is ignored
+			if want != "|audit-retention-override|retention-override|6|" && !strings.Contains(line, "src=192.0.2.1") {
+				t.Errorf("event = %s, want address of client", line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("missing event %s", want)
+		}
+	}
+}
+
+func TestNewSIEMSink(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  SIEM
+		err  error
+	}{
+		{"defaults", SIEM{Address: "localhost:514"}, nil},
+		{"missing address", SIEM{}, errors.New("siem without address")},
+		{"unsupported network", SIEM{Address: "localhost:514", Network: "sctp"}, errors.New("unsupported siem network sctp")},
+		{"unsupported format", SIEM{Address: "localhost:514", Format: "json"}, errors.New("unsupported siem format json")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newSIEMSink(&tt.cfg)
+			if tt.err == nil && err != nil || tt.err != nil && (err == nil || err.Error() != tt.err.Error()) {
+				t.Errorf("newSIEMSink() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package app
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/net/webdav"
+)
+
+// sparseBlockSize is the granularity of holes, the block size of common file systems.
+const sparseBlockSize = 4096
+
+// truncater is implemented by files which can change their size, like *os.File.
+type truncater interface {
+	Truncate(size int64) error
+}
+
+// sparseFile skips the zero blocks of an upload, leaving holes instead of allocating them.
+// Writes are split into blocks, the start of an incomplete block is kept until the block is complete.
+type sparseFile struct {
+	webdav.File
+	pos     int64
+	skipped bool
+	partial []byte
+}
+
+// isZero reports whether b only contains zero bytes.
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Write writes the complete blocks of b, the rest is kept for the next write.
+func (f *sparseFile) Write(b []byte) (int, error) {
+	n := len(b)
+	if len(f.partial) > 0 {
+		fill := sparseBlockSize - len(f.partial)
+		if fill > len(b) {
+			fill = len(b)
+		}
+		f.partial = append(f.partial, b[:fill]...)
+		b = b[fill:]
+		if len(f.partial) < sparseBlockSize {
+			return n, nil
+		}
+		if err := f.writeBlocks(f.partial); err != nil {
+			return 0, err
+		}
+		f.partial = f.partial[:0]
+	}
+	full := len(b) - len(b)%sparseBlockSize
+	if err := f.writeBlocks(b[:full]); err != nil {
+		return 0, err
+	}
+	f.partial = append(f.partial, b[full:]...)
+	return n, nil
+}
+
+// writeBlocks writes runs of data blocks at once and skips zero blocks.
+func (f *sparseFile) writeBlocks(b []byte) error {
+	for len(b) > 0 {
+		run := 0
+		for run < len(b) && !isZero(b[run:run+sparseBlockSize]) {
+			run += sparseBlockSize
+		}
+		if run == 0 {
+			f.pos += sparseBlockSize
+			f.skipped = true
+			b = b[sparseBlockSize:]
+			continue
+		}
+		if err := f.write(b[:run]); err != nil {
+			return err
+		}
+		b = b[run:]
+	}
+	return nil
+}
+
+// write writes b at the offset behind the skipped blocks.
+func (f *sparseFile) write(b []byte) error {
+	if f.skipped {
+		if _, err := f.File.Seek(f.pos, io.SeekStart); err != nil {
+			return err
+		}
+		f.skipped = false
+	}
+	n, err := f.File.Write(b)
+	f.pos += int64(n)
+	return err
+}
+
+// finish writes the incomplete block and extends the file over trailing zero blocks, which weren't written.
+func (f *sparseFile) finish() error {
+	if len(f.partial) > 0 {
+		if isZero(f.partial) {
+			f.pos += int64(len(f.partial))
+			f.skipped = true
+		} else if err := f.write(f.partial); err != nil {
+			return err
+		}
+		f.partial = f.partial[:0]
+	}
+	if !f.skipped {
+		return nil
+	}
+	f.skipped = false
+	if err := f.File.(truncater).Truncate(f.pos); err != nil {
+		return err
+	}
+	_, err := f.File.Seek(f.pos, io.SeekStart)
+	return err
+}
+
+// Seek completes skipped blocks before moving the offset.
+func (f *sparseFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.finish(); err != nil {
+		return 0, err
+	}
+	pos, err := f.File.Seek(offset, whence)
+	if err == nil {
+		f.pos = pos
+	}
+	return pos, err
+}
+
+// Stat completes skipped blocks, so the size of the file includes them.
+func (f *sparseFile) Stat() (os.FileInfo, error) {
+	if err := f.finish(); err != nil {
+		return nil, err
+	}
+	return f.File.Stat()
+}
+
+// Close completes skipped blocks and closes the file.
+func (f *sparseFile) Close() error {
+	finishErr := f.finish()
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return finishErr
+}
+
+// sparseReader serves the holes of a sparse file as zeros without reading them from the file system.
+// Holes are found with SEEK_DATA where supported.
+type sparseReader struct {
+	webdav.File
+	pos  int64
+	size int64
+}
+
+// newSparseReader returns f wrapped for reading holes if the platform supports finding them.
+func newSparseReader(f webdav.File) webdav.File {
+	if seekData == 0 {
+		return f
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return f
+	}
+	return &sparseReader{File: f, size: info.Size()}
+}
+
+// Read fills b with zeros while the offset is in a hole, and reads the data otherwise.
+func (r *sparseReader) Read(b []byte) (int, error) {
+	if r.pos >= r.size {
+		return r.File.Read(b)
+	}
+	data, err := r.File.Seek(r.pos, seekData)
+	if isNoData(err) {
+		// No data behind the offset, the rest of the file is a hole
+		data = r.size
+	} else if err != nil {
+		// The file system can't find holes, read the file as is
+		if _, err := r.File.Seek(r.pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+		data = r.pos
+	}
+	if data <= r.pos {
+		n, err := r.File.Read(b)
+		r.pos += int64(n)
+		return n, err
+	}
+	n := len(b)
+	if int64(n) > data-r.pos {
+		n = int(data - r.pos)
+	}
+	clear(b[:n])
+	r.pos += int64(n)
+	_, err = r.File.Seek(r.pos, io.SeekStart)
+	return n, err
+}
+
+// Seek moves the offset of the reader.
+func (r *sparseReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.File.Seek(offset, whence)
+	if err == nil {
+		r.pos = pos
+	}
+	return pos, err
+}
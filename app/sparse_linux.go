@@ -0,0 +1,14 @@
+package app
+
+import (
+	"errors"
+	"syscall"
+)
+
+// seekData is the whence of lseek moving to the next data behind the offset.
+const seekData = 3
+
+// isNoData reports whether a SEEK_DATA failed because there is no data behind the offset.
+func isNoData(err error) bool {
+	return errors.Is(err, syscall.ENXIO)
+}
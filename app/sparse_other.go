@@ -0,0 +1,11 @@
+//go:build !linux
+
+package app
+
+// seekData is zero where holes can't be found, sparse files are read as is.
+const seekData = 0
+
+// isNoData is never true without SEEK_DATA.
+func isNoData(err error) bool {
+	return false
+}
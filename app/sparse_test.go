@@ -0,0 +1,116 @@
+//go:build linux
+
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestSparseFile(t *testing.T) {
+	data := []byte("data")
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"hole in the middle", append(append(append([]byte{}, data...), make([]byte, 4*sparseBlockSize)...), data...)},
+		{"trailing hole", append(append([]byte{}, data...), make([]byte, 4*sparseBlockSize)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "image")
+			file, err := os.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := &sparseFile{File: file}
+			// Write in chunks which aren't aligned to the blocks
+			for b := bytes.NewReader(tt.content); b.Len() > 0; {
+				chunk := make([]byte, 1000)
+				n, _ := b.Read(chunk)
+				if _, err := f.Write(chunk[:n]); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			if info, err := f.Stat(); err != nil || info.Size() != int64(len(tt.content)) {
+				t.Errorf("Stat() = %v, %v, want size %d", info, err, len(tt.content))
+			}
+			if err := f.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if content, _ := os.ReadFile(name); !bytes.Equal(content, tt.content) {
+				t.Errorf("content differs from the upload")
+			}
+			var st syscall.Stat_t
+			if err := syscall.Stat(name, &st); err != nil {
+				t.Fatal(err)
+			}
+			if st.Blocks*512 >= int64(len(tt.content)) {
+				t.Errorf("allocated %d bytes, want less than %d", st.Blocks*512, len(tt.content))
+			}
+		})
+	}
+}
+
+func TestSparseReader(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "image")
+	want := make([]byte, 3*sparseBlockSize)
+	copy(want[sparseBlockSize:], "data")
+	os.WriteFile(name, nil, 0600)
+	file, _ := os.OpenFile(name, os.O_RDWR, 0)
+	file.Truncate(int64(len(want)))
+	file.WriteAt([]byte("data"), sparseBlockSize)
+	file.Close()
+
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	r := newSparseReader(file)
+	if content, err := io.ReadAll(r); err != nil || !bytes.Equal(content, want) {
+		t.Errorf("ReadAll() = %d bytes, %v, want %d bytes with data at %d", len(content), err, len(want), sparseBlockSize)
+	}
+	// Ranges start in holes as well
+	r.Seek(sparseBlockSize-2, io.SeekStart)
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != "\x00\x00data" {
+		t.Errorf("ReadFull() = %q, %v, want \\x00\\x00data", buf, err)
+	}
+}
+
+func TestSparseDownload(t *testing.T) {
+	cfg := &Config{
+		Dir:    t.TempDir(),
+		Sparse: true,
+		Users: map[string]*UserInfo{
+			"alice": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")},
+		},
+	}
+	name := filepath.Join(cfg.Dir, "image")
+	os.WriteFile(name, nil, 0600)
+	os.Truncate(name, 3*sparseBlockSize)
+	file, _ := os.OpenFile(name, os.O_RDWR, 0)
+	file.WriteAt([]byte("data"), sparseBlockSize)
+	file.Close()
+
+	// Downloads are served by the handler to users who may read, ranges starting in holes as well
+	handler := NewBasicAuthWebdavHandler(&App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}})
+	r := httptest.NewRequest(http.MethodGet, "/image", nil)
+	r.SetBasicAuth("alice", "password")
+	r.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", sparseBlockSize-2, sparseBlockSize+3))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "\x00\x00data" {
+		t.Errorf("GET = %d %q, want %d \\x00\\x00data", w.Code, w.Body.String(), http.StatusPartialContent)
+	}
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// defaultStagingSuffix marks the temp files of uploads in progress if no suffix is configured.
+const defaultStagingSuffix = ".david-upload"
+
+// suffix returns the configured suffix of temp files or the default one.
+func (s *Staging) suffix() string {
+	if s.Suffix != "" {
+		return s.Suffix
+	}
+	return defaultStagingSuffix
+}
+
+// stagingPath returns a unique temp file for an upload to name, in the configured directory
+// or hidden next to the destination.
+func (s *Staging) stagingPath(name string) (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	base := "." + filepath.Base(name) + "." + hex.EncodeToString(random) + s.suffix()
+	if s.Dir != "" {
+		return filepath.Join(s.Dir, base), nil
+	}
+	return filepath.Join(filepath.Dir(name), base), nil
+}
+
+// stagedFile is the temp file of an upload, which replaces the destination once it was written completely.
+// With stripMetadata, images are stripped of their metadata before.
+type stagedFile struct {
+	webdav.File
+	ctx           context.Context
+	storage       Storage
+	staging       *Staging
+	temp          string
+	name          string
+	failed        bool
+	stripMetadata bool
+}
+
+// Write remembers failed writes, which keep the destination untouched.
+func (f *stagedFile) Write(b []byte) (int, error) {
+	n, err := f.File.Write(b)
+	if err != nil {
+		f.failed = true
+	}
+	return n, err
+}
+
+// Close moves the temp file into place if the upload was complete, otherwise it is removed.
+func (f *stagedFile) Close() error {
+	err := f.File.Close()
+	if body := uploadFromContext(f.ctx); body != nil && body.err != nil && err == nil {
+		err = body.err
+	}
+	if err == nil && f.failed {
+		err = errors.New("incomplete upload")
+	}
+	if err == nil {
+		f.strip()
+		err = f.storage.Rename(f.temp, f.name)
+	}
+	if err != nil {
+		if removeErr := f.storage.RemoveAll(f.temp); removeErr != nil {
+			log.WithError(removeErr).WithField("path", f.temp).Error("Error removing temp file of upload")
+		}
+	}
+	return err
+}
+
+// stagingDir hides the temp files of uploads in progress from directory listings.
+type stagingDir struct {
+	webdav.File
+	suffix string
+}
+
+// Readdir lists the directory without temp files.
+func (d *stagingDir) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := d.File.Readdir(count)
+	visible := infos[:0]
+	for _, info := range infos {
+		if !strings.HasSuffix(info.Name(), d.suffix) {
+			visible = append(visible, info)
+		}
+	}
+	return visible, err
+}
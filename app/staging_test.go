@@ -0,0 +1,89 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+// brokenBody fails after returning its content, like a dropped connection.
+type brokenBody struct {
+	io.Reader
+}
+
+func (b brokenBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestStagedUpload(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    io.Reader
+		staging *Staging
+		want    string
+	}{
+		{"complete", strings.NewReader("new"), &Staging{}, "new"},
+		{"interrupted", brokenBody{strings.NewReader("ne")}, &Staging{}, "old"},
+		{"separate directory", strings.NewReader("new"), &Staging{Suffix: ".part"}, "new"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, "a.txt"), []byte("old"), 0600)
+			if tt.name == "separate directory" {
+				tt.staging.Dir = t.TempDir()
+			}
+			cfg := &Config{
+				Dir:     dir,
+				Staging: tt.staging,
+				Users:   map[string]*UserInfo{"foo": {Crud: newCrudType("crud")}},
+			}
+			a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+			ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "foo", Authenticated: true})
+			r := httptest.NewRequest(http.MethodPut, "/a.txt", nil)
+			r.Body = io.NopCloser(tt.body)
+			serveWebdav(a, ctx, httptest.NewRecorder(), r, "foo")
+
+			if content, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(content) != tt.want {
+				t.Errorf("content = %q, want %q", content, tt.want)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("temp files left in %s: %v", dir, entries)
+			}
+			if tt.staging.Dir != "" {
+				if entries, _ := os.ReadDir(tt.staging.Dir); len(entries) != 0 {
+					t.Errorf("temp files left in %s: %v", tt.staging.Dir, entries)
+				}
+			}
+		})
+	}
+}
+
+func TestStagingDirHidesTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0600)
+	os.WriteFile(filepath.Join(dir, ".b.txt.0123"+defaultStagingSuffix), nil, 0600)
+	cfg := &Config{Dir: dir, Staging: &Staging{}, Users: map[string]*UserInfo{"foo": {Crud: newCrudType("crud")}}}
+	ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "foo", Authenticated: true})
+	f, err := Dir{Config: cfg}.OpenFile(ctx, "/", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	defer f.Close()
+	infos, err := f.Readdir(0)
+	if err != nil || len(infos) != 1 || infos[0].Name() != "a.txt" {
+		t.Errorf("Readdir() = %v, %v, want only a.txt", infos, err)
+	}
+}
@@ -0,0 +1,254 @@
+package app
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// statsEndpoint is the path (relative to the configured prefix) of the statistics dashboard for admins.
+const statsEndpoint = "/_stats"
+
+// Sizes of the windows kept for the dashboard.
+const (
+	rateWindow       = 60
+	recentErrorCount = 20
+	topUserCount     = 10
+)
+
+// transfer is a request currently being served.
+type transfer struct {
+	User    string
+	Method  string
+	Path    string
+	Started time.Time
+	Size    int64
+	body    *countingReader
+	writer  *statusWriter
+}
+
+// Bytes returns the number of bytes transferred so far.
+func (t transfer) Bytes() int64 {
+	return t.body.n.Load() + t.writer.written.Load()
+}
+
+// recentError is an error which occurred while serving a request.
+type recentError struct {
+	Time   time.Time
+	User   string
+	Method string
+	Path   string
+	Error  string
+}
+
+// serverStats holds the live statistics shown on the dashboard.
+type serverStats struct {
+	mu          sync.Mutex
+	transfers   map[*transfer]struct{}
+	errors      []recentError
+	buckets     [rateWindow]int64
+	bucketTimes [rateWindow]int64
+	locks       map[string]time.Time
+}
+
+// stats collects the statistics of all requests.
+var stats = &serverStats{transfers: map[*transfer]struct{}{}, locks: map[string]time.Time{}}
+
+// begin registers a request as active transfer and counts it for the request rate.
+func (s *serverStats) begin(t *transfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transfers[t] = struct{}{}
+	now := t.Started.Unix()
+	if bucket := now % rateWindow; s.bucketTimes[bucket] != now {
+		s.bucketTimes[bucket] = now
+		s.buckets[bucket] = 1
+	} else {
+		s.buckets[bucket]++
+	}
+}
+
+// end removes a finished request from the active transfers.
+func (s *serverStats) end(t *transfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.transfers, t)
+}
+
+// requestRate returns the average number of requests per second over the last minute.
+func (s *serverStats) requestRate(now time.Time) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var total int64
+	for i, count := range s.buckets {
+		if now.Unix()-s.bucketTimes[i] < rateWindow {
+			total += count
+		}
+	}
+	return float64(total) / rateWindow
+}
+
+// RecordError remembers an error of a request for the dashboard.
+func RecordError(req *http.Request, err error) {
+	username := ""
+	if authInfo := AuthFromContext(req.Context()); authInfo != nil {
+		username = authInfo.Username
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.errors = append(stats.errors, recentError{Time: time.Now(), User: username, Method: req.Method, Path: req.URL.Path, Error: err.Error()})
+	if len(stats.errors) > recentErrorCount {
+		stats.errors = stats.errors[len(stats.errors)-recentErrorCount:]
+	}
+}
+
+// countingLockSystem wraps a webdav.LockSystem to count the held locks.
+type countingLockSystem struct {
+	webdav.LockSystem
+}
+
+// NewCountingLockSystem returns a lock system which reports its locks to the dashboard.
+func NewCountingLockSystem(ls webdav.LockSystem) webdav.LockSystem {
+	return &countingLockSystem{ls}
+}
+
+// lockExpiry returns the expiry of a lock, infinite locks never expire.
+func lockExpiry(now time.Time, duration time.Duration) time.Time {
+	if duration < 0 {
+		return time.Time{}
+	}
+	return now.Add(duration)
+}
+
+// Create creates a lock and remembers its token.
+func (ls *countingLockSystem) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	token, err := ls.LockSystem.Create(now, details)
+	if err == nil {
+		stats.mu.Lock()
+		stats.locks[token] = lockExpiry(now, details.Duration)
+		stats.mu.Unlock()
+	}
+	return token, err
+}
+
+// Refresh refreshes a lock and updates its expiry.
+func (ls *countingLockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	details, err := ls.LockSystem.Refresh(now, token, duration)
+	if err == nil {
+		stats.mu.Lock()
+		stats.locks[token] = lockExpiry(now, duration)
+		stats.mu.Unlock()
+	}
+	return details, err
+}
+
+// Unlock releases a lock and forgets its token.
+func (ls *countingLockSystem) Unlock(now time.Time, token string) error {
+	err := ls.LockSystem.Unlock(now, token)
+	stats.mu.Lock()
+	delete(stats.locks, token)
+	stats.mu.Unlock()
+	return err
+}
+
+// activeLocks returns the number of locks which haven't expired yet.
+func (s *serverStats) activeLocks(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for token, expiry := range s.locks {
+		if expiry.IsZero() || expiry.After(now) {
+			count++
+		} else {
+			delete(s.locks, token)
+		}
+	}
+	return count
+}
+
+// topUser is a user with their usage, ranked by transferred bytes.
+type topUser struct {
+	Name string
+	Usage
+}
+
+// statsPage holds the data rendered on the dashboard.
+type statsPage struct {
+	Now         time.Time
+	RequestRate float64
+	Transfers   []transfer
+	TopUsers    []topUser
+	Errors      []recentError
+	Locks       int
+}
+
+// snapshot collects the data of the dashboard.
+func (s *serverStats) snapshot(now time.Time) statsPage {
+	page := statsPage{Now: now, RequestRate: s.requestRate(now), Locks: s.activeLocks(now)}
+
+	s.mu.Lock()
+	for t := range s.transfers {
+		page.Transfers = append(page.Transfers, *t)
+	}
+	for i := len(s.errors) - 1; i >= 0; i-- {
+		page.Errors = append(page.Errors, s.errors[i])
+	}
+	s.mu.Unlock()
+	sort.Slice(page.Transfers, func(i, j int) bool { return page.Transfers[i].Started.Before(page.Transfers[j].Started) })
+
+	for name, u := range usage.all() {
+		page.TopUsers = append(page.TopUsers, topUser{name, u})
+	}
+	sort.Slice(page.TopUsers, func(i, j int) bool {
+		return page.TopUsers[i].BytesUploaded+page.TopUsers[i].BytesDownloaded > page.TopUsers[j].BytesUploaded+page.TopUsers[j].BytesDownloaded
+	})
+	if len(page.TopUsers) > topUserCount {
+		page.TopUsers = page.TopUsers[:topUserCount]
+	}
+	return page
+}
+
+// statsTemplate renders the dashboard, it reloads itself every five seconds.
+var statsTemplate = template.Must(template.New("stats").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>david statistics</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:2px 8px;text-align:left}</style>
+</head>
+<body>
+<h1>david statistics</h1>
+<p>{{.Now.Format "2006-01-02 15:04:05"}} &middot; {{printf "%.2f" .RequestRate}} requests/s &middot; {{.Locks}} locks</p>
+<h2>Active transfers</h2>
+<table><tr><th>User</th><th>Method</th><th>Path</th><th>Since</th><th>Bytes</th></tr>
+{{range .Transfers}}<tr><td>{{.User}}</td><td>{{.Method}}</td><td>{{.Path}}</td><td>{{.Started.Format "15:04:05"}}</td><td>{{.Bytes}}</td></tr>
+{{end}}</table>
+<h2>Top users</h2>
+<table><tr><th>User</th><th>Uploaded</th><th>Downloaded</th></tr>
+{{range .TopUsers}}<tr><td>{{.Name}}</td><td>{{.BytesUploaded}}</td><td>{{.BytesDownloaded}}</td></tr>
+{{end}}</table>
+<h2>Recent errors</h2>
+<table><tr><th>Time</th><th>User</th><th>Method</th><th>Path</th><th>Error</th></tr>
+{{range .Errors}}<tr><td>{{.Time.Format "15:04:05"}}</td><td>{{.User}}</td><td>{{.Method}}</td><td>{{.Path}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// handleStatsRequest renders the dashboard for admins.
+func handleStatsRequest(a *App, w http.ResponseWriter, authInfo *AuthInfo) {
+	if user := a.Config.user(authInfo.Username); user == nil || !user.Admin {
+		writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statsTemplate.Execute(w, stats.snapshot(time.Now())); err != nil {
+		log.WithError(err).Error("Error rendering statistics")
+	}
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestHandleStatsRequest(t *testing.T) {
+	configTmp := createTestConfig(t.TempDir())
+	configTmp.Users["admin"].Admin = true
+	a := &App{Config: configTmp}
+
+	tests := []struct {
+		name       string
+		user       string
+		statusCode int
+	}{
+		{"admin", "admin", http.StatusOK},
+		{"regular user", "user1", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handleStatsRequest(a, w, &AuthInfo{Username: tt.user, Authenticated: true})
+
+			resp := w.Result()
+			if resp.StatusCode != tt.statusCode {
+				t.Errorf("handleStatsRequest() = %v, want %v", resp.StatusCode, tt.statusCode)
+			}
+			if tt.statusCode == http.StatusOK && !strings.Contains(w.Body.String(), "Active transfers") {
+				t.Errorf("handleStatsRequest() body doesn't contain the dashboard")
+			}
+		})
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	cfg := &Config{
+		Dir: t.TempDir(),
+		Users: map[string]*UserInfo{
+			"admin": {Password: GenHash([]byte("password")), Crud: newCrudType("crud"), Admin: true},
+		},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	for _, enabled := range []bool{false, true} {
+		cfg.Stats = enabled
+		r := httptest.NewRequest(http.MethodGet, statsEndpoint, nil)
+		r.SetBasicAuth("admin", "password")
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		// Without the dashboard the path is served from the webdav tree, where it doesn't exist
+		if dashboard := strings.Contains(w.Body.String(), "Active transfers"); dashboard != enabled {
+			t.Errorf("GET %s with stats %v = %d, dashboard %v", statsEndpoint, enabled, w.Code, dashboard)
+		}
+	}
+}
+
+func TestCountingLockSystem(t *testing.T) {
+	now := time.Now()
+	before := stats.activeLocks(now)
+	ls := NewCountingLockSystem(webdav.NewMemLS())
+
+	token, err := ls.Create(now, webdav.LockDetails{Root: "/counted", Duration: time.Minute})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if got := stats.activeLocks(now) - before; got != 1 {
+		t.Errorf("activeLocks() after Create = %v, want 1", got)
+	}
+	// Expired locks are no longer counted
+	if got := stats.activeLocks(now.Add(2*time.Minute)) - before; got != 0 {
+		t.Errorf("activeLocks() after expiry = %v, want 0", got)
+	}
+	ls.Unlock(now, token)
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"os"
+
+	"golang.org/x/net/webdav"
+)
+
+// Storage abstracts the file operations Dir delegates to after resolving paths and checking permissions.
+type Storage interface {
+	Mkdir(name string, perm os.FileMode) error
+	OpenFile(name string, flag int, perm os.FileMode) (webdav.File, error)
+	RemoveAll(name string) error
+	Rename(oldName, newName string) error
+	Stat(name string) (os.FileInfo, error)
+}
+
+// osStorage is the default storage backend using the local file system. Long paths are passed in their
+// extended-length form on Windows.
+type osStorage struct{}
+
+// Mkdir creates a directory with os.Mkdir.
+func (osStorage) Mkdir(name string, perm os.FileMode) error {
+	return os.Mkdir(longPath(name), perm)
+}
+
+// OpenFile opens a file with os.OpenFile.
+func (osStorage) OpenFile(name string, flag int, perm os.FileMode) (webdav.File, error) {
+	f, err := os.OpenFile(longPath(name), flag, perm)
+	if err != nil {
+		// Avoid returning a typed nil inside the interface
+		return nil, err
+	}
+	return f, nil
+}
+
+// RemoveAll removes a file or directory with os.RemoveAll.
+func (osStorage) RemoveAll(name string) error {
+	return os.RemoveAll(longPath(name))
+}
+
+// Rename renames a file or directory with os.Rename.
+func (osStorage) Rename(oldName, newName string) error {
+	return os.Rename(longPath(oldName), longPath(newName))
+}
+
+// Stat returns file information with os.Stat.
+func (osStorage) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(longPath(name))
+}
+
+// storage returns the configured storage backend, the local file system by default.
+func (d Dir) storage() Storage {
+	if d.Config.storage != nil {
+		return d.Config.storage
+	}
+	return osStorage{}
+}
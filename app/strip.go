@@ -0,0 +1,249 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errNotStrippable is returned for content which isn't an image of a supported format.
+var errNotStrippable = errors.New("unsupported image format")
+
+// JPEG markers handled by the stripper.
+const (
+	jpegSOI  = 0xd8
+	jpegEOI  = 0xd9
+	jpegSOS  = 0xda
+	jpegAPP1 = 0xe1
+	jpegAPPD = 0xed
+	jpegCOM  = 0xfe
+)
+
+// exifHeader starts the APP1 segment holding the EXIF data of a JPEG.
+var exifHeader = []byte("Exif\x00\x00")
+
+// pngSignature starts every PNG.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// strippedPNGChunks are the PNG chunks holding EXIF data and text, like XMP with the location.
+var strippedPNGChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true}
+
+// stripsMetadata reports whether the physical path lies in a directory whose images are stripped of their metadata.
+func (cfg *Config) stripsMetadata(name string) bool {
+	rel, ok := cfg.relPath(name)
+	if !ok {
+		return false
+	}
+	for _, dir := range cfg.StripMetadata {
+		if hasFilePathPrefix(rel, path.Clean("/"+dir)) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripImageMetadata copies the image of the given extension without its metadata: JPEGs lose their EXIF data
+// (but the orientation), XMP, IPTC and comments, PNGs their EXIF data and text chunks.
+func stripImageMetadata(w io.Writer, r io.Reader, ext string) error {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		return stripJPEG(w, bufio.NewReader(r))
+	case ".png":
+		return stripPNG(w, bufio.NewReader(r))
+	}
+	return errNotStrippable
+}
+
+// stripJPEG copies the segments of the JPEG up to the image data, leaving out the ones with metadata.
+func stripJPEG(w io.Writer, r *bufio.Reader) error {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xff, jpegSOI} {
+		return errNotStrippable
+	}
+	if _, err := w.Write(soi[:]); err != nil {
+		return err
+	}
+	for {
+		// Markers may be preceded by any number of fill bytes
+		marker, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if marker != 0xff {
+			return errors.New("invalid JPEG marker")
+		}
+		for marker == 0xff {
+			if marker, err = r.ReadByte(); err != nil {
+				return err
+			}
+		}
+		if marker == jpegEOI || marker >= 0xd0 && marker <= 0xd7 || marker == 0x01 {
+			if _, err := w.Write([]byte{0xff, marker}); err != nil {
+				return err
+			}
+			if marker == jpegEOI {
+				return nil
+			}
+			continue
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			return err
+		}
+		size := int(binary.BigEndian.Uint16(length[:]))
+		if size < 2 {
+			return errors.New("invalid JPEG segment")
+		}
+		segment := make([]byte, size-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return err
+		}
+		switch {
+		case marker == jpegAPP1 && bytes.HasPrefix(segment, exifHeader):
+			// Only the orientation is kept, images would be displayed rotated otherwise
+			if orientation := exifOrientation(segment[len(exifHeader):]); orientation > 1 {
+				if _, err := w.Write(orientationSegment(orientation)); err != nil {
+					return err
+				}
+			}
+			continue
+		case marker == jpegAPP1 || marker == jpegAPPD || marker == jpegCOM:
+			continue
+		}
+		if _, err := w.Write(append([]byte{0xff, marker, length[0], length[1]}, segment...)); err != nil {
+			return err
+		}
+		if marker == jpegSOS {
+			// The entropy coded data follows, there's no metadata after it
+			_, err := io.Copy(w, r)
+			return err
+		}
+	}
+}
+
+// exifOrientation returns the orientation tag of the first IFD of the TIFF structure of the EXIF data, or 0.
+func exifOrientation(tiff []byte) uint16 {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + 12*i
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		// The orientation is a single SHORT
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			return order.Uint16(tiff[entry+8:])
+		}
+	}
+	return 0
+}
+
+// orientationSegment returns an APP1 segment with EXIF data holding nothing but the orientation.
+func orientationSegment(orientation uint16) []byte {
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(tiff[18:], orientation)
+	payload := append(append([]byte{}, exifHeader...), tiff...)
+	segment := []byte{0xff, jpegAPP1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// stripPNG copies the chunks of the PNG, leaving out the ones with metadata.
+func stripPNG(w io.Writer, r *bufio.Reader) error {
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return errNotStrippable
+	}
+	if _, err := w.Write(signature); err != nil {
+		return err
+	}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return err
+		}
+		// The data is followed by the CRC of the chunk
+		size := int64(binary.BigEndian.Uint32(header[:4])) + 4
+		kind := string(header[4:])
+		if strippedPNGChunks[kind] {
+			if _, err := io.CopyN(io.Discard, r, size); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := w.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return err
+		}
+		if kind == "IEND" {
+			return nil
+		}
+	}
+}
+
+// stripFile replaces the staged upload temp by a copy of it without metadata written to the temp file stripped.
+// Uploads which aren't images of a supported format are kept as they are.
+func stripFile(storage Storage, temp, stripped, name string) error {
+	src, err := storage.OpenFile(temp, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	dst, err := storage.OpenFile(stripped, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		src.Close()
+		return err
+	}
+	err = stripImageMetadata(dst, src, filepath.Ext(name))
+	src.Close()
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		storage.RemoveAll(stripped)
+		if errors.Is(err, errNotStrippable) {
+			return nil
+		}
+		return err
+	}
+	return storage.Rename(stripped, temp)
+}
+
+// strip strips the staged upload if its destination lies in a directory whose images are stripped. Images
+// which can't be parsed are kept as they are.
+func (f *stagedFile) strip() {
+	if !f.stripMetadata {
+		return
+	}
+	stripped, err := f.staging.stagingPath(f.name)
+	if err == nil {
+		err = stripFile(f.storage, f.temp, stripped, f.name)
+	}
+	if err != nil {
+		log.WithError(err).WithField("path", f.name).Warn("Error stripping metadata of image")
+	}
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testJPEG returns a JPEG with EXIF data holding the camera make "Leak" and the orientation 6, and a comment.
+func testJPEG() []byte {
+	var encoded bytes.Buffer
+	jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 16, 8)), nil)
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 2, 0,
+		0x0f, 0x01, 2, 0, 4, 0, 0, 0, 'L', 'e', 'a', 'k',
+		0x12, 0x01, 3, 0, 1, 0, 0, 0, 6, 0, 0, 0,
+		0, 0, 0, 0}
+	exif := append(append([]byte{0xff, jpegAPP1, 0, 0}, exifHeader...), tiff...)
+	binary.BigEndian.PutUint16(exif[2:], uint16(len(exif)-2))
+	comment := append([]byte{0xff, jpegCOM, 0, 9}, "Leaking"...)
+	b := encoded.Bytes()
+	return append(append(append(append([]byte{}, b[:2]...), exif...), comment...), b[2:]...)
+}
+
+// testPNG returns a PNG with a text chunk holding "Leak".
+func testPNG() []byte {
+	var encoded bytes.Buffer
+	png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 16, 8)))
+	data := []byte("Comment\x00Leak")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(append(chunk, "tEXt"...), data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	b := encoded.Bytes()
+	return append(append(append([]byte{}, b[:len(pngSignature)]...), chunk...), b[len(pngSignature):]...)
+}
+
+func TestStripImageMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		ext     string
+		content []byte
+		err     error
+	}{
+		{"jpeg", ".JPG", testJPEG(), nil},
+		{"png", ".png", testPNG(), nil},
+		{"not a jpeg", ".jpg", []byte("Leak"), errNotStrippable},
+		{"unsupported format", ".gif", []byte("GIF89a Leak"), errNotStrippable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stripped bytes.Buffer
+			err := stripImageMetadata(&stripped, bytes.NewReader(tt.content), tt.ext)
+			if err != tt.err {
+				t.Fatalf("stripImageMetadata() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if bytes.Contains(stripped.Bytes(), []byte("Leak")) {
+				t.Errorf("stripped image still contains the metadata")
+			}
+			if _, _, err := image.Decode(bytes.NewReader(stripped.Bytes())); err != nil {
+				t.Errorf("stripped image can't be decoded: %v", err)
+			}
+		})
+	}
+
+	// The orientation of JPEGs is kept
+	var stripped bytes.Buffer
+	stripImageMetadata(&stripped, bytes.NewReader(testJPEG()), ".jpg")
+	exif := stripped.Bytes()[2:]
+	if exif[1] != jpegAPP1 || exifOrientation(exif[4+len(exifHeader):]) != 6 {
+		t.Errorf("stripped JPEG lost its orientation")
+	}
+}
+
+func TestStripMetadataOnUpload(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "public"), 0700)
+	os.MkdirAll(filepath.Join(dir, "private"), 0700)
+	cfg := &Config{
+		Dir:           dir,
+		StripMetadata: []string{"public"},
+		Log:           Logging{Create: true},
+		Users:         map[string]*UserInfo{"foo": {Crud: newCrudType("crud")}},
+	}
+	ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "foo", Authenticated: true})
+
+	tests := []struct {
+		name  string
+		path  string
+		strip bool
+	}{
+		{"stripped in public directory", "/public/photo.jpg", true},
+		{"kept in other directories", "/private/photo.jpg", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Dir{Config: cfg}.OpenFile(ctx, tt.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+			if err != nil {
+				t.Fatalf("OpenFile() error = %v", err)
+			}
+			io.Copy(f, bytes.NewReader(testJPEG()))
+			if err := f.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			content, _ := os.ReadFile(filepath.Join(dir, filepath.FromSlash(tt.path)))
+			if stripped := !bytes.Contains(content, []byte("Leak")); stripped != tt.strip {
+				t.Errorf("stripped = %v, want %v", stripped, tt.strip)
+			}
+			entries, _ := os.ReadDir(filepath.Dir(filepath.Join(dir, filepath.FromSlash(tt.path))))
+			if len(entries) != 1 {
+				t.Errorf("directory holds %d entries, want only the upload", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Policies for users without subdir, set by subdirPolicy.
+const (
+	// subdirPolicyAllow serves them the whole base directory, including the subdirs of other users.
+	subdirPolicyAllow = "allow"
+	// subdirPolicyDeny serves them nothing.
+	subdirPolicyDeny = "deny"
+	// subdirPolicyAuto jails them in a subdir named after them.
+	subdirPolicyAuto = "auto"
+)
+
+// validSubdirPolicy reports whether the policy is known, empty is the default.
+func validSubdirPolicy(policy string) bool {
+	switch policy {
+	case "", subdirPolicyAllow, subdirPolicyDeny, subdirPolicyAuto:
+		return true
+	}
+	return false
+}
+
+// subdirOf returns the subdir the user is jailed in, empty for the whole base directory, and false if the
+// user is denied access to all files by the subdir policy.
+func (cfg *Config) subdirOf(username string, user *UserInfo) (string, bool) {
+	if user.Subdir != nil {
+		return *user.Subdir, true
+	}
+	switch cfg.SubdirPolicy {
+	case subdirPolicyDeny:
+		return "", false
+	case subdirPolicyAuto:
+		// Names which aren't a single path element would escape the base directory or share it
+		if username == "" || username == "." || username == ".." || strings.ContainsAny(username, `/\`) || filepath.VolumeName(username) != "" {
+			return "", false
+		}
+		return username, true
+	}
+	return "", true
+}
+
+// warnSubdirPolicy warns if users without subdir can see the subdirs of other users, because no policy was
+// chosen explicitly.
+func (cfg *Config) warnSubdirPolicy() {
+	if cfg.SubdirPolicy != "" {
+		return
+	}
+	var with, without []string
+	for username, user := range cfg.Users {
+		if user.Subdir != nil {
+			with = append(with, username)
+		} else {
+			without = append(without, username)
+		}
+	}
+	if len(with) != 0 && len(without) != 0 {
+		log.WithField("users", strings.Join(without, ", ")).Warn(fmt.Sprintf("Users without subdir can access the subdirs of %d other users, set subdirPolicy to deny, auto or allow", len(with)))
+	}
+}
+
+// createAssignedSubdir creates the subdir assigned to a user by the policy, like the ones of users of a user
+// store or plugin, which aren't known in advance.
+func (cfg *Config) createAssignedSubdir(username string) {
+	user := cfg.user(username)
+	if user == nil || user.Subdir != nil || cfg.SubdirPolicy != subdirPolicyAuto {
+		return
+	}
+	subdir, ok := cfg.subdirOf(username, user)
+	if !ok {
+		return
+	}
+	dir := filepath.Join(cfg.Dir, subdir)
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		log.WithError(err).WithField("path", dir).Warn("Can't create user dir")
+		return
+	}
+	log.WithField("path", dir).Info("Created user dir")
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestResolveSubdirPolicy(t *testing.T) {
+	subdir := "/alice"
+	users := map[string]*UserInfo{
+		"alice": {Subdir: &subdir, Crud: newCrudType("crud")},
+		"bob":   {Crud: newCrudType("crud")},
+		"..":    {Crud: newCrudType("crud")},
+	}
+	tests := []struct {
+		policy string
+		user   string
+		want   string
+	}{
+		{"", "alice", "/data/alice/file.txt"},
+		{"", "bob", "/data/file.txt"},
+		{subdirPolicyAllow, "bob", "/data/file.txt"},
+		{subdirPolicyDeny, "alice", "/data/alice/file.txt"},
+		{subdirPolicyDeny, "bob", ""},
+		{subdirPolicyAuto, "alice", "/data/alice/file.txt"},
+		{subdirPolicyAuto, "bob", "/data/bob/file.txt"},
+		{subdirPolicyAuto, "..", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+" "+tt.user, func(t *testing.T) {
+			cfg := &Config{Dir: "/data", Users: users, SubdirPolicy: tt.policy}
+			ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: tt.user, Authenticated: true, CrudType: users[tt.user].Crud})
+			want := tt.want
+			if want != "" {
+				want = filepath.FromSlash(want)
+			}
+			if got := Resolve(ctx, "/file.txt", Dir{Config: cfg}); got != want {
+				t.Errorf("Resolve() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestAssignedSubdir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "shared.txt"), []byte("content"), 0600)
+	cfg := &Config{
+		Dir:          dir,
+		SubdirPolicy: subdirPolicyAuto,
+		Users:        map[string]*UserInfo{"bob": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")}},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	for path, want := range map[string]int{"/": http.StatusMultiStatus, "/shared.txt": http.StatusNotFound} {
+		r := httptest.NewRequest("PROPFIND", path, nil)
+		r.Header.Set("Depth", "0")
+		r.SetBasicAuth("bob", "password")
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		if w.Code != want {
+			t.Errorf("PROPFIND %s = %d, want %d", path, w.Code, want)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dir, "bob")); err != nil || !info.IsDir() {
+		t.Errorf("subdir of bob wasn't created: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// metaEndpoint is the path (relative to the configured prefix) below which the tags and metadata of the files
+// of the user are read and replaced as JSON.
+const metaEndpoint = "/_meta"
+
+// metadataNamespace is the XML namespace of the dead properties holding the metadata of a file, the local name
+// of a property is the key of the metadata.
+const metadataNamespace = davidNamespace + "/metadata"
+
+// tagsProperty is the dead property holding the comma separated tags of a file.
+var tagsProperty = xml.Name{Space: davidNamespace, Local: "tags"}
+
+// FileMetadata holds the tags and the key-value metadata of a file.
+type FileMetadata struct {
+	Tags     []string          `json:"tags"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// propertyText returns the text content of a property, nested elements are flattened.
+func propertyText(p webdav.Property) string {
+	var b strings.Builder
+	decoder := xml.NewDecoder(bytes.NewReader(p.InnerXML))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		if text, ok := token.(xml.CharData); ok {
+			b.Write(text)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// textProperty returns a property holding the text.
+func textProperty(name xml.Name, text string) webdav.Property {
+	return webdav.Property{XMLName: name, InnerXML: []byte(escapeXML(text))}
+}
+
+// parseTags splits comma separated tags, they are case insensitive and returned sorted in lower case.
+func parseTags(s string) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// metadataOf returns the tags and metadata held by the properties of a file.
+func metadataOf(props map[xml.Name]webdav.Property) FileMetadata {
+	m := FileMetadata{Tags: []string{}, Metadata: map[string]string{}}
+	for name, p := range props {
+		switch {
+		case name == tagsProperty:
+			m.Tags = parseTags(propertyText(p))
+		case name.Space == metadataNamespace:
+			m.Metadata[name.Local] = propertyText(p)
+		}
+	}
+	return m
+}
+
+// metadataPatches returns the patches replacing the tags and metadata of the properties by the given ones.
+func metadataPatches(props map[xml.Name]webdav.Property, m FileMetadata) []webdav.Proppatch {
+	set := webdav.Proppatch{}
+	remove := webdav.Proppatch{Remove: true}
+	if tags := parseTags(strings.Join(m.Tags, ",")); len(tags) != 0 {
+		set.Props = append(set.Props, textProperty(tagsProperty, strings.Join(tags, ", ")))
+	} else if _, ok := props[tagsProperty]; ok {
+		remove.Props = append(remove.Props, webdav.Property{XMLName: tagsProperty})
+	}
+	for name := range props {
+		if _, ok := m.Metadata[name.Local]; name.Space == metadataNamespace && !ok {
+			remove.Props = append(remove.Props, webdav.Property{XMLName: name})
+		}
+	}
+	for key, value := range m.Metadata {
+		set.Props = append(set.Props, textProperty(xml.Name{Space: metadataNamespace, Local: key}, value))
+	}
+	return []webdav.Proppatch{remove, set}
+}
+
+// validMetadataKey reports whether the key can be the local name of a property.
+func validMetadataKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, r := range key {
+		letter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_'
+		if !letter && (i == 0 || !(r >= '0' && r <= '9' || r == '-' || r == '.')) {
+			return false
+		}
+	}
+	return true
+}
+
+// handleMetaRequest serves the tags and metadata of a file of the user: GET returns them, PUT replaces them.
+func handleMetaRequest(a *App, ctx context.Context, w http.ResponseWriter, req *http.Request, authInfo *AuthInfo) {
+	dir := Dir{a.Config}
+	name := Resolve(ctx, path.Clean("/"+strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, a.Config.Prefix), metaEndpoint)), dir)
+	if name == "" || dir.hiddenFromUser(ctx, name) || !dir.crudAt(ctx, name).Read {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if _, err := os.Stat(name); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	store := a.Config.propertyStore()
+	props, err := store.props(ctx, name)
+	if err != nil {
+		log.WithError(err).WithField("path", name).Error("Error reading dead properties")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, metadataOf(props))
+	case http.MethodPut:
+		if !dir.crudAt(ctx, name).Update {
+			writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges, req.URL.Path)
+			return
+		}
+		var m FileMetadata
+		if err := json.NewDecoder(req.Body).Decode(&m); err != nil {
+			http.Error(w, "invalid metadata", http.StatusBadRequest)
+			return
+		}
+		for key := range m.Metadata {
+			if !validMetadataKey(key) {
+				http.Error(w, "invalid metadata key "+key, http.StatusBadRequest)
+				return
+			}
+		}
+		if err := store.patch(ctx, name, metadataPatches(props, m)); err != nil {
+			log.WithError(err).WithField("path", name).Error("Error writing dead properties")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if a.Config.indexer != nil {
+			a.Config.indexer.enqueue(indexUpdate{meta: name})
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		handleMethodNotAllowed(ctx, w, req, http.MethodGet, http.MethodPut)
+	}
+}
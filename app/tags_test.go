@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestTags(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "docs"), 0700)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		os.WriteFile(filepath.Join(dir, "docs", name), []byte(name), 0600)
+	}
+	store, err := openPropertyStore(&Properties{File: filepath.Join(t.TempDir(), "props.db")})
+	if err != nil {
+		t.Fatalf("openPropertyStore() error = %v", err)
+	}
+	ix, err := openIndexer(&Index{File: filepath.Join(t.TempDir(), "index.db")})
+	if err != nil {
+		t.Fatalf("openIndexer() error = %v", err)
+	}
+	cfg := &Config{
+		Dir: dir,
+		Log: Logging{Create: true},
+		Users: map[string]*UserInfo{
+			"foo":    {Password: GenHash([]byte("password")), Crud: newCrudType("crud")},
+			"reader": {Password: GenHash([]byte("password")), Crud: newCrudType("r")},
+		},
+		properties: store,
+		indexer:    ix,
+	}
+	ix.props = cfg.propertyStore()
+	if err := ix.reconcile(cfg); err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	serve := func(user, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.SetBasicAuth(user, "password")
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		// Apply the queued updates of the index
+		for len(ix.updates) > 0 {
+			update := <-ix.updates
+			if update.remove != "" {
+				ix.remove(update.remove)
+			}
+			if update.add != "" {
+				ix.indexTree(cfg, update.add)
+			}
+			if update.meta != "" {
+				ix.refreshMeta(update.meta)
+			}
+		}
+		return w
+	}
+	const patch = `<?xml version="1.0"?><D:propertyupdate xmlns:D="DAV:" xmlns:david="https://github.com/audstanley/david" xmlns:m="https://github.com/audstanley/david/metadata">
+		<D:set><D:prop><david:tags>Alpha, review</david:tags><m:project>alpha</m:project></D:prop></D:set></D:propertyupdate>`
+
+	tests := []struct {
+		name     string
+		user     string
+		method   string
+		path     string
+		body     string
+		want     int
+		contains string
+	}{
+		{"tag by PROPPATCH", "foo", "PROPPATCH", "/docs/a.txt", patch, http.StatusMultiStatus, "200 OK"},
+		{"tag by endpoint", "foo", http.MethodPut, "/_meta/docs/b.txt", `{"tags": ["alpha"], "metadata": {"project": "beta"}}`, http.StatusNoContent, ""},
+		{"read tags", "reader", http.MethodGet, "/_meta/docs/a.txt", "", http.StatusOK, `{"tags":["alpha","review"],"metadata":{"project":"alpha"}}`},
+		{"tagging needs update permission", "reader", http.MethodPut, "/_meta/docs/c.txt", `{"tags": ["alpha"]}`, http.StatusForbidden, ""},
+		{"invalid metadata key", "foo", http.MethodPut, "/_meta/docs/c.txt", `{"metadata": {"a b": "c"}}`, http.StatusBadRequest, ""},
+		{"unknown file", "foo", http.MethodGet, "/_meta/docs/missing.txt", "", http.StatusNotFound, ""},
+		{"search by tag", "reader", http.MethodGet, "/_search?tag=ALPHA", "", http.StatusOK, `[{"path":"/docs/a.txt"`},
+		{"search by tags and metadata", "reader", http.MethodGet, "/_search?tag=alpha&meta=project:beta", "", http.StatusOK, `[{"path":"/docs/b.txt"`},
+		{"search by text and tag", "reader", http.MethodGet, "/_search?q=a&tag=review", "", http.StatusOK, `"path":"/docs/a.txt"`},
+		{"invalid metadata filter", "reader", http.MethodGet, "/_search?meta=project", "", http.StatusBadRequest, ""},
+		{"properties move with the file", "foo", "MOVE", "/docs/a.txt", "", http.StatusCreated, ""},
+		{"read tags of moved file", "reader", http.MethodGet, "/_meta/docs/moved.txt", "", http.StatusOK, `"tags":["alpha","review"]`},
+		{"search moved file by tag", "reader", http.MethodGet, "/_search?tag=review", "", http.StatusOK, `[{"path":"/docs/moved.txt"`},
+		{"untag", "foo", http.MethodPut, "/_meta/docs/b.txt", `{}`, http.StatusNoContent, ""},
+		{"search untagged", "reader", http.MethodGet, "/_search?meta=project:beta", "", http.StatusOK, `[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.user, tt.method, tt.path, tt.body, "Destination", "http://example.com/docs/moved.txt")
+			if w.Code != tt.want {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body.String(), tt.want)
+			}
+			if !strings.Contains(w.Body.String(), tt.contains) {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.contains)
+			}
+		})
+	}
+}
+
+func TestPropertyStoreNonASCII(t *testing.T) {
+	store, err := openPropertyStore(&Properties{File: filepath.Join(t.TempDir(), "props.db")})
+	if err != nil {
+		t.Fatalf("openPropertyStore() error = %v", err)
+	}
+	ctx := context.Background()
+	tag := webdav.Property{XMLName: tagsProperty, InnerXML: []byte("alpha")}
+	set := func(name string) {
+		if err := store.patch(ctx, name, []webdav.Proppatch{{Props: []webdav.Property{tag}}}); err != nil {
+			t.Fatalf("patch(%s) error = %v", name, err)
+		}
+	}
+	has := func(name string) bool {
+		props, _ := store.props(ctx, name)
+		return len(props) != 0
+	}
+
+	// Names with multibyte characters are longer in bytes than in characters
+	set(filepath.Join("/d", "Ä", "a.txt"))
+	if err := store.move(ctx, filepath.Join("/d", "Ä"), filepath.Join("/d", "Öü")); err != nil {
+		t.Fatalf("move() error = %v", err)
+	}
+	if has(filepath.Join("/d", "Ä", "a.txt")) || !has(filepath.Join("/d", "Öü", "a.txt")) {
+		t.Errorf("properties of the children weren't moved along with the directory")
+	}
+	set(filepath.Join("/d", "Äb", "b.txt"))
+	if err := store.remove(ctx, filepath.Join("/d", "Öü")); err != nil {
+		t.Fatalf("remove() error = %v", err)
+	}
+	if has(filepath.Join("/d", "Öü", "a.txt")) || !has(filepath.Join("/d", "Äb", "b.txt")) {
+		t.Errorf("properties of the children weren't removed along with the directory, or others were")
+	}
+}
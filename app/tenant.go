@@ -0,0 +1,273 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Tenant is a virtual host with its own directory, users and certificate, selected by the Host header. A tenant
+// without host is a realm selected by its Prefix instead, on any host which isn't a tenant of its own.
+type Tenant struct {
+	Host         string
+	Dir          string
+	Prefix       string
+	UserPrefix   bool
+	SubdirPolicy string
+	Realm        string
+	Users        map[string]*UserInfo
+	TLS          *TLS
+}
+
+// tenantConfig derives the configuration of a tenant.
+// Settings which aren't specific to a tenant are shared with the main configuration.
+func (cfg *Config) tenantConfig(t *Tenant) *Config {
+	realm := t.Realm
+	if realm == "" {
+		realm = cfg.Realm
+	}
+	subdirPolicy := t.SubdirPolicy
+	if subdirPolicy == "" {
+		subdirPolicy = cfg.SubdirPolicy
+	}
+	prefix := t.Prefix
+	if t.Host == "" {
+		prefix = t.key()
+	}
+	users := t.Users
+	if users == nil {
+		users = map[string]*UserInfo{}
+	}
+	tenant := &Config{
+		Address:         cfg.Address,
+		Port:            cfg.Port,
+		Prefix:          prefix,
+		UserPrefix:      t.UserPrefix,
+		SubdirPolicy:    subdirPolicy,
+		FollowSymlinks:  cfg.FollowSymlinks,
+		CaseInsensitive: cfg.CaseInsensitive,
+		ListPermission:  cfg.ListPermission,
+		Dir:             rootDir(t.Dir),
+		TLS:             t.TLS,
+		HTTP:            cfg.HTTP,
+		Security:        cfg.Security,
+		ErrorPages:      cfg.ErrorPages,
+		errorPages:      cfg.errorPages,
+		MaxUploadSize:   cfg.MaxUploadSize,
+		MaxPathLength:   cfg.MaxPathLength,
+		MaxPathDepth:    cfg.MaxPathDepth,
+		MaxWrites:       cfg.MaxWrites,
+		Staging:         cfg.Staging,
+		Preallocate:     cfg.Preallocate,
+		WriteBufferSize: cfg.WriteBufferSize,
+		Sparse:          cfg.Sparse,
+		Stats:           cfg.Stats,
+		AppendOnly:      cfg.AppendOnly,
+		OwnerOnly:       cfg.OwnerOnly,
+		TrackOwners:     cfg.TrackOwners,
+		StripMetadata:   cfg.StripMetadata,
+		Retention:       cfg.Retention,
+		Audit:           cfg.Audit,
+		Log:             cfg.Log,
+		Realm:           realm,
+		Users:           users,
+		Cors:            cfg.Cors,
+		Presign:         cfg.Presign,
+		Hooks:           cfg.Hooks,
+		Script:          cfg.Script,
+		script:          cfg.script,
+		storage:         cfg.storage,
+		eventPlugins:    cfg.eventPlugins,
+		HA:              cfg.HA,
+		Maintenance:     cfg.Maintenance,
+		Janitor:         cfg.Janitor,
+		Expiry:          cfg.Expiry,
+		Trash:           cfg.Trash.tenant(t.key()),
+		Versions:        cfg.Versions.tenant(t.key()),
+		Encryption:      cfg.Encryption.tenant(t.key()),
+		redis:           cfg.redis,
+		indexer:         cfg.indexer,
+		thumbnailer:     cfg.thumbnailer,
+		siem:            cfg.siem,
+		securityLog:     cfg.securityLog,
+		failedLogins:    cfg.failedLogins,
+		TrustedProxies:  cfg.TrustedProxies,
+		properties:      cfg.properties,
+		pepper:          cfg.pepper,
+		Roles:           cfg.Roles,
+		Groups:          cfg.Groups,
+		Usernames:       cfg.Usernames,
+	}
+	// The permissions of the users are merged with the ones of their roles and groups
+	for name, user := range users {
+		user.Crud = &CrudType{Crud: user.Permissions}
+		if err := FormatCrud(context.Background(), name, tenant); err != nil {
+			log.WithError(err).WithFields(log.Fields{"host": t.Host, "user": name}).Error("Error parsing crud string from config file")
+		}
+	}
+	return tenant
+}
+
+// parseTenants validates the tenants and derives their configurations.
+func (cfg *Config) parseTenants() error {
+	if len(cfg.Tenants) == 0 {
+		return nil
+	}
+	cfg.tenants = map[string]*Config{}
+	for _, t := range cfg.Tenants {
+		host := t.key()
+		if host == "" || host == "/" {
+			return errors.New("tenant without host or prefix")
+		}
+		if _, ok := cfg.tenants[host]; ok {
+			return fmt.Errorf("duplicate tenant %s", host)
+		}
+		// Falling back to the main directory would break the isolation of the tenants
+		if t.Dir == "" {
+			return fmt.Errorf("tenant %s has no dir", host)
+		}
+		if t.TLS != nil {
+			if t.Host == "" {
+				return fmt.Errorf("tenant %s has a certificate but no host to choose it by", host)
+			}
+			if cfg.TLS == nil {
+				return fmt.Errorf("tenant %s has a certificate but the server isn't listening with TLS", host)
+			}
+			if _, err := t.TLS.keyPair(); err != nil {
+				return fmt.Errorf("tenant %s: %s", host, err)
+			}
+			for _, rule := range t.TLS.ClientCertRules {
+				if err := rule.compile(); err != nil {
+					return fmt.Errorf("tenant %s: %s", host, err)
+				}
+			}
+		}
+		if !validSubdirPolicy(t.SubdirPolicy) {
+			return fmt.Errorf("tenant %s has invalid subdir policy %s", host, t.SubdirPolicy)
+		}
+		tenant := cfg.tenantConfig(t)
+		if err := tenant.applyGroups(); err != nil {
+			return fmt.Errorf("tenant %s: %s", host, err)
+		}
+		tenant.warnSubdirPolicy()
+		tenant.createBaseAndUserDirectoriesIfNeeded()
+		cfg.tenants[host] = tenant
+	}
+	return nil
+}
+
+// updateTenants applies a changed config file to the tenants.
+// Adding or removing tenants requires a restart.
+func updateTenants(cfg *Config, updatedCfg *Config) {
+	updated := map[string]*Tenant{}
+	for _, t := range updatedCfg.Tenants {
+		updated[t.key()] = t
+	}
+	for host, tenant := range cfg.tenants {
+		if t, ok := updated[host]; ok {
+			updateConfig(tenant, cfg.tenantConfig(t))
+		} else {
+			log.WithField("host", host).Warn("Removing a tenant requires a restart")
+		}
+	}
+	for host := range updated {
+		if _, ok := cfg.tenants[host]; !ok {
+			log.WithField("host", host).Warn("Adding a tenant requires a restart")
+		}
+	}
+}
+
+// TenantConfigs returns the configurations of the tenants keyed by their host, the ones of realms by their
+// prefix.
+func (cfg *Config) TenantConfigs() map[string]*Config {
+	return cfg.tenants
+}
+
+// key returns the host of the tenant, or the cleaned prefix of a realm, which starts with a slash unlike hosts.
+func (t *Tenant) key() string {
+	if t.Host == "" {
+		if t.Prefix == "" {
+			return ""
+		}
+		return path.Clean("/" + t.Prefix)
+	}
+	return normalizeHost(t.Host)
+}
+
+// normalizeHost strips the port and the trailing dot from a host name and makes it lower case.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// NewHostRouter returns a handler serving each request by the handler of its Host header. Keys starting with a
+// slash are prefixes of realms, which serve the requests below them for other hosts, the longest prefix wins.
+// Requests for unknown hosts outside of all realms are served by fallback.
+func NewHostRouter(hosts map[string]http.Handler, fallback http.Handler) http.Handler {
+	if len(hosts) == 0 {
+		return fallback
+	}
+	var prefixes []string
+	for key := range hosts {
+		if strings.HasPrefix(key, "/") {
+			prefixes = append(prefixes, key)
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handler, ok := hosts[normalizeHost(r.Host)]; ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		for _, prefix := range prefixes {
+			if hasPathPrefix(r.URL.Path, prefix) {
+				hosts[prefix].ServeHTTP(w, r)
+				return
+			}
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+// ServerTLSConfig returns the TLS settings of the listener with the certificates of the server and all tenants,
+// the certificate is chosen by the server name the client asks for.
+// Client certificates are requested if a client CA is configured.
+func (cfg *Config) ServerTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	files := []*TLS{cfg.TLS}
+	for _, tenant := range cfg.Tenants {
+		if tenant.TLS != nil {
+			files = append(files, tenant.TLS)
+		}
+	}
+	for _, f := range files {
+		certificate, err := f.keyPair()
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, certificate)
+	}
+
+	if cfg.TLS.ClientCAFile != "" {
+		pool, err := loadCertPool(cfg.TLS.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.TLS.ClientCertRequired {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTenants(t *testing.T) {
+	base := t.TempDir()
+	cfg := &Config{
+		Dir:    base,
+		Realm:  "david",
+		pepper: "pepper",
+		Users:  map[string]*UserInfo{"admin": {Permissions: "crud"}},
+		Roles:  map[string]string{"editor": "crud"},
+		Groups: map[string]*Group{"staff": {Permissions: "r"}},
+		Tenants: []*Tenant{
+			{Host: "dav.family.example", Dir: filepath.Join(base, "family"), Users: map[string]*UserInfo{"mom": {Permissions: "crud"}}},
+			{Host: "DAV.work.example.", Dir: filepath.Join(base, "work"), Prefix: "/dav", Realm: "work", Users: map[string]*UserInfo{"boss": {Permissions: "r"}}},
+			{Prefix: "club/", Dir: filepath.Join(base, "club"), Realm: "club", Users: map[string]*UserInfo{"coach": {Permissions: "cr"},
+				"intern": {Role: "editor"}, "clerk": {Groups: []string{"staff"}}}},
+		},
+	}
+	if err := cfg.parseTenants(); err != nil {
+		t.Fatalf("parseTenants() error = %v", err)
+	}
+
+	tests := []struct {
+		host      string
+		user      string
+		wantRealm string
+		wantRead  bool
+	}{
+		{"dav.family.example", "mom", "david", true},
+		{"dav.work.example", "boss", "work", true},
+		{"dav.work.example", "mom", "work", false},
+		{"dav.family.example", "admin", "david", false},
+		{"/club", "coach", "club", true},
+		{"/club", "mom", "club", false},
+		{"/club", "intern", "club", true},
+		{"/club", "clerk", "club", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host+"/"+tt.user, func(t *testing.T) {
+			tenant := cfg.tenants[tt.host]
+			if tenant == nil {
+				t.Fatalf("tenant %s not found", tt.host)
+			}
+			if tenant.Realm != tt.wantRealm {
+				t.Errorf("Realm = %s, want %s", tenant.Realm, tt.wantRealm)
+			}
+			user := tenant.user(tt.user)
+			if (user != nil && user.Crud.Read) != tt.wantRead {
+				t.Errorf("user(%s) = %v, want read permission %v", tt.user, user, tt.wantRead)
+			}
+		})
+	}
+
+	if prefix := cfg.tenants["/club"].Prefix; prefix != "/club" {
+		t.Errorf("Prefix of realm = %s, want /club", prefix)
+	}
+	// The passwords of tenants are peppered like the ones of the main configuration
+	if pepper := cfg.tenants["/club"].pepper; pepper != "pepper" {
+		t.Errorf("pepper of realm = %q, want the one of the main configuration", pepper)
+	}
+
+	invalid := []*Tenant{{Dir: base}, {Host: "dav.example"}, {Host: "dav.example", Dir: base, TLS: &TLS{}}, {Prefix: "/", Dir: base},
+		{Prefix: "/club", Dir: base, TLS: &TLS{}}, {Prefix: "/club", Dir: base, Users: map[string]*UserInfo{"coach": {Role: "coach"}}}}
+	for _, tenant := range invalid {
+		if err := (&Config{Tenants: []*Tenant{tenant}}).parseTenants(); err == nil {
+			t.Errorf("parseTenants(%v) error = nil, want error", tenant)
+		}
+	}
+}
+
+func TestNewHostRouter(t *testing.T) {
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(name)) })
+	}
+	router := NewHostRouter(map[string]http.Handler{
+		"dav.family.example": handler("family"),
+		"/work":              handler("work"),
+		"/work/team":         handler("team"),
+	}, handler("main"))
+
+	tests := []struct {
+		host string
+		path string
+		want string
+	}{
+		{"dav.family.example", "/", "family"},
+		{"DAV.Family.Example:8443", "/", "family"},
+		{"dav.family.example", "/work/file", "family"},
+		{"other.example", "/", "main"},
+		{"other.example", "/work", "work"},
+		{"other.example", "/work/team/file", "team"},
+		{"other.example", "/workshop", "main"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest("PROPFIND", tt.path, nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("served by %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"image"
+	_ "image/gif" // Decoders of the supported formats
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/image/draw"
+)
+
+// thumbnailEndpoint is the path (relative to the configured prefix) below which the thumbnails of the images
+// of the user are served.
+const thumbnailEndpoint = "/_thumbnail"
+
+// Defaults of the thumbnails.
+const (
+	defaultThumbnailSize      = 256
+	defaultThumbnailQuality   = 80
+	defaultThumbnailMaxPixels = 50_000_000
+	thumbnailQueueSize        = 1000
+)
+
+// thumbnailExtensions are the extensions of the images thumbnails are made of.
+var thumbnailExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+// errNoThumbnail is returned for files which have no thumbnail.
+var errNoThumbnail = errors.New("no thumbnail")
+
+// Thumbnails configures the JPEG thumbnails of the images kept in Dir, which fit in squares of the given Sizes
+// (256 pixels by default). They are generated by Workers in the background when images are uploaded, and on
+// the first request of ones missing. Images of more than MaxPixels are skipped.
+type Thumbnails struct {
+	Dir       string
+	Sizes     []int
+	Quality   int
+	Workers   int
+	MaxPixels int
+}
+
+// sizes returns the configured sizes, the first one is the default.
+func (t *Thumbnails) sizes() []int {
+	if len(t.Sizes) == 0 {
+		return []int{defaultThumbnailSize}
+	}
+	return t.Sizes
+}
+
+// thumbnailJob is a physical path whose thumbnails are generated by the storage of config.
+type thumbnailJob struct {
+	config *Config
+	name   string
+}
+
+// thumbnailer generates the thumbnails of the physical paths of the served trees, tenants share it.
+type thumbnailer struct {
+	config *Thumbnails
+	jobs   chan thumbnailJob
+}
+
+// newThumbnailer creates the thumbnailer, its workers are started by start.
+func newThumbnailer(cfg *Thumbnails) *thumbnailer {
+	return &thumbnailer{config: cfg, jobs: make(chan thumbnailJob, thumbnailQueueSize)}
+}
+
+// cacheDir returns the directory of the thumbnails of the file, which mirrors the physical path so the
+// thumbnails of a tree can be removed and moved at once.
+func (t *thumbnailer) cacheDir(name string) string {
+	return filepath.Join(t.config.Dir, strings.TrimPrefix(name, filepath.VolumeName(name)))
+}
+
+// path returns the path of the thumbnail of the file in the given size.
+func (t *thumbnailer) path(name string, size int) string {
+	return filepath.Join(t.cacheDir(name), strconv.Itoa(size)+".jpg")
+}
+
+// fresh reports whether the thumbnail exists and was made of the current content of the file, thumbnails
+// carry the modification time of their image.
+func (t *thumbnailer) fresh(name string, size int, info os.FileInfo) bool {
+	thumb, err := os.Stat(t.path(name, size))
+	return err == nil && thumb.ModTime().Equal(info.ModTime())
+}
+
+// generate creates the missing and outdated thumbnails of the image and returns the number generated.
+func (t *thumbnailer) generate(storage Storage, name string) (int, error) {
+	if !thumbnailExtensions[strings.ToLower(filepath.Ext(name))] {
+		return 0, errNoThumbnail
+	}
+	info, err := storage.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+	if info.IsDir() {
+		return 0, errNoThumbnail
+	}
+	var missing []int
+	for _, size := range t.config.sizes() {
+		if !t.fresh(name, size, info) {
+			missing = append(missing, size)
+		}
+	}
+	if len(missing) == 0 {
+		return 0, nil
+	}
+	f, err := storage.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	// Check the dimensions first, decoding huge images would exhaust the memory
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, err
+	}
+	maxPixels := t.config.MaxPixels
+	if maxPixels <= 0 {
+		maxPixels = defaultThumbnailMaxPixels
+	}
+	if config.Width*config.Height > maxPixels {
+		return 0, errNoThumbnail
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(t.cacheDir(name), 0o700); err != nil {
+		return 0, err
+	}
+	for _, size := range missing {
+		if err := t.write(img, t.path(name, size), size, info); err != nil {
+			return 0, err
+		}
+	}
+	metrics.Add("david_thumbnails_generated_total", "Thumbnails generated.", float64(len(missing)))
+	return len(missing), nil
+}
+
+// write scales the image to fit in a square of the size and writes it as JPEG. Images are never enlarged.
+func (t *thumbnailer) write(img image.Image, name string, size int, info os.FileInfo) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	// Bilinear scaling is good enough for thumbnails and cheap on low-power hardware
+	draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+	quality := t.config.Quality
+	if quality <= 0 {
+		quality = defaultThumbnailQuality
+	}
+	// The thumbnail is written aside and renamed, so concurrent requests never see a partial one
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".thumbnail-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := jpeg.Encode(tmp, scaled, &jpeg.Options{Quality: quality}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// remove removes the thumbnails of the path and the paths below it.
+func (t *thumbnailer) remove(name string) error {
+	return os.RemoveAll(t.cacheDir(name))
+}
+
+// enqueue schedules the generation of the thumbnails of the images at or below the path.
+func (t *thumbnailer) enqueue(cfg *Config, name string) {
+	select {
+	case t.jobs <- thumbnailJob{config: cfg, name: name}:
+	default:
+		log.WithField("path", name).Warn("Thumbnail queue is full, dropping image")
+	}
+}
+
+// publish applies an event of the event stream: thumbnails are generated for uploaded images, and removed
+// along with their images.
+func (t *thumbnailer) publish(cfg *Config, event *Event) {
+	if event.Result != "success" {
+		return
+	}
+	ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: event.User, Authenticated: event.User != ""})
+	name := Resolve(ctx, event.Path, Dir{cfg})
+	if name == "" {
+		return
+	}
+	switch event.Operation {
+	case OperationUpload:
+		t.enqueue(cfg, name)
+	case OperationDelete:
+		if err := t.remove(name); err != nil {
+			log.WithError(err).WithField("path", name).Warn("Error removing thumbnails")
+		}
+	case OperationMove:
+		if err := t.remove(name); err != nil {
+			log.WithError(err).WithField("path", name).Warn("Error removing thumbnails")
+		}
+		if destination := Resolve(ctx, event.Destination, Dir{cfg}); destination != "" {
+			t.enqueue(cfg, destination)
+		}
+	}
+}
+
+// run generates the thumbnails of a job, directories are walked.
+func (t *thumbnailer) run(job thumbnailJob) {
+	storage := Dir{job.config}.storage()
+	info, err := storage.Stat(job.name)
+	if err != nil {
+		return
+	}
+	if !info.IsDir() {
+		if job.config.clientEncrypted(context.Background(), job.name) {
+			return
+		}
+		if _, err := t.generate(storage, job.name); err != nil && !errors.Is(err, errNoThumbnail) {
+			log.WithError(err).WithField("path", job.name).Debug("Error generating thumbnails")
+		}
+		return
+	}
+	filepath.WalkDir(job.name, func(name string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || job.config.clientEncrypted(context.Background(), name) {
+			return nil
+		}
+		if _, err := t.generate(storage, name); err != nil && !errors.Is(err, errNoThumbnail) {
+			log.WithError(err).WithField("path", name).Debug("Error generating thumbnails")
+		}
+		return nil
+	})
+}
+
+// start starts the workers generating the thumbnails of the queued images.
+func (t *thumbnailer) start() {
+	workers := t.config.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range t.jobs {
+				t.run(job)
+			}
+		}()
+	}
+}
+
+// handleThumbnailRequest serves the thumbnail of an image of the user in the size given by the size parameter,
+// generating it if it's missing.
+func handleThumbnailRequest(a *App, ctx context.Context, w http.ResponseWriter, req *http.Request, authInfo *AuthInfo) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		handleMethodNotAllowed(ctx, w, req, http.MethodGet, http.MethodHead)
+		return
+	}
+	if !authInfo.CrudType.Read {
+		writeDAVError(w, http.StatusForbidden, conditionNeedPrivileges, req.URL.Path)
+		return
+	}
+	t := a.Config.thumbnailer
+	size := t.config.sizes()[0]
+	if s := req.URL.Query().Get("size"); s != "" {
+		size, _ = strconv.Atoi(s)
+		valid := false
+		for _, configured := range t.config.sizes() {
+			valid = valid || configured == size
+		}
+		if !valid {
+			http.Error(w, "unsupported size", http.StatusBadRequest)
+			return
+		}
+	}
+	dir := Dir{a.Config}
+	name := Resolve(ctx, path.Clean("/"+strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, a.Config.Prefix), thumbnailEndpoint)), dir)
+	if name == "" || a.Config.clientEncrypted(ctx, name) || dir.hiddenFromUser(ctx, name) || !dir.crudAt(ctx, name).Read {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	generated, err := t.generate(dir.storage(), name)
+	if err != nil {
+		if !errors.Is(err, errNoThumbnail) && !errors.Is(err, os.ErrNotExist) {
+			log.WithError(err).WithField("path", name).Warn("Error generating thumbnails")
+		}
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	cacheLookup("thumbnails", generated == 0)
+	f, err := os.Open(t.path(name, size))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	http.ServeContent(w, req, "", info.ModTime(), f)
+}
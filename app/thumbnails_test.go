@@ -0,0 +1,104 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestThumbnails(t *testing.T) {
+	dir := t.TempDir()
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 600, 300)))
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("text"), 0600)
+	thumbnails := newThumbnailer(&Thumbnails{Dir: t.TempDir(), Sizes: []int{128, 32}})
+	cfg := &Config{
+		Dir: dir,
+		Log: Logging{Create: true},
+		Users: map[string]*UserInfo{
+			"foo":    {Password: GenHash([]byte("password")), Crud: newCrudType("crud")},
+			"writer": {Password: GenHash([]byte("password")), Crud: newCrudType("cu")},
+		},
+		thumbnailer: thumbnails,
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	serve := func(user, method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.SetBasicAuth(user, "password")
+		r.Header.Set("Destination", "http://example.com/moved.png")
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		// Run the queued jobs of the event stream
+		for len(thumbnails.jobs) > 0 {
+			thumbnails.run(<-thumbnails.jobs)
+		}
+		return w
+	}
+
+	tests := []struct {
+		name   string
+		user   string
+		method string
+		path   string
+		body   string
+		want   int
+		size   image.Point
+	}{
+		{"upload generates thumbnails", "foo", http.MethodPut, "/photo.png", img.String(), http.StatusCreated, image.Point{}},
+		{"default size", "foo", http.MethodGet, "/_thumbnail/photo.png", "", http.StatusOK, image.Pt(128, 64)},
+		{"configured size", "foo", http.MethodGet, "/_thumbnail/photo.png?size=32", "", http.StatusOK, image.Pt(32, 16)},
+		{"unsupported size", "foo", http.MethodGet, "/_thumbnail/photo.png?size=64", "", http.StatusBadRequest, image.Point{}},
+		{"no thumbnail of text", "foo", http.MethodGet, "/_thumbnail/notes.txt", "", http.StatusNotFound, image.Point{}},
+		{"thumbnails need read permission", "writer", http.MethodGet, "/_thumbnail/photo.png", "", http.StatusUnauthorized, image.Point{}},
+		{"only reading", "foo", http.MethodPut, "/_thumbnail/photo.png", "", http.StatusMethodNotAllowed, image.Point{}},
+		{"move", "foo", "MOVE", "/photo.png", "", http.StatusCreated, image.Point{}},
+		{"thumbnail of moved image", "foo", http.MethodGet, "/_thumbnail/moved.png?size=32", "", http.StatusOK, image.Pt(32, 16)},
+		{"unknown image", "foo", http.MethodGet, "/_thumbnail/photo.png", "", http.StatusNotFound, image.Point{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.user, tt.method, tt.path, tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body.String(), tt.want)
+			}
+			if tt.size == (image.Point{}) {
+				return
+			}
+			thumb, err := jpeg.Decode(w.Body)
+			if err != nil {
+				t.Fatalf("jpeg.Decode() error = %v", err)
+			}
+			if got := thumb.Bounds().Size(); got != tt.size {
+				t.Errorf("thumbnail size = %v, want %v", got, tt.size)
+			}
+		})
+	}
+
+	// The upload and the move generated the thumbnails in the background, the source ones were removed
+	for _, name := range []string{"photo.png", "moved.png"} {
+		_, err := os.Stat(thumbnails.path(filepath.Join(dir, name), 128))
+		if exists := err == nil; exists != (name == "moved.png") {
+			t.Errorf("thumbnail of %s exists = %v", name, exists)
+		}
+	}
+	// Fresh thumbnails aren't generated again
+	if n, err := thumbnails.generate(osStorage{}, filepath.Join(dir, "moved.png")); n != 0 || err != nil {
+		t.Errorf("generate() = %d, %v, want 0", n, err)
+	}
+	now := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "moved.png"), now, now)
+	if n, err := thumbnails.generate(osStorage{}, filepath.Join(dir, "moved.png")); n != 2 || err != nil {
+		t.Errorf("generate() of changed image = %d, %v, want 2", n, err)
+	}
+}
@@ -0,0 +1,311 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// defaultTieringInterval is used when no interval of the tiering is configured.
+const defaultTieringInterval = 6 * time.Hour
+
+// Tiering migrates files which weren't read for MinIdle (and are at least MinSize large) to an S3 bucket.
+// They are replaced by a sparse stub of the same size and modification time, which is rehydrated transparently
+// when opened. Dir holds the index of the migrated files and has to be outside of the served tree.
+type Tiering struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	Insecure  bool
+	Dir       string
+	MinIdle   time.Duration
+	MinSize   int64
+	Exclude   []string
+	Interval  time.Duration
+}
+
+// objectStore stores the content of migrated files.
+type objectStore interface {
+	put(ctx context.Context, key string, r io.Reader, size int64) error
+	get(ctx context.Context, key string) (io.ReadCloser, error)
+	remove(ctx context.Context, key string) error
+}
+
+// s3Store is an objectStore backed by an S3 compatible bucket.
+type s3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+// openS3Store connects to the bucket of the tiering and checks that it exists.
+func openS3Store(t *Tiering) (*s3Store, error) {
+	client, err := minio.New(t.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(t.AccessKey, t.SecretKey, ""),
+		Secure: !t.Insecure,
+		Region: t.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	exists, err := client.BucketExists(ctx, t.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.New("bucket " + t.Bucket + " doesn't exist")
+	}
+	return &s3Store{client: client, bucket: t.Bucket}, nil
+}
+
+func (s *s3Store) put(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{})
+	return err
+}
+
+func (s *s3Store) get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
+
+func (s *s3Store) remove(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// tieredStorage rehydrates migrated files when they are opened and keeps the index in sync with
+// renames and removals. Stubs have the size and modification time of the file, so Stat is passed through.
+type tieredStorage struct {
+	osStorage
+	tiering *Tiering
+	objects objectStore
+	mu      sync.Mutex
+}
+
+// indexPath returns the path of the index entry of a physical path, which mirrors it below the index directory.
+func (s *tieredStorage) indexPath(name string) string {
+	return filepath.Join(s.tiering.Dir, strings.TrimPrefix(name, filepath.VolumeName(name)))
+}
+
+// objectKey returns the key of a migrated file, if it's one.
+func (s *tieredStorage) objectKey(name string) (string, bool) {
+	key, err := os.ReadFile(s.indexPath(name))
+	if err != nil {
+		return "", false
+	}
+	return string(key), true
+}
+
+// drop removes the index entry and the object of a migrated file which is overwritten.
+func (s *tieredStorage) drop(name string) {
+	key, ok := s.objectKey(name)
+	if !ok {
+		return
+	}
+	os.Remove(s.indexPath(name))
+	if err := s.objects.remove(context.Background(), key); err != nil {
+		log.WithError(err).WithField("key", key).Warn("Error removing migrated file from object storage")
+	}
+}
+
+// rehydrate restores the content of a migrated file from the object storage, keeping its modification time.
+func (s *tieredStorage) rehydrate(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.objectKey(name)
+	if !ok {
+		// Rehydrated concurrently
+		return nil
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	r, err := s.objects.get(context.Background(), key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	temp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".rehydrate")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(temp, r); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	os.Chmod(temp.Name(), info.Mode().Perm())
+	os.Chtimes(temp.Name(), time.Now(), info.ModTime())
+	if err := os.Rename(temp.Name(), name); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	s.drop(name)
+	metrics.Add("david_tiering_rehydrated_total", "Migrated files restored from object storage.", 1)
+	log.WithFields(log.Fields{"path": name, "key": key}).Info("Rehydrated file")
+	return nil
+}
+
+// OpenFile rehydrates migrated files before opening them, truncated ones are only removed from the index.
+func (s *tieredStorage) OpenFile(name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if _, ok := s.objectKey(name); ok {
+		if flag&os.O_TRUNC != 0 {
+			s.drop(name)
+		} else if err := s.rehydrate(name); err != nil {
+			return nil, err
+		}
+	}
+	return s.osStorage.OpenFile(name, flag, perm)
+}
+
+// RemoveAll removes a file or directory along with the migrated content of its files.
+func (s *tieredStorage) RemoveAll(name string) error {
+	if err := s.osStorage.RemoveAll(name); err != nil {
+		return err
+	}
+	index := s.indexPath(name)
+	filepath.Walk(index, func(entry string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			if key, err := os.ReadFile(entry); err == nil {
+				s.objects.remove(context.Background(), string(key))
+			}
+		}
+		return nil
+	})
+	return os.RemoveAll(index)
+}
+
+// Rename renames a file or directory, the index entries of migrated files are moved along with it.
+func (s *tieredStorage) Rename(oldName, newName string) error {
+	s.drop(newName)
+	if err := s.osStorage.Rename(oldName, newName); err != nil {
+		return err
+	}
+	if _, err := os.Stat(s.indexPath(oldName)); err != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.indexPath(newName)), 0700); err != nil {
+		return err
+	}
+	return os.Rename(s.indexPath(oldName), s.indexPath(newName))
+}
+
+// migrate moves the content of a file to the object storage and replaces it by a sparse stub.
+func (s *tieredStorage) migrate(name string, info os.FileInfo, now time.Time) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	key := path.Join(s.tiering.Prefix, strconv.FormatInt(now.UnixNano(), 10), filepath.Base(name))
+	err = s.objects.put(context.Background(), key, f, info.Size())
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Files changed during the upload are left alone
+	if current, err := os.Stat(name); err != nil || current.Size() != info.Size() || !current.ModTime().Equal(info.ModTime()) {
+		s.objects.remove(context.Background(), key)
+		return errors.New("file changed during migration")
+	}
+	index := s.indexPath(name)
+	if err := os.MkdirAll(filepath.Dir(index), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(index, []byte(key), 0600); err != nil {
+		return err
+	}
+	// Truncating to zero frees the blocks, extending again leaves a hole of the original size
+	if err := os.Truncate(name, 0); err != nil {
+		os.Remove(index)
+		return err
+	}
+	if err := os.Truncate(name, info.Size()); err != nil {
+		return err
+	}
+	return os.Chtimes(name, accessTime(info), info.ModTime())
+}
+
+// tierColdFiles migrates the files below the base directory which weren't read for the minimum idle time
+// and returns their number and size.
+func (cfg *Config) tierColdFiles(s *tieredStorage, now time.Time) (int, int64) {
+	migrated, size := 0, int64(0)
+	filepath.Walk(filepath.Clean(cfg.Dir), func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, ok := cfg.relPath(name)
+		if !ok {
+			return nil
+		}
+		for _, exclude := range s.tiering.Exclude {
+			if hasFilePathPrefix(rel, path.Clean("/"+exclude)) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		if cfg.Staging != nil && cfg.Staging.Dir != "" && filepath.Clean(cfg.Staging.Dir) == name {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() || info.Size() == 0 || info.Size() < s.tiering.MinSize || now.Sub(accessTime(info)) < s.tiering.MinIdle {
+			return nil
+		}
+		if _, ok := s.objectKey(name); ok {
+			return nil
+		}
+		if err := s.migrate(name, info, now); err != nil {
+			log.WithError(err).WithField("path", rel).Warn("Error migrating file to object storage")
+			return nil
+		}
+		migrated++
+		size += info.Size()
+		return nil
+	})
+	metrics.Add("david_tiering_migrated_total", "Files migrated to object storage.", float64(migrated))
+	metrics.Add("david_tiering_migrated_bytes_total", "Bytes migrated to object storage.", float64(size))
+	return migrated, size
+}
+
+// startTiering periodically migrates the cold files of the main configuration and the tenants.
+func (cfg *Config) startTiering(s *tieredStorage) {
+	interval := cfg.Tiering.Interval
+	if interval <= 0 {
+		interval = defaultTieringInterval
+	}
+	go func() {
+		for now := range time.Tick(interval) {
+			configs := []*Config{cfg}
+			for _, tenant := range cfg.tenants {
+				configs = append(configs, tenant)
+			}
+			for _, c := range configs {
+				if migrated, size := c.tierColdFiles(s, now); migrated != 0 {
+					log.WithFields(log.Fields{"path": c.Dir, "migrated": migrated, "bytes": size}).Info("Migrated cold files")
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memObjects is an in-memory objectStore.
+type memObjects struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *memObjects) put(_ context.Context, key string, r io.Reader, _ int64) error {
+	b, err := io.ReadAll(r)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = b
+	return err
+}
+
+func (m *memObjects) get(_ context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.objects[key]
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m *memObjects) remove(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func TestTiering(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	content := bytes.Repeat([]byte("cold"), 4096)
+	for _, name := range []string{"cold.bin", "moved.bin", "deleted.bin", "hot.bin", "excluded/cold.bin"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0700)
+		os.WriteFile(filepath.Join(dir, name), content, 0600)
+		if name != "hot.bin" {
+			os.Chtimes(filepath.Join(dir, name), old, old)
+		}
+	}
+	objects := &memObjects{objects: map[string][]byte{}}
+	s := &tieredStorage{tiering: &Tiering{Dir: t.TempDir(), MinIdle: 24 * time.Hour, Exclude: []string{"/excluded"}}, objects: objects}
+	cfg := &Config{Dir: dir, storage: s}
+
+	if migrated, size := cfg.tierColdFiles(s, time.Now()); migrated != 3 || size != 3*int64(len(content)) {
+		t.Fatalf("tierColdFiles() = %d, %d, want 3 files", migrated, size)
+	}
+	if len(objects.objects) != 3 {
+		t.Fatalf("objects = %d, want 3", len(objects.objects))
+	}
+	// Stubs keep the size and modification time
+	info, err := os.Stat(filepath.Join(dir, "cold.bin"))
+	if err != nil || info.Size() != int64(len(content)) || !info.ModTime().Equal(old) {
+		t.Errorf("stub = %v (%v), want the size and modification time of the file", info, err)
+	}
+
+	// Renamed stubs are rehydrated at their new path, deleted ones removed from the bucket
+	if err := s.Rename(filepath.Join(dir, "moved.bin"), filepath.Join(dir, "renamed.bin")); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if err := s.RemoveAll(filepath.Join(dir, "deleted.bin")); err != nil {
+		t.Fatalf("RemoveAll() error = %v", err)
+	}
+	for _, name := range []string{"cold.bin", "renamed.bin"} {
+		f, err := s.OpenFile(filepath.Join(dir, name), os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatalf("OpenFile(%s) error = %v", name, err)
+		}
+		got, _ := io.ReadAll(f)
+		f.Close()
+		if !bytes.Equal(got, content) {
+			t.Errorf("content of %s = %d bytes, want the rehydrated file", name, len(got))
+		}
+	}
+	if len(objects.objects) != 0 {
+		t.Errorf("objects = %d, want none after rehydration and removal", len(objects.objects))
+	}
+	if _, ok := s.objectKey(filepath.Join(dir, "cold.bin")); ok {
+		t.Error("rehydrated file still in the index")
+	}
+}
@@ -0,0 +1,256 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultPurgeInterval is used when no interval of the purge is configured.
+const defaultPurgeInterval = time.Hour
+
+// versionSeparator separates the name of a file from the time of its version in the version directory.
+const versionSeparator = ";"
+
+// Trash keeps deleted files and directories in Dir, outside of the served tree and on the same file system,
+// for Retention before they are purged. Entries are stored as <Dir>/<unix nanoseconds>/<path below the base directory>.
+type Trash struct {
+	Dir       string
+	Retention time.Duration
+}
+
+// Versions keeps the previous content of files overwritten by uploads in Dir, outside of the served tree.
+// At most Keep versions of a file are kept (all if 0), none longer than Retention (forever if 0).
+// Versions are stored as <Dir>/<path below the base directory>;<unix nanoseconds>.
+type Versions struct {
+	Dir       string
+	Keep      int
+	Retention time.Duration
+}
+
+// PurgeReport holds the number of trash entries and versions removed by a purge and the space reclaimed.
+type PurgeReport struct {
+	TrashEntries  int   `json:"trashEntries"`
+	TrashBytes    int64 `json:"trashBytes"`
+	Versions      int   `json:"versions"`
+	VersionsBytes int64 `json:"versionsBytes"`
+}
+
+// tenant returns the trash of a tenant, which is kept in a subdirectory named after its host.
+func (t *Trash) tenant(host string) *Trash {
+	if t == nil {
+		return nil
+	}
+	return &Trash{Dir: filepath.Join(t.Dir, host), Retention: t.Retention}
+}
+
+// tenant returns the versions of a tenant, which are kept in a subdirectory named after its host.
+func (v *Versions) tenant(host string) *Versions {
+	if v == nil {
+		return nil
+	}
+	return &Versions{Dir: filepath.Join(v.Dir, host), Keep: v.Keep, Retention: v.Retention}
+}
+
+// moveToTrash moves a file or directory into the trash instead of removing it.
+func (cfg *Config) moveToTrash(name string, now time.Time) error {
+	rel, ok := cfg.relPath(name)
+	if !ok {
+		return os.ErrInvalid
+	}
+	target := filepath.Join(cfg.Trash.Dir, strconv.FormatInt(now.UnixNano(), 10), filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+	return Dir{Config: cfg}.storage().Rename(name, target)
+}
+
+// keepVersion copies the current content of an existing file to the versions before it is overwritten.
+// The content is copied as uploads without staging truncate the file in place.
+func (cfg *Config) keepVersion(ctx context.Context, name string, now time.Time) error {
+	storage := Dir{Config: cfg}.storage()
+	info, err := storage.Stat(name)
+	if err != nil || info.IsDir() {
+		// Nothing to keep for new files
+		return nil
+	}
+	rel, ok := cfg.relPath(name)
+	if !ok {
+		return os.ErrInvalid
+	}
+	target := filepath.Join(cfg.Versions.Dir, filepath.FromSlash(rel)) + versionSeparator + strconv.FormatInt(now.UnixNano(), 10)
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return noteDiskFull(ctx, err)
+	}
+	src, err := storage.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return noteDiskFull(ctx, err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(target)
+		return noteDiskFull(ctx, err)
+	}
+	return noteDiskFull(ctx, dst.Close())
+}
+
+// diskUsage returns the size of the files below name.
+func diskUsage(name string) int64 {
+	var size int64
+	filepath.Walk(name, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// purgeTrash removes the trash entries older than the retention period.
+func (cfg *Config) purgeTrash(now time.Time, report *PurgeReport) error {
+	entries, err := os.ReadDir(cfg.Trash.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		deleted, err := strconv.ParseInt(entry.Name(), 10, 64)
+		if err != nil || now.Sub(time.Unix(0, deleted)) < cfg.Trash.Retention {
+			continue
+		}
+		name := filepath.Join(cfg.Trash.Dir, entry.Name())
+		size := diskUsage(name)
+		if err := os.RemoveAll(name); err != nil {
+			return err
+		}
+		report.TrashEntries++
+		report.TrashBytes += size
+	}
+	return nil
+}
+
+// purgeVersions removes the versions exceeding the number to keep or older than the retention period.
+func (cfg *Config) purgeVersions(now time.Time, report *PurgeReport) error {
+	type version struct {
+		name string
+		time int64
+		size int64
+	}
+	// Versions are grouped by the file they belong to
+	files := map[string][]version{}
+	err := filepath.Walk(cfg.Versions.Dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		i := strings.LastIndex(name, versionSeparator)
+		if info.IsDir() || i < 0 {
+			return nil
+		}
+		saved, err := strconv.ParseInt(name[i+1:], 10, 64)
+		if err != nil {
+			return nil
+		}
+		files[name[:i]] = append(files[name[:i]], version{name, saved, info.Size()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, versions := range files {
+		sort.Slice(versions, func(i, j int) bool { return versions[i].time > versions[j].time })
+		for i, v := range versions {
+			expired := cfg.Versions.Retention > 0 && now.Sub(time.Unix(0, v.time)) >= cfg.Versions.Retention
+			if !expired && (cfg.Versions.Keep <= 0 || i < cfg.Versions.Keep) {
+				continue
+			}
+			if err := os.Remove(v.name); err != nil {
+				return err
+			}
+			report.Versions++
+			report.VersionsBytes += v.size
+		}
+	}
+	return nil
+}
+
+// purge removes the expired trash entries and versions of the configuration and reports them as metrics.
+func (cfg *Config) purge(now time.Time) (*PurgeReport, error) {
+	report := &PurgeReport{}
+	if cfg.Trash != nil {
+		if err := cfg.purgeTrash(now, report); err != nil {
+			return report, err
+		}
+	}
+	if cfg.Versions != nil {
+		if err := cfg.purgeVersions(now, report); err != nil {
+			return report, err
+		}
+	}
+	metrics.Add("david_purged_entries_total", "Trash entries and file versions purged.", float64(report.TrashEntries), "kind", "trash")
+	metrics.Add("david_purged_entries_total", "Trash entries and file versions purged.", float64(report.Versions), "kind", "version")
+	metrics.Add("david_purged_bytes_total", "Space reclaimed by purging trash entries and file versions.", float64(report.TrashBytes), "kind", "trash")
+	metrics.Add("david_purged_bytes_total", "Space reclaimed by purging trash entries and file versions.", float64(report.VersionsBytes), "kind", "version")
+	return report, nil
+}
+
+// Purge removes the expired trash entries and versions of the main configuration and the tenants at once.
+func Purge(cfg *Config, now time.Time) (*PurgeReport, error) {
+	total := &PurgeReport{}
+	configs := []*Config{cfg}
+	for _, tenant := range cfg.tenants {
+		configs = append(configs, tenant)
+	}
+	for _, c := range configs {
+		report, err := c.purge(now)
+		total.TrashEntries += report.TrashEntries
+		total.TrashBytes += report.TrashBytes
+		total.Versions += report.Versions
+		total.VersionsBytes += report.VersionsBytes
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// startPurge periodically purges the expired trash entries and versions.
+func (cfg *Config) startPurge() {
+	interval := cfg.PurgeInterval
+	if interval <= 0 {
+		interval = defaultPurgeInterval
+	}
+	go func() {
+		for now := range time.Tick(interval) {
+			report, err := Purge(cfg, now)
+			if err != nil {
+				log.WithError(err).Error("Error purging trash and versions")
+			}
+			if report.TrashEntries != 0 || report.Versions != 0 {
+				log.WithFields(log.Fields{
+					"trashEntries":  report.TrashEntries,
+					"trashBytes":    report.TrashBytes,
+					"versions":      report.Versions,
+					"versionsBytes": report.VersionsBytes,
+				}).Info("Purged trash and versions")
+			}
+		}
+	}()
+}
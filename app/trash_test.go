@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestTrashAndVersions(t *testing.T) {
+	dir, trash, versions := t.TempDir(), t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "docs"), 0700)
+	os.WriteFile(filepath.Join(dir, "docs", "a.txt"), []byte("first"), 0600)
+	cfg := &Config{
+		Dir:      dir,
+		Log:      Logging{Create: true},
+		Users:    map[string]*UserInfo{"foo": {Crud: newCrudType("crud")}},
+		Trash:    &Trash{Dir: trash, Retention: time.Hour},
+		Versions: &Versions{Dir: versions, Keep: 2},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	serve := func(method, path, body string) int {
+		w := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "foo", Authenticated: true})
+		serveWebdav(a, ctx, w, httptest.NewRequest(method, path, strings.NewReader(body)), "foo")
+		return w.Code
+	}
+
+	// Each overwrite keeps the previous content
+	for _, content := range []string{"second", "third", "fourth"} {
+		if code := serve(http.MethodPut, "/docs/a.txt", content); code != http.StatusCreated && code != http.StatusNoContent {
+			t.Fatalf("PUT = %d", code)
+		}
+	}
+	kept, _ := filepath.Glob(filepath.Join(versions, "docs", "a.txt"+versionSeparator+"*"))
+	if len(kept) != 3 {
+		t.Fatalf("versions = %v, want 3", kept)
+	}
+	if content, _ := os.ReadFile(kept[0]); string(content) != "first" {
+		t.Errorf("oldest version = %q, want %q", content, "first")
+	}
+
+	// Deleted files are moved into the trash
+	if code := serve(http.MethodDelete, "/docs", ""); code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d", code)
+	}
+	if deleted, _ := filepath.Glob(filepath.Join(trash, "*", "docs", "a.txt")); len(deleted) != 1 {
+		t.Errorf("trash = %v, want the deleted file", deleted)
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want PurgeReport
+	}{
+		{"within retention", time.Now(), PurgeReport{Versions: 1, VersionsBytes: 5}},
+		{"after retention", time.Now().Add(2 * time.Hour), PurgeReport{TrashEntries: 1, TrashBytes: 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Purge(cfg, tt.now)
+			if err != nil {
+				t.Fatalf("Purge() error = %v", err)
+			}
+			if *report != tt.want {
+				t.Errorf("Purge() = %+v, want %+v", *report, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Defaults of the authentication of Unix accounts.
+const (
+	defaultShadowFile = "/etc/shadow"
+	defaultUnixMinUID = 1000
+)
+
+// Unix authenticates system accounts unknown to the configuration by the password hashes of the Shadow file
+// (/etc/shadow if empty) without PAM, which requires david to be allowed to read it. Accounts with a uid
+// below MinUID (1000 if zero), like the ones of daemons, are denied, the others get Permissions. With Home
+// they're jailed in their home directory if it's below the base directory, else in a subdir named after them.
+type Unix struct {
+	Shadow      string
+	Permissions string
+	MinUID      int `mapstructure:"min_uid"`
+	Home        bool
+}
+
+// lookupUnixAccount returns the uid and home directory of a system account, replaced by tests.
+var lookupUnixAccount = func(username string) (int, string, error) {
+	account, err := user.Lookup(username)
+	if err != nil {
+		return 0, "", err
+	}
+	uid, err := strconv.Atoi(account.Uid)
+	if err != nil {
+		return 0, "", err
+	}
+	return uid, account.HomeDir, nil
+}
+
+// shadowEntry returns the password hash of an account in the shadow file and whether the account expired at
+// now. The expiry is given in days since the epoch.
+func shadowEntry(path, username string, now time.Time) (string, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 2 || fields[0] != username {
+			continue
+		}
+		expired := false
+		if len(fields) > 7 && fields[7] != "" {
+			if days, err := strconv.ParseInt(fields[7], 10, 64); err == nil {
+				expired = !now.Before(time.Unix(days*24*60*60, 0))
+			}
+		}
+		return fields[1], expired, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", false, err
+	}
+	return "", false, errors.New("no such account")
+}
+
+// verifyCrypt compares a password hash of crypt(3) with a password. Locked accounts, whose hashes start with
+// ! or *, never match.
+func verifyCrypt(hash, password string) error {
+	switch {
+	case hash == "" || strings.HasPrefix(hash, "!") || strings.HasPrefix(hash, "*"):
+		return errors.New("account is locked or has no password")
+	case isShaCrypt(hash):
+		return verifyShaCrypt(hash, password)
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	}
+	return errUnsupportedCrypt
+}
+
+// authenticateWithUnix verifies the password of a system account against the shadow file.
+func authenticateWithUnix(cfg *Config, username, password string) (*AuthInfo, error) {
+	uid, home, err := lookupUnixAccount(username)
+	if err != nil {
+		return nil, err
+	}
+	minUID := cfg.Unix.MinUID
+	if minUID == 0 {
+		minUID = defaultUnixMinUID
+	}
+	if uid < minUID {
+		return nil, errors.New("uid " + strconv.Itoa(uid) + " of system account is below the minimum")
+	}
+	shadow := cfg.Unix.Shadow
+	if shadow == "" {
+		shadow = defaultShadowFile
+	}
+	hash, expired, err := shadowEntry(shadow, username, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyCrypt(hash, password); err != nil {
+		if errors.Is(err, errUnsupportedCrypt) {
+			log.WithField("user", username).Warn("Password hash of system account isn't supported, use sha512crypt or bcrypt")
+		}
+		return nil, err
+	}
+	if expired {
+		return nil, errors.New("system account expired")
+	}
+
+	user := &UserInfo{Permissions: cfg.Unix.Permissions, Crud: &CrudType{Crud: cfg.Unix.Permissions}}
+	if cfg.Unix.Home {
+		subdir := "/" + username
+		if rel, err := filepath.Rel(cfg.Dir, home); err == nil && withinDir(cfg.Dir, home) {
+			subdir = "/" + filepath.ToSlash(rel)
+		} else if err := os.MkdirAll(filepath.Join(cfg.Dir, subdir), 0700); err != nil {
+			return nil, err
+		}
+		user.Subdir = &subdir
+	}
+	cfg.externalUsers.Store(username, user)
+	if err := FormatCrud(context.Background(), username, cfg); err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{"user": username, "crud": user.Crud}).Debug("User was authenticated by the shadow file")
+	return &AuthInfo{Username: username, Authenticated: true, CrudType: user.Crud}, nil
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyCrypt(t *testing.T) {
+	// Hashes of "Hello world!" by openssl passwd and crypt(3)
+	tests := []struct {
+		hash    string
+		wantErr bool
+	}{
+		{"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", false},
+		{"$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", false},
+		{"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.", false},
+		{"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz2", true},
+		{GenHash([]byte("Hello world!")), false},
+		{"!$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", true},
+		{"*", true},
+		{"$y$j9T$salt$hash", true},
+	}
+	for _, tt := range tests {
+		if err := verifyCrypt(tt.hash, "Hello world!"); (err != nil) != tt.wantErr {
+			t.Errorf("verifyCrypt(%s) error = %v, want error %v", tt.hash, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAuthenticateWithUnix(t *testing.T) {
+	dir := t.TempDir()
+	hash := "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"
+	shadow := filepath.Join(t.TempDir(), "shadow")
+	expired := time.Now().Add(-48*time.Hour).Unix() / (24 * 60 * 60)
+	os.WriteFile(shadow, []byte("root:"+hash+":19000:0:99999:7:::\n"+
+		"alice:"+hash+":19000:0:99999:7:::\n"+
+		"bob:"+hash+":19000:0:99999:7:::\n"+
+		"carol:!"+hash+":19000:0:99999:7:::\n"+
+		"dave:"+hash+":19000:0:99999:7::"+strconv.FormatInt(expired, 10)+":\n"), 0o600)
+	accounts := map[string]struct {
+		uid  int
+		home string
+	}{
+		"root":  {0, "/root"},
+		"alice": {1000, filepath.Join(dir, "alice")},
+		"bob":   {1001, "/home/bob"},
+		"carol": {1002, filepath.Join(dir, "carol")},
+		"dave":  {1003, filepath.Join(dir, "dave")},
+	}
+	defer func(lookup func(string) (int, string, error)) { lookupUnixAccount = lookup }(lookupUnixAccount)
+	lookupUnixAccount = func(username string) (int, string, error) {
+		account, ok := accounts[username]
+		if !ok {
+			return 0, "", errors.New("unknown user")
+		}
+		return account.uid, account.home, nil
+	}
+
+	cfg := &Config{Dir: dir, Unix: &Unix{Shadow: shadow, Permissions: "crud", Home: true}}
+	a := &App{Config: cfg}
+	tests := []struct {
+		username   string
+		password   string
+		wantSubdir string
+	}{
+		{"alice", "Hello world!", "/alice"},
+		{"bob", "Hello world!", "/bob"},
+		{"alice", "wrong", ""},
+		{"root", "Hello world!", ""},
+		{"carol", "Hello world!", ""},
+		{"dave", "Hello world!", ""},
+		{"eve", "Hello world!", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("PROPFIND", "/", nil)
+		req.SetBasicAuth(tt.username, tt.password)
+		authInfo := authenticateBasic(a, req)
+		if tt.wantSubdir == "" {
+			if authInfo != nil && authInfo.Authenticated {
+				t.Errorf("%s/%s was authenticated", tt.username, tt.password)
+			}
+			continue
+		}
+		if authInfo == nil || !authInfo.Authenticated || authInfo.CrudType.Crud != "crud" {
+			t.Errorf("authenticateBasic(%s) = %v, want crud", tt.username, authInfo)
+			continue
+		}
+		if user := cfg.user(tt.username); user == nil || user.Subdir == nil || *user.Subdir != tt.wantSubdir {
+			t.Errorf("user(%s) = %v, want subdir %s", tt.username, user, tt.wantSubdir)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dir, "bob")); err != nil || !info.IsDir() {
+		t.Errorf("subdir of user with home outside of the base dir wasn't created: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// uploadBodyKey holds the uploadBody of a PUT in the request context.
+var uploadBodyKey contextKey = 3
+
+// errChecksumMismatch fails an upload whose content doesn't match the checksum sent by the client.
+var errChecksumMismatch = errors.New("content doesn't match its checksum")
+
+// uploadDigest is a checksum of an upload announced in a request header.
+type uploadDigest struct {
+	hash hash.Hash
+	want []byte
+}
+
+// uploadBody is the body of an upload with its announced size and checksums. It remembers whether reading
+// it failed, like on a dropped connection, or its content didn't match the checksums.
+type uploadBody struct {
+	io.ReadCloser
+	size     int64
+	digests  []uploadDigest
+	verified bool
+	err      error
+}
+
+// newUploadBody wraps the body of a PUT, verifying it against the Content-MD5 (RFC 1864) and the
+// X-Content-SHA256 (hex or base64) headers if present.
+func newUploadBody(req *http.Request) (*uploadBody, error) {
+	body := &uploadBody{ReadCloser: req.Body, size: req.ContentLength}
+	if value := req.Header.Get("Content-MD5"); value != "" {
+		want, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(want) != md5.Size {
+			return nil, errors.New("malformed Content-MD5 header")
+		}
+		body.digests = append(body.digests, uploadDigest{md5.New(), want})
+	}
+	if value := req.Header.Get("X-Content-SHA256"); value != "" {
+		want, err := hex.DecodeString(value)
+		if err != nil {
+			want, err = base64.StdEncoding.DecodeString(value)
+		}
+		if err != nil || len(want) != sha256.Size {
+			return nil, errors.New("malformed X-Content-SHA256 header")
+		}
+		body.digests = append(body.digests, uploadDigest{sha256.New(), want})
+	}
+	return body, nil
+}
+
+// verifies reports whether the upload has checksums to match.
+func (b *uploadBody) verifies() bool {
+	return len(b.digests) != 0
+}
+
+// Read records the first read error other than the end of the body, and verifies the checksums at its end.
+func (b *uploadBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	for _, d := range b.digests {
+		d.hash.Write(p[:n])
+	}
+	if err == io.EOF && !b.verified {
+		b.verified = true
+		for _, d := range b.digests {
+			if !bytes.Equal(d.hash.Sum(nil), d.want) {
+				err = errChecksumMismatch
+				break
+			}
+		}
+	}
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// checksumWriter answers an upload not matching its checksum with 400 Bad Request instead of the status
+// of the webdav handler.
+type checksumWriter struct {
+	http.ResponseWriter
+	body     *uploadBody
+	replaced bool
+}
+
+// WriteHeader writes a DAV:error body if the checksum didn't match and passes all other statuses.
+func (w *checksumWriter) WriteHeader(status int) {
+	if status < http.StatusBadRequest || w.body.err != errChecksumMismatch || w.replaced {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	writeDAVError(w.ResponseWriter, http.StatusBadRequest, conditionChecksumMismatch)
+	w.replaced = true
+}
+
+// Write discards the original body after it has been replaced.
+func (w *checksumWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// uploadFromContext returns the body of the upload served in ctx, nil for other requests.
+func uploadFromContext(ctx context.Context) *uploadBody {
+	body, _ := ctx.Value(uploadBodyKey).(*uploadBody)
+	return body
+}
+
+// preallocate reserves the announced size of an upload, so large files are written with less fragmentation.
+// File systems without support for it are skipped, a lack of space fails the upload before it starts.
+func preallocate(ctx context.Context, f webdav.File) error {
+	body := uploadFromContext(ctx)
+	if body == nil || body.size <= 0 {
+		return nil
+	}
+	file, ok := f.(interface{ Fd() uintptr })
+	if !ok {
+		return nil
+	}
+	err := fallocate(file.Fd(), body.size)
+	if err != nil && diskFullReason(err) == "" {
+		log.WithError(err).WithField("size", body.size).Debug("Skipped preallocation of upload")
+		return nil
+	}
+	return err
+}
+
+// bufferedFile collects the writes of an upload into larger ones of the configured buffer size.
+type bufferedFile struct {
+	webdav.File
+	w *bufio.Writer
+}
+
+// newBufferedFile buffers the writes to f in a buffer of size bytes.
+func newBufferedFile(f webdav.File, size int) *bufferedFile {
+	return &bufferedFile{File: f, w: bufio.NewWriterSize(f, size)}
+}
+
+// Write adds b to the buffer, which is written to the file once it is full.
+func (f *bufferedFile) Write(b []byte) (int, error) {
+	return f.w.Write(b)
+}
+
+// Read flushes the buffer before reading from the file.
+func (f *bufferedFile) Read(b []byte) (int, error) {
+	if err := f.w.Flush(); err != nil {
+		return 0, err
+	}
+	return f.File.Read(b)
+}
+
+// Seek flushes the buffer before moving the offset of the file.
+func (f *bufferedFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.w.Flush(); err != nil {
+		return 0, err
+	}
+	return f.File.Seek(offset, whence)
+}
+
+// Stat flushes the buffer, so the size of the file includes all writes.
+func (f *bufferedFile) Stat() (os.FileInfo, error) {
+	if err := f.w.Flush(); err != nil {
+		return nil, err
+	}
+	return f.File.Stat()
+}
+
+// Close flushes the buffer and closes the file.
+func (f *bufferedFile) Close() error {
+	flushErr := f.w.Flush()
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return flushErr
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestBufferedFile(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bf := newBufferedFile(f, 16)
+	bf.Write([]byte("abc"))
+	if info, _ := f.Stat(); info.Size() != 0 {
+		t.Errorf("size before flush = %d, want 0", info.Size())
+	}
+	// Stat is used for the ETag of an upload, it has to see all writes
+	if info, err := bf.Stat(); err != nil || info.Size() != 3 {
+		t.Errorf("Stat() = %v, %v, want size 3", info, err)
+	}
+	bf.Write([]byte("def"))
+	if err := bf.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if content, _ := os.ReadFile(f.Name()); string(content) != "abcdef" {
+		t.Errorf("content = %q, want abcdef", content)
+	}
+}
+
+func TestTunedUpload(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		want          string
+	}{
+		{"complete", "0123456789", 10, "0123456789"},
+		{"shorter than announced", "01234", 1 << 20, "01234"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &Config{
+				Dir:             dir,
+				Log:             Logging{Create: true},
+				Preallocate:     true,
+				WriteBufferSize: 4,
+				Users:           map[string]*UserInfo{"foo": {Crud: newCrudType("crud")}},
+			}
+			a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+			ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "foo", Authenticated: true})
+			r := httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader(tt.body))
+			r.ContentLength = tt.contentLength
+			serveWebdav(a, ctx, httptest.NewRecorder(), r, "foo")
+
+			// The preallocated space must not show up in the size of the file
+			if content, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(content) != tt.want {
+				t.Errorf("content = %q, want %q", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestChecksumUpload(t *testing.T) {
+	md5Sum := md5.Sum([]byte("new"))
+	sha256Sum := sha256.Sum256([]byte("new"))
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		status int
+		want   string
+	}{
+		{"matching md5", "Content-MD5", base64.StdEncoding.EncodeToString(md5Sum[:]), http.StatusCreated, "new"},
+		{"matching sha256", "X-Content-SHA256", hex.EncodeToString(sha256Sum[:]), http.StatusCreated, "new"},
+		{"mismatching md5", "Content-MD5", base64.StdEncoding.EncodeToString(make([]byte, md5.Size)), http.StatusBadRequest, "old"},
+		{"malformed", "Content-MD5", "abc", http.StatusBadRequest, "old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, "a.txt"), []byte("old"), 0600)
+			cfg := &Config{Dir: dir, Users: map[string]*UserInfo{"foo": {Crud: newCrudType("crud")}}}
+			a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+			ctx := context.WithValue(context.Background(), authInfoKey, &AuthInfo{Username: "foo", Authenticated: true})
+			r := httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("new"))
+			r.Header.Set(tt.header, tt.value)
+			w := httptest.NewRecorder()
+			serveWebdav(a, ctx, w, r, "foo")
+
+			if w.Code != tt.status {
+				t.Errorf("PUT = %d %s, want %d", w.Code, w.Body.String(), tt.status)
+			}
+			// A mismatching upload never replaces the file
+			if content, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(content) != tt.want {
+				t.Errorf("content = %q, want %q", content, tt.want)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("temp files left: %v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package app
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// ErasureReport summarizes what EraseUser removed.
+type ErasureReport struct {
+	Account           bool   `json:"account"`
+	Files             string `json:"files"`
+	Pseudonym         string `json:"pseudonym"`
+	AuditEntries      int    `json:"auditEntries"`
+	AccountingRecords int    `json:"accountingRecords"`
+}
+
+// userFiles returns the directory holding only the files of a user. Users without their own subdir
+// share the base directory with others, their files can't be told apart.
+func userFiles(cfg *Config, username string) (string, error) {
+	user := cfg.user(username)
+	if user == nil {
+		return "", errors.New("unknown user " + username)
+	}
+	root := filepath.Clean(cfg.Dir)
+	dir := filepath.Clean(userRoot(cfg, username))
+	if foldPath(dir) == foldPath(root) {
+		return "", errors.New("user " + username + " has no subdir of their own")
+	}
+	for name, other := range cfg.Users {
+		subdir, _ := cfg.subdirOf(name, other)
+		if name == username || subdir == "" {
+			continue
+		}
+		otherDir := filepath.Clean(filepath.Join(cfg.Dir, subdir))
+		if withinDir(dir, otherDir) || withinDir(otherDir, dir) {
+			return "", errors.New("the subdir of user " + username + " overlaps with the one of " + name)
+		}
+	}
+	return dir, nil
+}
+
+// readAuditEntries reads all entries of the audit file, a missing file has no entries.
+func readAuditEntries(file string) ([]AuditEntry, error) {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// addTarFile adds a file with the given content to the tarball.
+func addTarFile(tw *tar.Writer, name string, content []byte) error {
+	header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), ModTime: time.Now()}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+// jsonLines encodes each item on a line of its own.
+func jsonLines[T any](items []T) ([]byte, error) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	for _, item := range items {
+		if err := encoder.Encode(item); err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// ExportUser writes a gzipped tarball with everything stored about a user: the account without its password
+// (account.json), the files of their subdir (files/), their audit history (audit.jsonl) and their accounting
+// records (accounting.jsonl).
+func ExportUser(cfg *Config, username string, w io.Writer) error {
+	dir, err := userFiles(cfg, username)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	user := cfg.user(username)
+	account, err := json.MarshalIndent(struct {
+		User        string  `json:"user"`
+		Subdir      *string `json:"subdir"`
+		Permissions string  `json:"permissions"`
+		Admin       bool    `json:"admin"`
+	}{username, user.Subdir, user.Permissions, user.Admin}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := addTarFile(tw, "account.json", account); err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() && !info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(filepath.Join("files", rel))
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil || info.IsDir() {
+			return err
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if cfg.Audit != nil && cfg.Audit.File != "" {
+		entries, err := readAuditEntries(cfg.Audit.File)
+		if err != nil {
+			return err
+		}
+		var own []AuditEntry
+		for _, entry := range entries {
+			if entry.User == username {
+				own = append(own, entry)
+			}
+		}
+		content, err := jsonLines(own)
+		if err != nil {
+			return err
+		}
+		if err := addTarFile(tw, "audit.jsonl", content); err != nil {
+			return err
+		}
+	}
+	if cfg.Accounting != nil && cfg.Accounting.File != "" {
+		records, err := ReadAccounting(cfg.Accounting.File, time.Time{}, time.Now().AddDate(1, 0, 0))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		var own []AccountingRecord
+		for _, record := range records {
+			if record.User == username {
+				own = append(own, record)
+			}
+		}
+		content, err := jsonLines(own)
+		if err != nil {
+			return err
+		}
+		if err := addTarFile(tw, "accounting.jsonl", content); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// replaceFile atomically replaces the content of a file, keeping its permissions.
+func replaceFile(file string, content []byte) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	temp := file + ".tmp"
+	if err := os.WriteFile(temp, content, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(temp, file)
+}
+
+// removeUserFromConfig removes the user from the users of a YAML config file, keeping its comments.
+func removeUserFromConfig(file, username string) (bool, error) {
+	if ext := strings.ToLower(filepath.Ext(file)); ext != ".yaml" && ext != ".yml" {
+		return false, errors.New("only YAML config files can be edited, remove the user from " + file + " manually")
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return false, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return false, nil
+	}
+	// Mappings hold their keys and values alternately, keys are case insensitive like for viper
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if !strings.EqualFold(root.Content[i].Value, "users") || root.Content[i+1].Kind != yaml.MappingNode {
+			continue
+		}
+		users := root.Content[i+1]
+		for j := 0; j+1 < len(users.Content); j += 2 {
+			if strings.EqualFold(users.Content[j].Value, username) {
+				users.Content = append(users.Content[:j], users.Content[j+2:]...)
+				var b bytes.Buffer
+				encoder := yaml.NewEncoder(&b)
+				encoder.SetIndent(2)
+				if err := encoder.Encode(&doc); err != nil {
+					return false, err
+				}
+				return true, replaceFile(file, b.Bytes())
+			}
+		}
+	}
+	return false, nil
+}
+
+// eraseTrashAndVersions removes the deleted files and the versions kept of the files below dir.
+func (cfg *Config) eraseTrashAndVersions(dir string) error {
+	rel, ok := cfg.relPath(dir)
+	if !ok {
+		return nil
+	}
+	if cfg.Trash != nil {
+		entries, err := os.ReadDir(cfg.Trash.Dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		for _, entry := range entries {
+			if err := os.RemoveAll(filepath.Join(cfg.Trash.Dir, entry.Name(), filepath.FromSlash(rel))); err != nil {
+				return err
+			}
+		}
+	}
+	if cfg.Versions != nil {
+		return os.RemoveAll(filepath.Join(cfg.Versions.Dir, filepath.FromSlash(rel)))
+	}
+	return nil
+}
+
+// EraseUser removes a user with everything stored about them: the account in the config file or the user
+// store, the files of their subdir including deleted ones, versions and thumbnails, and their accounting records.
+// Their entries of the audit log are kept for accountability without their paths and details, the username is
+// replaced by a random pseudonym there and in the entries of others.
+func EraseUser(cfg *Config, configFile, username string) (*ErasureReport, error) {
+	dir, err := userFiles(cfg, username)
+	if err != nil {
+		return nil, err
+	}
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	report := &ErasureReport{Pseudonym: "erased-" + hex.EncodeToString(random)}
+
+	if cfg.Users[username] != nil || cfg.userStore == nil {
+		if report.Account, err = removeUserFromConfig(configFile, username); err != nil {
+			return report, err
+		}
+	}
+	if cfg.userStore != nil {
+		deleted, err := cfg.userStore.delete(username)
+		if err != nil {
+			return report, err
+		}
+		report.Account = report.Account || deleted
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return report, err
+	}
+	report.Files = dir
+	if err := cfg.eraseTrashAndVersions(dir); err != nil {
+		return report, err
+	}
+	if cfg.thumbnailer != nil {
+		if err := cfg.thumbnailer.remove(dir); err != nil {
+			return report, err
+		}
+	}
+
+	if cfg.Audit != nil && cfg.Audit.File != "" {
+		entries, err := readAuditEntries(cfg.Audit.File)
+		if err != nil {
+			return report, err
+		}
+		// The paths and details of their own entries name their files, the ones of others may name the user
+		mention := regexp.MustCompile(`\b` + regexp.QuoteMeta(username) + `\b`)
+		for i := range entries {
+			entry := &entries[i]
+			if entry.User == username {
+				entry.User, entry.Path, entry.Detail = report.Pseudonym, "", ""
+				report.AuditEntries++
+				continue
+			}
+			path := mention.ReplaceAllLiteralString(entry.Path, report.Pseudonym)
+			detail := mention.ReplaceAllLiteralString(entry.Detail, report.Pseudonym)
+			if path != entry.Path || detail != entry.Detail {
+				entry.Path, entry.Detail = path, detail
+				report.AuditEntries++
+			}
+		}
+		if report.AuditEntries != 0 {
+			if err := rewriteAudit(cfg, entries); err != nil {
+				return report, err
+			}
+		}
+	}
+	if cfg.Accounting != nil && cfg.Accounting.File != "" {
+		records, err := ReadAccounting(cfg.Accounting.File, time.Time{}, time.Now().AddDate(1, 0, 0))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return report, err
+		}
+		kept := records[:0]
+		for _, record := range records {
+			if record.User == username {
+				report.AccountingRecords++
+			} else {
+				kept = append(kept, record)
+			}
+		}
+		if report.AccountingRecords != 0 {
+			content, err := jsonLines(kept)
+			if err != nil {
+				return report, err
+			}
+			if err := replaceFile(cfg.Accounting.File, content); err != nil {
+				return report, err
+			}
+		}
+	}
+	// The erasure is logged under the pseudonym, the name of the user isn't kept anywhere
+	securityEvent(cfg, log.InfoLevel, "Erased user", log.Fields{"user": report.Pseudonym})
+	return report, nil
+}
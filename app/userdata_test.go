@@ -0,0 +1,155 @@
+package app
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// userDataConfig sets up the files, audit log and accounting of the users alice and bob.
+func userDataConfig(t *testing.T) (*Config, string) {
+	dir := t.TempDir()
+	meta := t.TempDir()
+	for _, name := range []string{"alice/docs/a.txt", "bob/b.txt"} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0700)
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0600)
+	}
+	configFile := filepath.Join(meta, "config.yaml")
+	os.WriteFile(configFile, []byte(`dir: `+dir+`
+users:
+  # The first user
+  alice:
+    subdir: /alice
+    permissions: crud
+  bob:
+    subdir: /bob
+`), 0600)
+	auditFile := filepath.Join(meta, "audit.log")
+	os.WriteFile(auditFile, []byte(`{"time":"2024-01-01T00:00:00Z","user":"alice","action":"retention-override","path":"/alice/a.txt"}
+{"time":"2024-01-01T00:00:00Z","user":"bob","action":"retention-override","path":"/bob/b.txt"}
+{"time":"2024-01-01T00:00:00Z","user":"bob","action":"share-revoke","path":"/alice/docs","detail":"link of alice for r"}
+`), 0600)
+	accountingFile := filepath.Join(meta, "accounting.log")
+	os.WriteFile(accountingFile, []byte(`{"date":"2024-01-01","user":"alice","bytesUploaded":1}
+{"date":"2024-01-01","user":"bob","bytesUploaded":2}
+`), 0600)
+	alice, bob := "/alice", "/bob"
+	return &Config{
+		Dir:        dir,
+		Audit:      &Audit{File: auditFile},
+		Accounting: &Accounting{File: accountingFile},
+		Users: map[string]*UserInfo{
+			"alice": {Subdir: &alice, Permissions: "crud", Password: "secret"},
+			"bob":   {Subdir: &bob},
+		},
+	}, configFile
+}
+
+func TestExportUser(t *testing.T) {
+	cfg, _ := userDataConfig(t)
+	var b bytes.Buffer
+	if err := ExportUser(cfg, "alice", &b); err != nil {
+		t.Fatalf("ExportUser() error = %v", err)
+	}
+	gz, err := gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		content, _ := io.ReadAll(tr)
+		files[header.Name] = string(content)
+	}
+	if files["files/docs/a.txt"] != "alice/docs/a.txt" {
+		t.Errorf("export without the files of the user: %v", files)
+	}
+	if strings.Contains(files["account.json"], "secret") || !strings.Contains(files["account.json"], `"permissions": "crud"`) {
+		t.Errorf("account.json = %s, want the account without password", files["account.json"])
+	}
+	if !strings.Contains(files["audit.jsonl"], "/alice/a.txt") || strings.Contains(files["audit.jsonl"], "bob") {
+		t.Errorf("audit.jsonl = %s, want only the entries of the user", files["audit.jsonl"])
+	}
+	if !strings.Contains(files["accounting.jsonl"], `"bytesUploaded":1`) || strings.Contains(files["accounting.jsonl"], "bob") {
+		t.Errorf("accounting.jsonl = %s, want only the records of the user", files["accounting.jsonl"])
+	}
+}
+
+func TestEraseUser(t *testing.T) {
+	cfg, configFile := userDataConfig(t)
+	report, err := EraseUser(cfg, configFile, "alice")
+	if err != nil {
+		t.Fatalf("EraseUser() error = %v", err)
+	}
+	if !report.Account || report.AuditEntries != 2 || report.AccountingRecords != 1 {
+		t.Errorf("EraseUser() = %+v, want the account, two audit entries and an accounting record", report)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Dir, "alice")); !os.IsNotExist(err) {
+		t.Errorf("files of the user still exist")
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Dir, "bob", "b.txt")); err != nil {
+		t.Errorf("files of other users were removed: %v", err)
+	}
+	config, _ := os.ReadFile(configFile)
+	if strings.Contains(string(config), "alice") || !strings.Contains(string(config), "bob:") || !strings.Contains(string(config), "dir:") {
+		t.Errorf("config file = %s, want only alice removed", config)
+	}
+	audit, _ := os.ReadFile(cfg.Audit.File)
+	if strings.Contains(string(audit), "alice") || !strings.Contains(string(audit), "link of "+report.Pseudonym) || !strings.Contains(string(audit), `"bob"`) {
+		t.Errorf("audit file = %s, want alice replaced by %s", audit, report.Pseudonym)
+	}
+	accounting, _ := os.ReadFile(cfg.Accounting.File)
+	if strings.Contains(string(accounting), "alice") || !strings.Contains(string(accounting), "bob") {
+		t.Errorf("accounting file = %s, want the records of alice removed", accounting)
+	}
+}
+
+func TestEraseStoredUser(t *testing.T) {
+	cfg, configFile := userDataConfig(t)
+	store, err := openUserStore(&UserStore{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "users.db")})
+	if err != nil {
+		t.Fatalf("openUserStore() error = %v", err)
+	}
+	cfg.userStore = store
+	carol := "/carol"
+	os.MkdirAll(filepath.Join(cfg.Dir, "carol"), 0700)
+	store.put("carol", &UserInfo{Password: "secret", Subdir: &carol, Permissions: "crud"})
+
+	report, err := EraseUser(cfg, configFile, "carol")
+	if err != nil {
+		t.Fatalf("EraseUser() error = %v", err)
+	}
+	if !report.Account {
+		t.Errorf("EraseUser() = %+v, want the account", report)
+	}
+	if user, err := store.get("carol"); err != nil || user != nil {
+		t.Errorf("get() = %v, %v, want the user removed from the store", user, err)
+	}
+	if config, _ := os.ReadFile(configFile); !strings.Contains(string(config), "alice:") {
+		t.Errorf("config file = %s, want it unchanged", config)
+	}
+}
+
+func TestUserFilesShared(t *testing.T) {
+	shared, nested := "/shared", "/shared/nested"
+	cfg := &Config{Dir: t.TempDir(), Users: map[string]*UserInfo{
+		"root":   {},
+		"a":      {Subdir: &shared},
+		"b":      {Subdir: &nested},
+		"single": {Subdir: &shared},
+	}}
+	for _, username := range []string{"root", "a", "b", "unknown"} {
+		if _, err := userFiles(cfg, username); err == nil {
+			t.Errorf("userFiles(%s) error = nil, want error", username)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package app
+
+import "strings"
+
+// Usernames normalizes the usernames of Basic auth before they're looked up, for clients like Windows which
+// send them in mixed case or prefixed with the domain, DOMAIN\user.
+type Usernames struct {
+	Lowercase   bool
+	StripDomain bool `mapstructure:"strip_domain"`
+}
+
+// normalizeUsername returns the username as the users are looked up by.
+func (cfg *Config) normalizeUsername(username string) string {
+	if cfg.Usernames == nil {
+		return username
+	}
+	if cfg.Usernames.StripDomain {
+		if i := strings.LastIndex(username, `\`); i >= 0 {
+			username = username[i+1:]
+		}
+	}
+	if cfg.Usernames.Lowercase {
+		username = strings.ToLower(username)
+	}
+	return username
+}
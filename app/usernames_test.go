@@ -0,0 +1,49 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := []struct {
+		usernames *Usernames
+		username  string
+		want      string
+	}{
+		{nil, `CORP\Alice`, `CORP\Alice`},
+		{&Usernames{Lowercase: true}, `CORP\Alice`, `corp\alice`},
+		{&Usernames{StripDomain: true}, `CORP\Alice`, "Alice"},
+		{&Usernames{Lowercase: true, StripDomain: true}, `CORP\Alice`, "alice"},
+		{&Usernames{Lowercase: true, StripDomain: true}, "Bob", "bob"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Usernames: tt.usernames}
+		if got := cfg.normalizeUsername(tt.username); got != tt.want {
+			t.Errorf("normalizeUsername(%v, %q) = %q, want %q", tt.usernames, tt.username, got, tt.want)
+		}
+	}
+}
+
+func TestHandleNormalizedUsername(t *testing.T) {
+	cfg := &Config{
+		Dir:       t.TempDir(),
+		Usernames: &Usernames{Lowercase: true, StripDomain: true},
+		Users:     map[string]*UserInfo{"alice": {Password: GenHash([]byte("password")), Crud: newCrudType("crud")}},
+	}
+	a := &App{Config: cfg, Handler: &webdav.Handler{FileSystem: Dir{Config: cfg}, LockSystem: webdav.NewMemLS()}}
+	for _, username := range []string{"alice", "Alice", `CORP\ALICE`} {
+		r := httptest.NewRequest("PROPFIND", "/", nil)
+		r.Header.Set("Depth", "0")
+		r.SetBasicAuth(username, "password")
+		w := httptest.NewRecorder()
+		handle(context.Background(), w, r, a)
+		if w.Code != http.StatusMultiStatus {
+			t.Errorf("status of %s = %d, want %d", username, w.Code, http.StatusMultiStatus)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+)
+
+// UserStore configures a database holding users besides the ones of the config file.
+// The driver is "sqlite" (DSN is the path of the database file), "postgres" or "mysql" (DSN is a connection
+// string). Users are kept in memory for CacheTTL, 5 seconds by default, so changes made by other instances
+// apply within it. A negative CacheTTL reads every user from the database.
+type UserStore struct {
+	Driver   string
+	DSN      string
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+}
+
+// defaultUserStoreTTL is used when no cache TTL is configured, so the users aren't read from the database on
+// every request.
+const defaultUserStoreTTL = 5 * time.Second
+
+// userStoreMigrations create and evolve the schema of the user store, each is applied once in order.
+// The number of applied migrations is kept in david_schema.
+var userStoreMigrations = []string{
+	`CREATE TABLE david_users (
+		username TEXT PRIMARY KEY,
+		password TEXT NOT NULL,
+		subdir TEXT,
+		permissions TEXT NOT NULL DEFAULT '',
+		admin BOOLEAN NOT NULL DEFAULT FALSE,
+		max_upload_size BIGINT NOT NULL DEFAULT 0
+	)`,
+}
+
+// mysqlUserStoreMigrations are the migrations in the dialect of MySQL, which can't index TEXT columns.
+var mysqlUserStoreMigrations = []string{
+	`CREATE TABLE david_users (
+		username VARCHAR(255) PRIMARY KEY,
+		password TEXT NOT NULL,
+		subdir TEXT,
+		permissions VARCHAR(16) NOT NULL DEFAULT '',
+		admin BOOLEAN NOT NULL DEFAULT FALSE,
+		max_upload_size BIGINT NOT NULL DEFAULT 0
+	)`,
+}
+
+// cachedUser is a user read from the store, nil if there's no such user.
+type cachedUser struct {
+	user    *UserInfo
+	fetched time.Time
+}
+
+// userStore reads and writes users in a SQL database.
+type userStore struct {
+	db     *sql.DB
+	driver string
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedUser
+	swept time.Time
+}
+
+// openUserStore connects to the database and brings its schema up to date.
+func openUserStore(cfg *UserStore) (*userStore, error) {
+	if cfg.Driver != "sqlite" && cfg.Driver != "postgres" && cfg.Driver != "mysql" {
+		return nil, errors.New("unsupported user store driver " + cfg.Driver)
+	}
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Driver == "sqlite" {
+		// SQLite doesn't allow concurrent writers, a single connection serializes them
+		db.SetMaxOpenConns(1)
+	}
+	ttl := cfg.CacheTTL
+	if ttl == 0 {
+		ttl = defaultUserStoreTTL
+	}
+	s := &userStore{db: db, driver: cfg.Driver, ttl: ttl, cache: map[string]cachedUser{}}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// rebind replaces the ? placeholders of a query by the numbered ones of Postgres.
+func (s *userStore) rebind(query string) string {
+	if s.driver != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, ch := range query {
+		if ch == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(ch)
+		}
+	}
+	return b.String()
+}
+
+// migrate applies the migrations missing in the database.
+func (s *userStore) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS david_schema (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+	var version int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM david_schema`).Scan(&version); err != nil {
+		return err
+	}
+	migrations := userStoreMigrations
+	if s.driver == "mysql" {
+		migrations = mysqlUserStoreMigrations
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(s.rebind(`INSERT INTO david_schema (version) VALUES (?)`), version+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.WithField("version", version+1).Info("Migrated schema of user store")
+	}
+	return nil
+}
+
+// get returns the user with the given name, or nil if there's no such user. Users are read from the cache
+// while they're fresh, unknown ones as well, so guessing usernames doesn't hit the database.
+func (s *userStore) get(username string) (*UserInfo, error) {
+	if s.ttl < 0 {
+		return s.query(username)
+	}
+	now := time.Now()
+	s.mu.Lock()
+	cached, ok := s.cache[username]
+	s.mu.Unlock()
+	if ok && now.Sub(cached.fetched) < s.ttl {
+		cacheLookup("users", true)
+		return cached.user, nil
+	}
+	cacheLookup("users", false)
+	user, err := s.query(username)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Forget stale users now and then, so the cache doesn't grow with every username ever tried
+	if now.Sub(s.swept) > s.ttl {
+		for name, c := range s.cache {
+			if now.Sub(c.fetched) >= s.ttl {
+				delete(s.cache, name)
+			}
+		}
+		s.swept = now
+	}
+	s.cache[username] = cachedUser{user: user, fetched: now}
+	return user, nil
+}
+
+// forget removes a user from the cache after it was changed.
+func (s *userStore) forget(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cache, username)
+}
+
+// query reads the user with the given name from the database, nil if there's no such user.
+func (s *userStore) query(username string) (*UserInfo, error) {
+	var user UserInfo
+	var subdir sql.NullString
+	err := s.db.QueryRow(s.rebind(`SELECT password, subdir, permissions, admin, max_upload_size FROM david_users WHERE username = ?`), username).
+		Scan(&user.Password, &subdir, &user.Permissions, &user.Admin, &user.MaxUploadSize)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if subdir.Valid {
+		user.Subdir = &subdir.String
+	}
+	user.Crud = newCrudType(user.Permissions)
+	return &user, nil
+}
+
+// list returns the names of all users in alphabetical order.
+func (s *userStore) list() ([]string, error) {
+	rows, err := s.db.Query(`SELECT username FROM david_users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
+
+// put creates the user or replaces all of its fields.
+func (s *userStore) put(username string, user *UserInfo) error {
+	var subdir sql.NullString
+	if user.Subdir != nil {
+		subdir = sql.NullString{String: *user.Subdir, Valid: true}
+	}
+	query := `INSERT INTO david_users (username, password, subdir, permissions, admin, max_upload_size)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (username) DO UPDATE SET password = excluded.password, subdir = excluded.subdir,
+			permissions = excluded.permissions, admin = excluded.admin, max_upload_size = excluded.max_upload_size`
+	if s.driver == "mysql" {
+		query = `INSERT INTO david_users (username, password, subdir, permissions, admin, max_upload_size)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE password = VALUES(password), subdir = VALUES(subdir),
+			permissions = VALUES(permissions), admin = VALUES(admin), max_upload_size = VALUES(max_upload_size)`
+	}
+	defer s.forget(username)
+	_, err := s.db.Exec(s.rebind(query), username, user.Password, subdir, user.Permissions, user.Admin, user.MaxUploadSize)
+	return err
+}
+
+// delete removes the user and reports whether it existed.
+func (s *userStore) delete(username string) (bool, error) {
+	defer s.forget(username)
+	result, err := s.db.Exec(s.rebind(`DELETE FROM david_users WHERE username = ?`), username)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n != 0, err
+}
+
+// storedUser returns the user of the config file or else of the user store.
+// Errors of the user store are logged and treated like an unknown user.
+func (cfg *Config) storedUser(name string) *UserInfo {
+	if user := cfg.Users[name]; user != nil {
+		return user
+	}
+	if cfg.userStore == nil {
+		return nil
+	}
+	user, err := cfg.userStore.get(name)
+	if err != nil {
+		log.WithError(err).WithField("user", name).Error("Error reading user from user store")
+		return nil
+	}
+	return user
+}
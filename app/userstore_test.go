@@ -0,0 +1,131 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestUserStore(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "users.db")
+	store, err := openUserStore(&UserStore{Driver: "sqlite", DSN: dsn})
+	if err != nil {
+		t.Fatalf("openUserStore() error = %v", err)
+	}
+	a := &App{
+		Config: &Config{
+			Dir: t.TempDir(),
+			Users: map[string]*UserInfo{
+				"admin": {Password: GenHash([]byte(PepperPassword("password", "pepper"))), Permissions: "crud", Crud: newCrudType("crud"), Admin: true},
+			},
+			userStore: store,
+			pepper:    "pepper",
+		},
+		Handler: &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()},
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		method   string
+		path     string
+		body     string
+		want     int
+		wantBody string
+	}{
+		{"create user", "admin", "password", http.MethodPut, "/_admin/users/bob", `{"password": "secret", "permissions": "R", "subdir": "../bob"}`, http.StatusCreated, ""},
+		{"login of stored user", "bob", "secret", "PROPFIND", "/", "", http.StatusMultiStatus, ""},
+		{"stored user isn't admin", "bob", "secret", http.MethodGet, "/_admin/users", "", http.StatusForbidden, ""},
+		{"read user", "admin", "password", http.MethodGet, "/_admin/users/bob", "", http.StatusOK, `"subdir":"/bob","permissions":"r"`},
+		{"create without password", "admin", "password", http.MethodPut, "/_admin/users/carol", `{"permissions": "r"}`, http.StatusBadRequest, ""},
+		{"update keeps password", "admin", "password", http.MethodPut, "/_admin/users/bob", `{"permissions": "cr", "admin": true}`, http.StatusNoContent, ""},
+		{"login after update", "bob", "secret", http.MethodGet, "/_admin/users", "", http.StatusOK, `"username":"admin"`},
+		{"change password", "admin", "password", http.MethodPut, "/_admin/users/bob", `{"password": "new", "permissions": "r"}`, http.StatusNoContent, ""},
+		{"login with old password", "bob", "secret", "PROPFIND", "/", "", http.StatusUnauthorized, ""},
+		{"user of config file", "admin", "password", http.MethodDelete, "/_admin/users/admin", "", http.StatusConflict, ""},
+		{"delete user", "admin", "password", http.MethodDelete, "/_admin/users/bob", "", http.StatusNoContent, ""},
+		{"login of deleted user", "bob", "new", "PROPFIND", "/", "", http.StatusUnauthorized, ""},
+		{"delete unknown user", "admin", "password", http.MethodDelete, "/_admin/users/bob", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.SetBasicAuth(tt.user, tt.password)
+			w := httptest.NewRecorder()
+			handle(context.Background(), w, r, a)
+			if w.Code != tt.want {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body.String(), tt.want)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("%s %s body = %s, want %s", tt.method, tt.path, w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	// The schema is only created once
+	store.db.Close()
+	if _, err := openUserStore(&UserStore{Driver: "sqlite", DSN: dsn}); err != nil {
+		t.Errorf("openUserStore() of existing store error = %v", err)
+	}
+}
+
+func TestUserStoreCache(t *testing.T) {
+	store, err := openUserStore(&UserStore{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "users.db"), CacheTTL: time.Hour})
+	if err != nil {
+		t.Fatalf("openUserStore() error = %v", err)
+	}
+	if err := store.put("alice", &UserInfo{Password: "first", Permissions: "r"}); err != nil {
+		t.Fatalf("put() error = %v", err)
+	}
+	if user, _ := store.get("alice"); user == nil || user.Password != "first" {
+		t.Fatalf("get() = %v, want the stored user", user)
+	}
+	if user, _ := store.get("bob"); user != nil {
+		t.Fatalf("get() of unknown user = %v, want nil", user)
+	}
+
+	// Changes of other instances apply once the cached users expire
+	store.db.Exec(`UPDATE david_users SET password = 'second' WHERE username = 'alice'`)
+	store.db.Exec(`INSERT INTO david_users (username, password) VALUES ('bob', 'third')`)
+	if user, _ := store.get("alice"); user.Password != "first" {
+		t.Errorf("get() within ttl = %s, want the cached password", user.Password)
+	}
+	if user, _ := store.get("bob"); user != nil {
+		t.Errorf("get() of unknown user within ttl = %v, want nil", user)
+	}
+	store.ttl = time.Nanosecond
+	if user, _ := store.get("alice"); user.Password != "second" {
+		t.Errorf("get() after ttl = %s, want the changed password", user.Password)
+	}
+
+	// Changes of this instance apply right away
+	store.ttl = time.Hour
+	store.get("alice")
+	store.put("alice", &UserInfo{Password: "fourth", Permissions: "r"})
+	if user, _ := store.get("alice"); user.Password != "fourth" {
+		t.Errorf("get() after put() = %s, want the new password", user.Password)
+	}
+	store.delete("alice")
+	if user, _ := store.get("alice"); user != nil {
+		t.Errorf("get() after delete() = %v, want nil", user)
+	}
+
+	// Users are cached briefly unless the cache is disabled
+	for ttl, want := range map[time.Duration]time.Duration{0: defaultUserStoreTTL, time.Minute: time.Minute, -1: -1} {
+		store, err := openUserStore(&UserStore{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "users.db"), CacheTTL: ttl})
+		if err != nil {
+			t.Fatalf("openUserStore() error = %v", err)
+		}
+		if store.ttl != want {
+			t.Errorf("ttl of cache_ttl %v = %v, want %v", ttl, store.ttl, want)
+		}
+		store.db.Close()
+	}
+}
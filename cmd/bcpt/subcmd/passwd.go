@@ -10,9 +10,18 @@ import (
 	"golang.org/x/term"
 )
 
+// algorithm is the hash algorithm of passwd, bcrypt, argon2id or scrypt.
+var algorithm string
+
+// cost is the cost of bcrypt hashes, the default one if zero.
+var cost int
+
+// pepperFile is the file of the pepper of the server, else it's taken from $DAVID_PEPPER.
+var pepperFile string
+
 var passwdCmd = &cobra.Command{
 	Use:   "passwd",
-	Short: "Generates a BCrypt hash of a given input string",
+	Short: "Generates a BCrypt, Argon2id or scrypt hash of a given input string",
 	Run: func(cmd *cobra.Command, args []string) {
 		pw1 := readPassword()
 		pw2 := readPassword()
@@ -25,7 +34,18 @@ var passwdCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		fmt.Printf("Hashed Password: %s\n", app.GenHash(pw1))
+		pepper, err := app.LoadPepper(pepperFile)
+		if err != nil {
+			fmt.Printf("An error occurred loading the pepper: %s\n", err)
+			os.Exit(1)
+		}
+
+		hash, err := app.GenHashWithCost(algorithm, cost, []byte(app.PepperPassword(pw1Str, pepper)))
+		if err != nil {
+			fmt.Printf("An error occurred hashing the password: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Hashed Password: %s\n", hash)
 	},
 }
 
@@ -42,5 +62,8 @@ func readPassword() []byte {
 }
 
 func init() {
+	passwdCmd.Flags().StringVarP(&algorithm, "algorithm", "a", app.HashBcrypt, "Hash algorithm, bcrypt, argon2id or scrypt")
+	passwdCmd.Flags().IntVarP(&cost, "cost", "c", 0, "Cost of bcrypt hashes, 10 if not set")
+	passwdCmd.Flags().StringVarP(&pepperFile, "pepper-file", "p", "", "File of the pepper of the server, defaults to $DAVID_PEPPER")
 	RootCmd.AddCommand(passwdCmd)
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/audstanley/david/app"
+	log "github.com/sirupsen/logrus"
+)
+
+// runAudit runs the subcommands of the audit log, verify checks the chain of its entries. Rotated files can be
+// given in the order they were written, followed by the current one.
+func runAudit(args []string) {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, "usage: david audit verify [-config file] [audit files...]")
+		os.Exit(2)
+	}
+	var configPath string
+	flags := flag.NewFlagSet("audit verify", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", "", "Path to configuration file")
+	flags.Parse(args[1:])
+
+	log.SetLevel(log.WarnLevel)
+	config := app.ParseConfig(configPath)
+	if config.Audit == nil || config.Audit.File == "" {
+		log.Fatal("No audit file is configured")
+	}
+	result, err := app.VerifyAudit(config, flags.Args()...)
+	if err != nil {
+		log.WithError(err).Fatal("Error verifying audit log")
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+	if len(result.Problems) != 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/audstanley/david/app"
+	log "github.com/sirupsen/logrus"
+)
+
+// runDoctor checks the environment of the configuration and prints each result with a hint how to fix it.
+// It exits with status 1 if a check failed.
+func runDoctor(args []string) {
+	var configPath string
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", "", "Path to configuration file")
+	flags.Parse(args)
+
+	log.SetLevel(log.WarnLevel)
+	config := app.ParseConfig(configPath)
+	failed := false
+	for _, check := range app.Doctor(config) {
+		fmt.Printf("[%-4s] %s: %s\n", strings.ToUpper(check.Result), check.Name, check.Detail)
+		if check.Fix != "" {
+			fmt.Printf("       fix: %s\n", check.Fix)
+		}
+		failed = failed || check.Result == app.DoctorFail
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
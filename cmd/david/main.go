@@ -1,70 +1,98 @@
 package main
 
 import (
-	"errors"
 	"flag"
 	"fmt"
 	syslog "log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/audstanley/david/app"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/webdav"
 )
 
+// commands are the subcommands of david, called with the remaining arguments.
+var commands = map[string]func(args []string){
+	"report": runReport,
+	"export": runExport,
+	"erase":  runErase,
+	"purge":  runPurge,
+	"audit":  runAudit,
+	"doctor": runDoctor,
+	"test":   runTest,
+	"token":  runToken,
+}
+
 func main() {
+	// Run a subcommand if one is given
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
 	var configPath string
 
 	flag.StringVar(&configPath, "config", "", "Path to configuration file")
 	flag.Parse()
 
-	// Set formatter for logrus
-	ProductionFormatter := &log.JSONFormatter{}
-	NonProductionFormatter := &log.TextFormatter{}
-	log.SetFormatter(ProductionFormatter)
+	// Set formatter for logrus, until the configured one is known
+	log.SetFormatter(&log.JSONFormatter{})
 	log.SetLevel(log.DebugLevel)
 
 	config := app.ParseConfig(configPath)
-
-	// Set formatter for default log outputs
-	logger := log.New()
-	if config.Log.Production {
-		logger.Formatter = ProductionFormatter
-		log.WithField("prdouction", config.Log.Production).Debug("Production mode enabled")
-	} else {
-		logger.Formatter = NonProductionFormatter
-		log.WithField("prdouction", config.Log.Production).Debug("Production mode disabled")
-		log.SetFormatter(NonProductionFormatter)
+	if err := config.Start(); err != nil {
+		log.Fatal(err)
 	}
-	if config.Log.Debug {
-		log.WithField("debug", config.Log.Debug).Debug("Debug mode enabled")
-	} else {
-		log.WithField("debug", config.Log.Debug).Debug("Debug mode has now been disabled from config")
-		log.SetLevel(log.InfoLevel)
+
+	// Set the configured level and formatter, also for default log outputs
+	if err := config.ApplyLog(); err != nil {
+		log.Fatal(err)
 	}
+	log.WithFields(log.Fields{"level": log.GetLevel().String(), "production": config.Log.Production}).Debug("Log configured")
+	logger := log.New()
+	logger.Formatter = log.StandardLogger().Formatter
 	writer := logger.Writer()
 	defer writer.Close()
 	syslog.SetOutput(writer)
 
-	wdHandler := webdav.Handler{
-		Prefix: config.Prefix,
-		FileSystem: &app.Dir{
-			Config: config,
-		},
-		LockSystem: webdav.NewMemLS(),
-		Logger: func(request *http.Request, err error) {
-			if config.Log.Error && err != nil {
-				log.Error(err)
-			}
-		},
-	}
+	// Write the pending usage to the accounting file before shutting down
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		sig := <-signals
+		log.WithField("signal", sig.String()).Info("Server is shutting down")
+		config.FlushAccounting()
+		os.Exit(0)
+	}()
 
-	a := &app.App{
-		Config:  config,
-		Handler: &wdHandler,
+	// Serve each tenant and realm by its own handler, other requests by the main configuration
+	hosts := map[string]http.Handler{}
+	for host, tenantConfig := range config.TenantConfigs() {
+		hosts[host] = newHandler(tenantConfig)
 	}
+	// Use a mux of our own, the default one gets the debug endpoints of net/http/pprof and expvar registered
+	mux := http.NewServeMux()
+	mux.Handle("/", wrapRecovery(app.NewHostRouter(hosts, newHandler(config)), config))
 
-	http.Handle("/", wrapRecovery(app.NewBasicAuthWebdavHandler(a), config))
+	// Serve metrics on a separate listener, as they aren't protected by authentication
+	if config.Metrics != nil {
+		log.WithField("address", config.Metrics.Address).Info("Metrics listener is starting")
+		go func() {
+			log.Fatal(http.ListenAndServe(config.Metrics.Address, app.NewMetricsHandler()))
+		}()
+	}
+	// Serve the profiles and runtime variables on a separate listener (if configured), they reveal internals
+	if config.Debug != nil {
+		log.WithField("address", config.Debug.Address).Info("Debug listener is starting")
+		go func() {
+			log.Fatal(http.ListenAndServe(config.Debug.Address, app.NewDebugHandler()))
+		}()
+	}
 	connAddr := fmt.Sprintf("%s:%s", config.Address, config.Port)
 
 	if config.TLS != nil {
@@ -73,7 +101,25 @@ func main() {
 			"port":     config.Port,
 			"security": "TLS",
 		}).Info("Server is starting and listening")
-		log.Fatal(http.ListenAndServeTLS(connAddr, config.TLS.CertFile, config.TLS.KeyFile, nil))
+		// Serve plain HTTP besides TLS (if configured)
+		if config.HTTP != nil {
+			httpAddr := fmt.Sprintf("%s:%s", config.HTTP.Address, config.HTTP.Port)
+			log.WithFields(log.Fields{
+				"address":  config.HTTP.Address,
+				"port":     config.HTTP.Port,
+				"security": "none",
+			}).Info("HTTP listener is starting")
+			go func() {
+				log.Fatal(http.ListenAndServe(httpAddr, mux))
+			}()
+		}
+		// Load the certificates of the server and the tenants, and the client CA if configured
+		tlsConfig, err := config.ServerTLSConfig()
+		if err != nil {
+			log.Fatal(fmt.Errorf("error loading TLS configuration: %s", err))
+		}
+		server := &http.Server{Addr: connAddr, Handler: mux, TLSConfig: tlsConfig}
+		log.Fatal(server.ListenAndServeTLS("", ""))
 
 	} else {
 		log.WithFields(log.Fields{
@@ -81,27 +127,38 @@ func main() {
 			"port":     config.Port,
 			"security": "none",
 		}).Info("Server is starting and listening")
-		log.Fatal(http.ListenAndServe(connAddr, nil))
+		log.Fatal(http.ListenAndServe(connAddr, mux))
 	}
 }
 
-func wrapRecovery(handler http.Handler, config *app.Config) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if err := recover(); err != nil {
-				switch t := err.(type) {
-				case string:
-					log.Printf("panic type: %T, value: %v", err, err)
-					log.WithFields(log.Fields{"error": err, "writer": w}).Warn("An error occurred handling a webdav request")
-					log.WithError(errors.New(t)).Error("An error occurred handling a webdav request")
-				case error:
-					log.Printf("panic type: %T, value: %v", err, err)
-					log.WithFields(log.Fields{"error": err, "writer": w}).Warn("An error occurred handling a webdav request")
-					log.WithError(t).Error("An error occurred handling a webdav request")
-				}
+// newHandler returns the webdav handler serving the given configuration.
+func newHandler(config *app.Config) http.Handler {
+	wdHandler := webdav.Handler{
+		Prefix: config.Prefix,
+		FileSystem: &app.Dir{
+			Config: config,
+		},
+		LockSystem: app.NewCountingLockSystem(config.LockSystem()),
+		Logger: func(request *http.Request, err error) {
+			if err != nil {
+				app.RecordError(request, err)
 			}
-		}()
+			if config.Log.Error && err != nil {
+				log.Error(err)
+			}
+		},
+	}
+
+	return app.NewBasicAuthWebdavHandler(&app.App{
+		Config:  config,
+		Handler: &wdHandler,
+	})
+}
 
+// wrapRecovery sets the CORS headers and recovers from the panics of the handler.
+func wrapRecovery(handler http.Handler, config *app.Config) http.Handler {
+	handler = app.NewRecoveryHandler(handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if len(config.Cors.Origin) > 0 {
 			w.Header().Set("Access-Control-Allow-Origin", config.Cors.Origin)
 			w.Header().Set("Access-Control-Allow-Headers", "*")
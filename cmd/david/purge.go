@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/audstanley/david/app"
+	log "github.com/sirupsen/logrus"
+)
+
+// runPurge removes the expired trash entries and file versions at once and prints what was reclaimed.
+func runPurge(args []string) {
+	var configPath string
+	flags := flag.NewFlagSet("purge", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", "", "Path to configuration file")
+	flags.Parse(args)
+
+	log.SetLevel(log.WarnLevel)
+	config := app.ParseConfig(configPath)
+	if config.Trash == nil && config.Versions == nil {
+		log.Fatal("Neither trash nor versions are configured")
+	}
+	report, err := app.Purge(config, time.Now())
+	if report != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	}
+	if err != nil {
+		log.WithError(err).Fatal("Error purging trash and versions")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/audstanley/david/app"
+	log "github.com/sirupsen/logrus"
+)
+
+// runReport prints the per-user storage and transfer report of a period.
+func runReport(args []string) {
+	var configPath, from, to, format string
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", "", "Path to configuration file")
+	flags.StringVar(&from, "from", "", "First day of the report (YYYY-MM-DD), defaults to the first day of the current month")
+	flags.StringVar(&to, "to", "", "Last day of the report (YYYY-MM-DD), defaults to today")
+	flags.StringVar(&format, "format", "csv", "Output format: csv or json")
+	flags.Parse(args)
+
+	// Only warnings and errors, the report itself goes to stdout
+	log.SetLevel(log.WarnLevel)
+	config := app.ParseConfig(configPath)
+
+	now := time.Now().UTC()
+	fromDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var err error
+	if from != "" {
+		if fromDate, err = time.Parse("2006-01-02", from); err != nil {
+			log.WithError(err).Fatal("Invalid --from date")
+		}
+	}
+	if to != "" {
+		if toDate, err = time.Parse("2006-01-02", to); err != nil {
+			log.WithError(err).Fatal("Invalid --to date")
+		}
+	}
+
+	rows, err := app.GenerateReport(config, fromDate, toDate)
+	if err != nil {
+		log.WithError(err).Fatal("Error generating report")
+	}
+	if err := app.WriteReport(os.Stdout, rows, format); err != nil {
+		log.WithError(err).Fatal("Error writing report")
+	}
+}
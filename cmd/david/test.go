@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/audstanley/david/app"
+)
+
+// runTest exercises a remote WebDAV server with the compliance suite and prints the result of each step.
+// It exits with status 1 if a step failed.
+func runTest(args []string) {
+	var url, username, password string
+	var insecure bool
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	flags.StringVar(&url, "url", "", "URL of the WebDAV server, the suite works in a scratch collection below it")
+	flags.StringVar(&username, "user", "", "Username to authenticate with")
+	flags.StringVar(&password, "pass", os.Getenv("DAVID_PASS"), "Password to authenticate with, defaults to $DAVID_PASS")
+	flags.BoolVar(&insecure, "insecure", false, "Don't verify the certificate of the server")
+	flags.Parse(args)
+	if url == "" {
+		fmt.Fprintln(os.Stderr, "usage: david test -url url [-user name] [-pass password] [-insecure]")
+		os.Exit(2)
+	}
+
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure}},
+		// Redirects would hide the answers of the server under test
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	failed := 0
+	for _, result := range app.RunCompliance(client, url, username, password) {
+		if result.Error == "" {
+			fmt.Printf("[PASS] %s: %s %s\n", result.Step, result.Method, result.Path)
+			continue
+		}
+		failed++
+		fmt.Printf("[FAIL] %s: %s %s: %s\n", result.Step, result.Method, result.Path, result.Error)
+	}
+	if failed != 0 {
+		fmt.Printf("%d steps failed\n", failed)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/audstanley/david/app"
+	log "github.com/sirupsen/logrus"
+)
+
+// runToken prints a bearer token signed with the configured secret, e.g. for CI jobs.
+func runToken(args []string) {
+	var configPath, username, crud, scope string
+	var ttl time.Duration
+	flags := flag.NewFlagSet("token", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", "", "Path to configuration file")
+	flags.StringVar(&username, "user", "", "Username of the token")
+	flags.StringVar(&crud, "crud", "", "Permissions of the token, the ones of the user if empty")
+	flags.StringVar(&scope, "scope", "", "Path the token is limited to, below the URL prefix of the user")
+	flags.DurationVar(&ttl, "ttl", 24*time.Hour, "Lifetime of the token")
+	flags.Parse(args)
+	if username == "" {
+		fmt.Fprintln(os.Stderr, "usage: david token [-config file] -user name [-crud permissions] [-scope path] [-ttl duration]")
+		os.Exit(2)
+	}
+
+	log.SetLevel(log.WarnLevel)
+	config := app.ParseConfig(configPath)
+	token, err := app.IssueJWT(config, username, crud, scope, ttl)
+	if err != nil {
+		log.WithError(err).Fatal("Error issuing token")
+	}
+	fmt.Println(token)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/audstanley/david/app"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// runExport writes the tarball with everything stored about a user.
+func runExport(args []string) {
+	var configPath, username, output string
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", "", "Path to configuration file")
+	flags.StringVar(&username, "user", "", "User to export")
+	flags.StringVar(&output, "output", "", "File to write the tarball to, defaults to <user>.tar.gz, - for stdout")
+	flags.Parse(args)
+	if username == "" {
+		log.Fatal("Missing --user")
+	}
+
+	log.SetLevel(log.WarnLevel)
+	config := app.ParseConfig(configPath)
+
+	var w io.Writer = os.Stdout
+	if output != "-" {
+		if output == "" {
+			output = username + ".tar.gz"
+		}
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			log.WithError(err).Fatal("Error creating export file")
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := app.ExportUser(config, username, w); err != nil {
+		log.WithError(err).Fatal("Error exporting user")
+	}
+}
+
+// runErase removes a user with everything stored about them and prints what was removed.
+func runErase(args []string) {
+	var configPath, username string
+	var confirmed bool
+	flags := flag.NewFlagSet("erase", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", "", "Path to configuration file")
+	flags.StringVar(&username, "user", "", "User to erase")
+	flags.BoolVar(&confirmed, "yes", false, "Confirm the irreversible erasure")
+	flags.Parse(args)
+	if username == "" {
+		log.Fatal("Missing --user")
+	}
+	if !confirmed {
+		log.Fatal("Erasing a user can't be undone, confirm it with --yes")
+	}
+
+	log.SetLevel(log.WarnLevel)
+	config := app.ParseConfig(configPath)
+	report, err := app.EraseUser(config, viper.ConfigFileUsed(), username)
+	if report != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	}
+	if err != nil {
+		log.WithError(err).Fatal("Error erasing user")
+	}
+}
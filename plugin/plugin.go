@@ -0,0 +1,161 @@
+// Package plugin defines the protocol spoken between david and external plugin processes.
+//
+// A plugin is an executable started by david. It serves JSON-RPC 1.0 (net/rpc/jsonrpc) on its
+// standard input and output and may implement any of the following services:
+//
+//   - "Auth.Authenticate" to verify credentials of users unknown to the config file
+//   - "Events.Publish" to receive file operation events
+//   - "Storage.*" to replace the local file system as storage backend
+//
+// Plugins written in Go can use Serve, plugins written in other languages only need a JSON-RPC 1.0 implementation.
+package plugin
+
+import (
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"time"
+)
+
+// Errors are transported as strings, these messages are mapped back to the os errors by david.
+const (
+	ErrNotExist = "file does not exist"
+	ErrExist    = "file already exists"
+	ErrInvalid  = "invalid argument"
+)
+
+// AuthArgs holds the credentials of a login attempt.
+type AuthArgs struct {
+	Username string
+	Password string
+	Address  string
+}
+
+// AuthReply holds the outcome of a login attempt and the settings of the authenticated user.
+type AuthReply struct {
+	Authenticated bool
+	Permissions   string
+	Subdir        string
+}
+
+// Event describes a finished file operation.
+type Event struct {
+	Operation   string
+	User        string
+	Path        string
+	Destination string
+	Size        int64
+	Result      string
+}
+
+// Empty is used for calls without arguments or reply.
+type Empty struct{}
+
+// FileInfo is the serializable form of os.FileInfo.
+type FileInfo struct {
+	Name    string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	IsDir   bool
+}
+
+// PathArgs references a path of the storage backend.
+type PathArgs struct {
+	Name string
+}
+
+// MkdirArgs holds the arguments of Storage.Mkdir.
+type MkdirArgs struct {
+	Name string
+	Perm os.FileMode
+}
+
+// OpenArgs holds the arguments of Storage.Open.
+type OpenArgs struct {
+	Name string
+	Flag int
+	Perm os.FileMode
+}
+
+// RenameArgs holds the arguments of Storage.Rename.
+type RenameArgs struct {
+	OldName string
+	NewName string
+}
+
+// Handle references a file opened by Storage.Open.
+type Handle struct {
+	Handle uint64
+}
+
+// ReadArgs holds the arguments of Storage.Read.
+type ReadArgs struct {
+	Handle uint64
+	Size   int
+}
+
+// ReadReply holds the data of Storage.Read, EOF is set once the end of the file is reached.
+type ReadReply struct {
+	Data []byte
+	EOF  bool
+}
+
+// WriteArgs holds the arguments of Storage.Write.
+type WriteArgs struct {
+	Handle uint64
+	Data   []byte
+}
+
+// WriteReply holds the number of bytes written by Storage.Write.
+type WriteReply struct {
+	N int
+}
+
+// SeekArgs holds the arguments of Storage.Seek.
+type SeekArgs struct {
+	Handle uint64
+	Offset int64
+	Whence int
+}
+
+// SeekReply holds the new offset after Storage.Seek.
+type SeekReply struct {
+	Offset int64
+}
+
+// ReaddirArgs holds the arguments of Storage.Readdir.
+type ReaddirArgs struct {
+	Handle uint64
+	Count  int
+}
+
+// ReaddirReply holds the directory entries returned by Storage.Readdir.
+type ReaddirReply struct {
+	Infos []FileInfo
+}
+
+// stdio combines standard input and output of the plugin process.
+type stdio struct {
+	io.Reader
+	io.Writer
+}
+
+// Close closes standard output, which ends the connection to david.
+func (stdio) Close() error {
+	return os.Stdout.Close()
+}
+
+// Serve registers the given services (e.g. map[string]interface{}{"Auth": &MyAuth{}}) and serves
+// them on standard input and output until david closes the connection.
+func Serve(services map[string]interface{}) error {
+	server := rpc.NewServer()
+	for name, service := range services {
+		if err := server.RegisterName(name, service); err != nil {
+			return err
+		}
+	}
+	server.ServeCodec(jsonrpc.NewServerCodec(stdio{os.Stdin, os.Stdout}))
+	return nil
+}